@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -24,10 +25,12 @@ func Run(cfg *property.Config) {
 	}
 	defer cli.Close()
 
-	fmt.Println("输入你的问题；指令：/reset 清空历史，/sys <prompt> 设置system，/exit 退出")
+	fmt.Println("输入你的问题；指令：/reset 清空历史，/sys <prompt> 设置system，/note <path>[:line] 设置当前笔记，/plan <目标> 按多步计划执行，/review <目标> 先审阅计划再执行，/summarize <笔记或文件夹> [> 输出笔记] 分层总结，/history [runId] 查看改动，/undo <runId> 撤销，/exit 退出")
 
-	// 会话状态
+	// 会话状态；服务端按 session 保存历史，/reset 时换一个新的 session
+	session := "cli-" + utils.RandID()
 	var system string
+	var editor *proto.EditorContext
 	history := make([]proto.ChatMessage, 0, 32)
 
 	// Ctrl+C 优雅退出
@@ -53,6 +56,7 @@ func Run(cfg *property.Config) {
 		if strings.HasPrefix(line, "/reset") {
 			history = history[:0]
 			system = ""
+			session = "cli-" + utils.RandID()
 			fmt.Println(constant.COLOR_GRAY + "[reset] 已清空 system 与历史" + constant.COLOR_RESET)
 			continue
 		}
@@ -62,6 +66,49 @@ func Run(cfg *property.Config) {
 			continue
 		}
 
+		if strings.HasPrefix(line, "/note") {
+			editor = parseNote(strings.TrimSpace(strings.TrimPrefix(line, "/note")))
+			if editor == nil {
+				fmt.Println(constant.COLOR_GRAY + "[note] 已清除当前笔记" + constant.COLOR_RESET)
+			} else {
+				fmt.Println(constant.COLOR_GRAY + "[note] " + editor.ActiveNote + constant.COLOR_RESET)
+			}
+			continue
+		}
+
+		if line == "/history" || strings.HasPrefix(line, "/history ") {
+			showHistory(cli, strings.TrimSpace(strings.TrimPrefix(line, "/history")))
+			continue
+		}
+		if strings.HasPrefix(line, "/undo") {
+			undoRun(cli, strings.TrimSpace(strings.TrimPrefix(line, "/undo")))
+			continue
+		}
+
+		// /plan <目标>：本轮使用 plan 意图，先生成计划再逐步执行；/review <目标>：计划经审阅后才执行
+		intent, mode := cfg.Intent, ""
+		if strings.HasPrefix(line, "/plan ") {
+			intent = "plan"
+			line = strings.TrimSpace(strings.TrimPrefix(line, "/plan "))
+		}
+		if strings.HasPrefix(line, "/review ") {
+			intent, mode = "plan", proto.ModeReview
+			line = strings.TrimSpace(strings.TrimPrefix(line, "/review "))
+		}
+		// /summarize <笔记或文件夹> [> 输出笔记]：本轮使用 summarize 意图，省略路径时总结当前笔记
+		var path, output string
+		if line == "/summarize" || strings.HasPrefix(line, "/summarize ") {
+			intent = "summarize"
+			path = strings.TrimSpace(strings.TrimPrefix(line, "/summarize"))
+			if i := strings.Index(path, ">"); i >= 0 {
+				path, output = strings.TrimSpace(path[:i]), strings.TrimSpace(path[i+1:])
+			}
+			line = "总结 " + path
+			if path == "" {
+				line = "总结当前笔记"
+			}
+		}
+
 		// 组装多轮 messages
 		msgs := make([]proto.ChatMessage, 0, len(history)+2)
 		if strings.TrimSpace(system) != "" {
@@ -74,11 +121,19 @@ func Run(cfg *property.Config) {
 		req := proto.MsgRequest{
 			Type:       "agent/run",
 			ID:         reqID,
-			Intent:     cfg.Intent,
+			Intent:     intent,
+			Mode:       mode,
+			Path:       path,
+			Output:     output,
+			SessionID:  session,
 			Question:   line,     // 兼容服务端旧版
 			Messages:   msgs,     // 新：把历史发给服务端（若支持）
 			Reserve:    cfg.Reserve,
-			AllowTools: cfg.AllowTools,
+			AllowTools: cfg.AllowTools || intent == "plan",
+			Context:    editor,
+		}
+		if editor != nil {
+			editor.Timestamp = time.Now().UnixMilli()
 		}
 
 		// 发送本轮
@@ -93,6 +148,7 @@ func Run(cfg *property.Config) {
 		assistantBuf := &strings.Builder{}
 		previewShown := false
 		turnDone := make(chan struct{})
+		var reviewing *proto.MsgResponse // 已答复但服务端可能拒绝（如删掉了被依赖的步骤）的审阅
 
 		go func() {
 			defer close(turnDone)
@@ -129,11 +185,59 @@ func Run(cfg *property.Config) {
 				case "tools/call.result":
 					js, _ := utils.JsonIndent(m.Result)
 					fmt.Printf("\n%s[tool.result]%s\n%s\n", constant.COLOR_GRAY, constant.COLOR_RESET, js)
+				case "agent/edit.done":
+					if diff, _ := m.Result["diff"].(string); diff != "" {
+						fmt.Printf("\n%s[edit]%s\n%s", constant.COLOR_GRAY, constant.COLOR_RESET, diff)
+					}
+				case "agent/plan":
+					printPlan("plan", m.Result)
+					if m.ConfirmToken != "" {
+						reviewing = &m
+						reviewPlan(cli, in, reqID, m)
+					}
+				case "agent/plan.replan":
+					fmt.Printf("\n%s[replan]%s %s\n", constant.COLOR_GRAY, constant.COLOR_RESET, m.Text)
+					printPlan("plan", m.Result)
+					if m.ConfirmToken != "" {
+						reviewing = &m
+						reviewPlan(cli, in, reqID, m)
+					}
+				case "agent/summarize.progress":
+					printProgress(m.Result)
+				case "agent/plan.step":
+					reviewing = nil
+					printStep(m.Result)
+				case "agent/confirm.request":
+					// 读取用户答复：此时主循环阻塞在 turnDone 上，可以安全地复用 stdin
+					fmt.Printf("\n%s[confirm]%s %s\n", constant.COLOR_CYAN, constant.COLOR_RESET, m.Text)
+					fmt.Print("允许执行吗？[y/N] ")
+					decision := proto.DecisionReject
+					if in.Scan() && strings.EqualFold(strings.TrimSpace(in.Text()), "y") {
+						decision = proto.DecisionApprove
+					}
+					_ = cli.SendJSON(proto.MsgRequest{Type: "agent/confirm", ID: reqID, ConfirmToken: m.ConfirmToken, Decision: decision})
 				case "agent/error":
 					fmt.Printf("\n%s[error]%s %s (%s)\n", constant.COLOR_RED, constant.COLOR_RESET, m.ErrorMsg, m.ErrorCode)
+					if reviewing != nil && m.ErrorCode == "INVALID_REQUEST" {
+						// 审阅的修改不合法，计划仍在等待答复
+						reviewPlan(cli, in, reqID, *reviewing)
+						continue
+					}
 					return
 				case "agent/done":
 					fmt.Println()
+					if plan, _ := m.Result["plan"].(map[string]any); plan["rejected"] == true {
+						fmt.Println(constant.COLOR_GRAY + "[plan] 已拒绝，未执行任何步骤" + constant.COLOR_RESET)
+					}
+					printEditor(m.Result)
+					printSources(m.Result)
+					printSummary(m.Result)
+					if s, _ := m.Result["session"].(map[string]any); s["summarized"] == true {
+						fmt.Println(constant.COLOR_GRAY + "[session] 较早的对话已折叠为摘要" + constant.COLOR_RESET)
+					}
+					if n, _ := m.Result["toolCalls"].(float64); n > 0 {
+						fmt.Printf("%s[run] %s（如有改动可用 /undo %s 撤销）%s\n", constant.COLOR_GRAY, reqID, reqID, constant.COLOR_RESET)
+					}
 					return
 				}
 			}
@@ -151,3 +255,201 @@ func Run(cfg *property.Config) {
 
 	fmt.Println("done.")
 }
+
+// printPlan 打印计划的步骤（agent/plan 与 agent/plan.replan 的 plan 字段）
+func printPlan(label string, result map[string]any) {
+	plan, _ := result["plan"].(map[string]any)
+	steps, _ := plan["steps"].([]any)
+	fmt.Printf("\n%s[%s]%s %d 步\n", constant.COLOR_CYAN, label, constant.COLOR_RESET, len(steps))
+	for _, item := range steps {
+		st, _ := item.(map[string]any)
+		tool, _ := st["tool"].(string)
+		if tool == "" {
+			tool = "模型"
+		}
+		deps := ""
+		if d, _ := st["dependsOn"].([]any); len(d) > 0 {
+			deps = fmt.Sprintf(" ← %v", d)
+		}
+		fmt.Printf("  %v. %v %s(%s)%s%s\n", st["id"], st["title"], constant.COLOR_GRAY, tool, deps, constant.COLOR_RESET)
+	}
+}
+
+// reviewPlan 读取用户对计划的审阅（agent/plan.review）：回车或 y 全部执行，n 拒绝，
+// 也可以输入要执行的步骤 ID（空格分隔，按执行顺序）以删减或调整步骤
+func reviewPlan(cli *WSClient, in *bufio.Scanner, reqID string, m proto.MsgResponse) {
+	if c, _ := m.Result["confirmations"].(map[string]any); len(c) > 0 {
+		for id, desc := range c {
+			fmt.Printf("  %s%v 需要确认：%v%s\n", constant.COLOR_RED, id, desc, constant.COLOR_RESET)
+		}
+	}
+	fmt.Print("执行计划吗？[Y/n/步骤ID...] ")
+	review := proto.MsgRequest{Type: "agent/plan.review", ID: reqID, ConfirmToken: m.ConfirmToken, Decision: proto.DecisionApprove}
+	answer := ""
+	if in.Scan() {
+		answer = strings.TrimSpace(in.Text())
+	} else {
+		answer = "n"
+	}
+	switch {
+	case answer == "" || strings.EqualFold(answer, "y"):
+	case strings.EqualFold(answer, "n"):
+		review.Decision = proto.DecisionReject
+	default:
+		review.Steps = strings.Fields(strings.ReplaceAll(answer, ",", " "))
+	}
+	_ = cli.SendJSON(review)
+}
+
+// printStep 打印计划步骤的进度（agent/plan.step），只打印结束的步骤
+func printStep(result map[string]any) {
+	st, _ := result["step"].(map[string]any)
+	status, _ := st["status"].(string)
+	color := constant.COLOR_GRAY
+	switch status {
+	case "running":
+		return
+	case "failed", "rejected":
+		color = constant.COLOR_RED
+	}
+	fmt.Printf("%s[step %v]%s %v: %s", color, st["stepId"], constant.COLOR_RESET, st["title"], status)
+	if e, _ := st["error"].(string); e != "" {
+		fmt.Print(" — " + e)
+	}
+	fmt.Println()
+}
+
+// printProgress 打印分层总结的进度（agent/summarize.progress 的 progress 字段）
+func printProgress(result map[string]any) {
+	p, _ := result["progress"].(map[string]any)
+	if p == nil {
+		return
+	}
+	stage, _ := p["stage"].(string)
+	if level, _ := p["level"].(float64); level > 0 {
+		stage = fmt.Sprintf("%s#%d", stage, int(level))
+	}
+	done, _ := p["done"].(float64)
+	total, _ := p["total"].(float64)
+	label, _ := p["label"].(string)
+	fmt.Printf("%s[summarize] %s %d/%d %s%s\n", constant.COLOR_GRAY, stage, int(done), int(total), label, constant.COLOR_RESET)
+}
+
+// printSummary 打印总结的规模和写入结果（agent/done 的 summary、output 字段）
+func printSummary(result map[string]any) {
+	if s, _ := result["summary"].(map[string]any); s != nil {
+		notes, _ := s["notes"].(float64)
+		chunks, _ := s["chunks"].(float64)
+		levels, _ := s["levels"].(float64)
+		fmt.Printf("%s[summary] %v：%d 篇笔记，%d 个分块，%d 层合并%s\n", constant.COLOR_GRAY, s["target"], int(notes), int(chunks), int(levels), constant.COLOR_RESET)
+	}
+	out, _ := result["output"].(map[string]any)
+	switch {
+	case out == nil:
+	case out["error"] != nil:
+		fmt.Printf("%s[output] 写入 %v 失败：%v%s\n", constant.COLOR_RED, out["path"], out["error"], constant.COLOR_RESET)
+	case out["rejected"] == true:
+		fmt.Printf("%s[output] 未写入 %v%s\n", constant.COLOR_GRAY, out["path"], constant.COLOR_RESET)
+	default:
+		fmt.Printf("%s[output] 已写入 %v%s\n", constant.COLOR_GRAY, out["path"], constant.COLOR_RESET)
+	}
+}
+
+// printSources 打印回答引用的笔记片段（agent/done 的 sources 字段）
+func printSources(result map[string]any) {
+	sources, _ := result["sources"].([]any)
+	for _, item := range sources {
+		src, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		loc, _ := src["path"].(string)
+		if h, _ := src["heading"].(string); h != "" {
+			loc += " > " + h
+		}
+		fmt.Printf("%s[%v]%s %s (L%v-L%v)\n", constant.COLOR_GRAY, src["id"], constant.COLOR_RESET, loc, src["startLine"], src["endLine"])
+	}
+}
+
+// parseNote 解析 /note 的参数 "path[:line]"，行号从 1 开始；参数为空时清除当前笔记
+func parseNote(arg string) *proto.EditorContext {
+	if arg == "" {
+		return nil
+	}
+	ec := &proto.EditorContext{ActiveNote: arg}
+	if i := strings.LastIndex(arg, ":"); i > 0 {
+		if n, err := strconv.Atoi(arg[i+1:]); err == nil && n > 0 {
+			ec.ActiveNote = arg[:i]
+			ec.Cursor = &proto.Position{Line: n - 1}
+		}
+	}
+	return ec
+}
+
+// printEditor 打印服务端实际使用的编辑器上下文（agent/done 的 editor 字段）
+func printEditor(result map[string]any) {
+	ed, ok := result["editor"].(map[string]any)
+	if !ok {
+		return
+	}
+	loc, _ := ed["activeNote"].(string)
+	if h, _ := ed["heading"].(string); h != "" {
+		loc += " > " + h
+	}
+	if ed["startLine"] != nil {
+		loc += fmt.Sprintf(" (L%v-L%v)", ed["startLine"], ed["endLine"])
+	}
+	fmt.Printf("%s[editor]%s %s\n", constant.COLOR_GRAY, constant.COLOR_RESET, loc)
+}
+
+// showHistory 列出最近改动过笔记的运行；指定 runId 时打印该运行的 diff
+func showHistory(cli *WSClient, runID string) {
+	m, err := cli.Request(proto.MsgRequest{Type: "agent/history", ID: "history-" + utils.RandID(), RunID: runID})
+	if err != nil {
+		fmt.Println(constant.COLOR_RED, "[history error]", err, constant.COLOR_RESET)
+		return
+	}
+	if m.Type == "agent/error" {
+		fmt.Printf("%s[error]%s %s (%s)\n", constant.COLOR_RED, constant.COLOR_RESET, m.ErrorMsg, m.ErrorCode)
+		return
+	}
+	runs, _ := m.Result["runs"].([]any)
+	if len(runs) == 0 {
+		fmt.Println(constant.COLOR_GRAY + "[history] 暂无改动记录" + constant.COLOR_RESET)
+		return
+	}
+	for _, item := range runs {
+		run, _ := item.(map[string]any)
+		status := ""
+		if run["undoneAt"] != nil {
+			status = "（已撤销）"
+		}
+		fmt.Printf("%s%v%s %v%s\n", constant.COLOR_CYAN, run["runId"], constant.COLOR_RESET, run["time"], status)
+		changes, _ := run["changes"].([]any)
+		for _, c := range changes {
+			ch, _ := c.(map[string]any)
+			fmt.Printf("  %v %v\n", ch["tool"], ch["path"])
+			if diff, _ := ch["diff"].(string); diff != "" {
+				fmt.Print(diff)
+			}
+		}
+	}
+}
+
+// undoRun 撤销一次运行对笔记的改动
+func undoRun(cli *WSClient, runID string) {
+	if runID == "" {
+		fmt.Println(constant.COLOR_GRAY + "[undo] 用法：/undo <runId>，runId 可通过 /history 查看" + constant.COLOR_RESET)
+		return
+	}
+	m, err := cli.Request(proto.MsgRequest{Type: "agent/undo", ID: "undo-" + utils.RandID(), RunID: runID})
+	if err != nil {
+		fmt.Println(constant.COLOR_RED, "[undo error]", err, constant.COLOR_RESET)
+		return
+	}
+	if m.Type == "agent/error" {
+		fmt.Printf("%s[error]%s %s (%s)\n", constant.COLOR_RED, constant.COLOR_RESET, m.ErrorMsg, m.ErrorCode)
+		return
+	}
+	fmt.Printf("%s[undo]%s 已撤销 %s：%v\n", constant.COLOR_CYAN, constant.COLOR_RESET, runID, m.Result["paths"])
+}
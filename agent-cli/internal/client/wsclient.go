@@ -48,3 +48,19 @@ func (w *WSClient) ReadOne(msg *proto.MsgResponse) error {
 	}
 	return json.Unmarshal(data, msg)
 }
+
+// Request 发送一条请求并等待同 ID 的响应，期间收到的其它消息（如 index/update 推送）被忽略
+func (w *WSClient) Request(req proto.MsgRequest) (proto.MsgResponse, error) {
+	if err := w.SendJSON(req); err != nil {
+		return proto.MsgResponse{}, err
+	}
+	for {
+		var m proto.MsgResponse
+		if err := w.ReadOne(&m); err != nil {
+			return proto.MsgResponse{}, err
+		}
+		if m.ID == req.ID {
+			return m, nil
+		}
+	}
+}
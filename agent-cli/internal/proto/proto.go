@@ -8,20 +8,62 @@ type ChatMessage struct {
 
 // MsgRequest 前端 -> 后端
 type MsgRequest struct {
-	Type string `json:"type"` // 消息类型: agent/run, agent/cancel, agent/confirm
+	Type string `json:"type"` // 消息类型: agent/run, agent/cancel, agent/confirm, agent/plan.review, agent/undo, agent/history
 
 	ID string `json:"id,omitempty"` // 前端生成的唯一请求 ID，后端会回传
 	Question string `json:"question,omitempty"` // 用户输入（兼容旧字段，不推荐）
-	Intent   string `json:"intent,omitempty"`   // 用户意图: qa|write|scaffold|brainstorm 等
+	Intent   string `json:"intent,omitempty"`   // 用户意图: qa|write|scaffold|brainstorm|plan|summarize 等
+	Mode     string `json:"mode,omitempty"`     // 运行模式: review 时计划先经用户审阅再执行
+
+	Path      string `json:"path,omitempty"`      // summarize 意图要总结的笔记或文件夹，省略时使用当前笔记
+	Output    string `json:"output,omitempty"`    // summarize 意图：把总结写入这篇新笔记
+	SessionID string `json:"sessionId,omitempty"` // 会话 ID：服务端保存该会话的历史，较早的轮次折叠为摘要
 
 	Reserve    int            `json:"reserve,omitempty"`    // 提示后端预留多少 token 空间
 	AllowTools bool           `json:"allowTools,omitempty"` // 是否允许调用工具
-	Context    map[string]any `json:"context,omitempty"`    // 上下文: 笔记名、光标位置、时间戳等
+	Context    *EditorContext `json:"context,omitempty"`    // 编辑器上下文: 当前笔记、光标、选区、时间戳等
 	Messages   []ChatMessage  `json:"messages,omitempty"`   // 对话历史 (system+user+assistant)
 
-	ConfirmToken string `json:"confirmToken,omitempty"` // 鉴权/确认用 token
+	ConfirmToken string   `json:"confirmToken,omitempty"` // 鉴权/确认用 token
+	Decision     string   `json:"decision,omitempty"`     // agent/confirm、agent/plan.review 的答复: approve|reject
+	Steps        []string `json:"steps,omitempty"`        // agent/plan.review 批准执行的步骤 ID（按执行顺序）
+
+	RunID string `json:"runId,omitempty"` // agent/undo 要撤销的运行；agent/history 只查看该运行
+	Limit int    `json:"limit,omitempty"` // agent/history 返回的运行数
+}
+
+// Position 是编辑器中的位置，行号和列号都从 0 开始
+type Position struct {
+	Line int `json:"line"`
+	Ch   int `json:"ch"`
+}
+
+// Selection 是编辑器中的选区
+type Selection struct {
+	From Position `json:"from"`
+	To   Position `json:"to"`
+	Text string   `json:"text,omitempty"`
+}
+
+// EditorContext 描述发起请求时编辑器的状态
+type EditorContext struct {
+	Vault      string     `json:"vault,omitempty"`      // 仓库名
+	ActiveNote string     `json:"activeNote,omitempty"` // 当前笔记，相对仓库根目录的路径
+	Cursor     *Position  `json:"cursor,omitempty"`     // 光标位置
+	Selection  *Selection `json:"selection,omitempty"`  // 选区
+	OpenTabs   []string   `json:"openTabs,omitempty"`   // 其他已打开笔记的路径
+	Timestamp  int64      `json:"timestamp,omitempty"`  // 采集时间，Unix 毫秒
 }
 
+// ModeReview 表示计划需经用户审阅后才执行
+const ModeReview = "review"
+
+// agent/confirm、agent/plan.review 的答复取值
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+)
+
 // MsgResponse 后端 -> 前端
 type MsgResponse struct {
 	Type string `json:"type"` // 消息类型: agent/preview.delta, agent/full.delta, agent/done, agent/error...
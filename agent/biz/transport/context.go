@@ -0,0 +1,102 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSelectionChars 限制随请求上传的选中文本长度
+const maxSelectionChars = 100_000
+
+// Position 是编辑器中的位置，与 Obsidian 的 EditorPosition 一致：行号和列号都从 0 开始
+type Position struct {
+	Line int `json:"line"`
+	Ch   int `json:"ch"`
+}
+
+// Before 判断 p 是否位于 q 之前
+func (p Position) Before(q Position) bool {
+	return p.Line < q.Line || (p.Line == q.Line && p.Ch < q.Ch)
+}
+
+// Selection 是编辑器中的选区
+type Selection struct {
+	From Position `json:"from"`
+	To   Position `json:"to"`
+	Text string   `json:"text,omitempty"` // 选中的文本；为空时由服务端按范围从磁盘读取
+}
+
+// EditorContext 描述发起请求时编辑器的状态
+type EditorContext struct {
+	Vault      string     `json:"vault,omitempty"`      // 仓库名
+	ActiveNote string     `json:"activeNote,omitempty"` // 当前笔记，相对仓库根目录的路径
+	Cursor     *Position  `json:"cursor,omitempty"`     // 光标位置
+	Selection  *Selection `json:"selection,omitempty"`  // 选区，没有选中内容时为空
+	OpenTabs   []string   `json:"openTabs,omitempty"`   // 其他已打开笔记的路径
+	Timestamp  int64      `json:"timestamp,omitempty"`  // 采集时间，Unix 毫秒
+}
+
+// Time 返回采集时间，未提供时返回零值
+func (c *EditorContext) Time() time.Time {
+	if c == nil || c.Timestamp <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(c.Timestamp)
+}
+
+// Validate 校验编辑器上下文，nil 表示请求未携带上下文，视为合法
+func (c *EditorContext) Validate() error {
+	if c == nil {
+		return nil
+	}
+	var errs []error
+	if c.ActiveNote != "" {
+		if err := validNotePath(c.ActiveNote); err != nil {
+			errs = append(errs, fmt.Errorf("activeNote: %w", err))
+		}
+	} else if c.Cursor != nil || c.Selection != nil {
+		errs = append(errs, errors.New("activeNote: required when cursor or selection is set"))
+	}
+	if c.Cursor != nil && (c.Cursor.Line < 0 || c.Cursor.Ch < 0) {
+		errs = append(errs, errors.New("cursor: line and ch must be >= 0"))
+	}
+	if s := c.Selection; s != nil {
+		switch {
+		case s.From.Line < 0 || s.From.Ch < 0 || s.To.Line < 0 || s.To.Ch < 0:
+			errs = append(errs, errors.New("selection: line and ch must be >= 0"))
+		case s.To.Before(s.From):
+			errs = append(errs, errors.New("selection: from must not be after to"))
+		}
+		if utf8.RuneCountInString(s.Text) > maxSelectionChars {
+			errs = append(errs, fmt.Errorf("selection: text exceeds %d characters", maxSelectionChars))
+		}
+	}
+	for i, tab := range c.OpenTabs {
+		if err := validNotePath(tab); err != nil {
+			errs = append(errs, fmt.Errorf("openTabs[%d]: %w", i, err))
+		}
+	}
+	if c.Timestamp < 0 {
+		errs = append(errs, errors.New("timestamp: must be a Unix time in milliseconds"))
+	}
+	return errors.Join(errs...)
+}
+
+// validNotePath 校验仓库内的相对路径：不能是绝对路径，也不能用 .. 跳出仓库
+func validNotePath(p string) error {
+	p = strings.ReplaceAll(strings.TrimSpace(p), "\\", "/")
+	switch {
+	case p == "":
+		return errors.New("empty path")
+	case strings.HasPrefix(p, "/") || (len(p) > 1 && p[1] == ':'):
+		return fmt.Errorf("%q must be relative to the vault root", p)
+	}
+	if clean := path.Clean(p); clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("%q escapes the vault root", p)
+	}
+	return nil
+}
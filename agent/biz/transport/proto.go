@@ -8,23 +8,42 @@ type ChatMessage struct {
 
 // MsgRequest 前端 -> 后端
 type MsgRequest struct {
-	Type string `json:"type"` // 消息类型: agent/run, agent/cancel, agent/confirm
+	Type string `json:"type"` // 消息类型: agent/run, agent/cancel, agent/confirm, agent/plan.review, agent/undo, agent/history
 
 	ID string `json:"id,omitempty"` // 前端生成的唯一请求 ID，后端会回传
 	Question string `json:"question,omitempty"` // 用户输入（兼容旧字段，不推荐）
-	Intent   string `json:"intent,omitempty"`   // 用户意图: qa|write|scaffold|brainstorm 等
+	Intent   string `json:"intent,omitempty"`   // 用户意图: qa|write|scaffold|brainstorm|plan|summarize 等
+	Mode     string `json:"mode,omitempty"`     // 运行模式: 空为直接执行；review 时 plan 意图的计划先经用户审阅再执行
+
+	Path      string `json:"path,omitempty"`      // summarize 意图要总结的笔记或文件夹，省略时使用编辑器中的当前笔记
+	Output    string `json:"output,omitempty"`    // summarize 意图：把总结写入这篇新笔记（需用户确认）
+	SessionID string `json:"sessionId,omitempty"` // 会话 ID：服务端保存该会话的历史（较早轮次折叠为摘要），此时 Messages 中只取 system 消息和本轮输入
 
 	Reserve    int            `json:"reserve,omitempty"`    // 提示后端预留多少 token 空间
 	AllowTools bool           `json:"allowTools,omitempty"` // 是否允许调用工具
-	Context    map[string]any `json:"context,omitempty"`    // 上下文: 笔记名、光标位置、时间戳等
+	Context    *EditorContext `json:"context,omitempty"`    // 编辑器上下文: 当前笔记、光标、选区、时间戳等
 	Messages   []ChatMessage  `json:"messages,omitempty"`   // 对话历史 (system+user+assistant)
 
-	ConfirmToken string `json:"confirmToken,omitempty"` // 鉴权/确认用 token
+	ConfirmToken string   `json:"confirmToken,omitempty"` // 鉴权/确认用 token
+	Decision     string   `json:"decision,omitempty"`     // agent/confirm、agent/plan.review 的答复: approve|reject
+	Steps        []string `json:"steps,omitempty"`        // agent/plan.review 批准执行的步骤 ID（按执行顺序），省略时批准整份计划
+
+	RunID string `json:"runId,omitempty"` // agent/undo 要撤销的运行；agent/history 只查看该运行（含 diff）
+	Limit int    `json:"limit,omitempty"` // agent/history 返回的运行数，默认 20
 }
 
+// ModeReview 表示计划需经用户通过 agent/plan.review 批准后才执行
+const ModeReview = "review"
+
+// agent/confirm、agent/plan.review 的答复取值
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+)
+
 // MsgResponse 后端 -> 前端
 type MsgResponse struct {
-	Type string `json:"type"` // 消息类型: agent/preview.delta, agent/full.delta, agent/done, agent/error...
+	Type string `json:"type"` // 消息类型: agent/preview.delta, agent/full.delta, agent/edit.*, agent/plan.*, agent/summarize.progress, agent/done, agent/error, agent/history, agent/undo.done, index/update...
 
 	ID  string `json:"id,omitempty"`  // 对应请求的 ID
 	Seq int    `json:"seq,omitempty"` // 流式分片序号，从 1 开始递增
@@ -37,3 +56,19 @@ type MsgResponse struct {
 	ErrorCode string `json:"code,omitempty"`    // 错误码: invalid_token | tool_failed | llm_timeout 等
 	ErrorMsg  string `json:"message,omitempty"` // 错误描述
 }
+
+// agent/error 下发的错误码
+const (
+	ErrCodeInvalidRequest = "INVALID_REQUEST" // 请求格式或对话历史不合法
+	ErrCodeUnknownIntent  = "UNKNOWN_INTENT"  // Intent 未注册
+	ErrCodeLLM            = "LLM_ERROR"       // 调用大模型失败
+	ErrCodeToolLoop       = "TOOL_LOOP_LIMIT" // 工具调用轮数超过上限
+	ErrCodeInvalidToken   = "INVALID_TOKEN"   // 确认 token 不存在、已使用或与请求不匹配
+	ErrCodeConfirmTimeout = "CONFIRM_TIMEOUT" // 等待用户确认超时
+	ErrCodeInvalidContext = "INVALID_CONTEXT" // 编辑器上下文不合法
+	ErrCodeNotFound       = "NOT_FOUND"       // 要撤销或查看的运行不存在
+	ErrCodeUndoConflict   = "UNDO_CONFLICT"   // 笔记在运行之后又被修改，或该运行已撤销
+	ErrCodeUnavailable    = "UNAVAILABLE"     // 服务端未启用该功能（如未配置仓库）
+	ErrCodePlan           = "PLAN_FAILED"     // 无法为目标生成合法的计划
+	ErrCodeInternal       = "INTERNAL"        // 服务端读写笔记、备份等内部错误
+)
@@ -2,8 +2,11 @@ package transport
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,6 +17,10 @@ import (
 type Orchestrator interface {
 	Run(ctx context.Context, msg MsgRequest, sender Sender) error
 	Cancel(id string)
+	Confirm(msg MsgRequest) error
+	ReviewPlan(msg MsgRequest, sender Sender) error
+	Undo(ctx context.Context, msg MsgRequest, sender Sender) error
+	History(msg MsgRequest, sender Sender) error
 }
 
 type Sender interface {
@@ -32,12 +39,58 @@ func (s *WsSender) Send(v any) error {
 }
 
 var Upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true }, // 仅 127.0.0.1 使用，生产请收紧
+	CheckOrigin: checkOrigin,
+}
+
+// 连接鉴权，由 SetAuth 在 Serve 之前设置
+var (
+	authToken      string
+	allowedOrigins = make(map[string]bool)
+)
+
+// SetAuth 设置 /mcp 等可直接调用工具的路由的鉴权：客户端必须以 ?token= 携带 token，
+// token 为空时拒绝这些连接，避免任意网页连上本机端口改写笔记。
+// 浏览器发起的连接（带 Origin 头）还必须与服务同源，或来自 origins 中列出的来源（如 app://obsidian.md），这一条对 /ws 同样生效。
+func SetAuth(token string, origins []string) {
+	authToken = token
+	allowedOrigins = make(map[string]bool, len(origins))
+	for _, o := range origins {
+		allowedOrigins[strings.TrimRight(strings.ToLower(o), "/")] = true
+	}
+}
+
+// Authorize 校验连接携带的 token，失败时写回 401 并返回 false；Origin 由 Upgrader 校验
+func Authorize(w http.ResponseWriter, r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if authToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(authToken)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// checkOrigin 放行非浏览器客户端（不带 Origin 头）、同源页面和配置中允许的来源
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if allowedOrigins[strings.TrimRight(strings.ToLower(origin), "/")] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
 }
 
 var wsLogger *logger.Logger
 var globalHandlerMap map[string]http.HandlerFunc
 
+// clients 记录当前连接的 /ws 客户端，用于推送索引变化等服务端事件
+var (
+	clientsMu sync.Mutex
+	clients   = make(map[*WsSender]struct{})
+)
+
 func init() {
 	var err error
 	wsLogger, err = logger.New("logs/ws_server.log")
@@ -61,6 +114,14 @@ func Serve(addr string, orch Orchestrator) error {
 		defer conn.Close()
 
 		sender := &WsSender{c: conn}
+		clientsMu.Lock()
+		clients[sender] = struct{}{}
+		clientsMu.Unlock()
+		defer func() {
+			clientsMu.Lock()
+			delete(clients, sender)
+			clientsMu.Unlock()
+		}()
 
 		// 心跳
 		go func() {
@@ -80,11 +141,21 @@ func Serve(addr string, orch Orchestrator) error {
 			}
 			var msg MsgRequest
 			if err := json.Unmarshal(data, &msg); err != nil {
+				// 尽量取出 id 回报错误，便于前端定位是哪条请求格式不对
+				var head struct {
+					ID string `json:"id"`
+				}
+				_ = json.Unmarshal(data, &head)
+				_ = sender.Send(MsgResponse{Type: "agent/error", ID: head.ID, ErrorCode: ErrCodeInvalidRequest, ErrorMsg: err.Error()})
 				continue
 			}
 
 			switch msg.Type {
 			case "agent/run":
+				if err := msg.Context.Validate(); err != nil {
+					_ = sender.Send(MsgResponse{Type: "agent/error", ID: msg.ID, ErrorCode: ErrCodeInvalidContext, ErrorMsg: err.Error()})
+					continue
+				}
 				// 为每个 run 开 goroutine
 				go func(m MsgRequest) {
 					ctx, cancel := context.WithCancel(context.Background())
@@ -93,14 +164,49 @@ func Serve(addr string, orch Orchestrator) error {
 				}(msg)
 			case "agent/cancel":
 				orch.Cancel(msg.ID)
+			case "agent/confirm":
+				if err := orch.Confirm(msg); err != nil {
+					_ = sender.Send(MsgResponse{Type: "agent/error", ID: msg.ID, ErrorCode: ErrCodeInvalidToken, ErrorMsg: err.Error()})
+				}
+			case "agent/plan.review":
+				_ = orch.ReviewPlan(msg, sender)
+			case "agent/undo":
+				_ = orch.Undo(context.Background(), msg, sender)
+			case "agent/history":
+				_ = orch.History(msg, sender)
 				// 也可以扩展 tools/call 等其它 type
 			}
 		}
 	})
 
+	// 其它通过 RegisterHandler 注册的路由（例如 /mcp）
+	for pattern, handler := range globalHandlerMap {
+		mux.HandleFunc(pattern, handler)
+	}
+
 	return http.ListenAndServe(addr, mux)
 }
 
+// Broadcast 向所有已连接的 /ws 客户端推送一条消息，发送失败的连接会在读循环中自行退出
+func Broadcast(v any) {
+	clientsMu.Lock()
+	targets := make([]*WsSender, 0, len(clients))
+	for s := range clients {
+		targets = append(targets, s)
+	}
+	clientsMu.Unlock()
+	for _, s := range targets {
+		if err := s.Send(v); err != nil {
+			wsLogger.Warn("broadcast: %v", err)
+		}
+	}
+}
+
+// RegisterHandler 注册一个额外的 HTTP/WebSocket 路由，需在 Serve 之前调用
+func RegisterHandler(pattern string, handler http.HandlerFunc) {
+	globalHandlerMap[pattern] = handler
+}
+
 func InitHandlerMap() map[string]http.HandlerFunc {
 	handlerMap := make(map[string]http.HandlerFunc)
 
@@ -0,0 +1,59 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/websocket"
+	"github.com/obsidian-agent/biz/transport"
+	"github.com/obsidian-agent/pkg/logger"
+	"github.com/obsidian-agent/pkg/mcp"
+)
+
+var mcpLogger *logger.Logger
+
+func init() {
+	if err := os.MkdirAll("logs/ws", 0755); err != nil {
+		panic(err)
+	}
+	var err error
+	mcpLogger, err = logger.New("logs/ws/mcp.log")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// NewMCPHandler 返回 /mcp 路由的处理函数：每个 WebSocket 文本帧承载一条 JSON-RPC 2.0 消息，
+// 每条连接对应一个独立的 MCP 会话。这条连接上无法征求用户确认，需要确认的工具调用（写笔记等）一律拒绝。
+func NewMCPHandler(server *mcp.MCPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !transport.Authorize(w, r) {
+			return
+		}
+		conn, err := transport.Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		sess := server.NewSession(func(data []byte) error {
+			return conn.WriteMessage(websocket.TextMessage, data)
+		}, mcp.WithConfirm(nil))
+		defer sess.Close()
+
+		clientIP := r.RemoteAddr
+		mcpLogger.Info("New MCP connection from %s", clientIP)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				mcpLogger.Info("MCP connection from %s closed: %v", clientIP, err)
+				return
+			}
+			sess.HandleMessage(ctx, data)
+		}
+	}
+}
@@ -2,18 +2,45 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/obsidian-agent/biz/transport"
+	"github.com/obsidian-agent/biz/transport/ws"
+	"github.com/obsidian-agent/internal/indexer"
+	"github.com/obsidian-agent/internal/linker"
 	"github.com/obsidian-agent/internal/orchestrator"
+	"github.com/obsidian-agent/internal/retrieval"
+	"github.com/obsidian-agent/internal/search"
+	"github.com/obsidian-agent/internal/summarizer"
+	"github.com/obsidian-agent/internal/vault"
 	"github.com/obsidian-agent/pkg/logger"
 	"github.com/obsidian-agent/pkg/llm/client"
+	"github.com/obsidian-agent/pkg/llm/llmutils"
+	"github.com/obsidian-agent/pkg/llm/models"
+	"github.com/obsidian-agent/pkg/mcp"
 	"github.com/obsidian-agent/pkg/property"
 	"github.com/sashabaranov/go-openai"
 )
 
+// Version 可在构建时通过 -ldflags "-X main.Version=..." 注入
+var Version = "dev"
+
+var mcpStdio = flag.Bool("mcp-stdio", false, "以 stdio 方式提供 MCP 服务（供编辑器等 MCP 客户端拉起）")
+
 var mainLogger *logger.Logger
 
 func main() {
+	flag.Parse()
+	if *mcpStdio {
+		// stdout 专用于 MCP 协议数据，日志改写到 stderr
+		logger.SetConsole(os.Stderr)
+	}
+
 	property.LoadConfig("/Users/jianghaojun/Projects/obsidian-agent/agent/config/config.json")
 	config := property.GetConfig()
 	agentLogger, err := logger.New(config.LogDir + "/agent.log")
@@ -21,15 +48,126 @@ func main() {
 		panic(err)
 	}
 	mainLogger = agentLogger
+	// 模型注册表在所有组件创建之前加载，WebSocket 与 stdio 两种模式共用
+	if err := models.Load(config.Models, config.Model); err != nil {
+		mainLogger.Error("Failed to load model registry: %v", err)
+	}
+
+	if *mcpStdio {
+		ServeMCPStdio()
+		return
+	}
 	TestWsServer()
 }
 
+// buildToolServer 创建工具注册表，WebSocket 编排和 MCP 服务共用同一份；
+// 配置了仓库目录时注册内置笔记工具，配置中的外部 MCP 服务会被拉起，其工具以 "<name>__<tool>" 导入。
+// llm 供需要调用模型的工具（如 summarize_notes）使用。
+func buildToolServer(llm client.BaseClient) *mcp.MCPServer {
+	config := property.GetConfig()
+	srv := mcp.NewMCPServer()
+	srv.SetServerInfo(mcp.Implementation{Name: "obsidian-agent", Version: Version}, "Tools for reading and editing an Obsidian vault.")
+
+	if v := openVault(); v != nil {
+		if err := vault.RegisterTools(srv, v); err != nil {
+			mainLogger.Error("Failed to register vault tools: %v", err)
+		}
+		if err := search.RegisterTools(srv, searchEngine); err != nil {
+			mainLogger.Error("Failed to register search tools: %v", err)
+		}
+		if err := indexer.RegisterTools(srv, vaultIndex); err != nil {
+			mainLogger.Error("Failed to register link graph tools: %v", err)
+		}
+		if err := linker.RegisterTools(srv, linker.New(vaultIndex, vectorIndex)); err != nil {
+			mainLogger.Error("Failed to register link suggestion tools: %v", err)
+		}
+		if err := summarizer.RegisterTools(srv, summarizer.NewSummarizer(llm), v); err != nil {
+			mainLogger.Error("Failed to register summarize tools: %v", err)
+		}
+	}
+
+	for _, cfg := range config.MCPServers {
+		ext := mcp.NewExternalServer(cfg, srv)
+		ext.SetLogger(mainLogger)
+		if err := ext.Start(context.Background()); err != nil {
+			mainLogger.Error("Failed to start external MCP server %s: %v", cfg.Name, err)
+		}
+	}
+	return srv
+}
+
+// buildSessions 创建服务端会话记忆，较早的轮次由 Summarizer 的 summary 场景折叠为摘要；
+// 会话保存在数据目录下，目录不可用时只保存在内存中
+func buildSessions(llm client.BaseClient) *llmutils.Histories {
+	config := property.GetConfig()
+	var store llmutils.HistoryStore
+	if s, err := llmutils.NewFileHistoryStore(filepath.Join(config.DataDir, "sessions")); err != nil {
+		mainLogger.Error("Failed to open session store, sessions will not persist: %v", err)
+	} else {
+		store = s
+	}
+	sum := summarizer.NewSummarizer(llm)
+	return llmutils.NewHistories(llm.GetModel(), store, sum.SummaryText, llmutils.HistoryOptions{MaxTokens: config.SessionMaxTokens})
+}
+
+// ServeMCPStdio 以 stdio 方式提供 MCP 服务，直到标准输入关闭
+func ServeMCPStdio() {
+	srv := buildToolServer(client.NewDeepSeekClient(property.GetConfig().Apikey))
+	mainLogger.Info("Serving MCP over stdio")
+	if err := srv.ServeStdio(context.Background(), os.Stdin, os.Stdout); err != nil {
+		mainLogger.Error("MCP stdio server stopped: %v", err)
+	}
+}
+
+// loadOrCreateToken 读取 path 中保存的 /mcp token，不存在时生成一个随机 token 并以 0600 写入，
+// 未配置 auth_token 时 MCP 客户端可从该文件读取 token，而不是被拒之门外
+func loadOrCreateToken(path string) (string, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	mainLogger.Info("Generated MCP token in %s", path)
+	return token, nil
+}
 
 func TestWsServer() {
 	config := property.GetConfig()
 	llm := client.NewDeepSeekClient(config.Apikey)
 	llm.SetSystemPrompt(`You are an Obsidian writing companion. Be concise, helpful.`)
+	tools := buildToolServer(llm)
 	orch := orchestrator.BuildMsgOrchestrator(llm)
+	orch.SetToolServer(tools)
+	if vaultIndex != nil {
+		orch.SetVault(vaultIndex.Vault())
+		if editJournal != nil {
+			orch.SetJournal(editJournal)
+		}
+		orch.SetRetriever(retrieval.NewRetriever(vaultIndex, searchEngine, vectorIndex))
+	}
+	orch.SetSessions(buildSessions(llm))
+	token := config.AuthToken
+	if token == "" {
+		var err error
+		if token, err = loadOrCreateToken(filepath.Join(config.DataDir, "mcp_token")); err != nil {
+			mainLogger.Error("Failed to prepare MCP token, /mcp connections will be refused: %v", err)
+		}
+	}
+	transport.SetAuth(token, config.AllowedOrigins)
+	transport.RegisterHandler("/mcp", ws.NewMCPHandler(tools))
 	mainLogger.Info("Starting WebSocket server on %s", config.ServerAddr)
 	if err := transport.Serve(config.ServerAddr, orch); err != nil {
 		mainLogger.Error("Failed to start WebSocket server: %v", err)
@@ -44,7 +182,7 @@ func TestDeepSeekClient() {
 	resp, err := deepseekClient.Client.CreateChatCompletion(
 		context.Background(),
 		openai.ChatCompletionRequest{
-			Model: "deepseek-chat",
+			Model: deepseekClient.GetModel(),
 			Messages: []openai.ChatCompletionMessage{
 				{
 					Role:    openai.ChatMessageRoleUser,
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/obsidian-agent/biz/transport"
+	"github.com/obsidian-agent/internal/indexer"
+	"github.com/obsidian-agent/internal/journal"
+	"github.com/obsidian-agent/internal/retrieval"
+	"github.com/obsidian-agent/internal/search"
+	"github.com/obsidian-agent/internal/vault"
+	"github.com/obsidian-agent/pkg/llm/embedding"
+	"github.com/obsidian-agent/pkg/property"
+)
+
+// vectorSaveInterval 是向量索引写盘的最短间隔，向量文件较大，不随每次变化写盘
+const vectorSaveInterval = 30 * time.Second
+
+// 配置了 vault_root 时由 openVault 创建：
+// vaultIndex 是笔记索引，searchEngine 是全文检索，vectorIndex 是向量检索（嵌入模型不可用时为 nil），
+// editJournal 记录 agent 对笔记的改动（打开失败时为 nil）
+var (
+	vaultIndex   *indexer.Index
+	searchEngine *search.Engine
+	vectorIndex  *retrieval.VectorIndex
+	editJournal  *journal.Journal
+)
+
+// openVault 打开配置中的仓库，在后台从快照恢复索引、与磁盘对账并开始监听变化；
+// 未配置或打开失败时返回 nil
+func openVault() *vault.Vault {
+	config := property.GetConfig()
+	if config.VaultRoot == "" {
+		return nil
+	}
+	v, err := vault.New(config.VaultRoot)
+	if err != nil {
+		mainLogger.Error("Failed to open vault %s: %v", config.VaultRoot, err)
+		return nil
+	}
+	// 笔记被改写前的版本按哈希保存在这里，供撤销使用
+	v.SetBackupDir(filepath.Join(config.DataDir, "backups"))
+	if j, err := journal.Open(filepath.Join(config.DataDir, "journal", "edits.jsonl"), v); err != nil {
+		mainLogger.Error("Failed to open edit journal: %v", err)
+	} else {
+		editJournal = j
+		v.SetCommitHook(func(ctx context.Context, res vault.PatchResult) {
+			if err := j.Record(ctx, res); err != nil {
+				mainLogger.Error("Failed to record edit of %s: %v", res.Path, err)
+			}
+		})
+	}
+	vaultIndex = indexer.New(v)
+	searchEngine = search.NewEngine(vaultIndex)
+	if e, err := embedding.New(config.Embedding, config.Apikey); err != nil {
+		mainLogger.Error("Failed to create embedder: %v", err)
+	} else {
+		vectorIndex = retrieval.NewVectorIndex(e, retrieval.Chunker{Model: config.Embedding.Model})
+	}
+
+	go func() {
+		dir := filepath.Join(config.DataDir, "index")
+		snapshot := filepath.Join(dir, "vault-index.json")
+		start := time.Now()
+		stats, err := vaultIndex.Open(context.Background(), snapshot)
+		if err != nil {
+			mainLogger.Error("Failed to index vault: %v", err)
+			return
+		}
+		mainLogger.Info("Indexed %d notes in %s (added %d, updated %d, removed %d)",
+			vaultIndex.Len(), time.Since(start), stats.Added, stats.Updated, stats.Removed)
+		if err := searchEngine.Build(context.Background()); err != nil {
+			mainLogger.Error("Failed to build search index: %v", err)
+		}
+
+		watcher := indexer.NewWatcher(vaultIndex)
+		watcher.SetSnapshot(snapshot, indexer.DefaultSaveDelay)
+		watcher.SetLogger(mainLogger)
+		watcher.OnEvents(searchEngine.Apply)
+		watcher.OnEvents(func(events []indexer.Event) {
+			transport.Broadcast(transport.MsgResponse{Type: "index/update", Result: map[string]any{"events": events}})
+		})
+		if vectorIndex != nil {
+			watcher.OnEvents(startVectorSync(filepath.Join(dir, "vectors.gob")))
+		}
+		if err := watcher.Start(context.Background()); err != nil {
+			mainLogger.Error("Failed to watch vault: %v", err)
+		}
+	}()
+	return v
+}
+
+// startVectorSync 在后台同步向量索引，并返回用于接收索引变化的回调。
+// 计算向量可能需要访问网络，因此变化先进入队列，由单独的 goroutine 依次处理，不阻塞文件监听；
+// 队列满时丢弃事件并在下一轮做一次全量同步。
+func startVectorSync(file string) func([]indexer.Event) {
+	queue := make(chan []indexer.Event, 64)
+	var resync atomic.Bool
+
+	go func() {
+		ctx := context.Background()
+		if err := vectorIndex.Load(file); err != nil {
+			mainLogger.Warn("Vector index not loaded, rebuilding: %v", err)
+		}
+		sync := func() {
+			start := time.Now()
+			stats, err := vectorIndex.Sync(ctx, vaultIndex)
+			if err != nil {
+				mainLogger.Error("Failed to sync vector index: %v", err)
+				return
+			}
+			mainLogger.Info("Vector index synced in %s (embedded %d notes / %d chunks, removed %d)",
+				time.Since(start), stats.Embedded, stats.Chunks, stats.Removed)
+		}
+		save := func() {
+			if err := vectorIndex.SaveIfDirty(file); err != nil {
+				mainLogger.Error("Failed to save vector index: %v", err)
+			}
+		}
+		sync()
+		save()
+
+		ticker := time.NewTicker(vectorSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case events := <-queue:
+				if resync.Swap(false) {
+					sync()
+					continue
+				}
+				if err := vectorIndex.Apply(ctx, vaultIndex, events); err != nil {
+					mainLogger.Warn("Failed to update vectors: %v", err)
+				}
+			case <-ticker.C:
+				save()
+			}
+		}
+	}()
+
+	return func(events []indexer.Event) {
+		select {
+		case queue <- events:
+		default:
+			resync.Store(true)
+		}
+	}
+}
@@ -7,6 +7,15 @@ require (
 	github.com/sashabaranov/go-openai v1.41.1
 )
 
+require github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
+
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.13.0 // indirect
+
 require (
 	github.com/dlclark/regexp2 v1.10.0 // indirect
 	github.com/google/uuid v1.3.0 // indirect
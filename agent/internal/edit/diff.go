@@ -0,0 +1,280 @@
+package edit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// contextLines 是统一 diff 中每个变更块前后保留的上下文行数
+const contextLines = 3
+
+// lineOp 是逐行比较的结果：' ' 不变，'-' 删除，'+' 新增
+type lineOp struct {
+	kind byte
+	text string
+}
+
+// UnifiedDiff 返回 a 到 b 的统一 diff（unified diff 格式），内容相同时返回空串。
+// 新建或删除（一侧为空）时不做比较，直接把每一行输出为新增或删除。
+func UnifiedDiff(path, a, b string) string {
+	if a == b {
+		return ""
+	}
+	var ops []lineOp
+	switch {
+	case a == "":
+		ops = sameKind('+', splitLines(b))
+	case b == "":
+		ops = sameKind('-', splitLines(a))
+	default:
+		ops = diffLines(splitLines(a), splitLines(b))
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", path, path)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// 从第一处变更向前取上下文，向后合并间隔不超过 2*contextLines 的变更
+		start := max(0, i-contextLines)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*contextLines {
+				break
+			}
+		}
+		end = min(len(ops), end+contextLines)
+		writeHunk(&out, ops, start, end)
+		i = end
+	}
+	return out.String()
+}
+
+// TruncateDiff 把 diff 截断到不超过 limit 字节（在行尾处截断），并注明被截断
+func TruncateDiff(diff string, limit int) string {
+	if len(diff) <= limit {
+		return diff
+	}
+	cut := strings.LastIndexByte(diff[:limit], '\n') + 1
+	return diff[:cut] + "... (diff truncated)\n"
+}
+
+func sameKind(kind byte, lines []string) []lineOp {
+	ops := make([]lineOp, len(lines))
+	for i, l := range lines {
+		ops[i] = lineOp{kind, l}
+	}
+	return ops
+}
+
+// writeHunk 输出 ops[start:end] 组成的一个变更块
+func writeHunk(out *strings.Builder, ops []lineOp, start, end int) {
+	// 统计块前各文件已经过的行数，得到起始行号
+	aLine, bLine := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			aLine++
+		}
+		if op.kind != '-' {
+			bLine++
+		}
+	}
+	aLen, bLen := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			aLen++
+		}
+		if op.kind != '-' {
+			bLen++
+		}
+	}
+	// 空范围按惯例使用前一行的行号
+	if aLen == 0 {
+		aLine--
+	}
+	if bLen == 0 {
+		bLine--
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aLine, aLen), hunkRange(bLine, bLen))
+	for _, op := range ops[start:end] {
+		out.WriteByte(op.kind)
+		out.WriteString(op.text)
+		if !strings.HasSuffix(op.text, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(line, n int) string {
+	if n == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, n)
+}
+
+// splitLines 按行切分并保留换行符，以便区分末尾是否有换行
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines 用 Myers 算法计算最短编辑脚本，先去掉公共前后缀以缩小搜索范围
+func diffLines(a, b []string) []lineOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]lineOp, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		ops = append(ops, lineOp{' ', l})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, lineOp{' ', l})
+	}
+	return ops
+}
+
+// myers 返回 a 到 b 的最短编辑脚本，删除排在新增之前。
+// 采用线性空间的分治 Myers 算法：找出最优路径中间的斜线段后对两侧递归，
+// 时间 O((N+M)·D)，额外空间 O(N+M)，大笔记整篇改写时也不会占用大量内存。
+func myers(a, b []string) []lineOp {
+	off := (len(a)+len(b)+1)/2 + 1
+	d := &differ{a: a, b: b, off: off, vf: make([]int, 2*off+1), vb: make([]int, 2*off+1)}
+	d.ops = make([]lineOp, 0, len(a)+len(b))
+	d.diff(0, len(a), 0, len(b))
+	return deletesFirst(d.ops)
+}
+
+// differ 保存分治过程共用的状态；vf、vb 分别是正向、反向搜索中各对角线走到的最远 x
+type differ struct {
+	a, b   []string
+	off    int
+	vf, vb []int
+	ops    []lineOp
+}
+
+// diff 把 a[a0:a1] 到 b[b0:b1] 的编辑脚本追加到 ops
+func (d *differ) diff(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.ops = append(d.ops, lineOp{' ', d.a[a0]})
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a0 < a1-suffix && b0 < b1-suffix && d.a[a1-1-suffix] == d.b[b1-1-suffix] {
+		suffix++
+	}
+	a1, b1 = a1-suffix, b1-suffix
+
+	switch {
+	case a0 == a1:
+		for _, l := range d.b[b0:b1] {
+			d.ops = append(d.ops, lineOp{'+', l})
+		}
+	case b0 == b1:
+		for _, l := range d.a[a0:a1] {
+			d.ops = append(d.ops, lineOp{'-', l})
+		}
+	default:
+		// 去掉公共前后缀后两侧都非空，编辑距离至少为 2，中间斜线段两侧的子问题都严格更小
+		x, y, u, v := d.middleSnake(a0, a1, b0, b1)
+		d.diff(a0, x, b0, y)
+		for _, l := range d.a[x:u] {
+			d.ops = append(d.ops, lineOp{' ', l})
+		}
+		d.diff(u, a1, v, b1)
+	}
+
+	for _, l := range d.a[a1 : a1+suffix] {
+		d.ops = append(d.ops, lineOp{' ', l})
+	}
+}
+
+// middleSnake 同时从两端搜索 a[a0:a1] 与 b[b0:b1] 的最短编辑路径，
+// 返回两个方向相遇处的斜线段 (x,y)-(u,v)，它位于某条最优路径的中间
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta&1 != 0
+	off, vf, vb := d.off, d.vf, d.vb
+	vf[off+1], vb[off+1] = 0, 0
+
+	for D := 0; D <= (n+m+1)/2; D++ {
+		// 正向：对角线 k = x - y
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1] // 向下：新增
+			} else {
+				x = vf[off+k-1] + 1 // 向右：删除
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && d.a[a0+x] == d.b[b0+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			// 反向对角线 c 与正向对角线 k 的关系为 c = delta - k
+			if c := delta - k; odd && c >= -(D-1) && c <= D-1 && x+vb[off+c] >= n {
+				return a0 + sx, b0 + sy, a0 + x, b0 + y
+			}
+		}
+		// 反向：在倒序的序列上做同样的搜索，x、y 为距末尾的行数
+		for c := -D; c <= D; c += 2 {
+			var x int
+			if c == -D || (c != D && vb[off+c-1] < vb[off+c+1]) {
+				x = vb[off+c+1]
+			} else {
+				x = vb[off+c-1] + 1
+			}
+			y := x - c
+			sx, sy := x, y
+			for x < n && y < m && d.a[a1-1-x] == d.b[b1-1-y] {
+				x++
+				y++
+			}
+			vb[off+c] = x
+			if k := delta - c; !odd && k >= -D && k <= D && x+vf[off+k] >= n {
+				return a1 - x, b1 - y, a1 - sx, b1 - sy
+			}
+		}
+	}
+	panic("edit: middle snake not found")
+}
+
+// deletesFirst 把每段连续的改动整理为先删除后新增，分治的两侧在同一段改动中可能交错
+func deletesFirst(ops []lineOp) []lineOp {
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(ops) && ops[j].kind != ' ' {
+			j++
+		}
+		sort.SliceStable(ops[i:j], func(p, q int) bool {
+			return ops[i+p].kind == '-' && ops[i+q].kind == '+'
+		})
+		i = j
+	}
+	return ops
+}
@@ -0,0 +1,171 @@
+package edit
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// lcsLen 用动态规划计算最长公共子序列的长度，作为最短编辑脚本长度的参照
+func lcsLen(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+// checkScript 检查编辑脚本能从 a 得到 b、长度最短，且每段改动都是先删除后新增
+func checkScript(t *testing.T, a, b []string, ops []lineOp) {
+	t.Helper()
+	var gotA, gotB []string
+	edits := 0
+	for i, op := range ops {
+		switch op.kind {
+		case ' ':
+			gotA, gotB = append(gotA, op.text), append(gotB, op.text)
+		case '-':
+			gotA = append(gotA, op.text)
+			edits++
+			if i > 0 && ops[i-1].kind == '+' {
+				t.Fatalf("deletion after addition at op %d: %v", i, ops)
+			}
+		case '+':
+			gotB = append(gotB, op.text)
+			edits++
+		}
+	}
+	if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+		t.Fatalf("script does not transform a into b\na=%q\nb=%q\nops=%v", a, b, ops)
+	}
+	if want := len(a) + len(b) - 2*lcsLen(a, b); edits != want {
+		t.Fatalf("script has %d edits, want %d\na=%q\nb=%q", edits, want, a, b)
+	}
+}
+
+func TestMyers(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{name: "empty", a: "", b: ""},
+		{name: "insert all", a: "", b: "x\ny\n"},
+		{name: "delete all", a: "x\ny\n", b: ""},
+		{name: "equal", a: "x\ny\n", b: "x\ny\n"},
+		{name: "replace middle", a: "a\nb\nc\n", b: "a\nx\nc\n"},
+		{name: "replace all", a: "a\nb\nc\n", b: "x\ny\n"},
+		{name: "swap", a: "a\nb\n", b: "b\na\n"},
+		{name: "classic", a: "a\nb\nc\na\nb\nb\na\n", b: "c\nb\na\nb\na\nc\n"},
+		{name: "repeated lines", a: "x\nx\nx\ny\n", b: "y\nx\nx\nx\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := splitLines(tt.a), splitLines(tt.b)
+			checkScript(t, a, b, myers(a, b))
+		})
+	}
+}
+
+func TestMyersRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	gen := func() []string {
+		lines := make([]string, r.Intn(30))
+		for i := range lines {
+			lines[i] = fmt.Sprintf("%c\n", 'a'+r.Intn(4))
+		}
+		return lines
+	}
+	for i := 0; i < 500; i++ {
+		a, b := gen(), gen()
+		checkScript(t, a, b, myers(a, b))
+	}
+}
+
+func TestMyersLinearMemory(t *testing.T) {
+	// 两侧完全不同时编辑距离为 N+M；旧实现每一步都复制整个数组，这里会分配数百 MB
+	const n = 2000
+	a, b := make([]string, n), make([]string, n)
+	for i := range a {
+		a[i] = fmt.Sprintf("old %d\n", i)
+		b[i] = fmt.Sprintf("new %d\n", i)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	ops := myers(a, b)
+	runtime.ReadMemStats(&after)
+
+	if len(ops) != 2*n {
+		t.Fatalf("got %d ops, want %d", len(ops), 2*n)
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+		t.Fatalf("myers allocated %d bytes for %d lines", alloc, 2*n)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{name: "no change", a: "x\n", b: "x\n", want: ""},
+		{
+			name: "create",
+			a:    "",
+			b:    "x\ny\n",
+			want: "--- a/n.md\n+++ b/n.md\n@@ -0,0 +1,2 @@\n+x\n+y\n",
+		},
+		{
+			name: "delete",
+			a:    "x\n",
+			b:    "",
+			want: "--- a/n.md\n+++ b/n.md\n@@ -1 +0,0 @@\n-x\n",
+		},
+		{
+			name: "context",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n",
+			b:    "1\n2\n3\n4\nX\n6\n7\n8\n",
+			want: "--- a/n.md\n+++ b/n.md\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+X\n 6\n 7\n 8\n",
+		},
+		{
+			name: "separate hunks",
+			a:    "a\n1\n2\n3\n4\n5\n6\n7\n8\nb\n",
+			b:    "A\n1\n2\n3\n4\n5\n6\n7\n8\nB\n",
+			want: "--- a/n.md\n+++ b/n.md\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-b\n+B\n",
+		},
+		{
+			name: "no newline at end",
+			a:    "x\ny",
+			b:    "x\nz",
+			want: "--- a/n.md\n+++ b/n.md\n@@ -1,2 +1,2 @@\n x\n-y\n\\ No newline at end of file\n+z\n\\ No newline at end of file\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnifiedDiff("n.md", tt.a, tt.b); got != tt.want {
+				t.Fatalf("UnifiedDiff =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateDiff(t *testing.T) {
+	diff := "--- a/n.md\n+++ b/n.md\n@@ -1 +1 @@\n-x\n+y\n"
+	if got := TruncateDiff(diff, len(diff)); got != diff {
+		t.Fatalf("diff within the limit changed: %q", got)
+	}
+	if got, want := TruncateDiff(diff, 15), "--- a/n.md\n... (diff truncated)\n"; got != want {
+		t.Fatalf("TruncateDiff = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,224 @@
+// Package edit 描述对笔记的结构化修改：在某个位置插入、替换某个范围，
+// 每个操作带上原文锚点和笔记哈希，前端或 patch 引擎据此检测冲突后再精确应用。
+package edit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// anchorRunes 是锚点保留的前后文字符数
+const anchorRunes = 64
+
+// Kind 是编辑操作的类型
+type Kind string
+
+const (
+	KindInsert  Kind = "insert"  // 在 From 处插入 Text
+	KindReplace Kind = "replace" // 用 Text 替换 [From, To) 的内容
+)
+
+// ErrConflict 表示笔记内容与生成编辑时看到的不一致
+var ErrConflict = errors.New("edit conflict")
+
+// Pos 是笔记中的位置，与编辑器一致：行号从 0 开始，列号按 UTF-16 码元计
+type Pos struct {
+	Line int `json:"line"`
+	Ch   int `json:"ch"`
+}
+
+// Op 是一次编辑操作。Original、Before、After 是生成编辑时的原文，用于检测冲突和重新定位
+type Op struct {
+	ID       string `json:"id"`
+	Kind     Kind   `json:"kind"`
+	Path     string `json:"path"`
+	From     Pos    `json:"from"`
+	To       Pos    `json:"to"`                 // 插入时与 From 相同
+	Original string `json:"original,omitempty"` // 被替换的原文
+	Before   string `json:"before,omitempty"`   // From 之前的原文
+	After    string `json:"after,omitempty"`    // To 之后的原文
+	Text     string `json:"text"`               // 插入或替换成的文本
+	BaseHash string `json:"baseHash,omitempty"` // 生成编辑时笔记内容的 sha256
+}
+
+// Hash 返回笔记内容的 sha256（十六进制）
+func Hash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewInsert 创建在 at 处插入的操作，锚点取自 content
+func NewInsert(path, content string, at Pos) (Op, error) {
+	return newOp(KindInsert, path, content, at, at)
+}
+
+// NewReplace 创建替换 [from, to) 的操作，锚点与原文取自 content
+func NewReplace(path, content string, from, to Pos) (Op, error) {
+	return newOp(KindReplace, path, content, from, to)
+}
+
+func newOp(kind Kind, path, content string, from, to Pos) (Op, error) {
+	start, err := Offset(content, from)
+	if err != nil {
+		return Op{}, err
+	}
+	end, err := Offset(content, to)
+	if err != nil {
+		return Op{}, err
+	}
+	if end < start {
+		return Op{}, fmt.Errorf("edit range %d:%d-%d:%d is reversed", from.Line, from.Ch, to.Line, to.Ch)
+	}
+	op := Op{
+		Kind:     kind,
+		Path:     path,
+		From:     from,
+		To:       to,
+		Original: content[start:end],
+		Before:   lastRunes(content[:start], anchorRunes),
+		After:    firstRunes(content[end:], anchorRunes),
+		BaseHash: Hash(content),
+	}
+	return op, nil
+}
+
+// Offset 把位置转换为 content 中的字节偏移；列号超出行尾时取行尾，行号越界时报错
+func Offset(content string, p Pos) (int, error) {
+	if p.Line < 0 || p.Ch < 0 {
+		return 0, fmt.Errorf("invalid position %d:%d", p.Line, p.Ch)
+	}
+	start := 0
+	for i := 0; i < p.Line; i++ {
+		n := strings.IndexByte(content[start:], '\n')
+		if n < 0 {
+			return 0, fmt.Errorf("line %d is beyond the end of the note", p.Line)
+		}
+		start += n + 1
+	}
+	line := content[start:]
+	if n := strings.IndexByte(line, '\n'); n >= 0 {
+		line = line[:n]
+	}
+	return start + LineOffset(line, p.Ch), nil
+}
+
+// LineOffset 把以 UTF-16 码元计的列号转换为行内字节偏移，超出行尾时返回行长度
+func LineOffset(line string, ch int) int {
+	units := 0
+	for i, r := range line {
+		if units >= ch {
+			return i
+		}
+		units += utf16.RuneLen(r)
+	}
+	return len(line)
+}
+
+// Apply 依次检查并应用编辑，任一操作的原文与 content 不符时返回 ErrConflict，content 不变。
+// 操作按位置从后往前应用，因此各操作的位置都相对于原始内容；范围重叠的操作视为错误。
+func Apply(content string, ops []Op) (string, error) {
+	type span struct {
+		start, end int
+		op         Op
+	}
+	spans := make([]span, 0, len(ops))
+	for _, op := range ops {
+		start, err := Offset(content, op.From)
+		if err != nil {
+			return "", fmt.Errorf("%w: op %s: %v", ErrConflict, op.ID, err)
+		}
+		end := start
+		if op.Kind == KindReplace {
+			if end, err = Offset(content, op.To); err != nil {
+				return "", fmt.Errorf("%w: op %s: %v", ErrConflict, op.ID, err)
+			}
+		}
+		if end < start || !op.matchesAt(content, start, end) {
+			return "", fmt.Errorf("%w: op %s: text at %d:%d no longer matches", ErrConflict, op.ID, op.From.Line, op.From.Ch)
+		}
+		spans = append(spans, span{start, end, op})
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start > spans[j].start })
+	for i := 1; i < len(spans); i++ {
+		if spans[i].end > spans[i-1].start {
+			return "", fmt.Errorf("ops %s and %s overlap", spans[i].op.ID, spans[i-1].op.ID)
+		}
+	}
+	for _, s := range spans {
+		content = content[:s.start] + s.op.Text + content[s.end:]
+	}
+	return content, nil
+}
+
+// matchesAt 检查 [start, end) 处的原文以及前后锚点是否与生成编辑时一致
+func (op Op) matchesAt(content string, start, end int) bool {
+	if op.Kind == KindReplace && content[start:end] != op.Original {
+		return false
+	}
+	return strings.HasSuffix(content[:start], op.Before) && strings.HasPrefix(content[end:], op.After)
+}
+
+func lastRunes(s string, n int) string {
+	i := len(s)
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(s[:i])
+		i -= size
+	}
+	return s[i:]
+}
+
+func firstRunes(s string, n int) string {
+	i := 0
+	for ; n > 0 && i < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return s[:i]
+}
+
+// PosAt 把字节偏移转换为位置
+func PosAt(content string, off int) Pos {
+	off = max(0, min(off, len(content)))
+	lineStart := strings.LastIndexByte(content[:off], '\n') + 1
+	ch := 0
+	for _, r := range content[lineStart:off] {
+		ch += utf16.RuneLen(r)
+	}
+	return Pos{Line: strings.Count(content[:off], "\n"), Ch: ch}
+}
+
+// Between 把 old 到 updated 的整体改写收窄为一个编辑操作：去掉公共前后缀，只替换中间变化的部分。
+// 两者相同时返回 ok=false。
+func Between(path, old, updated string) (op Op, ok bool) {
+	if old == updated {
+		return Op{}, false
+	}
+	prefix := 0
+	for prefix < len(old) && prefix < len(updated) && old[prefix] == updated[prefix] {
+		prefix++
+	}
+	for prefix > 0 && prefix < len(old) && !utf8.RuneStart(old[prefix]) {
+		prefix--
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(updated)-prefix && old[len(old)-1-suffix] == updated[len(updated)-1-suffix] {
+		suffix++
+	}
+	for suffix > 0 && !utf8.RuneStart(old[len(old)-suffix]) {
+		suffix--
+	}
+	from, to := PosAt(old, prefix), PosAt(old, len(old)-suffix)
+	if from == to {
+		op, _ = NewInsert(path, old, from)
+	} else {
+		op, _ = NewReplace(path, old, from, to)
+	}
+	op.Text = updated[prefix : len(updated)-suffix]
+	return op, true
+}
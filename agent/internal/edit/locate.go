@@ -0,0 +1,108 @@
+package edit
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	maxCandidates = 1000 // 候选位置过多时放弃定位，视为冲突
+	probeRunes    = 32   // 插入操作用锚点末尾的多少个字符查找候选位置
+)
+
+// Relocate 在已被修改过的 content 中重新定位 op：用原文和前后锚点查找候选位置，
+// 按上下文与锚点的吻合程度打分，分数相同时取离原位置最近的一个。
+// 被替换的原文本身必须原样存在，否则说明用户改动了同一处内容，返回 ErrConflict。
+// 返回的操作相对 content，锚点与 BaseHash 已按 content 更新。
+func Relocate(content string, op Op) (Op, error) {
+	var needle string
+	var insertAtEnd bool // 插入位置在 needle 之后（needle 取自 Before）
+	switch {
+	case op.Kind == KindReplace && op.Original != "":
+		needle = op.Original
+	case op.Before != "":
+		needle, insertAtEnd = lastRunes(op.Before, probeRunes), true
+	case op.After != "":
+		needle = firstRunes(op.After, probeRunes)
+	default:
+		// 生成编辑时笔记为空：只有笔记仍为空时才能确定位置
+		if content != "" {
+			return op, fmt.Errorf("%w: op %s: note is no longer empty", ErrConflict, op.ID)
+		}
+		op.From, op.To = Pos{}, Pos{}
+		return op, nil
+	}
+
+	expected := -1
+	if off, err := Offset(content, op.From); err == nil {
+		expected = off
+	}
+	best, bestScore, bestDist, ties := -1, -1, 0, 0
+	for i, n := 0, 0; ; n++ {
+		j := strings.Index(content[i:], needle)
+		if j < 0 {
+			break
+		}
+		if n == maxCandidates {
+			return op, fmt.Errorf("%w: op %s: anchor is too ambiguous", ErrConflict, op.ID)
+		}
+		start := i + j
+		end := start + len(needle)
+		if op.Kind != KindReplace {
+			if insertAtEnd {
+				start = end
+			} else {
+				end = start
+			}
+		}
+		score := commonSuffix(content[:start], op.Before) + commonPrefix(content[end:], op.After)
+		dist := abs(start - expected)
+		switch {
+		case score > bestScore, score == bestScore && expected >= 0 && dist < bestDist:
+			best, bestScore, bestDist, ties = start, score, dist, 0
+		case score == bestScore && (expected < 0 || dist == bestDist):
+			ties++
+		}
+		i += j + 1
+	}
+	if best < 0 {
+		return op, fmt.Errorf("%w: op %s: original text not found", ErrConflict, op.ID)
+	}
+	if ties > 0 {
+		return op, fmt.Errorf("%w: op %s: anchor matches %d places", ErrConflict, op.ID, ties+1)
+	}
+	end := best
+	if op.Kind == KindReplace {
+		end += len(op.Original)
+	}
+	// 定位后的操作以 content 为准，锚点和哈希随之更新
+	op.From, op.To = PosAt(content, best), PosAt(content, end)
+	op.Before, op.After = lastRunes(content[:best], anchorRunes), firstRunes(content[end:], anchorRunes)
+	op.BaseHash = Hash(content)
+	return op, nil
+}
+
+// commonSuffix 返回 a 与 b 公共后缀的字节数
+func commonSuffix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	return n
+}
+
+// commonPrefix 返回 a 与 b 公共前缀的字节数
+func commonPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
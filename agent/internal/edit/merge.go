@@ -0,0 +1,117 @@
+package edit
+
+import "strings"
+
+// Conflict 是三方合并中双方都改动了的一段，Line 为该段在 base 中的起始行（从 1 开始）
+type Conflict struct {
+	Line   int    `json:"line"`
+	Base   string `json:"base"`
+	Ours   string `json:"ours"`
+	Theirs string `json:"theirs"`
+}
+
+// change 是相对 base 的一处逐行改动：base[start:end) 被替换为 lines
+type change struct {
+	start, end int
+	lines      []string
+}
+
+// Merge3 以 base 为共同祖先逐行合并 ours 与 theirs：只有一方改动的段落直接采用，
+// 双方改动相同时取其一，否则记为冲突（冲突处保留 theirs）。
+func Merge3(base, ours, theirs string) (string, []Conflict) {
+	baseLines := splitLines(base)
+	a := changesOf(baseLines, splitLines(ours))
+	b := changesOf(baseLines, splitLines(theirs))
+
+	var out strings.Builder
+	var conflicts []Conflict
+	pos := 0
+	for len(a) > 0 || len(b) > 0 {
+		// 取起点最靠前的改动，把与它重叠或相邻的改动都并入同一段
+		start := 0
+		switch {
+		case len(a) == 0:
+			start = b[0].start
+		case len(b) == 0:
+			start = a[0].start
+		default:
+			start = min(a[0].start, b[0].start)
+		}
+		end := start
+		na, nb := 0, 0
+		for grew := true; grew; {
+			grew = false
+			for na < len(a) && a[na].start <= end {
+				end = max(end, a[na].end)
+				na, grew = na+1, true
+			}
+			for nb < len(b) && b[nb].start <= end {
+				end = max(end, b[nb].end)
+				nb, grew = nb+1, true
+			}
+		}
+
+		writeLines(&out, baseLines[pos:start])
+		switch {
+		case nb == 0:
+			out.WriteString(applyChanges(baseLines, a[:na], start, end))
+		case na == 0:
+			out.WriteString(applyChanges(baseLines, b[:nb], start, end))
+		default:
+			o := applyChanges(baseLines, a[:na], start, end)
+			t := applyChanges(baseLines, b[:nb], start, end)
+			if o != t {
+				conflicts = append(conflicts, Conflict{Line: start + 1, Base: strings.Join(baseLines[start:end], ""), Ours: o, Theirs: t})
+			}
+			out.WriteString(t)
+		}
+		pos = end
+		a, b = a[na:], b[nb:]
+	}
+	writeLines(&out, baseLines[pos:])
+	return out.String(), conflicts
+}
+
+// changesOf 把逐行比较结果整理为相对 base 的改动列表
+func changesOf(base, other []string) []change {
+	var out []change
+	i := 0
+	var cur *change
+	for _, op := range diffLines(base, other) {
+		if op.kind == ' ' {
+			cur = nil
+			i++
+			continue
+		}
+		if cur == nil {
+			out = append(out, change{start: i, end: i})
+			cur = &out[len(out)-1]
+		}
+		if op.kind == '-' {
+			i++
+			cur.end = i
+		} else {
+			cur.lines = append(cur.lines, op.text)
+		}
+	}
+	return out
+}
+
+// applyChanges 返回 base[start:end) 应用 changes 后的文本
+func applyChanges(base []string, changes []change, start, end int) string {
+	var b strings.Builder
+	p := start
+	for _, c := range changes {
+		writeLines(&b, base[p:c.start])
+		writeLines(&b, c.lines)
+		p = c.end
+	}
+	writeLines(&b, base[p:end])
+	return b.String()
+}
+
+func writeLines(b *strings.Builder, lines []string) {
+	for _, l := range lines {
+		b.WriteString(l)
+	}
+}
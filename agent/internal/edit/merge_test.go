@@ -0,0 +1,43 @@
+package edit
+
+import "testing"
+
+func TestMerge3(t *testing.T) {
+	const base = "a\nb\nc\nd\ne\n"
+	tests := []struct {
+		name          string
+		ours, theirs  string
+		want          string
+		wantConflicts []Conflict
+	}{
+		{name: "no changes", ours: base, theirs: base, want: base},
+		{name: "only ours", ours: "a\nB\nc\nd\ne\n", theirs: base, want: "a\nB\nc\nd\ne\n"},
+		{name: "only theirs", ours: base, theirs: "a\nb\nc\nD\ne\n", want: "a\nb\nc\nD\ne\n"},
+		{name: "disjoint", ours: "A\nb\nc\nd\ne\n", theirs: "a\nb\nc\nd\nE\n", want: "A\nb\nc\nd\nE\n"},
+		{name: "same change", ours: "a\nX\nc\nd\ne\n", theirs: "a\nX\nc\nd\ne\n", want: "a\nX\nc\nd\ne\n"},
+		{name: "insert and delete", ours: "a\nb\nnew\nc\nd\ne\n", theirs: "a\nb\nc\nd\n", want: "a\nb\nnew\nc\nd\n"},
+		{
+			name:          "conflict keeps theirs",
+			ours:          "a\nOURS\nc\nd\ne\n",
+			theirs:        "a\nTHEIRS\nc\nd\ne\n",
+			want:          "a\nTHEIRS\nc\nd\ne\n",
+			wantConflicts: []Conflict{{Line: 2, Base: "b\n", Ours: "OURS\n", Theirs: "THEIRS\n"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := Merge3(base, tt.ours, tt.theirs)
+			if got != tt.want {
+				t.Fatalf("Merge3 = %q, want %q", got, tt.want)
+			}
+			if len(conflicts) != len(tt.wantConflicts) {
+				t.Fatalf("conflicts = %+v, want %+v", conflicts, tt.wantConflicts)
+			}
+			for i := range conflicts {
+				if conflicts[i] != tt.wantConflicts[i] {
+					t.Fatalf("conflict %d = %+v, want %+v", i, conflicts[i], tt.wantConflicts[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package indexer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/obsidian-agent/internal/vault"
+)
+
+// Direction 是在链接图中遍历的方向
+type Direction string
+
+const (
+	DirectionOut  Direction = "out"  // 只沿出链
+	DirectionIn   Direction = "in"   // 只沿反链
+	DirectionBoth Direction = "both" // 不区分方向
+)
+
+// MaxHops 是邻域查询允许的最大跳数
+const MaxHops = 3
+
+// GraphNode 是邻域中的一篇笔记，Hops 为与中心笔记的最短跳数
+type GraphNode struct {
+	Path  string `json:"path"`
+	Title string `json:"title"`
+	Hops  int    `json:"hops"`
+	In    int    `json:"in"`  // 被多少篇笔记链接
+	Out   int    `json:"out"` // 链接了多少篇笔记
+}
+
+// GraphEdge 是两篇笔记之间的链接，同一对笔记之间的多条链接合并计数
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Count int    `json:"count"`
+}
+
+// Neighborhood 是以某篇笔记为中心、若干跳以内的子图
+type Neighborhood struct {
+	Root      string      `json:"root"`
+	Nodes     []GraphNode `json:"nodes"`
+	Edges     []GraphEdge `json:"edges"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// UnresolvedTarget 汇总指向同一个不存在笔记的链接
+type UnresolvedTarget struct {
+	Target  string   `json:"target"`
+	Count   int      `json:"count"`
+	Sources []string `json:"sources"`
+}
+
+// Lookup 把工具或用户给出的笔记标识解析为路径：先按路径精确查找，再按 [[链接名]] 解析
+func (x *Index) Lookup(ref string) (string, bool) {
+	ref = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(ref), "[["), "]]"))
+	if ref == "" {
+		return "", false
+	}
+	if n, ok := x.Note(ref); ok {
+		return n.Path, true
+	}
+	return x.Resolve(ref, "")
+}
+
+// neighborsLocked 返回与 p 直接相连的笔记及每个方向上的链接数，调用方需持有读锁
+func (x *Index) neighborsLocked(p string, dir Direction) map[string]int {
+	out := make(map[string]int)
+	if dir != DirectionIn {
+		if n, ok := x.notes[p]; ok {
+			for _, l := range n.Links {
+				if l.Resolved != "" && l.Resolved != p {
+					out[l.Resolved]++
+				}
+			}
+		}
+	}
+	if dir != DirectionOut {
+		for _, e := range x.backlinks[p] {
+			if e.From != p {
+				out[e.From]++
+			}
+		}
+	}
+	return out
+}
+
+// degreeLocked 返回笔记的入度和出度（按不同的笔记计数，不含自链接），调用方需持有读锁
+func (x *Index) degreeLocked(p string) (in, out int) {
+	return len(x.neighborsLocked(p, DirectionIn)), len(x.neighborsLocked(p, DirectionOut))
+}
+
+// Neighbors 返回以 rel 为中心、hops 跳以内的子图。hops 取值 1..MaxHops；
+// limit > 0 时最多返回 limit 篇笔记（按跳数、再按连接数优先），此时 Truncated 为 true。
+func (x *Index) Neighbors(rel string, hops int, dir Direction, limit int) (Neighborhood, bool) {
+	hops = max(1, min(hops, MaxHops))
+	if dir == "" {
+		dir = DirectionBoth
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	root := vault.NotePath(rel)
+	if _, ok := x.notes[root]; !ok {
+		return Neighborhood{}, false
+	}
+
+	// 广度优先，记录每篇笔记的最短跳数
+	dist := map[string]int{root: 0}
+	frontier := []string{root}
+	for h := 1; h <= hops && len(frontier) > 0; h++ {
+		var next []string
+		for _, p := range frontier {
+			for q := range x.neighborsLocked(p, dir) {
+				if _, seen := dist[q]; !seen {
+					dist[q] = h
+					next = append(next, q)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	nodes := make([]GraphNode, 0, len(dist))
+	for p, h := range dist {
+		in, out := x.degreeLocked(p)
+		nodes = append(nodes, GraphNode{Path: p, Title: x.notes[p].Title, Hops: h, In: in, Out: out})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if a.Hops != b.Hops {
+			return a.Hops < b.Hops
+		}
+		if a.In+a.Out != b.In+b.Out {
+			return a.In+a.Out > b.In+b.Out
+		}
+		return a.Path < b.Path
+	})
+	nb := Neighborhood{Root: root}
+	if limit > 0 && len(nodes) > limit {
+		nodes, nb.Truncated = nodes[:limit], true
+	}
+	nb.Nodes = nodes
+
+	// 只保留子图内部的边，方向按实际链接方向
+	keep := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		keep[n.Path] = true
+	}
+	nb.Edges = []GraphEdge{}
+	for _, n := range nodes {
+		for to, count := range x.neighborsLocked(n.Path, DirectionOut) {
+			if keep[to] {
+				nb.Edges = append(nb.Edges, GraphEdge{From: n.Path, To: to, Count: count})
+			}
+		}
+	}
+	sort.Slice(nb.Edges, func(i, j int) bool {
+		if nb.Edges[i].From != nb.Edges[j].From {
+			return nb.Edges[i].From < nb.Edges[j].From
+		}
+		return nb.Edges[i].To < nb.Edges[j].To
+	})
+	return nb, true
+}
+
+// Orphans 返回既没有被链接、也没有链接到其他笔记的笔记，按路径排序；folder 非空时只看该目录
+func (x *Index) Orphans(folder string) []string {
+	prefix := strings.Trim(folder, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var out []string
+	for p := range x.notes {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		if in, o := x.degreeLocked(p); in == 0 && o == 0 {
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// UnresolvedTargets 按目标汇总无法解析的链接，被引用次数多的在前；from 非空时只看该笔记发出的链接
+func (x *Index) UnresolvedTargets(from string) []UnresolvedTarget {
+	if from != "" {
+		from = vault.NotePath(from)
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var out []UnresolvedTarget
+	for _, edges := range x.unresolved {
+		t := UnresolvedTarget{Sources: []string{}}
+		seen := make(map[string]bool)
+		var first Edge
+		for _, e := range edges {
+			if from != "" && e.From != from {
+				continue
+			}
+			// 同一目标的写法可能大小写不同，取来源路径和行号最靠前的一处，与索引顺序无关
+			if t.Count == 0 || e.From < first.From || (e.From == first.From && e.Link.Line < first.Link.Line) {
+				first = e
+				t.Target = e.Link.Target
+			}
+			t.Count++
+			if !seen[e.From] {
+				seen[e.From] = true
+				t.Sources = append(t.Sources, e.From)
+			}
+		}
+		if t.Count > 0 {
+			sort.Strings(t.Sources)
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return strings.ToLower(out[i].Target) < strings.ToLower(out[j].Target)
+	})
+	return out
+}
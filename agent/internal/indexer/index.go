@@ -0,0 +1,436 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/obsidian-agent/internal/vault"
+)
+
+// Edge 是链接图中的一条边：From 笔记中的 Link，Link.Resolved 为目标笔记
+type Edge struct {
+	From string `json:"from"`
+	Link Link   `json:"link"`
+}
+
+// Index 维护仓库内全部笔记的结构化记录和链接图，可并发读取。
+// 索引中的 *Note 视为只读，更新时整体替换，调用方可以放心持有。
+type Index struct {
+	vault *vault.Vault
+
+	mu     sync.RWMutex
+	notes  map[string]*Note    // path → note
+	byName map[string][]string // 小写文件名（不含扩展名）→ paths，用于解析 [[name]]
+
+	backlinks  map[string][]Edge              // 目标 path → 指向它的边
+	unresolved map[string][]Edge              // 小写目标名 → 无法解析的边
+	pending    map[string]map[string]struct{} // noteKey → unresolved 中对应的目标名，新笔记出现时只需重解析这些边
+}
+
+// New 创建一个空索引，调用 Build 后可用
+func New(v *vault.Vault) *Index {
+	return &Index{
+		vault:      v,
+		notes:      make(map[string]*Note),
+		byName:     make(map[string][]string),
+		backlinks:  make(map[string][]Edge),
+		unresolved: make(map[string][]Edge),
+		pending:    make(map[string]map[string]struct{}),
+	}
+}
+
+// Vault 返回索引对应的仓库
+func (x *Index) Vault() *vault.Vault { return x.vault }
+
+// Build 遍历仓库重建整个索引
+func (x *Index) Build(ctx context.Context) error {
+	notes := make(map[string]*Note)
+	err := x.vault.WalkNotes("", func(info vault.NoteInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := x.load(info.Path)
+		if err != nil {
+			return nil // 单篇笔记读取失败不影响整体
+		}
+		notes[n.Path] = n
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.notes = notes
+	x.relinkAll()
+	return nil
+}
+
+// load 读取并解析一篇笔记
+func (x *Index) load(rel string) (*Note, error) {
+	content, info, err := x.vault.ReadNote(rel)
+	if err != nil {
+		return nil, err
+	}
+	n := ParseNote(info.Path, content)
+	n.Size = info.Size
+	n.Modified = info.Modified
+	return n, nil
+}
+
+// Update 重新解析一篇笔记；笔记已不存在时从索引中移除
+func (x *Index) Update(rel string) (*Note, error) {
+	rel = vault.NotePath(rel)
+	n, err := x.load(rel)
+	if errors.Is(err, fs.ErrNotExist) {
+		x.Remove(rel)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	x.Put(n)
+	return n, nil
+}
+
+// Put 把一篇已解析的笔记放入索引并更新链接图
+func (x *Index) Put(n *Note) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	old, existed := x.notes[n.Path]
+	if existed {
+		x.unlinkNote(old)
+		x.notes[n.Path] = n
+		x.linkNote(n)
+		return
+	}
+
+	// 新笔记只会改变同名链接的解析结果：此前无法解析的、以及原本指向其他同名笔记的
+	key := noteKey(n.Path)
+	affected := x.sourcesOf(key, n.Path)
+	x.notes[n.Path] = n
+	x.byName[key] = append(x.byName[key], n.Path)
+	x.linkNote(n)
+	x.relink(affected, n.Path)
+}
+
+// Remove 从索引中移除一篇笔记，返回它此前是否存在
+func (x *Index) Remove(rel string) bool {
+	rel = vault.NotePath(rel)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	old, ok := x.notes[rel]
+	if !ok {
+		return false
+	}
+	x.unlinkNote(old)
+	delete(x.notes, rel)
+	key := noteKey(rel)
+	x.byName[key] = dropPath(x.byName[key], rel)
+	if len(x.byName[key]) == 0 {
+		delete(x.byName, key)
+	}
+
+	// 只有指向被删笔记的链接需要改投其他同名笔记或变为未解析
+	affected := make(map[string]bool)
+	for _, e := range x.backlinks[rel] {
+		affected[e.From] = true
+	}
+	x.relink(affected, rel)
+	return true
+}
+
+// Note 返回指定路径的笔记记录
+func (x *Index) Note(rel string) (*Note, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	n, ok := x.notes[vault.NotePath(rel)]
+	return n, ok
+}
+
+// Notes 返回全部笔记，按路径排序
+func (x *Index) Notes() []*Note {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	out := make([]*Note, 0, len(x.notes))
+	for _, n := range x.notes {
+		out = append(out, n)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// Len 返回索引中的笔记数
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.notes)
+}
+
+// Resolve 按 Obsidian 的规则把链接目标解析为笔记路径：
+// 目标为空表示笔记自身；带目录的目标按路径后缀匹配；只有文件名时同名笔记优先选与 from 同目录的，
+// 其次选路径最短的。
+func (x *Index) Resolve(target, from string) (string, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.resolve(Link{Kind: LinkWiki, Target: target}, from)
+}
+
+// Outgoing 返回笔记的出链（含解析结果）
+func (x *Index) Outgoing(rel string) []Link {
+	n, ok := x.Note(rel)
+	if !ok {
+		return nil
+	}
+	return append([]Link(nil), n.Links...)
+}
+
+// Backlinks 返回指向该笔记的全部链接，按来源路径和行号排序
+func (x *Index) Backlinks(rel string) []Edge {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return sortedEdges(x.backlinks[vault.NotePath(rel)])
+}
+
+// Unresolved 返回全部指向不存在笔记的链接，按来源路径和行号排序
+func (x *Index) Unresolved() []Edge {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var out []Edge
+	for _, edges := range x.unresolved {
+		out = append(out, edges...)
+	}
+	return sortedEdges(out)
+}
+
+// Tags 统计每个标签被多少篇笔记使用；嵌套标签同时计入各级父标签
+func (x *Index) Tags() map[string]int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	counts := make(map[string]int)
+	for _, n := range x.notes {
+		seen := make(map[string]bool)
+		for _, t := range n.Tags {
+			name := strings.ToLower(t.Name)
+			for {
+				if !seen[name] {
+					seen[name] = true
+					counts[name]++
+				}
+				i := strings.LastIndex(name, "/")
+				if i < 0 {
+					break
+				}
+				name = name[:i]
+			}
+		}
+	}
+	return counts
+}
+
+// NotesWithTag 返回带有某个标签（含其嵌套子标签）的笔记
+func (x *Index) NotesWithTag(tag string) []*Note {
+	var out []*Note
+	for _, n := range x.Notes() {
+		if n.HasTag(tag) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// ---- 链接图维护（调用方需持有写锁）----
+
+// relinkAll 重建文件名索引并重新解析全部链接
+func (x *Index) relinkAll() {
+	x.byName = make(map[string][]string, len(x.notes))
+	for p := range x.notes {
+		key := noteKey(p)
+		x.byName[key] = append(x.byName[key], p)
+	}
+	x.backlinks = make(map[string][]Edge)
+	x.unresolved = make(map[string][]Edge)
+	x.pending = make(map[string]map[string]struct{})
+	for _, n := range x.notes {
+		x.linkNote(n)
+	}
+}
+
+// sourcesOf 返回解析结果可能受名为 key 的笔记 except 增删影响的来源笔记：
+// 指向该名称的未解析链接，以及已解析到其他同名笔记的链接
+func (x *Index) sourcesOf(key, except string) map[string]bool {
+	out := make(map[string]bool)
+	for target := range x.pending[key] {
+		for _, e := range x.unresolved[target] {
+			out[e.From] = true
+		}
+	}
+	for _, p := range x.byName[key] {
+		if p == except {
+			continue
+		}
+		for _, e := range x.backlinks[p] {
+			out[e.From] = true
+		}
+	}
+	return out
+}
+
+// relink 重新解析 sources 中各笔记的全部出链，skip 已单独处理
+func (x *Index) relink(sources map[string]bool, skip string) {
+	for from := range sources {
+		n, ok := x.notes[from]
+		if !ok || from == skip {
+			continue
+		}
+		x.unlinkNote(n)
+		x.linkNote(n)
+	}
+}
+
+// linkNote 解析笔记中的链接并加入链接图；解析结果写入新的 Note 副本以保持已发布记录不可变
+func (x *Index) linkNote(n *Note) {
+	links := make([]Link, len(n.Links))
+	for i, l := range n.Links {
+		l.Resolved, _ = x.resolve(l, n.Path)
+		links[i] = l
+		e := Edge{From: n.Path, Link: l}
+		if l.Resolved != "" {
+			x.backlinks[l.Resolved] = append(x.backlinks[l.Resolved], e)
+		} else {
+			key := strings.ToLower(l.Target)
+			x.unresolved[key] = append(x.unresolved[key], e)
+			name := noteKey(key)
+			if x.pending[name] == nil {
+				x.pending[name] = make(map[string]struct{})
+			}
+			x.pending[name][key] = struct{}{}
+		}
+	}
+	cp := *n
+	cp.Links = links
+	x.notes[n.Path] = &cp
+}
+
+// unlinkNote 从链接图中移除某篇笔记的全部出边
+func (x *Index) unlinkNote(n *Note) {
+	for _, l := range n.Links {
+		if l.Resolved != "" {
+			x.backlinks[l.Resolved] = dropFrom(x.backlinks[l.Resolved], n.Path)
+			if len(x.backlinks[l.Resolved]) == 0 {
+				delete(x.backlinks, l.Resolved)
+			}
+		} else {
+			key := strings.ToLower(l.Target)
+			x.unresolved[key] = dropFrom(x.unresolved[key], n.Path)
+			if len(x.unresolved[key]) == 0 {
+				delete(x.unresolved, key)
+				name := noteKey(key)
+				delete(x.pending[name], key)
+				if len(x.pending[name]) == 0 {
+					delete(x.pending, name)
+				}
+			}
+		}
+	}
+}
+
+func dropPath(paths []string, p string) []string {
+	out := paths[:0]
+	for _, q := range paths {
+		if q != p {
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+func dropFrom(edges []Edge, from string) []Edge {
+	out := edges[:0]
+	for _, e := range edges {
+		if e.From != from {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (x *Index) resolve(l Link, from string) (string, bool) {
+	target := strings.TrimSpace(l.Target)
+	if target == "" {
+		_, ok := x.notes[from]
+		return from, ok
+	}
+	target = strings.TrimPrefix(target, "/")
+
+	// markdown 链接是相对路径，先相对来源笔记所在目录查找
+	if l.Kind == LinkMarkdown {
+		rel := vault.NotePath(path.Join(path.Dir(from), target))
+		if _, ok := x.notes[rel]; ok {
+			return rel, true
+		}
+	}
+	if _, ok := x.notes[vault.NotePath(target)]; ok {
+		return vault.NotePath(target), true
+	}
+
+	key := noteKey(target)
+	candidates := x.byName[key]
+	if strings.Contains(target, "/") {
+		// 带目录的目标：按路径后缀匹配（大小写不敏感）
+		suffix := strings.ToLower(strings.TrimSuffix(vault.NotePath(target), vault.NoteExt))
+		var matched []string
+		for _, p := range candidates {
+			lp := strings.ToLower(strings.TrimSuffix(p, path.Ext(p)))
+			if lp == suffix || strings.HasSuffix(lp, "/"+suffix) {
+				matched = append(matched, p)
+			}
+		}
+		candidates = matched
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	return pickCandidate(candidates, from), true
+}
+
+// pickCandidate 从同名笔记中选出链接目标：同目录优先，其次路径最短，最后按字典序
+func pickCandidate(candidates []string, from string) string {
+	dir := path.Dir(from)
+	best := ""
+	for _, p := range candidates {
+		if path.Dir(p) == dir {
+			return p
+		}
+		if best == "" || len(p) < len(best) || (len(p) == len(best) && p < best) {
+			best = p
+		}
+	}
+	return best
+}
+
+// noteKey 返回用于按名称查找笔记的键：小写的文件名，不含扩展名
+func noteKey(p string) string {
+	base := path.Base(p)
+	if strings.EqualFold(path.Ext(base), vault.NoteExt) {
+		base = base[:len(base)-len(vault.NoteExt)]
+	}
+	return strings.ToLower(base)
+}
+
+func sortedEdges(edges []Edge) []Edge {
+	out := append([]Edge(nil), edges...)
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].From != out[j].From {
+			return out[i].From < out[j].From
+		}
+		return out[i].Link.Line < out[j].Link.Line
+	})
+	return out
+}
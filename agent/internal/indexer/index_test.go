@@ -0,0 +1,96 @@
+package indexer
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// graphState 汇总索引的链接图，便于比较增量维护和整体重建的结果
+func graphState(x *Index) map[string]any {
+	links := make(map[string][]Link)
+	backlinks := make(map[string][]Edge)
+	for _, n := range x.Notes() {
+		links[n.Path] = n.Links
+		if b := x.Backlinks(n.Path); len(b) > 0 {
+			backlinks[n.Path] = b
+		}
+	}
+	unresolved := x.Unresolved()
+	// Unresolved 只按来源和行号排序，同一行的多条边再按目标定序
+	sort.Slice(unresolved, func(i, j int) bool {
+		a, b := unresolved[i], unresolved[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.Link.Line != b.Link.Line {
+			return a.Link.Line < b.Link.Line
+		}
+		return a.Link.Target < b.Link.Target
+	})
+	targets := x.UnresolvedTargets("")
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Target < targets[j].Target })
+	return map[string]any{"links": links, "backlinks": backlinks, "unresolved": unresolved, "targets": targets}
+}
+
+func TestIndexIncrementalMatchesRebuild(t *testing.T) {
+	paths := []string{"a.md", "b.md", "dir/a.md", "dir/b.md", "dir/sub/a.md", "c.md", "dir/c.md"}
+	bodies := []string{
+		"[[a]] [[b]]",
+		"[[dir/a]] [[c#Top]]",
+		"[x](a.md) [y](../c.md)",
+		"[[sub/a]] [[missing]] [[]]",
+		"[[A|alias]] ![[b#^blk]]",
+	}
+
+	r := rand.New(rand.NewSource(1))
+	x := New(nil)
+	live := make(map[string]*Note)
+	for step := 0; step < 400; step++ {
+		p := paths[r.Intn(len(paths))]
+		if _, ok := live[p]; ok && r.Intn(3) == 0 {
+			x.Remove(p)
+			delete(live, p)
+		} else {
+			n := ParseNote(p, bodies[r.Intn(len(bodies))])
+			x.Put(n)
+			live[p] = n
+		}
+
+		want := New(nil)
+		for p, n := range live {
+			want.notes[p] = n
+		}
+		want.relinkAll()
+		if got, exp := graphState(x), graphState(want); !reflect.DeepEqual(got, exp) {
+			t.Fatalf("step %d: incremental graph differs from rebuild\ngot  %+v\nwant %+v", step, got, exp)
+		}
+	}
+}
+
+func TestIndexPutPrefersSameFolder(t *testing.T) {
+	x := New(nil)
+	x.Put(ParseNote("x/a.md", ""))
+	x.Put(ParseNote("dir/from.md", "[[a]]"))
+	if got := x.Backlinks("x/a.md"); len(got) != 1 {
+		t.Fatalf("backlinks of x/a.md = %+v", got)
+	}
+
+	x.Put(ParseNote("dir/a.md", ""))
+	if got := x.Backlinks("dir/a.md"); len(got) != 1 || got[0].From != "dir/from.md" {
+		t.Fatalf("link did not move to the note in the same folder: %+v", got)
+	}
+	if got := x.Backlinks("x/a.md"); len(got) != 0 {
+		t.Fatalf("stale backlinks on x/a.md: %+v", got)
+	}
+
+	x.Remove("dir/a.md")
+	if got := x.Backlinks("x/a.md"); len(got) != 1 {
+		t.Fatalf("link did not fall back to x/a.md: %+v", got)
+	}
+	x.Remove("x/a.md")
+	if got := x.Unresolved(); len(got) != 1 || got[0].Link.Target != "a" {
+		t.Fatalf("unresolved = %+v", got)
+	}
+}
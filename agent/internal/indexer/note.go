@@ -0,0 +1,83 @@
+package indexer
+
+import "time"
+
+// LinkKind 区分链接的写法
+type LinkKind string
+
+const (
+	LinkWiki     LinkKind = "wiki"     // [[target]]
+	LinkMarkdown LinkKind = "markdown" // [text](target.md)
+)
+
+// Link 是笔记中出现的一条指向其他笔记的链接
+type Link struct {
+	Kind    LinkKind `json:"kind"`
+	Target  string   `json:"target"`            // 链接目标（笔记名或路径），不含 #heading / #^block
+	Heading string   `json:"heading,omitempty"` // [[note#heading]]
+	Block   string   `json:"block,omitempty"`   // [[note#^block]]
+	Alias   string   `json:"alias,omitempty"`   // [[note|alias]] 或 markdown 链接文本
+	Embed   bool     `json:"embed,omitempty"`   // ![[note]]
+	Line    int      `json:"line"`              // 所在行号，从 1 开始
+
+	// Resolved 是解析后的目标笔记路径；无法解析（未创建的笔记）时为空
+	Resolved string `json:"resolved,omitempty"`
+}
+
+// Heading 是笔记中的一个标题
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	Line  int    `json:"line"`
+}
+
+// Block 是带有块 ID（行尾的 ^id）的段落
+type Block struct {
+	ID   string `json:"id"`
+	Line int    `json:"line"`
+}
+
+// Tag 是一个标签及其出现位置；来自 frontmatter 的标签 Line 为 0
+type Tag struct {
+	Name string `json:"name"` // 不含 #，嵌套标签形如 "project/alpha"
+	Line int    `json:"line"`
+}
+
+// Note 是索引中一篇笔记的结构化记录
+type Note struct {
+	Path        string         `json:"path"`  // 相对仓库根目录，/ 分隔
+	Title       string         `json:"title"` // 文件名（不含扩展名），与 Obsidian 的链接名一致
+	Aliases     []string       `json:"aliases,omitempty"`
+	Frontmatter map[string]any `json:"frontmatter,omitempty"`
+	Tags        []Tag          `json:"tags,omitempty"`
+	Headings    []Heading      `json:"headings,omitempty"`
+	Blocks      []Block        `json:"blocks,omitempty"`
+	Links       []Link         `json:"links,omitempty"`
+
+	Hash     string    `json:"hash"` // 内容的 sha256
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// TagNames 返回去重后的标签名
+func (n *Note) TagNames() []string {
+	seen := make(map[string]bool, len(n.Tags))
+	out := make([]string, 0, len(n.Tags))
+	for _, t := range n.Tags {
+		if !seen[t.Name] {
+			seen[t.Name] = true
+			out = append(out, t.Name)
+		}
+	}
+	return out
+}
+
+// HasTag 判断笔记是否带有某个标签；大小写不敏感，父标签可以匹配嵌套子标签（#a 匹配 #a/b）
+func (n *Note) HasTag(tag string) bool {
+	for _, t := range n.Tags {
+		if tagMatches(t.Name, tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/obsidian-agent/internal/vault"
+)
+
+var (
+	wikiLinkRe = regexp.MustCompile(`(!?)\[\[([^\[\]\n]+?)\]\]`)
+	mdLinkRe   = regexp.MustCompile(`(!?)\[([^\[\]\n]*)\]\(([^()\s]+)(?:\s+"[^"]*")?\)`)
+	tagRe      = regexp.MustCompile(`(?:^|[\s,;(\[])#([\p{L}\p{N}_/\-]+)`)
+	blockIDRe  = regexp.MustCompile(`(?:^|\s)\^([A-Za-z0-9\-]+)\s*$`)
+	inlineCode = regexp.MustCompile("`+[^`\n]*`+")
+)
+
+// ParseNote 解析一篇笔记：frontmatter、标题、块 ID、标签和链接。
+// 代码块与行内代码中的内容不会被当作标签或链接。
+func ParseNote(notePath, content string) *Note {
+	sum := sha256.Sum256([]byte(content))
+	n := &Note{
+		Path:  notePath,
+		Title: strings.TrimSuffix(path.Base(notePath), path.Ext(notePath)),
+		Hash:  hex.EncodeToString(sum[:]),
+		Size:  int64(len(content)),
+	}
+
+	_, body, bodyLine := vault.SplitFrontmatter(content)
+	if fm, err := vault.ParseFrontmatter(content); err == nil && len(fm) > 0 {
+		n.Frontmatter = fm
+		n.Aliases = stringList(fm, "aliases", "alias")
+		for _, t := range stringList(fm, "tags", "tag") {
+			if name := normalizeTag(t); name != "" {
+				n.Tags = append(n.Tags, Tag{Name: name})
+			}
+		}
+	}
+
+	inFence := ""
+	for i, line := range strings.Split(body, "\n") {
+		lineNo := bodyLine + i
+		line = strings.TrimRight(line, "\r")
+
+		if vault.IsFence(line) {
+			marker := strings.TrimSpace(line)[:3]
+			switch {
+			case inFence == "":
+				inFence = marker
+			case marker == inFence:
+				inFence = ""
+			}
+			continue
+		}
+		if inFence != "" {
+			continue
+		}
+
+		if level, text := vault.ParseHeading(line); level > 0 {
+			n.Headings = append(n.Headings, Heading{Level: level, Text: text, Line: lineNo})
+		}
+		if m := blockIDRe.FindStringSubmatch(line); m != nil {
+			n.Blocks = append(n.Blocks, Block{ID: m[1], Line: lineNo})
+		}
+
+		// 行内代码替换为等长空白，避免其中的 [[...]] 和 #xxx 被解析；
+		// 链接同样在解析后抹去，[[#heading]] 中的 # 不是标签
+		text := inlineCode.ReplaceAllStringFunc(line, blank)
+		n.Links = append(n.Links, parseWikiLinks(text, lineNo)...)
+		n.Links = append(n.Links, parseMarkdownLinks(text, lineNo)...)
+		text = wikiLinkRe.ReplaceAllStringFunc(text, blank)
+		text = mdLinkRe.ReplaceAllStringFunc(text, blank)
+		for _, m := range tagRe.FindAllStringSubmatch(text, -1) {
+			if name := normalizeTag(m[1]); name != "" {
+				n.Tags = append(n.Tags, Tag{Name: name, Line: lineNo})
+			}
+		}
+	}
+	return n
+}
+
+func blank(s string) string { return strings.Repeat(" ", len(s)) }
+
+// parseWikiLinks 解析 [[target#heading|alias]]、[[target#^block]] 和 ![[embed]]
+func parseWikiLinks(line string, lineNo int) []Link {
+	var out []Link
+	for _, m := range wikiLinkRe.FindAllStringSubmatch(line, -1) {
+		l := Link{Kind: LinkWiki, Embed: m[1] == "!", Line: lineNo}
+		inner := m[2]
+		if i := strings.Index(inner, "|"); i >= 0 {
+			l.Alias = strings.TrimSpace(inner[i+1:])
+			inner = inner[:i]
+		}
+		l.Target, l.Heading, l.Block = splitAnchor(inner)
+		if l.Target == "" && l.Heading == "" && l.Block == "" {
+			continue
+		}
+		if isAttachment(l.Target) {
+			continue
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// parseMarkdownLinks 解析指向仓库内笔记的 [text](path.md) 链接，忽略外部 URL 和其他类型的附件
+func parseMarkdownLinks(line string, lineNo int) []Link {
+	var out []Link
+	for _, m := range mdLinkRe.FindAllStringSubmatch(line, -1) {
+		raw := m[3]
+		if strings.Contains(raw, "://") || strings.HasPrefix(raw, "mailto:") || strings.HasPrefix(raw, "#") {
+			continue
+		}
+		if dec, err := url.PathUnescape(raw); err == nil {
+			raw = dec
+		}
+		target, heading, block := splitAnchor(raw)
+		if ext := path.Ext(target); ext != "" && !strings.EqualFold(ext, vault.NoteExt) {
+			continue
+		}
+		out = append(out, Link{
+			Kind:    LinkMarkdown,
+			Target:  target,
+			Heading: heading,
+			Block:   block,
+			Alias:   strings.TrimSpace(m[2]),
+			Embed:   m[1] == "!",
+			Line:    lineNo,
+		})
+	}
+	return out
+}
+
+// attachmentExts 是仓库中常见的非笔记附件，指向它们的链接不计入链接图
+var attachmentExts = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".webp": true, ".bmp": true,
+	".pdf": true, ".mp3": true, ".wav": true, ".ogg": true, ".m4a": true, ".mp4": true, ".webm": true, ".mov": true,
+	".canvas": true,
+}
+
+func isAttachment(target string) bool {
+	return attachmentExts[strings.ToLower(path.Ext(target))]
+}
+
+// splitAnchor 拆分 "note#heading" / "note#^block"
+func splitAnchor(s string) (target, heading, block string) {
+	target = s
+	if i := strings.Index(s, "#"); i >= 0 {
+		target = s[:i]
+		anchor := strings.TrimSpace(s[i+1:])
+		if strings.HasPrefix(anchor, "^") {
+			block = anchor[1:]
+		} else {
+			heading = anchor
+		}
+	}
+	return strings.TrimSpace(target), heading, block
+}
+
+// normalizeTag 去掉 # 前缀和首尾的 /；纯数字不是合法标签
+func normalizeTag(s string) string {
+	s = strings.Trim(strings.TrimPrefix(strings.TrimSpace(s), "#"), "/")
+	for _, r := range s {
+		if !unicode.IsDigit(r) && r != '/' {
+			return s
+		}
+	}
+	return ""
+}
+
+// tagMatches 判断标签 name 是否命中查询 query；父标签可以匹配嵌套子标签
+func tagMatches(name, query string) bool {
+	query = strings.ToLower(normalizeTag(query))
+	name = strings.ToLower(name)
+	return query != "" && (name == query || strings.HasPrefix(name, query+"/"))
+}
+
+// stringList 从 frontmatter 中读取字符串或字符串列表；字符串形式按逗号和空白拆分
+func stringList(fm map[string]any, keys ...string) []string {
+	var out []string
+	for _, key := range keys {
+		switch v := fm[key].(type) {
+		case string:
+			if key == "aliases" || key == "alias" {
+				// 别名中可能包含空格，只按逗号拆分
+				for _, s := range strings.Split(v, ",") {
+					if s = strings.TrimSpace(s); s != "" {
+						out = append(out, s)
+					}
+				}
+				continue
+			}
+			out = append(out, strings.FieldsFunc(v, func(r rune) bool {
+				return r == ',' || unicode.IsSpace(r)
+			})...)
+		case []any:
+			for _, item := range v {
+				if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+					out = append(out, strings.TrimSpace(s))
+				}
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,160 @@
+package indexer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNoteFrontmatter(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantAliases []string
+		wantTags    []Tag
+	}{
+		{
+			name:        "lists",
+			content:     "---\naliases: [Alpha, Project A]\ntags: [work, \"#project/alpha\"]\n---\nbody\n",
+			wantAliases: []string{"Alpha", "Project A"},
+			wantTags:    []Tag{{Name: "work"}, {Name: "project/alpha"}},
+		},
+		{
+			name:        "strings",
+			content:     "---\nalias: Alpha, Project A\ntags: work project/alpha\n---\n",
+			wantAliases: []string{"Alpha", "Project A"},
+			wantTags:    []Tag{{Name: "work"}, {Name: "project/alpha"}},
+		},
+		{
+			name:     "numeric tag is dropped",
+			content:  "---\ntags: [2024, y2024]\n---\n",
+			wantTags: []Tag{{Name: "y2024"}},
+		},
+		{
+			name:     "body tags keep line numbers",
+			content:  "---\ntags: work\n---\n\ntext #later\n",
+			wantTags: []Tag{{Name: "work"}, {Name: "later", Line: 5}},
+		},
+		{name: "no frontmatter", content: "# Title\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := ParseNote("a.md", tt.content)
+			if !reflect.DeepEqual(n.Aliases, tt.wantAliases) {
+				t.Errorf("aliases = %q, want %q", n.Aliases, tt.wantAliases)
+			}
+			if !reflect.DeepEqual(n.Tags, tt.wantTags) {
+				t.Errorf("tags = %+v, want %+v", n.Tags, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestParseNoteLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []Link
+	}{
+		{
+			name: "plain",
+			line: "see [[Note]]",
+			want: []Link{{Kind: LinkWiki, Target: "Note", Line: 1}},
+		},
+		{
+			name: "alias",
+			line: "[[folder/Note|the note]]",
+			want: []Link{{Kind: LinkWiki, Target: "folder/Note", Alias: "the note", Line: 1}},
+		},
+		{
+			name: "heading and alias",
+			line: "[[Note#Part two|part]]",
+			want: []Link{{Kind: LinkWiki, Target: "Note", Heading: "Part two", Alias: "part", Line: 1}},
+		},
+		{
+			name: "block ref",
+			line: "![[Note#^abc-1]]",
+			want: []Link{{Kind: LinkWiki, Target: "Note", Block: "abc-1", Embed: true, Line: 1}},
+		},
+		{
+			name: "same note heading",
+			line: "[[#Intro]]",
+			want: []Link{{Kind: LinkWiki, Heading: "Intro", Line: 1}},
+		},
+		{
+			name: "markdown links",
+			line: "[a](sub/My%20Note.md#Top) [b](https://x.io/a.md) [c](img.png) [d](Other)",
+			want: []Link{
+				{Kind: LinkMarkdown, Target: "sub/My Note.md", Heading: "Top", Alias: "a", Line: 1},
+				{Kind: LinkMarkdown, Target: "Other", Alias: "d", Line: 1},
+			},
+		},
+		{name: "attachment", line: "![[photo.PNG]]"},
+		{name: "inline code", line: "`[[Not a link]]` and ``#nottag``"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := ParseNote("a.md", tt.line)
+			if !reflect.DeepEqual(n.Links, tt.want) {
+				t.Errorf("links = %+v, want %+v", n.Links, tt.want)
+			}
+			if len(n.Tags) != 0 {
+				t.Errorf("unexpected tags %+v", n.Tags)
+			}
+		})
+	}
+}
+
+func TestParseNoteTags(t *testing.T) {
+	tests := []struct {
+		line string
+		want []Tag
+	}{
+		{line: "#todo", want: []Tag{{Name: "todo", Line: 1}}},
+		{line: "a #project/alpha/beta b", want: []Tag{{Name: "project/alpha/beta", Line: 1}}},
+		{line: "中文 #标签 (#in-paren)", want: []Tag{{Name: "标签", Line: 1}, {Name: "in-paren", Line: 1}}},
+		{line: "issue#12 and #123"},
+		{line: "[[Note#Heading]] [x](Note.md#Heading)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := ParseNote("a.md", tt.line).Tags; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tags = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNoteHeadingsAndBlocks(t *testing.T) {
+	content := "---\ntitle: x\n---\n# Top\ntext ^intro\n\n## Sub section ##\n- item ^item-2\n#not-heading\n"
+	n := ParseNote("dir/Note.md", content)
+
+	if n.Title != "Note" {
+		t.Errorf("title = %q, want Note", n.Title)
+	}
+	wantHeadings := []Heading{{Level: 1, Text: "Top", Line: 4}, {Level: 2, Text: "Sub section", Line: 7}}
+	if !reflect.DeepEqual(n.Headings, wantHeadings) {
+		t.Errorf("headings = %+v, want %+v", n.Headings, wantHeadings)
+	}
+	wantBlocks := []Block{{ID: "intro", Line: 5}, {ID: "item-2", Line: 8}}
+	if !reflect.DeepEqual(n.Blocks, wantBlocks) {
+		t.Errorf("blocks = %+v, want %+v", n.Blocks, wantBlocks)
+	}
+}
+
+func TestParseNoteSkipsFences(t *testing.T) {
+	content := "```go\n# not a heading\n[[Hidden]] #hidden\n~~~\nstill code ^nope\n```\n" +
+		"~~~\n```\n[[AlsoHidden]]\n~~~\n[[Shown]] #shown\n"
+	n := ParseNote("a.md", content)
+
+	if len(n.Headings) != 0 || len(n.Blocks) != 0 {
+		t.Errorf("fenced content parsed: headings=%+v blocks=%+v", n.Headings, n.Blocks)
+	}
+	wantLinks := []Link{{Kind: LinkWiki, Target: "Shown", Line: 11}}
+	if !reflect.DeepEqual(n.Links, wantLinks) {
+		t.Errorf("links = %+v, want %+v", n.Links, wantLinks)
+	}
+	wantTags := []Tag{{Name: "shown", Line: 11}}
+	if !reflect.DeepEqual(n.Tags, wantTags) {
+		t.Errorf("tags = %+v, want %+v", n.Tags, wantTags)
+	}
+}
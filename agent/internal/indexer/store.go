@@ -0,0 +1,197 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/obsidian-agent/internal/vault"
+)
+
+// snapshotVersion 在索引记录格式不兼容地变化时递增，旧快照会被丢弃并全量重建
+const snapshotVersion = 1
+
+// snapshot 是持久化到磁盘的索引快照
+type snapshot struct {
+	Version int     `json:"version"`
+	Root    string  `json:"root"`
+	Notes   []*Note `json:"notes"`
+}
+
+// Save 把索引写入快照文件（先写临时文件再重命名）
+func (x *Index) Save(file string) error {
+	notes := x.Notes()
+	data, err := json.Marshal(snapshot{Version: snapshotVersion, Root: x.vault.Root(), Notes: notes})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".index-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// Load 从快照文件恢复索引；快照不存在、版本不符或属于其他仓库时返回错误，索引保持不变
+func (x *Index) Load(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode index snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("index snapshot version %d, want %d", snap.Version, snapshotVersion)
+	}
+	if snap.Root != x.vault.Root() {
+		return fmt.Errorf("index snapshot belongs to vault %s", snap.Root)
+	}
+
+	notes := make(map[string]*Note, len(snap.Notes))
+	for _, n := range snap.Notes {
+		if n != nil && n.Path != "" {
+			notes[n.Path] = n
+		}
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.notes = notes
+	x.relinkAll()
+	return nil
+}
+
+// ReconcileStats 汇总一次启动对账的结果
+type ReconcileStats struct {
+	Added     int `json:"added"`
+	Updated   int `json:"updated"`
+	Removed   int `json:"removed"`
+	Unchanged int `json:"unchanged"`
+}
+
+// Reconcile 将索引与磁盘对账：大小和修改时间都未变的笔记直接复用，
+// 否则读取内容比对哈希，只有内容真正变化时才重新解析；磁盘上已不存在的笔记被移除。
+// 返回的事件描述了对账过程中发现的变化。
+func (x *Index) Reconcile(ctx context.Context) (ReconcileStats, []Event, error) {
+	var stats ReconcileStats
+	var events []Event
+
+	x.mu.RLock()
+	known := make(map[string]*Note, len(x.notes))
+	for p, n := range x.notes {
+		known[p] = n
+	}
+	x.mu.RUnlock()
+
+	notes := make(map[string]*Note, len(known))
+	err := x.vault.WalkNotes("", func(info vault.NoteInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		old, ok := known[info.Path]
+		if ok && old.Size == info.Size && old.Modified.Equal(info.Modified) {
+			notes[info.Path] = old
+			stats.Unchanged++
+			return nil
+		}
+		n, err := x.load(info.Path)
+		if err != nil {
+			if ok {
+				notes[info.Path] = old
+			}
+			return nil
+		}
+		switch {
+		case !ok:
+			stats.Added++
+			events = append(events, Event{Type: EventCreated, Path: n.Path})
+		case old.Hash == n.Hash:
+			// 只是 mtime 变了（例如被同步工具 touch），沿用旧记录，避免无谓的重新解析
+			cp := *old
+			cp.Modified = n.Modified
+			n = &cp
+			stats.Unchanged++
+		default:
+			stats.Updated++
+			events = append(events, Event{Type: EventUpdated, Path: n.Path})
+		}
+		notes[n.Path] = n
+		return nil
+	})
+	if err != nil {
+		return stats, nil, err
+	}
+
+	for p := range known {
+		if _, ok := notes[p]; !ok {
+			stats.Removed++
+			events = append(events, Event{Type: EventDeleted, Path: p})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.notes = notes
+	x.relinkAll()
+	return stats, events, nil
+}
+
+// Open 从快照恢复索引并与磁盘对账；快照不可用时全量建立索引。
+// 对账完成后会立即写回快照，snapshotFile 为空时不持久化。
+func (x *Index) Open(ctx context.Context, snapshotFile string) (ReconcileStats, error) {
+	if snapshotFile != "" {
+		if err := x.Load(snapshotFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			// 快照损坏或版本不兼容：丢弃后全量重建
+			x.mu.Lock()
+			x.notes = make(map[string]*Note)
+			x.relinkAll()
+			x.mu.Unlock()
+		}
+	}
+	stats, _, err := x.Reconcile(ctx)
+	if err != nil {
+		return stats, err
+	}
+	if snapshotFile != "" {
+		err = x.Save(snapshotFile)
+	}
+	return stats, err
+}
+
+// removePrefix 移除某个目录下的全部笔记（目录被删除或移出仓库时使用），返回被移除的笔记
+func (x *Index) removePrefix(dir string) []*Note {
+	dir = strings.TrimSuffix(dir, "/") + "/"
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var removed []*Note
+	for p, n := range x.notes {
+		if strings.HasPrefix(p, dir) {
+			delete(x.notes, p)
+			removed = append(removed, n)
+		}
+	}
+	if len(removed) > 0 {
+		x.relinkAll()
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Path < removed[j].Path })
+	return removed
+}
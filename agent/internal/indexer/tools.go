@@ -0,0 +1,414 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/obsidian-agent/internal/textutil"
+	"github.com/obsidian-agent/pkg/mcp"
+)
+
+const (
+	defaultGraphLimit = 50
+	maxContextLen     = 200 // 反链所在行的最大长度
+)
+
+// ---- 入参 ----
+
+type noteRefInput struct {
+	Path  string `json:"path"`
+	Limit int    `json:"limit"`
+}
+
+type unresolvedInput struct {
+	Path  string `json:"path"`
+	Limit int    `json:"limit"`
+}
+
+type orphansInput struct {
+	Folder string `json:"folder"`
+	Limit  int    `json:"limit"`
+}
+
+type neighborhoodInput struct {
+	Path      string    `json:"path"`
+	Depth     int       `json:"depth"`
+	Direction Direction `json:"direction"`
+	Limit     int       `json:"limit"`
+}
+
+// ---- 结构化返回 ----
+
+// Backlink 是一条反链及其所在行的文本
+type Backlink struct {
+	From    string `json:"from"`
+	Line    int    `json:"line"`
+	Heading string `json:"heading,omitempty"` // 链接指向的标题
+	Context string `json:"context,omitempty"` // 链接所在行
+}
+
+type backlinksOutput struct {
+	Path      string     `json:"path"`
+	Backlinks []Backlink `json:"backlinks"`
+	Total     int        `json:"total"`
+}
+
+type outgoingOutput struct {
+	Path  string `json:"path"`
+	Links []Link `json:"links"`
+}
+
+type unresolvedOutput struct {
+	Targets []UnresolvedTarget `json:"targets"`
+	Total   int                `json:"total"`
+}
+
+type orphansOutput struct {
+	Orphans []string `json:"orphans"`
+	Total   int      `json:"total"`
+}
+
+// ---- schema ----
+
+const (
+	noteRefProperty = `"path": {"type": "string", "minLength": 1, "description": "笔记路径或链接名，如 \"Projects/plan.md\" 或 \"plan\""}`
+	limitProperty   = `"limit": {"type": "integer", "minimum": 1, "maximum": 500}`
+
+	backlinksInputSchema = `{
+  "type": "object",
+  "properties": {` + noteRefProperty + `, ` + limitProperty + `},
+  "required": ["path"],
+  "additionalProperties": false
+}`
+	backlinksOutputSchema = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string"},
+    "backlinks": {"type": "array", "items": {"type": "object", "properties": {"from": {"type": "string"}, "line": {"type": "integer"}, "heading": {"type": "string"}, "context": {"type": "string"}}, "required": ["from", "line"]}},
+    "total": {"type": "integer"}
+  },
+  "required": ["path", "backlinks", "total"]
+}`
+	outgoingInputSchema = `{
+  "type": "object",
+  "properties": {` + noteRefProperty + `},
+  "required": ["path"],
+  "additionalProperties": false
+}`
+	outgoingOutputSchema = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string"},
+    "links": {"type": "array", "items": {"type": "object", "properties": {"target": {"type": "string"}, "resolved": {"type": "string"}, "line": {"type": "integer"}}, "required": ["target", "line"]}}
+  },
+  "required": ["path", "links"]
+}`
+	unresolvedInputSchema = `{
+  "type": "object",
+  "properties": {"path": {"type": "string", "description": "只看这篇笔记中的未解析链接，默认整个仓库"}, ` + limitProperty + `},
+  "additionalProperties": false
+}`
+	unresolvedOutputSchema = `{
+  "type": "object",
+  "properties": {
+    "targets": {"type": "array", "items": {"type": "object", "properties": {"target": {"type": "string"}, "count": {"type": "integer"}, "sources": {"type": "array", "items": {"type": "string"}}}, "required": ["target", "count", "sources"]}},
+    "total": {"type": "integer"}
+  },
+  "required": ["targets", "total"]
+}`
+	orphansInputSchema = `{
+  "type": "object",
+  "properties": {"folder": {"type": "string", "description": "只看该目录下的笔记"}, ` + limitProperty + `},
+  "additionalProperties": false
+}`
+	orphansOutputSchema = `{
+  "type": "object",
+  "properties": {"orphans": {"type": "array", "items": {"type": "string"}}, "total": {"type": "integer"}},
+  "required": ["orphans", "total"]
+}`
+	neighborhoodInputSchema = `{
+  "type": "object",
+  "properties": {
+    ` + noteRefProperty + `,
+    "depth": {"type": "integer", "minimum": 1, "maximum": 3, "description": "跳数，默认 1"},
+    "direction": {"enum": ["out", "in", "both"], "description": "out 只沿出链，in 只沿反链，默认 both"},
+    ` + limitProperty + `
+  },
+  "required": ["path"],
+  "additionalProperties": false
+}`
+	neighborhoodOutputSchema = `{
+  "type": "object",
+  "properties": {
+    "root": {"type": "string"},
+    "nodes": {"type": "array", "items": {"type": "object", "properties": {"path": {"type": "string"}, "title": {"type": "string"}, "hops": {"type": "integer"}, "in": {"type": "integer"}, "out": {"type": "integer"}}, "required": ["path", "hops"]}},
+    "edges": {"type": "array", "items": {"type": "object", "properties": {"from": {"type": "string"}, "to": {"type": "string"}, "count": {"type": "integer"}}, "required": ["from", "to"]}},
+    "truncated": {"type": "boolean"}
+  },
+  "required": ["root", "nodes", "edges"]
+}`
+)
+
+// RegisterTools 注册基于链接图的只读查询工具
+func RegisterTools(srv *mcp.MCPServer, x *Index) error {
+	openWorld := false
+	readOnly := &mcp.ToolAnnotations{ReadOnlyHint: true, OpenWorldHint: &openWorld}
+	tools := []struct {
+		def     *mcp.ToolDef
+		handler mcp.ToolHandler
+	}{
+		{
+			def: &mcp.ToolDef{
+				Name: "get_backlinks", Title: "反向链接",
+				Description:  "List notes that link to the given note, with the line containing each link.",
+				InputSchema:  json.RawMessage(backlinksInputSchema),
+				OutputSchema: json.RawMessage(backlinksOutputSchema),
+				Annotations:  readOnly,
+			},
+			handler: x.backlinksTool,
+		},
+		{
+			def: &mcp.ToolDef{
+				Name: "get_outgoing_links", Title: "出链",
+				Description:  "List the links in a note and the notes they resolve to (resolved is empty for notes that do not exist yet).",
+				InputSchema:  json.RawMessage(outgoingInputSchema),
+				OutputSchema: json.RawMessage(outgoingOutputSchema),
+				Annotations:  readOnly,
+			},
+			handler: x.outgoingTool,
+		},
+		{
+			def: &mcp.ToolDef{
+				Name: "get_unresolved_links", Title: "未解析链接",
+				Description:  "List link targets that do not match any note, most referenced first, with the notes that reference them.",
+				InputSchema:  json.RawMessage(unresolvedInputSchema),
+				OutputSchema: json.RawMessage(unresolvedOutputSchema),
+				Annotations:  readOnly,
+			},
+			handler: x.unresolvedTool,
+		},
+		{
+			def: &mcp.ToolDef{
+				Name: "find_orphans", Title: "孤立笔记",
+				Description:  "List notes with no incoming and no outgoing links.",
+				InputSchema:  json.RawMessage(orphansInputSchema),
+				OutputSchema: json.RawMessage(orphansOutputSchema),
+				Annotations:  readOnly,
+			},
+			handler: x.orphansTool,
+		},
+		{
+			def: &mcp.ToolDef{
+				Name: "get_neighborhood", Title: "关联笔记",
+				Description:  "Return the notes within N link hops of a note (following links in either direction by default) and the links between them.",
+				InputSchema:  json.RawMessage(neighborhoodInputSchema),
+				OutputSchema: json.RawMessage(neighborhoodOutputSchema),
+				Annotations:  readOnly,
+			},
+			handler: x.neighborhoodTool,
+		},
+	}
+	for _, t := range tools {
+		if err := srv.RegisterTool(t.def, t.handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeArgs 把已通过 schema 校验的 arguments 解码到具体的入参结构体
+func decodeArgs(args map[string]any, out any) error {
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func textResult(text string, structured any) mcp.ToolCallResult {
+	return mcp.ToolCallResult{
+		Content:           []mcp.ContentPart{{Type: "text", Text: text}},
+		StructuredContent: structured,
+	}
+}
+
+// lookupNote 解析工具入参中的笔记，找不到时返回错误
+func (x *Index) lookupNote(ref string) (string, error) {
+	p, ok := x.Lookup(ref)
+	if !ok {
+		return "", fmt.Errorf("note not found: %s", ref)
+	}
+	return p, nil
+}
+
+func (x *Index) backlinksTool(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	var in noteRefInput
+	if err := decodeArgs(args, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	p, err := x.lookupNote(in.Path)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	if in.Limit <= 0 {
+		in.Limit = defaultGraphLimit
+	}
+	edges := x.Backlinks(p)
+	out := backlinksOutput{Path: p, Backlinks: []Backlink{}, Total: len(edges)}
+	lines := make(map[string][]string) // 每篇来源笔记只读一次
+	for _, e := range edges {
+		if len(out.Backlinks) == in.Limit {
+			break
+		}
+		src, ok := lines[e.From]
+		if !ok {
+			content, _, err := x.vault.ReadNote(e.From)
+			if err == nil {
+				src = strings.Split(content, "\n")
+			}
+			lines[e.From] = src
+		}
+		b := Backlink{From: e.From, Line: e.Link.Line, Heading: e.Link.Heading}
+		if i := e.Link.Line - 1; i >= 0 && i < len(src) {
+			b.Context = textutil.Clip(strings.TrimSpace(src[i]), maxContextLen)
+		}
+		out.Backlinks = append(out.Backlinks, b)
+	}
+
+	var b strings.Builder
+	for _, l := range out.Backlinks {
+		fmt.Fprintf(&b, "%s:%d: %s\n", l.From, l.Line, l.Context)
+	}
+	if out.Total > len(out.Backlinks) {
+		fmt.Fprintf(&b, "... (%d more)\n", out.Total-len(out.Backlinks))
+	}
+	if out.Total == 0 {
+		b.WriteString("no backlinks")
+	}
+	return textResult(strings.TrimRight(b.String(), "\n"), out), nil
+}
+
+func (x *Index) outgoingTool(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	var in noteRefInput
+	if err := decodeArgs(args, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	p, err := x.lookupNote(in.Path)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	links := x.Outgoing(p)
+	if links == nil {
+		links = []Link{}
+	}
+
+	var b strings.Builder
+	for _, l := range links {
+		target := l.Resolved
+		if target == "" {
+			target = l.Target + " (unresolved)"
+		}
+		fmt.Fprintf(&b, "L%d -> %s\n", l.Line, target)
+	}
+	if len(links) == 0 {
+		b.WriteString("no links")
+	}
+	return textResult(strings.TrimRight(b.String(), "\n"), outgoingOutput{Path: p, Links: links}), nil
+}
+
+func (x *Index) unresolvedTool(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	var in unresolvedInput
+	if err := decodeArgs(args, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	from := ""
+	if in.Path != "" {
+		p, err := x.lookupNote(in.Path)
+		if err != nil {
+			return mcp.ToolCallResult{}, err
+		}
+		from = p
+	}
+	if in.Limit <= 0 {
+		in.Limit = defaultGraphLimit
+	}
+	targets := x.UnresolvedTargets(from)
+	out := unresolvedOutput{Targets: targets, Total: len(targets)}
+	if len(targets) > in.Limit {
+		out.Targets = targets[:in.Limit]
+	}
+	if out.Targets == nil {
+		out.Targets = []UnresolvedTarget{}
+	}
+
+	var b strings.Builder
+	for _, t := range out.Targets {
+		fmt.Fprintf(&b, "[[%s]] ×%d: %s\n", t.Target, t.Count, strings.Join(t.Sources, ", "))
+	}
+	if out.Total > len(out.Targets) {
+		fmt.Fprintf(&b, "... (%d more)\n", out.Total-len(out.Targets))
+	}
+	if out.Total == 0 {
+		b.WriteString("no unresolved links")
+	}
+	return textResult(strings.TrimRight(b.String(), "\n"), out), nil
+}
+
+func (x *Index) orphansTool(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	var in orphansInput
+	if err := decodeArgs(args, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	if in.Limit <= 0 {
+		in.Limit = defaultGraphLimit
+	}
+	orphans := x.Orphans(in.Folder)
+	out := orphansOutput{Orphans: orphans, Total: len(orphans)}
+	if len(orphans) > in.Limit {
+		out.Orphans = orphans[:in.Limit]
+	}
+	if out.Orphans == nil {
+		out.Orphans = []string{}
+	}
+
+	text := strings.Join(out.Orphans, "\n")
+	if out.Total > len(out.Orphans) {
+		text += fmt.Sprintf("\n... (%d more)", out.Total-len(out.Orphans))
+	}
+	if out.Total == 0 {
+		text = "no orphan notes"
+	}
+	return textResult(text, out), nil
+}
+
+func (x *Index) neighborhoodTool(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	var in neighborhoodInput
+	if err := decodeArgs(args, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	p, err := x.lookupNote(in.Path)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	if in.Limit <= 0 {
+		in.Limit = defaultGraphLimit
+	}
+	nb, ok := x.Neighbors(p, in.Depth, in.Direction, in.Limit)
+	if !ok {
+		return mcp.ToolCallResult{}, fmt.Errorf("note not found: %s", in.Path)
+	}
+
+	var b strings.Builder
+	for _, n := range nb.Nodes[1:] {
+		fmt.Fprintf(&b, "%d hop(s): %s (in %d, out %d)\n", n.Hops, n.Path, n.In, n.Out)
+	}
+	if nb.Truncated {
+		b.WriteString("... (truncated)\n")
+	}
+	if len(nb.Nodes) == 1 {
+		b.WriteString("no linked notes")
+	}
+	return textResult(strings.TrimRight(b.String(), "\n"), nb), nil
+}
@@ -0,0 +1,350 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/obsidian-agent/internal/vault"
+	"github.com/obsidian-agent/pkg/logger"
+)
+
+const (
+	// DefaultDebounce 是文件变化后等待静默的时间；Obsidian 编辑时每隔一两秒就会保存一次
+	DefaultDebounce = 500 * time.Millisecond
+	// maxDebounceWait 限制持续写入时的最长等待，避免索引长期得不到更新
+	maxDebounceWait = 5 * time.Second
+	// DefaultSaveDelay 是索引变化后写回快照前的等待时间
+	DefaultSaveDelay = 10 * time.Second
+)
+
+// EventType 是索引变化的类型
+type EventType string
+
+const (
+	EventCreated EventType = "created"
+	EventUpdated EventType = "updated"
+	EventDeleted EventType = "deleted"
+	EventRenamed EventType = "renamed"
+)
+
+// Event 描述一次索引变化
+type Event struct {
+	Type    EventType `json:"type"`
+	Path    string    `json:"path"`
+	OldPath string    `json:"oldPath,omitempty"` // renamed 时的原路径
+}
+
+// Watcher 监听仓库目录（Linux 下基于 inotify），去抖后增量更新索引，并把变化通知给订阅者
+type Watcher struct {
+	index *Index
+
+	debounce     time.Duration
+	saveDelay    time.Duration
+	snapshotFile string
+	logger       *logger.Logger
+
+	mu       sync.Mutex
+	handlers []func([]Event)
+
+	fsw  *fsnotify.Watcher
+	done chan struct{}
+}
+
+// NewWatcher 为索引创建监听器，调用 Start 后生效
+func NewWatcher(x *Index) *Watcher {
+	return &Watcher{
+		index:     x,
+		debounce:  DefaultDebounce,
+		saveDelay: DefaultSaveDelay,
+		done:      make(chan struct{}),
+	}
+}
+
+// SetDebounce 设置去抖时间，需在 Start 之前调用
+func (w *Watcher) SetDebounce(d time.Duration) {
+	if d > 0 {
+		w.debounce = d
+	}
+}
+
+// SetSnapshot 设置索引快照文件，索引变化后会延迟写回；需在 Start 之前调用
+func (w *Watcher) SetSnapshot(file string, delay time.Duration) {
+	w.snapshotFile = file
+	if delay > 0 {
+		w.saveDelay = delay
+	}
+}
+
+// SetLogger 设置日志输出，未设置时不记录日志
+func (w *Watcher) SetLogger(l *logger.Logger) { w.logger = l }
+
+// OnEvents 订阅索引变化，同一次去抖窗口内的变化合并为一批回调
+func (w *Watcher) OnEvents(fn func([]Event)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers = append(w.handlers, fn)
+}
+
+// Done 在监听结束后关闭
+func (w *Watcher) Done() <-chan struct{} { return w.done }
+
+// Start 开始监听，ctx 取消后停止并写回快照。
+// 监听建立后会先与磁盘对账一次，补上建立监听之前（如启动对账期间）保存的笔记，这些变化同样经 OnEvents 通知。
+func (w *Watcher) Start(ctx context.Context) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	w.fsw = fsw
+	if err := w.watchTree(w.index.vault.Root()); err != nil {
+		fsw.Close()
+		return err
+	}
+	go w.loop(ctx)
+	return nil
+}
+
+// watchTree 递归监听目录及其子目录，跳过 .obsidian 等隐藏目录
+func (w *Watcher) watchTree(root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if err := w.fsw.Add(p); err != nil {
+			w.logf("watch %s: %v", p, err)
+		}
+		return nil
+	})
+}
+
+func (w *Watcher) loop(ctx context.Context) {
+	defer close(w.done)
+	defer w.fsw.Close()
+
+	pending := make(map[string]bool)
+	var first time.Time
+	flush := time.NewTimer(time.Hour)
+	flush.Stop()
+	save := time.NewTimer(time.Hour)
+	save.Stop()
+	dirty := false
+
+	// 监听建立之前发生的变化不会产生事件，先对账一次；期间到达的事件留在队列中稍后处理
+	if _, events, err := w.index.Reconcile(ctx); err != nil {
+		w.logf("reconcile: %v", err)
+	} else if len(events) > 0 {
+		w.emit(events)
+		if w.snapshotFile != "" {
+			dirty = true
+			save.Reset(w.saveDelay)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if dirty {
+				w.save()
+			}
+			return
+
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			rel, ok := w.relPath(ev.Name)
+			if !ok {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					_ = w.watchTree(ev.Name)
+				}
+			}
+			if len(pending) == 0 {
+				first = time.Now()
+			}
+			pending[rel] = true
+			wait := w.debounce
+			if rest := maxDebounceWait - time.Since(first); rest < wait {
+				wait = max(rest, 0)
+			}
+			flush.Reset(wait)
+
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// 事件队列溢出，已无法知道丢了哪些变化，退化为一次全量对账
+				w.logf("watcher overflow, reconciling vault")
+				_, events, err := w.index.Reconcile(ctx)
+				if err != nil {
+					w.logf("reconcile: %v", err)
+				}
+				if len(events) > 0 {
+					w.emit(events)
+					dirty = true
+					save.Reset(w.saveDelay)
+				}
+				continue
+			}
+			w.logf("watcher error: %v", err)
+
+		case <-flush.C:
+			paths := make([]string, 0, len(pending))
+			for p := range pending {
+				paths = append(paths, p)
+			}
+			pending = make(map[string]bool)
+			if events := w.apply(paths); len(events) > 0 {
+				w.emit(events)
+				if w.snapshotFile != "" {
+					dirty = true
+					save.Reset(w.saveDelay)
+				}
+			}
+
+		case <-save.C:
+			if dirty {
+				w.save()
+				dirty = false
+			}
+		}
+	}
+}
+
+// relPath 把事件中的绝对路径转换为仓库相对路径；隐藏路径（含本程序写入的临时文件）被忽略
+func (w *Watcher) relPath(abs string) (string, bool) {
+	rel := w.index.vault.Rel(abs)
+	if rel == "." || rel == "" || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	for _, seg := range strings.Split(rel, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return "", false
+		}
+	}
+	return rel, true
+}
+
+// apply 根据发生变化的路径更新索引，并把“删除 + 新建且内容相同”的组合识别为重命名
+func (w *Watcher) apply(paths []string) []Event {
+	sort.Strings(paths)
+	var events []Event
+	deleted := make(map[string]string) // hash → 被删除的路径
+
+	update := func(rel string) {
+		before, existed := w.index.Note(rel)
+		n, err := w.index.Update(rel)
+		if err != nil {
+			w.logf("index %s: %v", rel, err)
+			return
+		}
+		switch {
+		case n == nil && existed:
+			deleted[before.Hash] = rel
+			events = append(events, Event{Type: EventDeleted, Path: rel})
+		case n != nil && !existed:
+			events = append(events, Event{Type: EventCreated, Path: n.Path})
+		case n != nil && before.Hash != n.Hash:
+			events = append(events, Event{Type: EventUpdated, Path: n.Path})
+		}
+	}
+
+	for _, rel := range paths {
+		abs, err := w.index.vault.Resolve(rel)
+		if err != nil {
+			continue
+		}
+		info, statErr := os.Stat(abs)
+		switch {
+		case statErr == nil && info.IsDir():
+			// 新建或移入的目录：索引其中的全部笔记
+			_ = w.index.vault.WalkNotes(rel, func(ni vault.NoteInfo) error {
+				update(ni.Path)
+				return nil
+			})
+		case strings.EqualFold(filepath.Ext(rel), vault.NoteExt):
+			update(rel)
+		case statErr != nil:
+			// 不存在且不是笔记：可能是被删除或移出的目录
+			for _, n := range w.index.removePrefix(rel) {
+				deleted[n.Hash] = n.Path
+				events = append(events, Event{Type: EventDeleted, Path: n.Path})
+			}
+		}
+	}
+	return pairRenames(events, deleted, w.index)
+}
+
+// pairRenames 把内容哈希相同的 deleted/created 事件合并为 renamed
+func pairRenames(events []Event, deleted map[string]string, x *Index) []Event {
+	if len(deleted) == 0 {
+		return events
+	}
+	renamedFrom := make(map[string]bool)
+	out := make([]Event, 0, len(events))
+	for _, e := range events {
+		if e.Type == EventCreated {
+			if n, ok := x.Note(e.Path); ok {
+				if old, ok := deleted[n.Hash]; ok && !renamedFrom[old] {
+					renamedFrom[old] = true
+					out = append(out, Event{Type: EventRenamed, Path: e.Path, OldPath: old})
+					continue
+				}
+			}
+		}
+		out = append(out, e)
+	}
+	filtered := out[:0]
+	for _, e := range out {
+		if e.Type == EventDeleted && renamedFrom[e.Path] {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered
+}
+
+func (w *Watcher) emit(events []Event) {
+	w.mu.Lock()
+	handlers := make([]func([]Event), len(w.handlers))
+	copy(handlers, w.handlers)
+	w.mu.Unlock()
+	for _, fn := range handlers {
+		fn(events)
+	}
+}
+
+func (w *Watcher) save() {
+	if w.snapshotFile == "" {
+		return
+	}
+	if err := w.index.Save(w.snapshotFile); err != nil {
+		w.logf("save index snapshot: %v", err)
+	}
+}
+
+func (w *Watcher) logf(format string, args ...any) {
+	if w.logger != nil {
+		w.logger.Warn(format, args...)
+	}
+}
@@ -0,0 +1,358 @@
+// Package journal 记录 agent 对笔记的每一次改动（哪次运行、哪个工具调用、改动前后的哈希和 diff），
+// 并支持按运行撤销：只要笔记在此之后没有被再次修改，就从备份恢复改动前的版本。
+package journal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/obsidian-agent/internal/edit"
+	"github.com/obsidian-agent/internal/vault"
+)
+
+// maxDiffBytes 是单条记录保存的 diff 上限，超出部分截断；撤销依赖备份而不是 diff
+const maxDiffBytes = 64 << 10
+
+// 记录类型
+const (
+	KindEdit = "edit" // 一次笔记改动
+	KindUndo = "undo" // 撤销了 RunID 对应运行的全部改动
+)
+
+var (
+	// ErrRunNotFound 表示日志中没有该运行的改动
+	ErrRunNotFound = errors.New("no recorded changes for this run")
+	// ErrAlreadyUndone 表示该运行已经撤销过
+	ErrAlreadyUndone = errors.New("run has already been undone")
+)
+
+// DivergedError 表示运行改动过的笔记之后又被修改，撤销会丢失这些修改
+type DivergedError struct {
+	RunID string
+	Paths []string
+}
+
+func (e *DivergedError) Error() string {
+	return fmt.Sprintf("cannot undo %s: %d note(s) changed afterwards: %v", e.RunID, len(e.Paths), e.Paths)
+}
+
+// PartialUndoError 表示撤销中途失败，且已恢复的笔记未能全部回滚，Restored 中的笔记停留在运行之前的版本
+type PartialUndoError struct {
+	RunID    string
+	Restored []string
+	Err      error
+}
+
+func (e *PartialUndoError) Error() string {
+	return fmt.Sprintf("undo %s partially applied, %d note(s) left restored %v: %v", e.RunID, len(e.Restored), e.Restored, e.Err)
+}
+
+func (e *PartialUndoError) Unwrap() error { return e.Err }
+
+// Call 标识一次工具调用，由编排器放进工具调用的 context
+type Call struct {
+	RunID  string
+	Tool   string
+	CallID string
+}
+
+type callKey struct{}
+
+// WithCall 返回携带工具调用信息的 context，经由它发生的笔记改动会被记入日志
+func WithCall(ctx context.Context, c Call) context.Context {
+	return context.WithValue(ctx, callKey{}, c)
+}
+
+// CallFrom 取出 context 中的工具调用信息
+func CallFrom(ctx context.Context) (Call, bool) {
+	c, ok := ctx.Value(callKey{}).(Call)
+	return c, ok
+}
+
+// Entry 是日志中的一条记录
+type Entry struct {
+	Kind       string    `json:"kind"`
+	Time       time.Time `json:"time"`
+	RunID      string    `json:"runId"`
+	Tool       string    `json:"tool,omitempty"`
+	CallID     string    `json:"callId,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Created    bool      `json:"created,omitempty"`
+	Deleted    bool      `json:"deleted,omitempty"`
+	BeforeHash string    `json:"beforeHash,omitempty"`
+	AfterHash  string    `json:"afterHash,omitempty"`
+	Diff       string    `json:"diff,omitempty"`
+}
+
+// Run 汇总一次运行对笔记的全部改动
+type Run struct {
+	RunID    string     `json:"runId"`
+	Time     time.Time  `json:"time"` // 第一次改动的时间
+	Changes  []Entry    `json:"changes"`
+	UndoneAt *time.Time `json:"undoneAt,omitempty"`
+}
+
+// Paths 返回运行改动过的笔记，按首次改动的顺序排列
+func (r *Run) Paths() []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, c := range r.Changes {
+		if !seen[c.Path] {
+			seen[c.Path] = true
+			out = append(out, c.Path)
+		}
+	}
+	return out
+}
+
+// Journal 是追加写入的 JSONL 日志
+type Journal struct {
+	vault *vault.Vault
+	file  string
+
+	mu   sync.Mutex
+	runs map[string]*Run
+}
+
+// Open 打开（或创建）日志文件并加载已有记录
+func Open(file string, v *vault.Vault) (*Journal, error) {
+	j := &Journal{vault: v, file: file, runs: make(map[string]*Run)}
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64<<10), 4*maxDiffBytes)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue // 写到一半的最后一行
+		}
+		j.apply(e)
+	}
+	return j, sc.Err()
+}
+
+// apply 把一条记录合并进内存中的运行汇总
+func (j *Journal) apply(e Entry) {
+	r := j.runs[e.RunID]
+	switch e.Kind {
+	case KindEdit:
+		if r == nil {
+			r = &Run{RunID: e.RunID, Time: e.Time}
+			j.runs[e.RunID] = r
+		}
+		r.Changes = append(r.Changes, e)
+	case KindUndo:
+		if r != nil {
+			t := e.Time
+			r.UndoneAt = &t
+		}
+	}
+}
+
+// append 把记录写入文件并合并进内存，调用方需持有 j.mu
+func (j *Journal) append(e Entry) error {
+	if err := os.MkdirAll(filepath.Dir(j.file), 0o755); err != nil {
+		return err
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	j.apply(e)
+	return nil
+}
+
+// Record 记录一次笔记改动，只记录 context 中带有工具调用信息（即由 agent 发起）的改动。
+// 可直接用作 vault.CommitHook。
+func (j *Journal) Record(ctx context.Context, res vault.PatchResult) error {
+	call, ok := CallFrom(ctx)
+	if !ok {
+		return nil
+	}
+	diff := edit.TruncateDiff(res.Diff, maxDiffBytes)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.append(Entry{
+		Kind:       KindEdit,
+		Time:       time.Now(),
+		RunID:      call.RunID,
+		Tool:       call.Tool,
+		CallID:     call.CallID,
+		Path:       res.Path,
+		Created:    res.Created,
+		Deleted:    res.Deleted,
+		BeforeHash: res.BeforeHash,
+		AfterHash:  res.AfterHash,
+		Diff:       diff,
+	})
+}
+
+// History 返回最近的运行，新的在前；limit <= 0 时返回全部
+func (j *Journal) History(limit int) []Run {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make([]Run, 0, len(j.runs))
+	for _, r := range j.runs {
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Time.After(out[b].Time) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// Run 返回某次运行的改动
+func (j *Journal) Run(runID string) (Run, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	r, ok := j.runs[runID]
+	if !ok {
+		return Run{}, false
+	}
+	return *r, true
+}
+
+// Undo 撤销一次运行对笔记的全部改动：先确认每篇笔记都仍是该运行最后写入的版本，
+// 有任何一篇之后被修改过就整体放弃并返回 DivergedError；然后从备份恢复改动前的版本，
+// 运行中新建的笔记会被删除。撤销本身也会备份当前版本。
+func (j *Journal) Undo(ctx context.Context, runID string) (Run, error) {
+	// 撤销产生的写入不再记为新的改动（否则会在持有锁时回调 Record）
+	ctx = context.WithValue(ctx, callKey{}, nil)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	r, ok := j.runs[runID]
+	if !ok {
+		return Run{}, ErrRunNotFound
+	}
+	if r.UndoneAt != nil {
+		return Run{}, ErrAlreadyUndone
+	}
+
+	// 每篇笔记取运行中的第一次和最后一次改动
+	type span struct{ first, last Entry }
+	spans := make(map[string]*span)
+	for _, c := range r.Changes {
+		if s, ok := spans[c.Path]; ok {
+			s.last = c
+		} else {
+			spans[c.Path] = &span{first: c, last: c}
+		}
+	}
+	paths := r.Paths()
+
+	current := make(map[string]string)
+	var diverged []string
+	for _, p := range paths {
+		content, _, err := j.vault.ReadNote(p)
+		switch {
+		case spans[p].last.Deleted:
+			if err == nil {
+				diverged = append(diverged, p)
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return Run{}, err
+			}
+		case err != nil:
+			if !errors.Is(err, fs.ErrNotExist) {
+				return Run{}, err
+			}
+			diverged = append(diverged, p)
+		case edit.Hash(content) != spans[p].last.AfterHash:
+			diverged = append(diverged, p)
+		default:
+			current[p] = content
+		}
+	}
+	if len(diverged) > 0 {
+		return Run{}, &DivergedError{RunID: runID, Paths: diverged}
+	}
+
+	// 先取出全部需要恢复的旧版本，避免恢复到一半才发现备份缺失
+	originals := make(map[string]string)
+	for _, p := range paths {
+		if first := spans[p].first; !first.Created {
+			content, err := j.vault.Backup(first.BeforeHash)
+			if err != nil {
+				return Run{}, fmt.Errorf("undo %s: backup of %s is unavailable: %w", runID, p, err)
+			}
+			originals[p] = content
+		}
+	}
+	var restored []string
+	for _, p := range paths {
+		_, exists := current[p]
+		var err error
+		if spans[p].first.Created {
+			if exists {
+				_, err = j.vault.DeleteNote(ctx, p, current[p])
+			}
+		} else {
+			_, err = j.vault.Commit(ctx, p, current[p], exists, originals[p])
+		}
+		if err != nil {
+			err = fmt.Errorf("undo %s: restore %s: %w", runID, p, err)
+			// 已恢复的笔记改回运行后的版本，撤销要么全部生效要么不生效
+			if left := j.rollback(ctx, restored, current, originals); len(left) > 0 {
+				return Run{}, &PartialUndoError{RunID: runID, Restored: left, Err: err}
+			}
+			return Run{}, err
+		}
+		restored = append(restored, p)
+	}
+	if err := j.append(Entry{Kind: KindUndo, Time: time.Now(), RunID: runID}); err != nil {
+		return Run{}, err
+	}
+	return *r, nil
+}
+
+// rollback 把撤销中已恢复的笔记改回运行后的版本 current（不在 current 中的表示运行后不存在），
+// originals 是恢复成的版本（不在其中的表示恢复时被删除）。返回未能改回的笔记
+func (j *Journal) rollback(ctx context.Context, restored []string, current, originals map[string]string) []string {
+	var left []string
+	for i := len(restored) - 1; i >= 0; i-- {
+		p := restored[i]
+		after, existed := current[p]
+		before, restoredExists := originals[p]
+		var err error
+		switch {
+		case !restoredExists && !existed:
+			continue
+		case !restoredExists:
+			_, err = j.vault.Commit(ctx, p, "", false, after)
+		case !existed:
+			_, err = j.vault.DeleteNote(ctx, p, before)
+		default:
+			_, err = j.vault.Commit(ctx, p, before, true, after)
+		}
+		if err != nil {
+			left = append(left, p)
+		}
+	}
+	return left
+}
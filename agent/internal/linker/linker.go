@@ -0,0 +1,415 @@
+// Package linker 在笔记正文中查找提到其他笔记标题或别名、但尚未加链接的地方，
+// 结合链接图和语义相似度排序，以编辑操作的形式给出 [[wikilink]] 建议。
+package linker
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/obsidian-agent/internal/edit"
+	"github.com/obsidian-agent/internal/indexer"
+	"github.com/obsidian-agent/internal/retrieval"
+	"github.com/obsidian-agent/internal/textutil"
+	"github.com/obsidian-agent/internal/vault"
+)
+
+const (
+	DefaultLimit = 20
+	minWordLen   = 3 // 不含 CJK 的名称至少 3 个字符，避免 "Go"、"AI" 之类到处命中
+	minCJKLen    = 2 // 含 CJK 的名称至少 2 个字符
+)
+
+// 匹配方式
+const (
+	MatchTitle = "title"
+	MatchAlias = "alias"
+)
+
+// 不参与匹配的行内片段：行内代码、已有链接、URL 和标签
+var (
+	inlineCodeRe = regexp.MustCompile("`+[^`\n]*`+")
+	wikiLinkRe   = regexp.MustCompile(`!?\[\[[^\[\]\n]+?\]\]`)
+	mdLinkRe     = regexp.MustCompile(`!?\[[^\[\]\n]*\]\([^()\s]+(?:\s+"[^"]*")?\)`)
+	urlRe        = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.\-]*://\S+`)
+	tagRe        = regexp.MustCompile(`#[\p{L}\p{N}_/\-]+`)
+)
+
+// Suggestion 是一条链接建议：把 Line 行的 Text 替换为 Link
+type Suggestion struct {
+	Target     string  `json:"target"` // 目标笔记路径
+	Title      string  `json:"title"`
+	Text       string  `json:"text"` // 正文中被提到的原文
+	Link       string  `json:"link"` // 替换成的 [[...]]
+	Line       int     `json:"line"` // 从 1 开始
+	Match      string  `json:"match"`
+	Score      float64 `json:"score"`
+	Hops       int     `json:"hops,omitempty"`       // 链接图中与当前笔记的距离（2 跳以内），0 表示不相邻
+	Backlinks  int     `json:"backlinks"`            // 目标笔记被多少篇笔记链接
+	Similarity float64 `json:"similarity,omitempty"` // 与当前笔记的语义相似度，没有向量索引时为 0
+	Op         edit.Op `json:"op"`
+}
+
+// Result 是一篇笔记的链接建议，Ops 可直接交给 apply_edits
+type Result struct {
+	Path        string       `json:"path"`
+	BaseHash    string       `json:"baseHash"`
+	Suggestions []Suggestion `json:"suggestions"`
+	Total       int          `json:"total"`
+	Diff        string       `json:"diff,omitempty"` // 应用全部建议后的 diff 预览
+}
+
+// Options 控制建议的数量和门槛
+type Options struct {
+	Limit    int     // 最多返回的建议数，<= 0 时使用 DefaultLimit
+	MinScore float64 // 低于该得分的建议被丢弃
+}
+
+// Suggester 基于笔记索引生成链接建议
+type Suggester struct {
+	index   *indexer.Index
+	vectors *retrieval.VectorIndex // 可为 nil，此时不计算语义相似度
+}
+
+// New 创建链接建议器；vectors 为 nil 时只用标题匹配和链接图排序
+func New(x *indexer.Index, vectors *retrieval.VectorIndex) *Suggester {
+	return &Suggester{index: x, vectors: vectors}
+}
+
+// name 是可以被提及的一个笔记名称（标题或别名）
+type name struct {
+	runes  []rune // 归一化后的字符
+	target string
+	title  string
+	match  string
+}
+
+// mention 是正文中一处可能的提及，names 为与之匹配的全部候选（同名笔记可能有多篇）
+type mention struct {
+	start, end int // 在全文中的字节偏移
+	line       int // 从 0 开始
+	names      []*name
+}
+
+// Suggest 为笔记 rel 生成链接建议。每篇目标笔记只在第一次被提到的地方建议链接，
+// 当前笔记已经链接过的目标、笔记自身、代码块和标题行中的文本都会被跳过。
+func (s *Suggester) Suggest(rel string, opts Options) (Result, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultLimit
+	}
+	note, ok := s.index.Note(rel)
+	if !ok {
+		return Result{}, fmt.Errorf("note not found: %s", rel)
+	}
+	content, _, err := s.index.Vault().ReadNote(note.Path)
+	if err != nil {
+		return Result{}, err
+	}
+	res := Result{Path: note.Path, BaseHash: edit.Hash(content), Suggestions: []Suggestion{}}
+
+	linked := map[string]bool{note.Path: true}
+	for _, l := range note.Links {
+		if l.Resolved != "" {
+			linked[l.Resolved] = true
+		}
+	}
+	dict := s.dictionary(linked)
+	mentions := findMentions(content, dict)
+	if len(mentions) == 0 {
+		return res, nil
+	}
+
+	// 为每个候选目标打分
+	var targets []string
+	seen := make(map[string]bool)
+	for _, m := range mentions {
+		for _, n := range m.names {
+			if !seen[n.target] {
+				seen[n.target] = true
+				targets = append(targets, n.target)
+			}
+		}
+	}
+	hops := make(map[string]int)
+	if nb, ok := s.index.Neighbors(note.Path, 2, indexer.DirectionBoth, 0); ok {
+		for _, n := range nb.Nodes {
+			hops[n.Path] = n.Hops
+		}
+	}
+	backlinks := make(map[string]int, len(targets))
+	maxIn := 0
+	for _, t := range targets {
+		backlinks[t] = distinctSources(s.index.Backlinks(t))
+		maxIn = max(maxIn, backlinks[t])
+	}
+	var sim map[string]float64
+	if s.vectors != nil {
+		sim = s.vectors.NoteSimilarity(note.Path, targets)
+	}
+	score := func(n *name) Suggestion {
+		sg := Suggestion{Target: n.target, Title: n.title, Match: n.match, Hops: hops[n.target], Backlinks: backlinks[n.target]}
+		match := 1.0
+		if n.match == MatchAlias {
+			match = 0.8
+		}
+		graph := 0.0
+		if sg.Hops > 0 {
+			graph += 0.6 / float64(sg.Hops)
+		}
+		if maxIn > 0 {
+			graph += 0.4 * math.Log1p(float64(sg.Backlinks)) / math.Log1p(float64(maxIn))
+		}
+		if v, ok := sim[n.target]; ok {
+			sg.Similarity = math.Round(max(0, v)*1000) / 1000
+			sg.Score = 0.4*match + 0.3*graph + 0.3*sg.Similarity
+		} else {
+			sg.Score = 0.5*match + 0.5*graph
+		}
+		sg.Score = math.Round(sg.Score*1000) / 1000
+		return sg
+	}
+
+	// 按出现顺序为每处提及选得分最高、且尚未被建议过的目标
+	taken := make(map[string]bool)
+	var all []Suggestion
+	for _, m := range mentions {
+		best, found := Suggestion{}, false
+		for _, n := range m.names {
+			if taken[n.target] {
+				continue
+			}
+			if sg := score(n); !found || sg.Score > best.Score {
+				best, found = sg, true
+			}
+		}
+		if !found || best.Score < opts.MinScore {
+			continue
+		}
+		taken[best.Target] = true
+		best.Text = content[m.start:m.end]
+		best.Line = m.line + 1
+		best.Link = s.linkText(best.Target, best.Title, best.Text, note.Path)
+		op, err := edit.NewReplace(note.Path, content, edit.PosAt(content, m.start), edit.PosAt(content, m.end))
+		if err != nil {
+			return Result{}, err
+		}
+		op.Text = best.Link
+		best.Op = op
+		all = append(all, best)
+	}
+
+	// 按得分取前 Limit 条，再恢复正文中的顺序
+	res.Total = len(all)
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Score > all[j].Score })
+	if len(all) > opts.Limit {
+		all = all[:opts.Limit]
+	}
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i].Op.From, all[j].Op.From
+		return a.Line < b.Line || a.Line == b.Line && a.Ch < b.Ch
+	})
+	ops := make([]edit.Op, len(all))
+	for i := range all {
+		all[i].Op.ID = fmt.Sprintf("link#%d", i+1)
+		ops[i] = all[i].Op
+	}
+	res.Suggestions = append(res.Suggestions, all...)
+	if len(ops) > 0 {
+		if updated, err := edit.Apply(content, ops); err == nil {
+			res.Diff = edit.UnifiedDiff(note.Path, content, updated)
+		}
+	}
+	return res, nil
+}
+
+// dictionary 收集全部笔记的标题和别名，按归一化后的首字符分组，组内长的在前（最长匹配优先）
+func (s *Suggester) dictionary(skip map[string]bool) map[rune][]*name {
+	dict := make(map[rune][]*name)
+	add := func(text, target, title, match string) {
+		runes := normalize(strings.TrimSpace(text))
+		if !mentionable(runes) {
+			return
+		}
+		for _, n := range dict[runes[0]] {
+			if n.target == target && string(n.runes) == string(runes) {
+				return // 别名与标题相同
+			}
+		}
+		dict[runes[0]] = append(dict[runes[0]], &name{runes: runes, target: target, title: title, match: match})
+	}
+	for _, n := range s.index.Notes() {
+		if skip[n.Path] {
+			continue
+		}
+		add(n.Title, n.Path, n.Title, MatchTitle)
+		for _, a := range n.Aliases {
+			add(a, n.Path, n.Title, MatchAlias)
+		}
+	}
+	for r := range dict {
+		sort.SliceStable(dict[r], func(i, j int) bool { return len(dict[r][i].runes) > len(dict[r][j].runes) })
+	}
+	return dict
+}
+
+// linkText 生成链接：提及的原文本身就能解析到目标时直接用 [[原文]]，否则用 [[目标|原文]]；
+// 目标标题与其他笔记重名时用不含扩展名的路径
+func (s *Suggester) linkText(target, title, text, from string) string {
+	if p, ok := s.index.Resolve(text, from); ok && p == target && !strings.ContainsAny(text, "|#^[]") {
+		return "[[" + text + "]]"
+	}
+	ref := title
+	if p, ok := s.index.Resolve(title, from); !ok || p != target {
+		ref = strings.TrimSuffix(target, ".md")
+	}
+	return "[[" + ref + "|" + text + "]]"
+}
+
+// findMentions 逐行扫描正文（跳过 frontmatter、代码块和标题行），返回互不重叠的提及，
+// 每个位置取最长的匹配
+func findMentions(content string, dict map[rune][]*name) []mention {
+	_, _, bodyLine := vault.SplitFrontmatter(content)
+	var out []mention
+	inFence := ""
+	off := 0
+	for i, line := range strings.Split(content, "\n") {
+		lineStart := off
+		off += len(line) + 1
+		if i < bodyLine-1 {
+			continue
+		}
+		line = strings.TrimRight(line, "\r")
+		if vault.IsFence(line) {
+			marker := strings.TrimSpace(line)[:3]
+			switch {
+			case inFence == "":
+				inFence = marker
+			case marker == inFence:
+				inFence = ""
+			}
+			continue
+		}
+		if inFence != "" {
+			continue
+		}
+		if level, _ := vault.ParseHeading(line); level > 0 {
+			continue
+		}
+		for _, m := range matchLine(line, dict) {
+			m.start += lineStart
+			m.end += lineStart
+			m.line = i
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// matchLine 在一行中查找提及，返回的偏移相对于行首
+func matchLine(line string, dict map[rune][]*name) []mention {
+	masked := make([]bool, len(line))
+	for _, re := range []*regexp.Regexp{inlineCodeRe, wikiLinkRe, mdLinkRe, urlRe, tagRe} {
+		for _, loc := range re.FindAllStringIndex(line, -1) {
+			for k := loc[0]; k < loc[1]; k++ {
+				masked[k] = true
+			}
+		}
+	}
+
+	var raw []rune
+	var offs []int // 每个字符的字节偏移，末尾追加 len(line)
+	for k, r := range line {
+		raw = append(raw, r)
+		offs = append(offs, k)
+	}
+	offs = append(offs, len(line))
+	norm := normalize(line)
+
+	var out []mention
+	for i := 0; i < len(norm); {
+		var hit []*name
+		size := 0
+		if !masked[offs[i]] && (i == 0 || !joins(raw[i-1], raw[i])) {
+			for _, n := range dict[norm[i]] {
+				if size > 0 && len(n.runes) < size {
+					break // 已有更长的匹配
+				}
+				if !matchAt(norm, raw, masked, offs, i, n.runes) {
+					continue
+				}
+				if size == 0 {
+					size = len(n.runes)
+				}
+				hit = append(hit, n)
+			}
+		}
+		if size == 0 {
+			i++
+			continue
+		}
+		out = append(out, mention{start: offs[i], end: offs[i+size], names: hit})
+		i += size
+	}
+	return out
+}
+
+// matchAt 判断 name 是否在第 i 个字符处完整出现：不跨越屏蔽区，且英文单词不被截断
+func matchAt(norm, raw []rune, masked []bool, offs []int, i int, name []rune) bool {
+	end := i + len(name)
+	if end > len(norm) {
+		return false
+	}
+	for k, r := range name {
+		if norm[i+k] != r || masked[offs[i+k]] {
+			return false
+		}
+	}
+	return end == len(raw) || !joins(raw[end-1], raw[end])
+}
+
+// joins 判断两个相邻字符是否属于同一个英文单词（此时不能从中间断开）；CJK 文字之间没有词边界
+func joins(a, b rune) bool {
+	return textutil.IsWordRune(a) && textutil.IsWordRune(b)
+}
+
+// normalize 逐字符归一化：全角转半角、转小写。字符数保持不变，便于映射回原文位置
+func normalize(s string) []rune {
+	out := make([]rune, 0, utf8.RuneCountInString(s))
+	for _, r := range s {
+		out = append(out, unicode.ToLower(textutil.FoldWidth(r)))
+	}
+	return out
+}
+
+// mentionable 判断名称是否足够具体，值得在正文中匹配：太短或不含任何文字的名称（如日期）不参与
+func mentionable(runes []rune) bool {
+	letters, cjk := 0, false
+	for _, r := range runes {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+		if textutil.IsCJK(r) {
+			cjk = true
+		}
+	}
+	if letters == 0 {
+		return false
+	}
+	if cjk {
+		return len(runes) >= minCJKLen
+	}
+	return len(runes) >= minWordLen
+}
+
+// distinctSources 统计反链来自多少篇不同的笔记
+func distinctSources(edges []indexer.Edge) int {
+	seen := make(map[string]bool, len(edges))
+	for _, e := range edges {
+		seen[e.From] = true
+	}
+	return len(seen)
+}
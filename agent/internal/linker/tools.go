@@ -0,0 +1,98 @@
+package linker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/obsidian-agent/pkg/mcp"
+)
+
+type suggestInput struct {
+	Path     string  `json:"path"`
+	Limit    int     `json:"limit"`
+	MinScore float64 `json:"minScore"`
+}
+
+const (
+	suggestLinksInput = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string", "minLength": 1, "description": "笔记路径或链接名"},
+    "limit": {"type": "integer", "minimum": 1, "maximum": 100},
+    "minScore": {"type": "number", "minimum": 0, "maximum": 1, "description": "只返回得分不低于该值的建议"}
+  },
+  "required": ["path"],
+  "additionalProperties": false
+}`
+	suggestLinksOutput = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string"},
+    "baseHash": {"type": "string"},
+    "suggestions": {"type": "array", "items": {
+      "type": "object",
+      "properties": {
+        "target": {"type": "string"}, "title": {"type": "string"}, "text": {"type": "string"}, "link": {"type": "string"},
+        "line": {"type": "integer"}, "match": {"enum": ["title", "alias"]}, "score": {"type": "number"},
+        "hops": {"type": "integer"}, "backlinks": {"type": "integer"}, "similarity": {"type": "number"},
+        "op": {"type": "object"}
+      },
+      "required": ["target", "text", "link", "line", "score", "op"]
+    }},
+    "total": {"type": "integer"},
+    "diff": {"type": "string"}
+  },
+  "required": ["path", "baseHash", "suggestions", "total"]
+}`
+)
+
+// RegisterTools 注册 suggest_links 工具。工具本身只读，建议以编辑操作返回，
+// 确认后可原样交给 apply_edits 写入。
+func RegisterTools(srv *mcp.MCPServer, s *Suggester) error {
+	openWorld := false
+	return srv.RegisterTool(&mcp.ToolDef{
+		Name:  "suggest_links",
+		Title: "链接建议",
+		Description: "Find places in a note that mention other notes by title or alias but are not linked yet, ranked by link-graph proximity and semantic similarity. " +
+			"Returns [[wikilink]] insertions as edit ops; pass path, baseHash and the chosen ops to apply_edits to apply them.",
+		InputSchema:  json.RawMessage(suggestLinksInput),
+		OutputSchema: json.RawMessage(suggestLinksOutput),
+		Annotations:  &mcp.ToolAnnotations{ReadOnlyHint: true, OpenWorldHint: &openWorld},
+	}, s.suggestTool)
+}
+
+func (s *Suggester) suggestTool(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	var in suggestInput
+	if err := json.Unmarshal(raw, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	p, ok := s.index.Lookup(in.Path)
+	if !ok {
+		return mcp.ToolCallResult{}, fmt.Errorf("note not found: %s", in.Path)
+	}
+	res, err := s.Suggest(p, Options{Limit: in.Limit, MinScore: in.MinScore})
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+
+	var b strings.Builder
+	for _, sg := range res.Suggestions {
+		fmt.Fprintf(&b, "L%d: %q -> %s (%.3f)\n", sg.Line, sg.Text, sg.Link, sg.Score)
+	}
+	if res.Total > len(res.Suggestions) {
+		fmt.Fprintf(&b, "... (%d more)\n", res.Total-len(res.Suggestions))
+	}
+	if res.Total == 0 {
+		b.WriteString("no link suggestions")
+	}
+	return mcp.ToolCallResult{
+		Content:           []mcp.ContentPart{{Type: "text", Text: strings.TrimRight(b.String(), "\n")}},
+		StructuredContent: res,
+	}, nil
+}
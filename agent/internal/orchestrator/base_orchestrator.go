@@ -9,4 +9,8 @@ import (
 type Orchestrator interface {
 	Run(ctx context.Context, msg transport.MsgRequest, sender transport.Sender) error
 	Cancel(id string)
+	Confirm(msg transport.MsgRequest) error
+	ReviewPlan(msg transport.MsgRequest, sender transport.Sender) error
+	Undo(ctx context.Context, msg transport.MsgRequest, sender transport.Sender) error
+	History(msg transport.MsgRequest, sender transport.Sender) error
 }
\ No newline at end of file
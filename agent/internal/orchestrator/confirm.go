@@ -0,0 +1,102 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/obsidian-agent/biz/transport"
+)
+
+// confirmTimeout 是等待用户确认的最长时间，超时后中止本次运行
+const confirmTimeout = 2 * time.Minute
+
+// pendingConfirm 是一个等待用户答复的确认请求
+type pendingConfirm struct {
+	runID    string
+	decision chan bool
+}
+
+// newConfirmToken 生成一次性的确认 token
+func newConfirmToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// requestConfirmation 暂停运行并向前端发送 agent/confirm.request，
+// 等待用户通过 agent/confirm 答复；返回用户是否同意。
+// 超时或运行被取消时返回错误，调用方应中止本次运行。
+func (o *MsgOrchestrator) requestConfirmation(ctx context.Context, req transport.MsgRequest, sink transport.Sender, description string, detail map[string]any) (bool, error) {
+	token, err := newConfirmToken()
+	if err != nil {
+		return false, err
+	}
+	p := &pendingConfirm{runID: req.ID, decision: make(chan bool, 1)}
+	o.mu.Lock()
+	o.confirms[token] = p
+	o.mu.Unlock()
+	defer func() {
+		o.mu.Lock()
+		delete(o.confirms, token)
+		o.mu.Unlock()
+	}()
+
+	result := map[string]any{"timeoutSec": int(confirmTimeout / time.Second)}
+	for k, v := range detail {
+		result[k] = v
+	}
+	if err := sink.Send(transport.MsgResponse{
+		Type:         "agent/confirm.request",
+		ID:           req.ID,
+		Text:         description,
+		Result:       result,
+		ConfirmToken: token,
+	}); err != nil {
+		return false, err
+	}
+
+	timer := time.NewTimer(confirmTimeout)
+	defer timer.Stop()
+	select {
+	case ok := <-p.decision:
+		return ok, nil
+	case <-timer.C:
+		return false, &runError{code: transport.ErrCodeConfirmTimeout, err: fmt.Errorf("no confirmation within %s", confirmTimeout)}
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// Confirm 处理前端的 agent/confirm 答复：token 只能使用一次，且必须属于同一个运行
+func (o *MsgOrchestrator) Confirm(req transport.MsgRequest) error {
+	if req.ConfirmToken == "" {
+		return errors.New("missing confirm token")
+	}
+	var approve bool
+	switch req.Decision {
+	case transport.DecisionApprove:
+		approve = true
+	case transport.DecisionReject:
+	default:
+		return fmt.Errorf("invalid decision %q", req.Decision)
+	}
+
+	o.mu.Lock()
+	p, ok := o.confirms[req.ConfirmToken]
+	if ok && p.runID == req.ID {
+		delete(o.confirms, req.ConfirmToken)
+	}
+	o.mu.Unlock()
+	if !ok || p.runID != req.ID {
+		return errors.New("unknown or expired confirm token")
+	}
+
+	p.decision <- approve
+	return nil
+}
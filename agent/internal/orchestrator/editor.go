@@ -0,0 +1,164 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/obsidian-agent/biz/transport"
+	"github.com/obsidian-agent/internal/edit"
+	"github.com/obsidian-agent/internal/vault"
+	"github.com/obsidian-agent/pkg/llm/llmutils"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	maxSectionTokens   = 1500 // 当前章节最多占用的 token 数，超出时只保留光标附近的行
+	maxSelectionTokens = 2000 // 选中文本最多占用的 token 数
+	cursorMarker       = "<|光标|>"
+	editorPromptHead   = `以下是用户发起请求时编辑器的状态。用户说"这段""这里""选中的内容"等时指的就是它们；
+续写时从光标处接着写，改写选区时只输出替换后的文本，不要重复上下文。`
+)
+
+// SetVault 设置笔记仓库，用于按编辑器上下文从磁盘读取当前笔记
+func (o *MsgOrchestrator) SetVault(v *vault.Vault) { o.vault = v }
+
+// editorInfo 描述拼进 prompt 的编辑器上下文，随 agent/done 的 editor 字段下发；行号从 1 开始
+type editorInfo struct {
+	ActiveNote string `json:"activeNote"`
+	Heading    string `json:"heading,omitempty"`
+	StartLine  int    `json:"startLine,omitempty"`
+	EndLine    int    `json:"endLine,omitempty"`
+	Selection  bool   `json:"selection,omitempty"`
+}
+
+// withEditorContext 根据请求中的编辑器上下文（当前笔记、光标、选区）组装一段说明，
+// 拼到首条 system 消息之后。光标所在章节从磁盘读取，笔记不存在（如尚未保存）时只使用前端给的信息。
+func (o *MsgOrchestrator) withEditorContext(req transport.MsgRequest, msgs []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, *editorInfo) {
+	ec := req.Context
+	if ec == nil || ec.ActiveNote == "" {
+		return msgs, nil
+	}
+	model := o.llm.GetModel()
+	info := &editorInfo{ActiveNote: ec.ActiveNote}
+
+	var b strings.Builder
+	b.WriteString(editorPromptHead)
+	b.WriteString("\n\n当前笔记: " + ec.ActiveNote)
+	if ec.Vault != "" {
+		b.WriteString("（仓库 " + ec.Vault + "）")
+	}
+	if len(ec.OpenTabs) > 0 {
+		b.WriteString("\n其他打开的笔记: " + strings.Join(ec.OpenTabs, ", "))
+	}
+
+	var lines []string
+	if o.vault != nil {
+		if content, _, err := o.vault.ReadNote(ec.ActiveNote); err == nil {
+			lines = strings.Split(content, "\n")
+		}
+	}
+
+	// 光标优先，没有光标时以选区起点定位章节
+	var anchor *transport.Position
+	if ec.Cursor != nil {
+		anchor = ec.Cursor
+	} else if ec.Selection != nil {
+		anchor = &ec.Selection.From
+	}
+	if anchor != nil && anchor.Line < len(lines) {
+		sec := vault.SectionAt(strings.Join(lines, "\n"), anchor.Line)
+		body := make([]string, sec.End-sec.Start)
+		copy(body, lines[sec.Start:sec.End])
+		if ec.Cursor != nil {
+			i := ec.Cursor.Line - sec.Start
+			off := edit.LineOffset(body[i], ec.Cursor.Ch)
+			body[i] = body[i][:off] + cursorMarker + body[i][off:]
+		}
+		lo, hi := windowAround(model, body, anchor.Line-sec.Start, maxSectionTokens)
+		info.Heading, info.StartLine, info.EndLine = sec.Heading, sec.Start+lo+1, sec.Start+hi
+		loc := fmt.Sprintf("L%d-L%d", info.StartLine, info.EndLine)
+		if sec.Heading != "" {
+			loc = sec.Heading + " (" + loc + ")"
+		}
+		b.WriteString("\n\n光标所在章节 " + loc)
+		if ec.Cursor != nil {
+			b.WriteString("，" + cursorMarker + " 标出光标位置")
+		}
+		b.WriteString(":\n" + strings.Join(body[lo:hi], "\n"))
+	}
+
+	if sel := selectionText(ec.Selection, lines); sel != "" {
+		if n, _ := llmutils.CountTokens(model, sel); n > maxSelectionTokens {
+			sel = truncateRunes(sel, maxSelectionTokens*utf8.RuneCountInString(sel)/n) + "\n……（选区过长，已截断）"
+		}
+		info.Selection = true
+		b.WriteString(fmt.Sprintf("\n\n选中的文本 (L%d-L%d):\n%s", ec.Selection.From.Line+1, ec.Selection.To.Line+1, sel))
+	}
+
+	return appendSystem(msgs, b.String()), info
+}
+
+// selectionText 返回选中的文本：优先使用前端上传的内容，否则按范围从笔记中截取
+func selectionText(sel *transport.Selection, lines []string) string {
+	if sel == nil {
+		return ""
+	}
+	if sel.Text != "" {
+		return sel.Text
+	}
+	if sel.To.Line >= len(lines) {
+		return ""
+	}
+	if sel.From.Line == sel.To.Line {
+		l := lines[sel.From.Line]
+		return l[edit.LineOffset(l, sel.From.Ch):edit.LineOffset(l, sel.To.Ch)]
+	}
+	parts := []string{lines[sel.From.Line][edit.LineOffset(lines[sel.From.Line], sel.From.Ch):]}
+	parts = append(parts, lines[sel.From.Line+1:sel.To.Line]...)
+	last := lines[sel.To.Line]
+	parts = append(parts, last[:edit.LineOffset(last, sel.To.Ch)])
+	return strings.Join(parts, "\n")
+}
+
+// windowAround 以第 center 行为中心向两侧扩展，返回 token 预算内的行范围 [lo, hi)
+func windowAround(model string, lines []string, center, budget int) (lo, hi int) {
+	cost := func(i int) int {
+		n, _ := llmutils.CountTokens(model, lines[i])
+		return n + 1
+	}
+	lo, hi = center, center+1
+	spent := cost(center)
+	for lo > 0 || hi < len(lines) {
+		grew := false
+		if hi < len(lines) {
+			if n := cost(hi); spent+n <= budget {
+				spent += n
+				hi++
+				grew = true
+			}
+		}
+		if lo > 0 {
+			if n := cost(lo - 1); spent+n <= budget {
+				spent += n
+				lo--
+				grew = true
+			}
+		}
+		if !grew {
+			break
+		}
+	}
+	return lo, hi
+}
+
+// truncateRunes 截取前 n 个字符
+func truncateRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
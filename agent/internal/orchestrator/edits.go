@@ -0,0 +1,145 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/obsidian-agent/biz/transport"
+	"github.com/obsidian-agent/internal/edit"
+	"github.com/sashabaranov/go-openai"
+)
+
+// pendingEdit 是本次运行要生成的编辑操作，content 为生成时看到的笔记内容（读取失败时为空）
+type pendingEdit struct {
+	op      edit.Op
+	content string
+	loaded  bool
+	seq     int
+}
+
+// planEdit 根据编辑器上下文确定输出要落到哪里：有选区时替换选区，否则在光标处插入。
+// 能读到笔记时按磁盘内容记录原文锚点和哈希，否则只能依据前端上传的选中文本。
+func (o *MsgOrchestrator) planEdit(req transport.MsgRequest) (*pendingEdit, error) {
+	ec := req.Context
+	if ec == nil || ec.ActiveNote == "" {
+		return nil, nil
+	}
+	kind, from, to := edit.KindInsert, edit.Pos{}, edit.Pos{}
+	switch {
+	case ec.Selection != nil && ec.Selection.From != ec.Selection.To:
+		kind = edit.KindReplace
+		from = edit.Pos{Line: ec.Selection.From.Line, Ch: ec.Selection.From.Ch}
+		to = edit.Pos{Line: ec.Selection.To.Line, Ch: ec.Selection.To.Ch}
+	case ec.Cursor != nil:
+		from = edit.Pos{Line: ec.Cursor.Line, Ch: ec.Cursor.Ch}
+		to = from
+	case ec.Selection != nil:
+		from = edit.Pos{Line: ec.Selection.From.Line, Ch: ec.Selection.From.Ch}
+		to = from
+	default:
+		return nil, nil
+	}
+
+	pe := &pendingEdit{}
+	if o.vault != nil {
+		if content, _, err := o.vault.ReadNote(ec.ActiveNote); err == nil {
+			pe.content, pe.loaded = content, true
+		}
+	}
+	switch {
+	case !pe.loaded:
+		pe.op = edit.Op{Kind: kind, Path: ec.ActiveNote, From: from, To: to}
+		if kind == edit.KindReplace {
+			pe.op.Original = ec.Selection.Text
+		}
+	case kind == edit.KindReplace:
+		op, err := edit.NewReplace(ec.ActiveNote, pe.content, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("editor context does not match %s: %w", ec.ActiveNote, err)
+		}
+		pe.op = op
+	default:
+		op, err := edit.NewInsert(ec.ActiveNote, pe.content, from)
+		if err != nil {
+			return nil, fmt.Errorf("editor context does not match %s: %w", ec.ActiveNote, err)
+		}
+		pe.op = op
+	}
+	pe.op.ID = req.ID + "#1"
+	return pe, nil
+}
+
+// instruction 告诉模型本次输出会如何落到笔记中
+func (pe *pendingEdit) instruction() string {
+	if pe.op.Kind == edit.KindReplace {
+		return "本次操作：改写选中的文本。你的输出会直接替换选区，只输出替换后的文本。"
+	}
+	return "本次操作：在光标处续写。你的输出会直接插入到光标位置，不要重复光标前已有的内容。"
+}
+
+// withEditInstruction 把编辑说明追加到首条 system 消息
+func withEditInstruction(msgs []openai.ChatCompletionMessage, pe *pendingEdit) []openai.ChatCompletionMessage {
+	return appendSystem(msgs, pe.instruction())
+}
+
+// begin 通知前端即将生成的编辑操作（此时 text 为空）
+func (pe *pendingEdit) begin(sink transport.Sender, id string) {
+	_ = sink.Send(transport.MsgResponse{Type: "agent/edit.begin", ID: id, Result: map[string]any{"op": pe.op}})
+}
+
+// delta 流式下发编辑文本
+func (pe *pendingEdit) delta(sink transport.Sender, id, text string) {
+	pe.seq++
+	_ = sink.Send(transport.MsgResponse{Type: "agent/edit.delta", ID: id, Seq: pe.seq, Text: text})
+}
+
+// finish 用完整输出填充编辑操作并计算 diff 预览，下发 agent/edit.done；
+// 笔记未能读取时无法预览，diff 为空。
+func (pe *pendingEdit) finish(sink transport.Sender, id, text string) (edit.Op, string) {
+	pe.op.Text = fitEditText(pe.op, text)
+	diff := ""
+	if pe.loaded {
+		if updated, err := edit.Apply(pe.content, []edit.Op{pe.op}); err == nil {
+			diff = edit.UnifiedDiff(pe.op.Path, pe.content, updated)
+		}
+	}
+	result := map[string]any{"op": pe.op}
+	if diff != "" {
+		result["diff"] = diff
+	}
+	_ = sink.Send(transport.MsgResponse{Type: "agent/edit.done", ID: id, Result: result})
+	return pe.op, diff
+}
+
+// fitEditText 整理模型输出：去掉包住全文的代码围栏，替换时保留原文首尾的换行，插入时去掉末尾多余的换行
+func fitEditText(op edit.Op, text string) string {
+	if !strings.HasPrefix(strings.TrimSpace(op.Original), "```") {
+		text = unwrapFence(text)
+	}
+	if op.Kind == edit.KindReplace {
+		lead := len(op.Original) - len(strings.TrimLeft(op.Original, "\n"))
+		trail := len(op.Original) - len(strings.TrimRight(op.Original, "\n"))
+		if lead == len(op.Original) {
+			trail = 0
+		}
+		return op.Original[:lead] + strings.Trim(text, "\n") + op.Original[len(op.Original)-trail:]
+	}
+	return strings.TrimRight(text, "\n")
+}
+
+// unwrapFence 模型有时会把整段输出包在 ``` 代码块里，此时只保留块内文本
+func unwrapFence(text string) string {
+	s := strings.TrimSpace(text)
+	if !strings.HasPrefix(s, "```") || !strings.HasSuffix(s, "```") || len(s) < 6 {
+		return text
+	}
+	nl := strings.IndexByte(s, '\n')
+	if nl < 0 {
+		return text
+	}
+	inner := s[nl+1 : len(s)-3]
+	if strings.Contains(inner, "```") {
+		return text // 输出本身包含多个代码块，不做处理
+	}
+	return strings.TrimRight(inner, "\n")
+}
@@ -0,0 +1,72 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+
+	"github.com/obsidian-agent/biz/transport"
+	"github.com/obsidian-agent/internal/edit"
+	"github.com/obsidian-agent/internal/journal"
+)
+
+// defaultHistoryLimit 是 agent/history 未指定 limit 时返回的运行数
+const defaultHistoryLimit = 20
+
+// SetJournal 设置编辑日志，用于 agent/history 查看和 agent/undo 撤销 agent 对笔记的改动
+func (o *MsgOrchestrator) SetJournal(j *journal.Journal) { o.journal = j }
+
+// History 处理 agent/history：带 RunID 时返回该运行的全部改动（含 diff），
+// 否则返回最近的运行列表（不含 diff，避免消息过大）
+func (o *MsgOrchestrator) History(req transport.MsgRequest, sink transport.Sender) error {
+	if o.journal == nil {
+		return fail(sink, req.ID, transport.ErrCodeUnavailable, errors.New("edit history is not enabled"))
+	}
+	if req.RunID != "" {
+		run, ok := o.journal.Run(req.RunID)
+		if !ok {
+			return fail(sink, req.ID, transport.ErrCodeNotFound, journal.ErrRunNotFound)
+		}
+		return sink.Send(transport.MsgResponse{Type: "agent/history", ID: req.ID, Result: map[string]any{"runs": []journal.Run{run}}})
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	runs := o.journal.History(limit)
+	for i := range runs {
+		changes := make([]journal.Entry, len(runs[i].Changes))
+		for k, c := range runs[i].Changes {
+			c.Diff = ""
+			changes[k] = c
+		}
+		runs[i].Changes = changes
+	}
+	return sink.Send(transport.MsgResponse{Type: "agent/history", ID: req.ID, Result: map[string]any{"runs": runs}})
+}
+
+// Undo 处理 agent/undo：撤销 RunID 对应运行对笔记的全部改动
+func (o *MsgOrchestrator) Undo(ctx context.Context, req transport.MsgRequest, sink transport.Sender) error {
+	if o.journal == nil {
+		return fail(sink, req.ID, transport.ErrCodeUnavailable, errors.New("edit history is not enabled"))
+	}
+	if req.RunID == "" {
+		return fail(sink, req.ID, transport.ErrCodeInvalidRequest, errors.New("runId is required"))
+	}
+	run, err := o.journal.Undo(ctx, req.RunID)
+	var diverged *journal.DivergedError
+	var partial *journal.PartialUndoError
+	switch {
+	case errors.Is(err, journal.ErrRunNotFound):
+		return fail(sink, req.ID, transport.ErrCodeNotFound, err)
+	case errors.As(err, &partial):
+		return fail(sink, req.ID, transport.ErrCodeInternal, err)
+	case errors.As(err, &diverged), errors.Is(err, journal.ErrAlreadyUndone), errors.Is(err, edit.ErrConflict):
+		// 撤销途中笔记又被保存时，恢复会因内容不符而失败，同样视为冲突
+		return fail(sink, req.ID, transport.ErrCodeUndoConflict, err)
+	case err != nil:
+		// 读写笔记或备份失败，不是请求本身的问题
+		return fail(sink, req.ID, transport.ErrCodeInternal, err)
+	}
+	return sink.Send(transport.MsgResponse{Type: "agent/undo.done", ID: req.ID, Result: map[string]any{"runId": run.RunID, "paths": run.Paths()}})
+}
@@ -0,0 +1,196 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/obsidian-agent/pkg/llm/client"
+)
+
+// DefaultIntent 是请求未携带 Intent 时使用的意图
+const DefaultIntent = "qa"
+
+// PostProcessor 在一次运行结束后处理完整输出，返回的字段会合并进 agent/done 的 Result
+type PostProcessor func(text string) map[string]any
+
+// Intent 描述一种用户意图对应的处理流水线：
+// 自己的 prompt 模板、模型参数、预览策略和后处理。
+type Intent struct {
+	Name        string
+	Prompt      string             // system prompt 模板（text/template），可使用 PromptData 中的字段
+	Options     client.ChatOptions // 模型参数；MaxTokens 作为前端未指定 Reserve 时的默认预留
+	Preview     PreviewStrategy    // 预览策略
+	PostProcess PostProcessor      // 可选：后处理
+	Retrieve    bool               // 是否检索相关笔记作为回答依据，结果以 sources 随 agent/done 下发
+	Edits       bool               // 带编辑器上下文时是否把输出转换为对当前笔记的编辑操作（agent/edit.*）
+	Plan        bool               // 是否先生成多步计划并执行（agent/plan.*），再根据执行结果作答
+	Summarize   bool               // 是否先分层压缩要总结的笔记或文件夹（agent/summarize.progress），再生成最终摘要
+
+	tmpl *template.Template
+}
+
+// PromptData 是渲染意图 prompt 模板时可用的数据
+type PromptData struct {
+	Intent string
+	Date   string // 当前日期，例如 2006-01-02
+	Time   string // 当前时间，例如 15:04
+}
+
+// RenderPrompt 渲染意图的 system prompt
+func (it *Intent) RenderPrompt(now time.Time) (string, error) {
+	var b strings.Builder
+	data := PromptData{Intent: it.Name, Date: now.Format("2006-01-02"), Time: now.Format("15:04")}
+	if err := it.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("render prompt for intent %q: %w", it.Name, err)
+	}
+	return b.String(), nil
+}
+
+// ChatOptions 返回本意图的模型参数副本，MaxTokens 使用实际预留值
+func (it *Intent) ChatOptions(maxTokens int) *client.ChatOptions {
+	opts := it.Options
+	opts.MaxTokens = maxTokens
+	return &opts
+}
+
+// IntentRegistry 维护意图名到处理流水线的映射
+type IntentRegistry struct {
+	mu      sync.RWMutex
+	intents map[string]*Intent
+}
+
+// NewIntentRegistry 创建一个包含内置意图（qa/write/scaffold/brainstorm/plan/summarize）的注册表
+func NewIntentRegistry() *IntentRegistry {
+	r := &IntentRegistry{intents: make(map[string]*Intent)}
+	for _, it := range builtinIntents() {
+		if err := r.Register(it); err != nil {
+			panic(err) // 内置意图出错属于编码错误
+		}
+	}
+	return r
+}
+
+// Register 注册或覆盖一个意图，注册时即解析 prompt 模板
+func (r *IntentRegistry) Register(it *Intent) error {
+	if it == nil || it.Name == "" {
+		return errors.New("intent name must not be empty")
+	}
+	tmpl, err := template.New(it.Name).Option("missingkey=error").Parse(it.Prompt)
+	if err != nil {
+		return fmt.Errorf("parse prompt for intent %q: %w", it.Name, err)
+	}
+	it.tmpl = tmpl
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.intents[it.Name] = it
+	return nil
+}
+
+// Resolve 根据请求中的意图名查找流水线，空名使用 DefaultIntent
+func (r *IntentRegistry) Resolve(name string) (*Intent, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = DefaultIntent
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	it, ok := r.intents[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown intent: %s", name)
+	}
+	return it, nil
+}
+
+// ---- 内置意图 ----
+
+func builtinIntents() []*Intent {
+	return []*Intent{
+		{
+			Name: "qa",
+			Prompt: `当前任务：回答用户关于笔记内容的问题（{{.Date}}）。
+要求：只陈述有把握的事实，不确定时直接说明；先给结论，再给必要的解释；保持简洁。`,
+			Options:  client.ChatOptions{Temperature: 0.2, MaxTokens: 800},
+			Preview:  PreviewFirstSentence,
+			Retrieve: true,
+		},
+		{
+			Name: "write",
+			Prompt: `当前任务：协助用户写作（{{.Date}}）。
+要求：延续用户的语气和语言，输出可以直接放进笔记的正文，不要添加解释或客套话。`,
+			Options:     client.ChatOptions{Temperature: 0.7, MaxTokens: 1500},
+			Preview:     PreviewFirstParagraph,
+			PostProcess: postProcessWrite,
+			Edits:       true,
+		},
+		{
+			Name: "scaffold",
+			Prompt: `当前任务：为用户的主题搭建笔记骨架（{{.Date}}）。
+要求：只输出 Markdown 标题层级（#、##、###）和每节一句话的提示，不展开正文。`,
+			Options:     client.ChatOptions{Temperature: 0.4, MaxTokens: 1200},
+			Preview:     PreviewNone,
+			PostProcess: postProcessScaffold,
+		},
+		{
+			Name: "brainstorm",
+			Prompt: `当前任务：围绕用户的主题进行头脑风暴（{{.Date}}）。
+要求：给出尽可能多样、大胆的想法，每条想法单独一行，以 "- " 开头，不做评判。`,
+			Options:     client.ChatOptions{Temperature: 1.2, MaxTokens: 1200},
+			Preview:     PreviewFirstLine,
+			PostProcess: postProcessBrainstorm,
+		},
+		{
+			Name: "plan",
+			Prompt: `当前任务：完成用户交代的多步任务（{{.Date}}）。各步骤已按计划执行，结果附在下面。
+要求：简要汇报做了什么、结果如何；有步骤失败或被拒绝时如实说明，不要声称完成了没有完成的操作。`,
+			Options: client.ChatOptions{Temperature: 0.3, MaxTokens: 1000},
+			Preview: PreviewFirstParagraph,
+			Plan:    true,
+		},
+		{
+			Name: "summarize",
+			Prompt: `当前任务：总结笔记（{{.Date}}）。笔记原文或其分段摘要附在下面，每段以【来源】开头。
+要求：先用一两句话概括主旨，再按主题分点列出要点；保留关键的事实、结论和待办；只依据给出的内容，不要编造，不要输出【来源】标记。`,
+			Options:   client.ChatOptions{Temperature: 0.3, MaxTokens: 1200},
+			Preview:   PreviewFirstParagraph,
+			Summarize: true,
+		},
+	}
+}
+
+// postProcessWrite 统计写作结果的字数
+func postProcessWrite(text string) map[string]any {
+	return map[string]any{"chars": utf8.RuneCountInString(strings.TrimSpace(text))}
+}
+
+var headingRe = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+// postProcessScaffold 从输出中提取标题大纲
+func postProcessScaffold(text string) map[string]any {
+	outline := make([]map[string]any, 0)
+	for _, line := range strings.Split(text, "\n") {
+		if m := headingRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			outline = append(outline, map[string]any{"level": len(m[1]), "title": m[2]})
+		}
+	}
+	return map[string]any{"outline": outline}
+}
+
+var bulletRe = regexp.MustCompile(`^(?:[-*+]|\d+[.)])\s+(.+)$`)
+
+// postProcessBrainstorm 将列表项拆成独立的想法
+func postProcessBrainstorm(text string) map[string]any {
+	ideas := make([]string, 0)
+	for _, line := range strings.Split(text, "\n") {
+		if m := bulletRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			ideas = append(ideas, m[1])
+		}
+	}
+	return map[string]any{"ideas": ideas}
+}
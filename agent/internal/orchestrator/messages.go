@@ -0,0 +1,80 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/obsidian-agent/biz/transport"
+	"github.com/sashabaranov/go-openai"
+)
+
+// toOpenAIMessages 将前端传来的对话历史转换为 openai 消息，并校验角色。
+// 只接受 system/user/assistant 三种角色，内容为空的消息会被忽略。
+func toOpenAIMessages(history []transport.ChatMessage) ([]openai.ChatCompletionMessage, error) {
+	out := make([]openai.ChatCompletionMessage, 0, len(history))
+	for i, m := range history {
+		role := strings.ToLower(strings.TrimSpace(m.Role))
+		switch role {
+		case openai.ChatMessageRoleSystem, openai.ChatMessageRoleUser, openai.ChatMessageRoleAssistant:
+		default:
+			return nil, fmt.Errorf("messages[%d]: unsupported role %q", i, m.Role)
+		}
+		if strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		out = append(out, openai.ChatCompletionMessage{Role: role, Content: m.Content})
+	}
+	return out, nil
+}
+
+// buildConversation 根据请求组装本轮发给模型的消息：
+// 优先使用 Messages 作为多轮历史，为空时才回退到 Question；
+// 意图的 system prompt 放在历史之前，最终交给 BuildMessages 与服务端 system prompt 合并。
+func (o *MsgOrchestrator) buildConversation(req transport.MsgRequest, intentPrompt string) ([]openai.ChatCompletionMessage, error) {
+	history, err := toOpenAIMessages(req.Messages)
+	if err != nil {
+		return nil, err
+	}
+
+	question := strings.TrimSpace(req.Question)
+	if len(history) == 0 || lastNonSystemRole(history) == "" {
+		if question == "" {
+			return nil, errors.New("empty request: neither messages nor question provided")
+		}
+		history = append(history, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: req.Question})
+	} else if lastNonSystemRole(history) != openai.ChatMessageRoleUser {
+		// 历史以 assistant 结尾时，只有带了 Question 才能继续
+		if question == "" {
+			return nil, errors.New("messages must end with a user message")
+		}
+		history = append(history, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: req.Question})
+	}
+
+	if strings.TrimSpace(intentPrompt) != "" {
+		history = append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: intentPrompt}}, history...)
+	}
+	return o.llm.BuildMessages(history), nil
+}
+
+// appendSystem 把 text 追加到首条 system 消息末尾，没有 system 消息时在开头插入一条；返回新的切片，不修改 msgs。
+// 检索片段、编辑器上下文等都放在首条 system 中，assemblePrompt 裁剪历史时始终保留它
+func appendSystem(msgs []openai.ChatCompletionMessage, text string) []openai.ChatCompletionMessage {
+	out := append([]openai.ChatCompletionMessage(nil), msgs...)
+	if len(out) > 0 && out[0].Role == openai.ChatMessageRoleSystem {
+		out[0].Content += "\n\n" + text
+	} else {
+		out = append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: text}}, out...)
+	}
+	return out
+}
+
+// lastNonSystemRole 返回最后一条非 system 消息的角色，不存在时返回空串
+func lastNonSystemRole(msgs []openai.ChatCompletionMessage) string {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role != openai.ChatMessageRoleSystem {
+			return msgs[i].Role
+		}
+	}
+	return ""
+}
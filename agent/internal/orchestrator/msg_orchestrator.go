@@ -3,28 +3,53 @@ package orchestrator
 
 import (
 	"context"
-	"strings"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/obsidian-agent/biz/transport"
+	"github.com/obsidian-agent/internal/edit"
+	"github.com/obsidian-agent/internal/journal"
+	"github.com/obsidian-agent/internal/summarizer"
+	"github.com/obsidian-agent/internal/vault"
 	"github.com/obsidian-agent/pkg/llm/client"
-	"github.com/sashabaranov/go-openai"
+	"github.com/obsidian-agent/pkg/llm/llmutils"
+	"github.com/obsidian-agent/pkg/mcp"
 )
 
 type MsgOrchestrator struct {
-	llm     client.BaseClient
-	mu      sync.Mutex
-	cancels map[string]context.CancelFunc
+	llm        client.BaseClient
+	intents    *IntentRegistry
+	tools      *mcp.MCPServer
+	retriever  Retriever
+	vault      *vault.Vault
+	journal    *journal.Journal
+	mu         sync.Mutex
+	cancels    map[string]context.CancelFunc
+	confirms   map[string]*pendingConfirm // confirm token -> 等待中的确认
+	reviews    map[string]*pendingReview  // review token -> 等待审阅的计划
+	sessions   *llmutils.Histories        // 服务端会话记忆，nil 时只使用前端传来的历史
+	summarizer *summarizer.Summarizer     // summarize 意图的分层总结
 }
 
+// runTimeout 是单次运行的最长时间，包含工具调用和等待用户确认的时间
+const runTimeout = 5 * time.Minute
+
 func BuildMsgOrchestrator(llm client.BaseClient) *MsgOrchestrator {
 	return &MsgOrchestrator{
-		llm:     llm,
-		cancels: make(map[string]context.CancelFunc),
+		llm:        llm,
+		intents:    NewIntentRegistry(),
+		cancels:    make(map[string]context.CancelFunc),
+		confirms:   make(map[string]*pendingConfirm),
+		reviews:    make(map[string]*pendingReview),
+		summarizer: summarizer.NewSummarizer(llm),
 	}
 }
 
+// Intents 返回意图注册表，可用于注册自定义意图或覆盖内置意图
+func (o *MsgOrchestrator) Intents() *IntentRegistry { return o.intents }
+
 func (o *MsgOrchestrator) Cancel(id string) {
 	o.mu.Lock()
 	if c, ok := o.cancels[id]; ok {
@@ -34,67 +59,199 @@ func (o *MsgOrchestrator) Cancel(id string) {
 	o.mu.Unlock()
 }
 
+// runError 携带下发给前端的错误码
+type runError struct {
+	code string
+	err  error
+}
+
+func (e *runError) Error() string { return e.err.Error() }
+func (e *runError) Unwrap() error { return e.err }
+
+// fail 向前端发送 agent/error 并返回原错误；err 为 runError 时使用其错误码，否则使用 code
+func fail(sink transport.Sender, id, code string, err error) error {
+	var re *runError
+	if errors.As(err, &re) {
+		code = re.code
+	}
+	_ = sink.Send(transport.MsgResponse{Type: "agent/error", ID: id, ErrorCode: code, ErrorMsg: err.Error()})
+	return err
+}
+
 func (o *MsgOrchestrator) Run(ctx context.Context, req transport.MsgRequest, sink transport.Sender) error {
 	// 记录 cancel
-	ctx, cancel := context.WithTimeout(ctx, 90*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, runTimeout)
 	o.mu.Lock()
 	o.cancels[req.ID] = cancel
 	o.mu.Unlock()
 	defer func() { o.Cancel(req.ID) }()
 
+	// 按意图选择处理流水线
+	intent, err := o.intents.Resolve(req.Intent)
+	if err != nil {
+		return fail(sink, req.ID, transport.ErrCodeUnknownIntent, err)
+	}
+	if req.Mode != "" && req.Mode != transport.ModeReview {
+		return fail(sink, req.ID, transport.ErrCodeInvalidRequest, fmt.Errorf("unknown mode %q", req.Mode))
+	}
+	intentPrompt, err := intent.RenderPrompt(time.Now())
+	if err != nil {
+		return fail(sink, req.ID, transport.ErrCodeInvalidRequest, err)
+	}
+
+	// 带 SessionID 时历史轮次取自服务端的会话记忆，较早的轮次以摘要形式给出
+	var session *llmutils.History
+	var turn string
+	if req.SessionID != "" && o.sessions != nil {
+		if session, err = o.sessions.Get(req.SessionID); err != nil {
+			return fail(sink, req.ID, transport.ErrCodeInvalidRequest, err)
+		}
+		req, turn = withSession(req, session)
+	}
+
 	// 构建 messages：system + 历史 + 本轮 user
-	messages := o.llm.BuildMessages([]openai.ChatCompletionMessage{{
-		Role:    openai.ChatMessageRoleUser,
-		Content: req.Question,
-	}})
+	messages, err := o.buildConversation(req, intentPrompt)
+	if err != nil {
+		return fail(sink, req.ID, transport.ErrCodeInvalidRequest, err)
+	}
+	if session != nil {
+		messages = withSessionSummary(messages, session.Summary())
+	}
 
-	// 预览策略：首句/首段只发一次
-	previewSent := false
-	seq := 0
-	var previewBuf strings.Builder
-	previewDeadline := time.NewTimer(300 * time.Millisecond)
-	defer previewDeadline.Stop()
+	// 为回复预留 Reserve（未指定时使用意图的默认值）
+	reserve := req.Reserve
+	if reserve <= 0 {
+		reserve = intent.Options.MaxTokens
+	}
 
-	onDelta := func(delta string) error {
-		seq++
+	// 带了编辑器上下文：把当前笔记、光标所在章节和选区拼进 prompt
+	messages, editor := o.withEditorContext(req, messages)
 
-		// 累积到 previewBuf，满足条件就发 preview.delta（只发一次）
-		if !previewSent {
-			previewBuf.WriteString(delta)
+	// 输出要落到当前笔记的意图（如 write）：确定编辑位置并告诉模型输出会如何使用
+	var pe *pendingEdit
+	if intent.Edits {
+		if pe, err = o.planEdit(req); err != nil {
+			return fail(sink, req.ID, transport.ErrCodeInvalidContext, err)
+		}
+		if pe != nil {
+			messages = withEditInstruction(messages, pe)
+		}
+	}
 
-			// 条件一：遇到句子终止符
-			if i := strings.IndexAny(previewBuf.String(), "。.!?"); i >= 0 {
-				text := previewBuf.String()[:i+1]
-				_ = sink.Send(transport.MsgResponse{Type: "agent/preview.delta", ID: req.ID, Seq: 1, Text: text})
-				previewSent = true
-			}
+	// 多步任务：先生成计划并逐步执行，再根据执行结果作答
+	var plan *planOutcome
+	if intent.Plan {
+		messages, plan, err = o.executePlan(ctx, req, sink, messages)
+		if errors.Is(err, errPlanRejected) {
+			// 用户拒绝了计划：什么都没有执行，直接结束
+			_ = sink.Send(transport.MsgResponse{Type: "agent/done", ID: req.ID, Result: map[string]any{"intent": intent.Name, "plan": plan}})
+			return nil
 		}
-		// 条件二：超时仍未到句末，也先发
-		select {
-		case <-previewDeadline.C:
-			if !previewSent && previewBuf.Len() > 0 {
-				_ = sink.Send(transport.MsgResponse{Type: "agent/preview.delta", ID: req.ID, Seq: 1, Text: previewBuf.String()})
-				previewSent = true
-			}
-		default:
+		if err != nil {
+			return fail(sink, req.ID, transport.ErrCodePlan, err)
+		}
+	}
+
+	// 总结笔记或文件夹：先分层压缩，再由模型流式写出最终摘要
+	var summary *summaryOutcome
+	if intent.Summarize {
+		if messages, summary, err = o.condenseNotes(ctx, req, sink, messages); err != nil {
+			return fail(sink, req.ID, transport.ErrCodeLLM, err)
 		}
+	}
+
+	// 需要依据笔记回答的意图：检索相关片段拼进 prompt
+	var sources []citedSource
+	if intent.Retrieve && o.retriever != nil {
+		messages, sources = o.augmentWithNotes(ctx, req, messages, reserve)
+	}
+
+	// 按模型上下文窗口裁剪历史
+	messages, stats, err := o.assemblePrompt(ctx, messages, reserve)
+	if err != nil {
+		return fail(sink, req.ID, transport.ErrCodeInvalidRequest, err)
+	}
+
+	// 调用 LLM（流式），允许时驱动工具调用循环
+	// 计划模式的工具调用已由执行器完成，汇报时不再下发工具
+	opts := intent.ChatOptions(stats.Reserve)
+	if opts.Tools = o.toolsFor(req); len(opts.Tools) > 0 && plan == nil {
+		opts.ToolChoice = "auto"
+	} else {
+		opts.Tools = nil
+	}
+
+	// 预览策略由意图决定：首句/首段/首行只发一次
+	preview := newPreviewer(intent.Preview)
+	seq := 0
+	// 可能调用工具时，流式输出中夹着工具调用前的过渡说明，编辑文本要等最后一轮结束后再下发
+	streamEdit := pe != nil && len(opts.Tools) == 0
 
+	onDelta := func(delta string) error {
+		seq++
+		if text, ok := preview.Feed(delta); ok {
+			_ = sink.Send(transport.MsgResponse{Type: "agent/preview.delta", ID: req.ID, Seq: 1, Text: text})
+		}
 		// 全量永远流
 		_ = sink.Send(transport.MsgResponse{Type: "agent/full.delta", ID: req.ID, Seq: seq, Text: delta})
+		if streamEdit {
+			pe.delta(sink, req.ID, delta)
+		}
 		return nil
 	}
+	if pe != nil {
+		pe.begin(sink, req.ID)
+	}
 
-	// 调用 LLM（流式）
-	_, err := o.llm.StreamChatCompletion(ctx, messages, &client.ChatOptions{
-		Temperature: 0.3,
-		MaxTokens:   800,
-	}, onDelta)
-
+	gen, err := o.generate(ctx, req, sink, messages, opts, stats.ContextWindow-stats.Reserve, onDelta)
 	if err != nil {
-		_ = sink.Send(transport.MsgResponse{Type: "agent/error", ID: req.ID, ErrorCode: "LLM_ERROR", ErrorMsg: err.Error()})
-		return err
+		return fail(sink, req.ID, transport.ErrCodeLLM, err)
+	}
+	if pe != nil && !streamEdit && gen.Final != "" {
+		pe.delta(sink, req.ID, gen.Final)
 	}
 
-	_ = sink.Send(transport.MsgResponse{Type: "agent/done", ID: req.ID})
+	result := map[string]any{"intent": intent.Name, "prompt": stats.toResult()}
+	if usage := usageResult(o.llm.GetModel(), gen.Usage); usage != nil {
+		result["usage"] = usage
+	}
+	if plan != nil {
+		result["plan"] = plan
+		gen.ToolCalls += plan.toolCalls
+	}
+	if summary != nil {
+		result["summary"] = summary
+		if req.Output != "" {
+			var saved bool
+			if result["output"], saved = o.saveSummary(ctx, req, sink, summary, gen.Text); saved {
+				gen.ToolCalls++
+			}
+		}
+	}
+	if gen.ToolCalls > 0 {
+		result["toolCalls"] = gen.ToolCalls
+	}
+	if editor != nil {
+		result["editor"] = editor
+	}
+	if sources != nil {
+		result["sources"] = sources
+	}
+	if pe != nil {
+		op, diff := pe.finish(sink, req.ID, gen.Final)
+		result["edits"] = []edit.Op{op}
+		if diff != "" {
+			result["diff"] = diff
+		}
+	}
+	if intent.PostProcess != nil {
+		for k, v := range intent.PostProcess(gen.Text) {
+			result[k] = v
+		}
+	}
+	if session != nil {
+		result["session"] = recordTurn(ctx, session, turn, gen.Text)
+	}
+	_ = sink.Send(transport.MsgResponse{Type: "agent/done", ID: req.ID, Result: result})
 	return nil
 }
@@ -0,0 +1,136 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/obsidian-agent/biz/transport"
+	"github.com/obsidian-agent/internal/journal"
+	"github.com/obsidian-agent/internal/planner"
+	"github.com/obsidian-agent/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	maxPlanOutputChars = 1500 // 每一步的输出拼进 prompt 时的最大字符数
+	planPromptHead     = `以下是为完成用户的目标生成并执行的多步计划，以及每一步的结果。请据此回答用户。`
+)
+
+// planOutcome 是计划执行的汇总，随 agent/done 的 plan 字段下发
+type planOutcome struct {
+	Goal      string               `json:"goal"`
+	Steps     []planner.StepResult `json:"steps"`
+	Replans   int                  `json:"replans,omitempty"`
+	Rejected  bool                 `json:"rejected,omitempty"` // 用户在执行前拒绝了计划
+	Error     string               `json:"error,omitempty"`
+	toolCalls int
+}
+
+// executePlan 为本轮目标生成计划并执行：计划以 agent/plan 下发，每一步的进度以 agent/plan.step 推送，
+// 重新规划时推送 agent/plan.replan。执行结果拼进首条 system 消息，由后续的生成向用户汇报。
+// 审阅模式（Mode 为 review）下计划先经用户批准，只执行批准的步骤；用户拒绝时返回 errPlanRejected。
+// 只有无法生成计划、用户拒绝或运行被取消时返回错误；步骤失败会如实写进结果。
+func (o *MsgOrchestrator) executePlan(ctx context.Context, req transport.MsgRequest, sink transport.Sender, msgs []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, *planOutcome, error) {
+	if o.tools == nil {
+		return msgs, nil, &runError{code: transport.ErrCodeUnavailable, err: errors.New("no tools are available for planning")}
+	}
+	if !req.AllowTools {
+		return msgs, nil, &runError{code: transport.ErrCodeInvalidRequest, err: errors.New("the plan intent requires allowTools")}
+	}
+	goal := retrievalQuery(req, msgs)
+	background := ""
+	if req.Context != nil && req.Context.ActiveNote != "" {
+		background = "用户当前打开的笔记：" + req.Context.ActiveNote
+	}
+
+	p := planner.New(o.llm, o.tools)
+	plan, err := p.Plan(ctx, goal, background)
+	if err != nil {
+		return msgs, nil, &runError{code: transport.ErrCodePlan, err: err}
+	}
+	review := req.Mode == transport.ModeReview
+	if !review {
+		_ = sink.Send(transport.MsgResponse{Type: "agent/plan", ID: req.ID, Result: map[string]any{"plan": plan}})
+	}
+
+	exec := planner.NewExecutor(p, o.planCaller(req, sink, review), func(ev planner.Event) {
+		switch {
+		case ev.Type == planner.EventStep:
+			_ = sink.Send(transport.MsgResponse{Type: "agent/plan.step", ID: req.ID, Result: map[string]any{"step": ev.Result}})
+		case ev.Type == planner.EventReplan && !review: // 审阅模式下由 Reviewer 下发待批准的新计划
+			_ = sink.Send(transport.MsgResponse{Type: "agent/plan.replan", ID: req.ID, Text: ev.Reason, Result: map[string]any{"plan": ev.Plan}})
+		}
+	})
+	if review {
+		exec.SetReviewer(o.planReviewer(req, sink))
+	}
+	report, err := exec.Execute(ctx, plan)
+	if ctx.Err() != nil {
+		return msgs, nil, ctx.Err()
+	}
+	var re *runError
+	if errors.As(err, &re) {
+		return msgs, nil, err // 等待确认或审阅超时
+	}
+	if errors.Is(err, planner.ErrPlanRejected) && report.Replans == 0 {
+		return msgs, &planOutcome{Goal: goal, Steps: []planner.StepResult{}, Rejected: true}, errPlanRejected
+	}
+
+	out := &planOutcome{Goal: goal, Steps: report.Results, Replans: report.Replans}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	for _, r := range report.Results {
+		if r.Tool != "" && r.Status == planner.StatusDone {
+			out.toolCalls++
+		}
+	}
+	return withPlanReport(msgs, out), out, nil
+}
+
+// planCaller 执行计划中的工具步骤：需要确认的工具先征得用户同意，改动记入编辑日志（CallID 为步骤 ID）。
+// reviewed 为 true 时计划已经用户审阅，参数在审阅时已完整可见（不含 {{引用}}）的步骤不再逐个确认。
+func (o *MsgOrchestrator) planCaller(req transport.MsgRequest, sink transport.Sender, reviewed bool) planner.ToolCaller {
+	return func(ctx context.Context, step planner.Step, args map[string]any) (mcp.ToolCallResult, error) {
+		if !reviewed || step.HasRefs() {
+			approved, err := o.confirmToolCall(ctx, req, sink, step.Tool, args)
+			if err != nil {
+				return mcp.ToolCallResult{}, err
+			}
+			if !approved {
+				return mcp.ToolCallResult{}, planner.ErrRejected
+			}
+		}
+		return o.tools.CallTool(journal.WithCall(ctx, journal.Call{RunID: req.ID, Tool: step.Tool, CallID: step.ID}), step.Tool, args)
+	}
+}
+
+// withPlanReport 把计划的执行结果追加到首条 system 消息
+func withPlanReport(msgs []openai.ChatCompletionMessage, out *planOutcome) []openai.ChatCompletionMessage {
+	var b strings.Builder
+	b.WriteString(planPromptHead)
+	for _, r := range out.Steps {
+		fmt.Fprintf(&b, "\n\n[%s] %s", r.StepID, r.Title)
+		if r.Tool != "" {
+			b.WriteString("（工具 " + r.Tool + "）")
+		}
+		b.WriteString("：" + r.Status)
+		switch {
+		case r.Error != "":
+			b.WriteString("\n错误：" + r.Error)
+		case r.Output != "":
+			text := truncateRunes(r.Output, maxPlanOutputChars)
+			if text != r.Output {
+				text += "……"
+			}
+			b.WriteString("\n" + text)
+		}
+	}
+	if out.Error != "" {
+		b.WriteString("\n\n计划未能全部完成：" + out.Error)
+	}
+
+	return appendSystem(msgs, b.String())
+}
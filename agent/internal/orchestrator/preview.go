@@ -0,0 +1,87 @@
+package orchestrator
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// PreviewStrategy 决定如何从流式输出中切出一段预览（只发一次）
+type PreviewStrategy struct {
+	Name string
+	// Cut 返回预览截止位置（不含），-1 表示尚未就绪；为 nil 时不发送预览
+	Cut func(buf string) int
+	// Timeout 超时仍未就绪时，把已累积的内容先作为预览发出；0 表示不按超时发送
+	Timeout time.Duration
+}
+
+var (
+	// PreviewFirstSentence 遇到首个句子终止符即发预览
+	PreviewFirstSentence = PreviewStrategy{Name: "sentence", Cut: cutAfterAny("。.!?！？"), Timeout: 300 * time.Millisecond}
+	// PreviewFirstParagraph 遇到首个空行即发预览，适合成段的写作
+	PreviewFirstParagraph = PreviewStrategy{Name: "paragraph", Cut: cutBefore("\n\n"), Timeout: 800 * time.Millisecond}
+	// PreviewFirstLine 遇到首个换行即发预览，适合列表/大纲类输出
+	PreviewFirstLine = PreviewStrategy{Name: "line", Cut: cutBefore("\n"), Timeout: 500 * time.Millisecond}
+	// PreviewNone 不发送预览
+	PreviewNone = PreviewStrategy{Name: "none"}
+)
+
+// cutAfterAny 在任意一个终止符之后截断（包含终止符本身）
+func cutAfterAny(chars string) func(string) int {
+	return func(buf string) int {
+		i := strings.IndexAny(buf, chars)
+		if i < 0 {
+			return -1
+		}
+		_, size := utf8.DecodeRuneInString(buf[i:])
+		return i + size
+	}
+}
+
+// cutBefore 在分隔符之前截断，忽略开头的空白
+func cutBefore(sep string) func(string) int {
+	return func(buf string) int {
+		lead := len(buf) - len(strings.TrimLeft(buf, " \n\t"))
+		if i := strings.Index(buf[lead:], sep); i > 0 {
+			return lead + i
+		}
+		return -1
+	}
+}
+
+// previewer 按策略累积流式增量，并在满足条件时返回一次预览文本
+type previewer struct {
+	strategy PreviewStrategy
+	buf      strings.Builder
+	sent     bool
+	deadline time.Time
+}
+
+func newPreviewer(s PreviewStrategy) *previewer {
+	p := &previewer{strategy: s, sent: s.Cut == nil}
+	if s.Timeout > 0 {
+		p.deadline = time.Now().Add(s.Timeout)
+	}
+	return p
+}
+
+// Feed 追加一段增量；返回 (预览文本, true) 表示此时应下发预览
+func (p *previewer) Feed(delta string) (string, bool) {
+	if p.sent {
+		return "", false
+	}
+	p.buf.WriteString(delta)
+	text := p.buf.String()
+
+	// 条件一：满足策略的切分条件
+	if i := p.strategy.Cut(text); i >= 0 {
+		p.sent = true
+		return text[:i], true
+	}
+	// 条件二：超时仍未就绪，也先发
+	if !p.deadline.IsZero() && time.Now().After(p.deadline) && strings.TrimSpace(text) != "" {
+		p.sent = true
+		return text, true
+	}
+	return "", false
+}
@@ -0,0 +1,110 @@
+package orchestrator
+
+import (
+	"context"
+
+	"github.com/obsidian-agent/pkg/llm/llmutils"
+	"github.com/obsidian-agent/pkg/llm/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultResponseReserve = 800 // 前端未指定 Reserve 时为回复预留的 token 数
+	minResponseReserve     = 64  // Reserve 的下限，过小会导致回复被截断
+)
+
+// promptStats 记录 prompt 组装阶段的裁剪情况，随 agent/done 回传给前端
+type promptStats struct {
+	ContextWindow   int  // 模型上下文窗口
+	Reserve         int  // 实际为回复预留的 token 数
+	PromptTokens    int  // 裁剪后 prompt 的 token 数
+	DroppedMessages int  // 被丢弃的历史消息条数
+	DroppedTokens   int  // 被丢弃（含截断）的 token 数
+	Truncated       bool // 是否有消息被截断
+	Estimated       bool // token 数是否为近似估算（模型没有精确的分词器）
+}
+
+func (p promptStats) toResult() map[string]any {
+	return map[string]any{
+		"contextWindow":   p.ContextWindow,
+		"reserve":         p.Reserve,
+		"promptTokens":    p.PromptTokens,
+		"droppedMessages": p.DroppedMessages,
+		"droppedTokens":   p.DroppedTokens,
+		"truncated":       p.Truncated,
+		"estimated":       p.Estimated,
+	}
+}
+
+// responseReserve 计算本轮为回复预留的 token：优先使用前端传来的 Reserve，
+// 并限制在 [minResponseReserve, min(contextWindow/2, maxOutput)] 之间，避免挤占全部 prompt 空间。
+func responseReserve(reserve int, model models.Model) int {
+	if reserve <= 0 {
+		reserve = defaultResponseReserve
+	}
+	if reserve < minResponseReserve {
+		reserve = minResponseReserve
+	}
+	if limit := min(model.ContextWindow/2, model.MaxOutputTokens); reserve > limit {
+		reserve = limit
+	}
+	return reserve
+}
+
+// assemblePrompt 是 prompt 组装阶段：查询模型上下文窗口，
+// 在为回复预留 reserve 个 token 的前提下用 ClipMessagesToTokenLimit 裁剪历史。
+func (o *MsgOrchestrator) assemblePrompt(ctx context.Context, msgs []openai.ChatCompletionMessage, reserve int) ([]openai.ChatCompletionMessage, promptStats, error) {
+	model := o.llm.GetModel()
+	info := models.Get(model)
+	stats := promptStats{ContextWindow: info.ContextWindow, Estimated: llmutils.IsEstimate(model)}
+	stats.Reserve = responseReserve(reserve, info)
+
+	before, err := llmutils.CountMessagesTokens(model, msgs)
+	if err != nil {
+		return nil, stats, err
+	}
+	clipped, err := llmutils.ClipMessagesToTokenLimit(ctx, model, msgs, stats.ContextWindow, stats.Reserve)
+	if err != nil {
+		return nil, stats, err
+	}
+	after, err := llmutils.CountMessagesTokens(model, clipped)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	stats.PromptTokens = after
+	stats.DroppedMessages = len(msgs) - len(clipped)
+	stats.DroppedTokens = before - after
+	stats.Truncated = stats.DroppedTokens > 0 && isTruncated(msgs, clipped)
+	return clipped, stats, nil
+}
+
+// isTruncated 判断裁剪结果中是否有消息被截断过。
+// ClipMessagesToTokenLimit 总是保留首条 system 和历史的一个后缀，因此按尾部对齐比较即可。
+func isTruncated(orig, clipped []openai.ChatCompletionMessage) bool {
+	i := len(orig) - 1
+	for j := len(clipped) - 1; j >= 0; j-- {
+		if j == 0 && clipped[0].Role == openai.ChatMessageRoleSystem {
+			return len(orig) > 0 && orig[0].Content != clipped[0].Content
+		}
+		if i < 0 || orig[i].Content != clipped[j].Content {
+			return true
+		}
+		i--
+	}
+	return false
+}
+
+// usageResult 将模型返回的 token 用量和按注册表价格估算的费用整理成响应结果
+func usageResult(model string, usage *openai.Usage) map[string]any {
+	if usage == nil {
+		return nil
+	}
+	return map[string]any{
+		"model":            model,
+		"promptTokens":     usage.PromptTokens,
+		"completionTokens": usage.CompletionTokens,
+		"totalTokens":      usage.TotalTokens,
+		"cost":             models.Get(model).Cost(usage.PromptTokens, usage.CompletionTokens),
+	}
+}
@@ -0,0 +1,103 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/obsidian-agent/biz/transport"
+	"github.com/obsidian-agent/internal/retrieval"
+	"github.com/obsidian-agent/pkg/llm/llmutils"
+	"github.com/obsidian-agent/pkg/llm/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	retrieveLimit     = 8    // 每次检索的候选分块数
+	maxContextTokens  = 3000 // 笔记片段最多占用的 token 数
+	minPassageTokens  = 32   // 剩余预算不足以放下一段有意义的片段时停止
+	contextPromptHead = `以下是从用户笔记中检索到的片段，按相关度排序，每段以 [编号] 开头并注明出处。
+回答时优先依据这些片段，在用到的句子后用 [编号] 标注来源，例如 "……[1]"；
+片段与问题无关时忽略它们，不要编造笔记中没有的内容。`
+)
+
+// Retriever 检索与问题相关的笔记片段
+type Retriever interface {
+	Retrieve(ctx context.Context, query string, limit int) ([]retrieval.Source, error)
+}
+
+// SetRetriever 设置笔记检索器，启用了检索的意图（如 qa）会据此把相关笔记拼进 prompt
+func (o *MsgOrchestrator) SetRetriever(r Retriever) { o.retriever = r }
+
+// citedSource 是拼进 prompt 的一段笔记，ID 与回答中的 [编号] 对应
+type citedSource struct {
+	ID int `json:"id"`
+	retrieval.Source
+}
+
+// retrievalQuery 取本轮用户的问题作为检索词
+func retrievalQuery(req transport.MsgRequest, msgs []openai.ChatCompletionMessage) string {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == openai.ChatMessageRoleUser {
+			return msgs[i].Content
+		}
+	}
+	return req.Question
+}
+
+// augmentWithNotes 检索相关笔记片段，在 token 预算内拼到首条 system 消息之后，返回实际使用的片段。
+// 预算 = 上下文窗口 - 回复预留 - system 与本轮问题已占用的 token，且不超过 maxContextTokens；
+// 历史消息不计入预算，放不下时由后续的 assemblePrompt 从最旧的消息开始裁剪。
+// 检索失败不影响回答，只是不带笔记片段。
+func (o *MsgOrchestrator) augmentWithNotes(ctx context.Context, req transport.MsgRequest, msgs []openai.ChatCompletionMessage, reserve int) ([]openai.ChatCompletionMessage, []citedSource) {
+	query := retrievalQuery(req, msgs)
+	sources, err := o.retriever.Retrieve(ctx, query, retrieveLimit)
+	if err != nil || len(sources) == 0 {
+		return msgs, []citedSource{}
+	}
+
+	model := o.llm.GetModel()
+	info := models.Get(model)
+	used := 0
+	for i, m := range msgs {
+		if (i == 0 && m.Role == openai.ChatMessageRoleSystem) || i == len(msgs)-1 {
+			n, _ := llmutils.CountMessageTokens(model, m)
+			used += n
+		}
+	}
+	budget := min(info.ContextWindow-responseReserve(reserve, info)-used, maxContextTokens)
+
+	var b strings.Builder
+	b.WriteString(contextPromptHead)
+	cited := make([]citedSource, 0, len(sources))
+	spent, _ := llmutils.CountTokens(model, contextPromptHead)
+	for _, s := range sources {
+		if budget-spent < minPassageTokens {
+			break
+		}
+		passage := formatPassage(len(cited)+1, s)
+		n, _ := llmutils.CountTokens(model, passage)
+		if spent+n > budget {
+			continue // 放不下就尝试更短的下一段
+		}
+		b.WriteString("\n\n")
+		b.WriteString(passage)
+		spent += n
+		cited = append(cited, citedSource{ID: len(cited) + 1, Source: s})
+	}
+	if len(cited) == 0 {
+		return msgs, cited
+	}
+
+	// 片段放在 system 消息末尾：assemblePrompt 裁剪时始终保留首条 system
+	return appendSystem(msgs, b.String()), cited
+}
+
+// formatPassage 把一段笔记格式化为带编号和出处的片段
+func formatPassage(id int, s retrieval.Source) string {
+	loc := s.Path
+	if s.Heading != "" {
+		loc += " > " + s.Heading
+	}
+	return fmt.Sprintf("[%d] %s (L%d-L%d)\n%s", id, loc, s.StartLine, s.EndLine, s.Text)
+}
@@ -0,0 +1,128 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/obsidian-agent/biz/transport"
+	"github.com/obsidian-agent/internal/planner"
+)
+
+// errPlanRejected 表示用户在执行前拒绝了整份计划
+var errPlanRejected = errors.New("the user rejected the plan")
+
+// pendingReview 是一份等待用户审阅的计划
+type pendingReview struct {
+	runID    string
+	plan     *planner.Plan
+	decision chan *planner.Plan // 批准执行的计划（可能已删减或调整顺序）；nil 表示拒绝
+}
+
+// planReviewer 返回审阅模式下的 Reviewer：计划以 agent/plan（重新规划时为 agent/plan.replan）下发，
+// 带上 awaitingApproval 和 token，等待用户通过 agent/plan.review 批准、删减/调整步骤或拒绝。
+// 超时与确认相同，按 confirmTimeout 计算。
+func (o *MsgOrchestrator) planReviewer(req transport.MsgRequest, sink transport.Sender) planner.Reviewer {
+	return func(ctx context.Context, plan *planner.Plan, reason string) (*planner.Plan, error) {
+		token, err := newConfirmToken()
+		if err != nil {
+			return nil, err
+		}
+		p := &pendingReview{runID: req.ID, plan: plan, decision: make(chan *planner.Plan, 1)}
+		o.mu.Lock()
+		o.reviews[token] = p
+		o.mu.Unlock()
+		defer func() {
+			o.mu.Lock()
+			delete(o.reviews, token)
+			o.mu.Unlock()
+		}()
+
+		result := map[string]any{
+			"plan":             plan,
+			"awaitingApproval": true,
+			"timeoutSec":       int(confirmTimeout / time.Second),
+		}
+		if c := o.stepConfirmations(plan); len(c) > 0 {
+			result["confirmations"] = c
+		}
+		msg := transport.MsgResponse{Type: "agent/plan", ID: req.ID, Result: result, ConfirmToken: token}
+		if reason != "" {
+			msg.Type, msg.Text = "agent/plan.replan", reason
+		}
+		if err := sink.Send(msg); err != nil {
+			return nil, err
+		}
+
+		timer := time.NewTimer(confirmTimeout)
+		defer timer.Stop()
+		select {
+		case approved := <-p.decision:
+			if approved == nil {
+				return nil, planner.ErrPlanRejected
+			}
+			return approved, nil
+		case <-timer.C:
+			return nil, &runError{code: transport.ErrCodeConfirmTimeout, err: fmt.Errorf("no plan review within %s", confirmTimeout)}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// stepConfirmations 列出计划中会修改笔记等需要确认的步骤及其说明，供前端审阅时重点提示
+func (o *MsgOrchestrator) stepConfirmations(plan *planner.Plan) map[string]string {
+	out := make(map[string]string)
+	for _, s := range plan.Steps {
+		if s.Tool == "" {
+			continue
+		}
+		if description, need := o.tools.NeedsConfirmation(s.Tool, s.Args); need {
+			out[s.ID] = description
+		}
+	}
+	return out
+}
+
+// ReviewPlan 处理前端的 agent/plan.review 答复：approve 时可以用 Steps 删减或调整步骤顺序，
+// 裁剪后的计划不合法（如保留了依赖被删除步骤的步骤）时返回错误，计划继续等待审阅。
+func (o *MsgOrchestrator) ReviewPlan(req transport.MsgRequest, sink transport.Sender) error {
+	if req.ConfirmToken == "" {
+		return fail(sink, req.ID, transport.ErrCodeInvalidToken, errors.New("missing review token"))
+	}
+	o.mu.Lock()
+	p, ok := o.reviews[req.ConfirmToken]
+	o.mu.Unlock()
+	if !ok || p.runID != req.ID {
+		return fail(sink, req.ID, transport.ErrCodeInvalidToken, errors.New("unknown or expired review token"))
+	}
+
+	var approved *planner.Plan
+	switch req.Decision {
+	case transport.DecisionApprove:
+		approved = p.plan
+		if req.Steps != nil {
+			selected, err := p.plan.Select(req.Steps)
+			if err != nil {
+				return fail(sink, req.ID, transport.ErrCodeInvalidRequest, err)
+			}
+			approved = selected
+		}
+	case transport.DecisionReject:
+	default:
+		return fail(sink, req.ID, transport.ErrCodeInvalidRequest, fmt.Errorf("invalid decision %q", req.Decision))
+	}
+
+	// token 只能使用一次：校验期间计划可能已超时或被并发的答复取走
+	o.mu.Lock()
+	_, ok = o.reviews[req.ConfirmToken]
+	delete(o.reviews, req.ConfirmToken)
+	o.mu.Unlock()
+	if !ok {
+		return fail(sink, req.ID, transport.ErrCodeInvalidToken, errors.New("unknown or expired review token"))
+	}
+
+	p.decision <- approved
+	return nil
+}
@@ -0,0 +1,77 @@
+package orchestrator
+
+import (
+	"context"
+	"strings"
+
+	"github.com/obsidian-agent/biz/transport"
+	"github.com/obsidian-agent/pkg/llm/llmutils"
+	"github.com/sashabaranov/go-openai"
+)
+
+const sessionPromptHead = `以下是与用户此前对话的摘要，更早的细节已不在对话中，需要时可以请用户补充：`
+
+// SetSessions 启用服务端会话记忆：请求带 SessionID 时，此前的轮次取自服务端保存的记忆，
+// 前端传来的历史轮次被忽略
+func (o *MsgOrchestrator) SetSessions(h *llmutils.Histories) { o.sessions = h }
+
+// withSession 用会话记忆代替请求中的历史轮次：保留请求中的 system 消息和本轮的用户输入，
+// 中间换成原样保留的最近轮次。返回改写后的请求和本轮的用户输入。
+func withSession(req transport.MsgRequest, h *llmutils.History) (transport.MsgRequest, string) {
+	turn := strings.TrimSpace(req.Question)
+	if n := len(req.Messages); n > 0 {
+		last := req.Messages[n-1]
+		if strings.EqualFold(strings.TrimSpace(last.Role), openai.ChatMessageRoleUser) && strings.TrimSpace(last.Content) != "" {
+			turn = last.Content
+		}
+	}
+
+	var msgs []transport.ChatMessage
+	for _, m := range req.Messages {
+		if strings.EqualFold(strings.TrimSpace(m.Role), openai.ChatMessageRoleSystem) {
+			msgs = append(msgs, m)
+		}
+	}
+	for _, m := range h.Messages() {
+		msgs = append(msgs, transport.ChatMessage{Role: m.Role, Content: m.Content})
+	}
+	if turn != "" {
+		msgs = append(msgs, transport.ChatMessage{Role: openai.ChatMessageRoleUser, Content: turn})
+	}
+	req.Messages, req.Question = msgs, turn
+	return req, turn
+}
+
+// withSessionSummary 把会话的滚动摘要追加到首条 system 消息
+func withSessionSummary(msgs []openai.ChatCompletionMessage, summary string) []openai.ChatCompletionMessage {
+	if strings.TrimSpace(summary) == "" {
+		return msgs
+	}
+	text := sessionPromptHead + "\n" + summary
+	return appendSystem(msgs, text)
+}
+
+// recordTurn 把本轮的问答记入会话记忆，超过阈值时把较早的轮次折叠进摘要；
+// 返回随 agent/done 的 session 字段下发的状态，记忆写入或折叠失败只记在 error 中，不影响本轮结果。
+func recordTurn(ctx context.Context, h *llmutils.History, question, answer string) map[string]any {
+	out := map[string]any{"id": h.ID()}
+	err := h.Append(
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: question},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer},
+	)
+	if err == nil {
+		var folded bool
+		if folded, err = h.Compact(ctx); folded {
+			out["summarized"] = true
+		}
+	}
+	if err != nil {
+		out["error"] = err.Error()
+	}
+	st := h.State()
+	out["messages"] = len(st.Messages)
+	if st.Folded > 0 {
+		out["folded"] = st.Folded
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/obsidian-agent/biz/transport"
+	"github.com/obsidian-agent/internal/journal"
+	"github.com/obsidian-agent/internal/summarizer"
+	"github.com/obsidian-agent/internal/vault"
+	"github.com/sashabaranov/go-openai"
+)
+
+// summaryOutcome 描述本次总结的输入规模，随 agent/done 的 summary 字段下发
+type summaryOutcome struct {
+	Target string `json:"target"`
+	Notes  int    `json:"notes"`
+	Chunks int    `json:"chunks"`
+	Levels int    `json:"levels"` // Reduce 的层数，0 表示原文直接交给模型
+
+	docs []summarizer.Document
+}
+
+// condenseNotes 读取要总结的笔记或文件夹（请求的 Path，省略时为编辑器中的当前笔记），
+// 分层压缩到一次生成放得下的长度，进度以 agent/summarize.progress 推送；
+// 压缩结果拼进首条 system 消息，由后续的流式生成写出最终摘要。
+func (o *MsgOrchestrator) condenseNotes(ctx context.Context, req transport.MsgRequest, sink transport.Sender, msgs []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, *summaryOutcome, error) {
+	if o.vault == nil {
+		return msgs, nil, &runError{code: transport.ErrCodeUnavailable, err: errors.New("no vault is configured")}
+	}
+	target := req.Path
+	if target == "" && req.Context != nil {
+		target = req.Context.ActiveNote
+	}
+	if target == "" {
+		return msgs, nil, &runError{code: transport.ErrCodeInvalidRequest, err: errors.New("the summarize intent needs a path or an active note")}
+	}
+	if req.Output != "" {
+		if err := vault.CheckNoteTarget(req.Output); err != nil {
+			return msgs, nil, &runError{code: transport.ErrCodeInvalidRequest, err: err}
+		}
+		if o.vault.Exists(req.Output) {
+			return msgs, nil, &runError{code: transport.ErrCodeInvalidRequest, err: fmt.Errorf("note already exists: %s", vault.NotePath(req.Output))}
+		}
+	}
+	docs, err := summarizer.Collect(o.vault, target)
+	if err != nil {
+		return msgs, nil, &runError{code: transport.ErrCodeInvalidRequest, err: err}
+	}
+
+	res, err := o.summarizer.Condense(ctx, docs, summarizer.MapReduceOptions{
+		Focus: retrievalQuery(req, msgs),
+		OnProgress: func(p summarizer.Progress) {
+			_ = sink.Send(transport.MsgResponse{Type: "agent/summarize.progress", ID: req.ID, Text: p.Label, Result: map[string]any{"progress": p}})
+		},
+	})
+	if err != nil {
+		return msgs, nil, err
+	}
+
+	head := fmt.Sprintf("以下是要总结的内容（%s，共 %d 篇笔记）", target, res.Notes)
+	if res.Partials[0].Raw {
+		head += "，为笔记原文："
+	} else {
+		head += "，较长的部分已分段压缩为摘要："
+	}
+	text := head + "\n\n" + summarizer.FormatPartials(res.Partials)
+	out := &summaryOutcome{Target: target, Notes: res.Notes, Chunks: res.Chunks, Levels: res.Levels, docs: docs}
+
+	msgs = appendSystem(msgs, text)
+	return msgs, out, nil
+}
+
+// saveSummary 经用户确认后把最终摘要写入请求指定的新笔记，改动记入编辑日志，可以撤销。
+// 返回随 agent/done 的 output 字段下发的结果；写入失败不影响本次运行的结果。
+func (o *MsgOrchestrator) saveSummary(ctx context.Context, req transport.MsgRequest, sink transport.Sender, out *summaryOutcome, text string) (map[string]any, bool) {
+	path := vault.NotePath(req.Output)
+	result := map[string]any{"path": path}
+	approved, err := o.requestConfirmation(ctx, req, sink, "把总结写入新笔记 "+path, map[string]any{"path": path})
+	switch {
+	case err != nil:
+		result["error"] = err.Error()
+		return result, false
+	case !approved:
+		result["rejected"] = true
+		return result, false
+	}
+	res, err := summarizer.SaveSummary(journal.WithCall(ctx, journal.Call{RunID: req.ID, Tool: "summarize", CallID: "output"}), o.vault, path, out.docs, text)
+	if err != nil {
+		result["error"] = err.Error()
+		return result, false
+	}
+	result["created"] = res.Created
+	return result, true
+}
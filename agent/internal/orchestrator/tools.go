@@ -0,0 +1,230 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/obsidian-agent/biz/transport"
+	"github.com/obsidian-agent/internal/journal"
+	"github.com/obsidian-agent/pkg/llm/client"
+	"github.com/obsidian-agent/pkg/llm/llmutils"
+	"github.com/obsidian-agent/pkg/llm/models"
+	"github.com/obsidian-agent/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxToolIterations 是单次运行中模型最多发起工具调用的轮数，达到后强制模型直接作答
+const maxToolIterations = 5
+
+// toolTruncatedNote 附在被截断的工具结果末尾，提示模型结果不完整
+const toolTruncatedNote = "\n…[tool result truncated to fit the context window; narrow the request to see more]"
+
+// SetToolServer 设置可供模型调用的工具注册表
+func (o *MsgOrchestrator) SetToolServer(s *mcp.MCPServer) { o.tools = s }
+
+// toolsFor 返回本次运行可下发给模型的工具定义：
+// 需要前端允许、已配置工具注册表且模型支持工具调用。
+func (o *MsgOrchestrator) toolsFor(req transport.MsgRequest) []openai.Tool {
+	if !req.AllowTools || o.tools == nil || !models.Get(o.llm.GetModel()).Capabilities.Tools {
+		return nil
+	}
+	return client.ToolsFromMCP(o.tools.ListRegisteredTools())
+}
+
+// generation 是一次运行（可能包含多轮工具调用）的汇总结果
+type generation struct {
+	Text      string // 各轮回答文本的拼接，含工具调用前的过渡说明
+	Final     string // 最后一轮（没有工具调用）的回答，落到笔记的编辑只取这一轮
+	Usage     *openai.Usage
+	ToolCalls int
+}
+
+// generate 调用模型并驱动工具调用循环：
+// 模型请求工具时执行调用、把结果回填为 tool 消息后继续，直到模型给出最终回答。
+// budget 是 prompt 可用的 token 数（上下文窗口减去回复预留），回填的工具结果超出剩余预算时截断。
+func (o *MsgOrchestrator) generate(
+	ctx context.Context,
+	req transport.MsgRequest,
+	sink transport.Sender,
+	messages []openai.ChatCompletionMessage,
+	opts *client.ChatOptions,
+	budget int,
+	onDelta client.StreamHandler,
+) (generation, error) {
+	var gen generation
+	var text strings.Builder
+	usage := openai.Usage{}
+	hasUsage := false
+	first := len(messages) // 本次运行回填的消息从这里开始
+
+	for round := 0; ; round++ {
+		if err := o.trimToolResults(messages, first, budget); err != nil {
+			return gen, err
+		}
+		res, err := o.llm.StreamChatCompletion(ctx, messages, opts, onDelta)
+		if err != nil {
+			return gen, &runError{code: transport.ErrCodeLLM, err: err}
+		}
+		if res.Usage != nil {
+			hasUsage = true
+			usage.PromptTokens += res.Usage.PromptTokens
+			usage.CompletionTokens += res.Usage.CompletionTokens
+			usage.TotalTokens += res.Usage.TotalTokens
+		}
+		text.WriteString(res.Text)
+		if len(res.ToolCalls) == 0 {
+			gen.Final = res.Text
+			break
+		}
+		if round >= maxToolIterations {
+			return gen, &runError{code: transport.ErrCodeToolLoop, err: fmt.Errorf("model kept calling tools after %d rounds", maxToolIterations)}
+		}
+
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:      openai.ChatMessageRoleAssistant,
+			Content:   res.Text,
+			ToolCalls: res.ToolCalls,
+		})
+		for _, call := range res.ToolCalls {
+			msg, err := o.callTool(ctx, req, sink, call)
+			if err != nil {
+				return gen, err
+			}
+			if msg.Content, err = o.fitToolResult(messages, msg.Content, budget); err != nil {
+				return gen, err
+			}
+			messages = append(messages, msg)
+			gen.ToolCalls++
+		}
+		// 达到轮数上限：保留工具定义但禁止继续调用，迫使模型基于已有结果作答
+		if round+1 >= maxToolIterations {
+			opts.ToolChoice = "none"
+		}
+	}
+
+	gen.Text = text.String()
+	if hasUsage {
+		gen.Usage = &usage
+	}
+	return gen, nil
+}
+
+// fitToolResult 把工具结果截断到 messages 之后剩余的 prompt 预算以内，截断时在末尾注明
+func (o *MsgOrchestrator) fitToolResult(messages []openai.ChatCompletionMessage, content string, budget int) (string, error) {
+	model := o.llm.GetModel()
+	used, err := llmutils.CountMessagesTokens(model, messages)
+	if err != nil {
+		return "", err
+	}
+	note, err := llmutils.CountTokens(model, toolTruncatedNote)
+	if err != nil {
+		return "", err
+	}
+	// 每条消息另有角色等开销，见 CountMessageTokens
+	remaining := budget - used - 4
+	fitted, truncated, err := llmutils.FitTokens(model, content, remaining)
+	if err != nil || !truncated {
+		return fitted, err
+	}
+	fitted, _, err = llmutils.FitTokens(model, content, remaining-note)
+	return fitted + toolTruncatedNote, err
+}
+
+// trimToolResults 在调用模型前核对 prompt 总量：后续轮次追加的消息使总量超出 budget 时，
+// 从本次运行最早的工具结果开始截断，直到放得下
+func (o *MsgOrchestrator) trimToolResults(messages []openai.ChatCompletionMessage, first, budget int) error {
+	model := o.llm.GetModel()
+	total, err := llmutils.CountMessagesTokens(model, messages)
+	if err != nil {
+		return err
+	}
+	for i := first; i < len(messages) && total > budget; i++ {
+		if messages[i].Role != openai.ChatMessageRoleTool {
+			continue
+		}
+		content := strings.TrimSuffix(messages[i].Content, toolTruncatedNote)
+		n, err := llmutils.CountTokens(model, messages[i].Content)
+		if err != nil {
+			return err
+		}
+		if messages[i].Content, err = o.fitToolResult(nil, content, n-(total-budget)); err != nil {
+			return err
+		}
+		if total, err = llmutils.CountMessagesTokens(model, messages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callTool 执行一次工具调用并把过程推送给前端，返回回填给模型的 tool 消息。
+// 参数解析失败、工具不存在、执行出错或用户拒绝都会以错误文本回填，让模型有机会自我修正；
+// 只有等待确认超时或运行被取消时才返回 error 中止运行。
+func (o *MsgOrchestrator) callTool(ctx context.Context, req transport.MsgRequest, sink transport.Sender, call openai.ToolCall) (openai.ChatCompletionMessage, error) {
+	name := call.Function.Name
+	_ = sink.Send(transport.MsgResponse{
+		Type:   "tools/call.delta",
+		ID:     req.ID,
+		Text:   fmt.Sprintf("%s %s", name, call.Function.Arguments),
+		Result: map[string]any{"callId": call.ID, "name": name},
+	})
+
+	var res mcp.ToolCallResult
+	args, err := parseToolArguments(call.Function.Arguments)
+	if err != nil {
+		res = mcp.ToolCallResult{IsError: true, ErrorMessage: "invalid JSON arguments: " + err.Error()}
+	} else if approved, err := o.confirmToolCall(ctx, req, sink, name, args); err != nil {
+		return openai.ChatCompletionMessage{}, err
+	} else if !approved {
+		res = mcp.ToolCallResult{IsError: true, ErrorMessage: "the user rejected this action"}
+	} else if res, err = o.tools.CallTool(journal.WithCall(ctx, journal.Call{RunID: req.ID, Tool: name, CallID: call.ID}), name, args); err != nil {
+		res = mcp.ToolCallResult{IsError: true, ErrorMessage: err.Error()}
+	}
+
+	_ = sink.Send(transport.MsgResponse{Type: "tools/call.result", ID: req.ID, Result: toolCallResult(call, res)})
+	return openai.ChatCompletionMessage{
+		Role:       openai.ChatMessageRoleTool,
+		ToolCallID: call.ID,
+		Content:    res.Text(),
+	}, nil
+}
+
+// confirmToolCall 对声明了需要确认的工具，先征得用户同意；其余工具直接放行
+func (o *MsgOrchestrator) confirmToolCall(ctx context.Context, req transport.MsgRequest, sink transport.Sender, name string, args map[string]any) (bool, error) {
+	description, need := o.tools.NeedsConfirmation(name, args)
+	if !need {
+		return true, nil
+	}
+	return o.requestConfirmation(ctx, req, sink, description, map[string]any{"tool": name, "arguments": args})
+}
+
+// parseToolArguments 解析模型生成的参数 JSON，空串视为无参数
+func parseToolArguments(raw string) (map[string]any, error) {
+	args := map[string]any{}
+	if strings.TrimSpace(raw) == "" {
+		return args, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &args); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// toolCallResult 将工具结果整理成 tools/call.result 的 Result 字段
+func toolCallResult(call openai.ToolCall, res mcp.ToolCallResult) map[string]any {
+	out := map[string]any{
+		"callId":  call.ID,
+		"name":    call.Function.Name,
+		"isError": res.IsError,
+		"content": res.Content,
+	}
+	if res.ErrorMessage != "" {
+		out["errorMessage"] = res.ErrorMessage
+	}
+	if res.StructuredContent != nil {
+		out["structuredContent"] = res.StructuredContent
+	}
+	return out
+}
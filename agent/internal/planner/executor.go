@@ -0,0 +1,312 @@
+package planner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/obsidian-agent/internal/textutil"
+	"github.com/obsidian-agent/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	MaxParallel    = 4     // 同时执行的步骤数上限
+	MaxReplans     = 2     // 单次执行中重新规划的次数上限
+	maxOutputChars = 4000  // 步骤输出用于展示和重新规划时的最大字符数
+	maxInputChars  = 12000 // 模型步骤中每个依赖步骤输出的最大字符数
+)
+
+// 步骤状态
+const (
+	StatusRunning  = "running"
+	StatusDone     = "done"
+	StatusFailed   = "failed"
+	StatusRejected = "rejected" // 用户拒绝了该步骤的操作
+	StatusSkipped  = "skipped"  // 依赖的步骤未完成，没有执行
+)
+
+// ErrRejected 由 ToolCaller 返回，表示用户拒绝执行该步骤；被拒绝的步骤不会触发重新规划
+var ErrRejected = errors.New("the user rejected this step")
+
+// ErrPlanRejected 由 Reviewer 返回，表示用户拒绝了整份计划
+var ErrPlanRejected = errors.New("the user rejected the plan")
+
+// ToolCaller 执行一个工具步骤，args 已完成 {{引用}} 替换。
+// 返回 ErrRejected 表示用户拒绝；其他 error 表示运行应当中止（如被取消）。
+type ToolCaller func(ctx context.Context, step Step, args map[string]any) (mcp.ToolCallResult, error)
+
+// Reviewer 在计划执行前交给用户审阅，返回批准执行的计划（可能已删减或调整顺序）。
+// reason 为空表示初始计划，否则是触发重新规划的失败。返回 ErrPlanRejected 表示用户拒绝。
+type Reviewer func(ctx context.Context, plan *Plan, reason string) (*Plan, error)
+
+// StepResult 是一个步骤的执行结果
+type StepResult struct {
+	StepID string         `json:"stepId"`
+	Title  string         `json:"title,omitempty"`
+	Tool   string         `json:"tool,omitempty"`
+	Status string         `json:"status"`
+	Output string         `json:"output,omitempty"`
+	Error  string         `json:"error,omitempty"`
+	Args   map[string]any `json:"-"` // 实际使用的参数（已替换引用）
+
+	text string // 完整输出，Output 是截断后用于展示和重新规划的版本
+}
+
+// 执行事件类型
+const (
+	EventStep   = "step"   // 步骤开始或结束，Result 为当前状态
+	EventReplan = "replan" // 某步失败后生成了新计划
+)
+
+// Event 是执行过程中的进度事件
+type Event struct {
+	Type   string
+	Result StepResult // EventStep
+	Plan   *Plan      // EventReplan：新的计划
+	Reason string     // EventReplan：触发重新规划的失败
+}
+
+// Report 汇总一次执行：全部步骤的结果（按完成顺序）和最终使用的计划
+type Report struct {
+	Plan    *Plan
+	Results []StepResult
+	Replans int
+}
+
+// Outputs 返回已完成步骤的输出，按完成顺序
+func (r *Report) Outputs() []StepResult {
+	var out []StepResult
+	for _, res := range r.Results {
+		if res.Status == StatusDone {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// Executor 按依赖关系执行计划：互不依赖的步骤并行执行，某步失败时请 Planner 重新规划剩余工作
+type Executor struct {
+	planner *Planner
+	call    ToolCaller
+	onEvent func(Event)
+	review  Reviewer
+}
+
+// NewExecutor 创建执行器；onEvent 可为 nil，非 nil 时会在多个 goroutine 中被调用
+func NewExecutor(p *Planner, call ToolCaller, onEvent func(Event)) *Executor {
+	if onEvent == nil {
+		onEvent = func(Event) {}
+	}
+	return &Executor{planner: p, call: call, onEvent: onEvent}
+}
+
+// SetReviewer 设置审阅者：初始计划和每次重新规划得到的计划都要经它批准才执行
+func (e *Executor) SetReviewer(r Reviewer) { e.review = r }
+
+// Execute 执行计划直到全部步骤完成。步骤失败时先等正在执行的步骤结束，再重新规划剩余工作，
+// 最多 MaxReplans 次；仍失败时返回的 error 描述失败的步骤，Report 中保留已完成步骤的结果。
+// 设置了 Reviewer 时只执行它批准的步骤，用户拒绝时返回的 error 包含 ErrPlanRejected。
+func (e *Executor) Execute(ctx context.Context, plan *Plan) (*Report, error) {
+	report := &Report{Plan: plan}
+	if e.review != nil {
+		approved, err := e.review(ctx, plan, "")
+		if err != nil {
+			return report, err
+		}
+		report.Plan = approved
+	}
+	outputs := make(map[string]string) // 已完成步骤的输出，供 {{引用}} 和模型步骤使用
+	for {
+		failed, err := e.run(ctx, report.Plan, outputs, report)
+		if err != nil || failed == nil {
+			return report, err
+		}
+		if failed.Status == StatusRejected {
+			return report, fmt.Errorf("step %s: %s", failed.StepID, failed.Error)
+		}
+		if report.Replans >= MaxReplans {
+			return report, fmt.Errorf("step %s failed after %d replans: %s", failed.StepID, report.Replans, failed.Error)
+		}
+		next, err := e.planner.Replan(ctx, report.Plan, report.Outputs(), *failed)
+		if err != nil {
+			return report, fmt.Errorf("step %s failed: %s; replan: %w", failed.StepID, failed.Error, err)
+		}
+		if len(next.Steps) == 0 {
+			return report, fmt.Errorf("step %s failed and no alternative was found: %s", failed.StepID, failed.Error)
+		}
+		report.Replans++
+		reason := fmt.Sprintf("%s: %s", failed.StepID, failed.Error)
+		e.onEvent(Event{Type: EventReplan, Plan: next, Reason: reason})
+		if e.review != nil {
+			if next, err = e.review(ctx, next, reason); err != nil {
+				return report, fmt.Errorf("step %s failed: %s; replan: %w", failed.StepID, failed.Error, err)
+			}
+		}
+		report.Plan = next
+	}
+}
+
+// run 执行一份计划中尚未完成的步骤，返回第一个失败（或被拒绝）的步骤；全部完成时返回 nil
+func (e *Executor) run(ctx context.Context, plan *Plan, outputs map[string]string, report *Report) (*StepResult, error) {
+	type finished struct {
+		res StepResult
+		err error
+	}
+	pending := make(map[string]Step, len(plan.Steps))
+	for _, s := range plan.Steps {
+		pending[s.ID] = s
+	}
+	done := make(chan finished)
+	running := 0
+	limit := MaxParallel
+	if plan.Sequential {
+		limit = 1
+	}
+	var failed *StepResult
+	var abort error
+
+	for {
+		// 没有失败时启动依赖已满足的步骤（按计划中的顺序）
+		if failed == nil && abort == nil {
+			for _, s := range plan.Steps {
+				if running >= limit {
+					break
+				}
+				if _, ok := pending[s.ID]; !ok || !ready(s, outputs) {
+					continue
+				}
+				delete(pending, s.ID)
+				running++
+				e.onEvent(Event{Type: EventStep, Result: StepResult{StepID: s.ID, Title: s.Title, Tool: s.Tool, Status: StatusRunning}})
+				go func(s Step, deps map[string]string) {
+					res, err := e.step(ctx, plan, s, deps)
+					done <- finished{res, err}
+				}(s, snapshot(outputs, s.DependsOn))
+			}
+		}
+		if running == 0 {
+			break
+		}
+
+		f := <-done
+		running--
+		report.Results = append(report.Results, f.res)
+		e.onEvent(Event{Type: EventStep, Result: f.res})
+		switch {
+		case f.err != nil:
+			if abort == nil {
+				abort = f.err
+			}
+		case f.res.Status == StatusDone:
+			outputs[f.res.StepID] = f.res.text
+		case failed == nil:
+			r := f.res
+			failed = &r
+		}
+	}
+	if abort != nil {
+		return nil, abort
+	}
+	if failed == nil && len(pending) > 0 {
+		// 不会发生：Validate 保证依赖存在且无环
+		return nil, fmt.Errorf("plan has unreachable steps")
+	}
+	// 失败时未执行的步骤标记为跳过
+	if failed != nil {
+		for _, s := range plan.Steps {
+			if _, ok := pending[s.ID]; ok {
+				res := StepResult{StepID: s.ID, Title: s.Title, Tool: s.Tool, Status: StatusSkipped}
+				report.Results = append(report.Results, res)
+				e.onEvent(Event{Type: EventStep, Result: res})
+			}
+		}
+	}
+	return failed, nil
+}
+
+// ready 判断步骤的依赖是否都已完成
+func ready(s Step, outputs map[string]string) bool {
+	for _, d := range s.DependsOn {
+		if _, ok := outputs[d]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshot 复制步骤所依赖的输出，避免步骤 goroutine 与调度循环并发访问 map
+func snapshot(outputs map[string]string, ids []string) map[string]string {
+	out := make(map[string]string, len(ids))
+	for _, id := range ids {
+		out[id] = outputs[id]
+	}
+	return out
+}
+
+// step 执行单个步骤；只有需要中止整个执行时才返回 error
+func (e *Executor) step(ctx context.Context, plan *Plan, s Step, deps map[string]string) (StepResult, error) {
+	res := StepResult{StepID: s.ID, Title: s.Title, Tool: s.Tool}
+
+	if s.Tool == "" {
+		text, err := e.think(ctx, plan, s, deps)
+		if err != nil {
+			if ctx.Err() != nil {
+				return res, ctx.Err()
+			}
+			res.Status, res.Error = StatusFailed, err.Error()
+			return res, nil
+		}
+		res.Status, res.text, res.Output = StatusDone, text, textutil.Clip(text, maxOutputChars)
+		return res, nil
+	}
+
+	args, _ := substitute(s.Args, deps).(map[string]any)
+	if args == nil {
+		args = map[string]any{}
+	}
+	res.Args = args
+	out, err := e.call(ctx, s, args)
+	switch {
+	case errors.Is(err, ErrRejected):
+		res.Status, res.Error = StatusRejected, err.Error()
+	case err != nil:
+		return res, err
+	case out.IsError:
+		res.Status, res.Error = StatusFailed, out.Text()
+	default:
+		res.Status, res.text, res.Output = StatusDone, out.Text(), textutil.Clip(out.Text(), maxOutputChars)
+	}
+	return res, nil
+}
+
+// think 执行不调用工具的步骤：把目标、步骤要求和依赖步骤的输出交给模型
+func (e *Executor) think(ctx context.Context, plan *Plan, s Step, deps map[string]string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "总目标：%s\n\n当前步骤：%s", plan.Goal, s.Title)
+	if s.Expected != "" {
+		b.WriteString("\n预期产出：" + s.Expected)
+	}
+	for _, id := range s.DependsOn {
+		title := id
+		if d, ok := plan.Step(id); ok && d.Title != "" {
+			title = id + "（" + d.Title + "）"
+		}
+		fmt.Fprintf(&b, "\n\n步骤 %s 的输出：\n%s", title, textutil.Clip(deps[id], maxInputChars))
+	}
+	msgs := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "你在执行一个多步计划中的一步。只输出这一步的产出本身，不要解释过程，不要添加客套话。"},
+		{Role: openai.ChatMessageRoleUser, Content: b.String()},
+	}
+	opts := e.planner.opts
+	opts.Temperature = 0.4
+	resp, err := e.planner.llm.ChatCompletion(ctx, msgs, &opts)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("model returned no choices")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
@@ -0,0 +1,309 @@
+package planner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/obsidian-agent/pkg/mcp"
+)
+
+// newExecServer 注册 echo（返回 text 参数）、fail（总是失败）和 handlers 中的额外工具
+func newExecServer(t *testing.T, handlers map[string]mcp.ToolHandler) *mcp.MCPServer {
+	t.Helper()
+	srv := mcp.NewMCPServer()
+	register := func(name string, h mcp.ToolHandler) {
+		if err := srv.RegisterTool(&mcp.ToolDef{Name: name}, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := srv.RegisterTool(&mcp.ToolDef{
+		Name:        "echo",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"text":{"type":"string"}},"required":["text"]}`),
+	}, func(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+		return mcp.ToolCallResult{Content: []mcp.ContentPart{{Type: "text", Text: args["text"].(string)}}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	register("fail", func(context.Context, map[string]any) (mcp.ToolCallResult, error) {
+		return mcp.ToolCallResult{}, errors.New("boom")
+	})
+	for name, h := range handlers {
+		register(name, h)
+	}
+	return srv
+}
+
+// callServer 把工具步骤直接交给 srv 执行
+func callServer(srv *mcp.MCPServer) ToolCaller {
+	return func(ctx context.Context, s Step, args map[string]any) (mcp.ToolCallResult, error) {
+		return srv.CallTool(ctx, s.Tool, args)
+	}
+}
+
+// events 收集执行事件，onEvent 会在多个 goroutine 中被调用
+type events struct {
+	mu  sync.Mutex
+	all []Event
+}
+
+func (e *events) add(ev Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.all = append(e.all, ev)
+}
+
+func (e *events) count(typ, status string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := 0
+	for _, ev := range e.all {
+		if ev.Type == typ && (status == "" || ev.Result.Status == status) {
+			n++
+		}
+	}
+	return n
+}
+
+// statuses 按步骤 ID 汇总最终状态
+func statuses(r *Report) map[string]string {
+	out := make(map[string]string, len(r.Results))
+	for _, res := range r.Results {
+		out[res.StepID] = res.Status
+	}
+	return out
+}
+
+func TestExecutorRunsIndependentStepsInParallel(t *testing.T) {
+	started := make(chan string, 2)
+	gate := make(chan struct{})
+	srv := newExecServer(t, map[string]mcp.ToolHandler{
+		"wait": func(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+			name, _ := args["name"].(string)
+			started <- name
+			<-gate
+			return mcp.ToolCallResult{Content: []mcp.ContentPart{{Type: "text", Text: "out-" + name}}}, nil
+		},
+	})
+	llm := &fakeLLM{replies: []string{"  merged  "}}
+	ev := &events{}
+	exec := NewExecutor(New(llm, srv), callServer(srv), ev.add)
+	plan := &Plan{Goal: "g", Steps: []Step{
+		{ID: "a", Tool: "wait", Args: map[string]any{"name": "a"}},
+		{ID: "b", Tool: "wait", Args: map[string]any{"name": "b"}},
+		{ID: "m", Title: "merge", DependsOn: []string{"a", "b"}},
+		{ID: "w", Tool: "echo", Args: map[string]any{"text": "[{{m}}] {{a}}"}, DependsOn: []string{"m", "a"}},
+	}}
+
+	type result struct {
+		report *Report
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		r, err := exec.Execute(context.Background(), plan)
+		done <- result{r, err}
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("independent steps did not start together")
+		}
+	}
+	close(gate)
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+
+	last := res.report.Results[len(res.report.Results)-1]
+	if last.StepID != "w" || last.Output != "[merged] out-a" {
+		t.Fatalf("last result = %+v", last)
+	}
+	if len(llm.calls) != 1 {
+		t.Fatalf("model called %d times, want 1", len(llm.calls))
+	}
+	prompt := llm.calls[0][1].Content
+	for _, want := range []string{"当前步骤：merge", "步骤 a 的输出：\nout-a", "步骤 b 的输出：\nout-b"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("model step prompt misses %q:\n%s", want, prompt)
+		}
+	}
+	if n := ev.count(EventStep, StatusRunning); n != 4 {
+		t.Errorf("%d running events, want 4", n)
+	}
+}
+
+func TestExecutorSequentialPlan(t *testing.T) {
+	var active, peak atomic.Int32
+	srv := newExecServer(t, map[string]mcp.ToolHandler{
+		"slow": func(context.Context, map[string]any) (mcp.ToolCallResult, error) {
+			n := active.Add(1)
+			defer active.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return mcp.ToolCallResult{}, nil
+		},
+	})
+	exec := NewExecutor(New(&fakeLLM{}, srv), callServer(srv), nil)
+	plan := &Plan{Sequential: true, Steps: []Step{{ID: "c", Tool: "slow"}, {ID: "a", Tool: "slow"}, {ID: "b", Tool: "slow"}}}
+	report, err := exec.Execute(context.Background(), plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peak.Load() != 1 {
+		t.Fatalf("%d steps ran at once in a sequential plan", peak.Load())
+	}
+	var order []string
+	for _, r := range report.Results {
+		order = append(order, r.StepID)
+	}
+	if strings.Join(order, ",") != "c,a,b" {
+		t.Fatalf("order = %v", order)
+	}
+}
+
+func TestExecutorSkipsDependentsAndReplans(t *testing.T) {
+	srv := newExecServer(t, nil)
+	llm := &fakeLLM{replies: []string{
+		`{"steps": [{"id": "r1", "tool": "echo", "args": {"text": "again {{ok}}"}, "dependsOn": ["ok"]}]}`,
+	}}
+	ev := &events{}
+	exec := NewExecutor(New(llm, srv), callServer(srv), ev.add)
+	plan := &Plan{Goal: "g", Steps: []Step{
+		{ID: "ok", Tool: "echo", Args: map[string]any{"text": "first"}},
+		{ID: "bad", Tool: "fail"},
+		{ID: "after", Tool: "echo", Args: map[string]any{"text": "{{bad}}"}, DependsOn: []string{"bad"}},
+	}}
+	report, err := exec.Execute(context.Background(), plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"ok": StatusDone, "bad": StatusFailed, "after": StatusSkipped, "r1": StatusDone}
+	if got := statuses(report); !reflect.DeepEqual(got, want) {
+		t.Fatalf("statuses = %v, want %v", got, want)
+	}
+	if report.Replans != 1 || report.Plan.Steps[0].ID != "r1" {
+		t.Fatalf("replans = %d, plan = %+v", report.Replans, report.Plan)
+	}
+	if out := report.Results[len(report.Results)-1].Output; out != "again first" {
+		t.Fatalf("replanned step output = %q", out)
+	}
+	if ev.count(EventReplan, "") != 1 {
+		t.Fatal("no replan event")
+	}
+	replan := llm.calls[0][1].Content
+	if !strings.Contains(replan, "- ok：first") || !strings.Contains(replan, "失败的步骤：bad（fail）") {
+		t.Fatalf("replan prompt:\n%s", replan)
+	}
+}
+
+func TestExecutorStopsAfterMaxReplans(t *testing.T) {
+	srv := newExecServer(t, nil)
+	llm := &fakeLLM{replies: []string{
+		`{"steps": [{"id": "r1", "tool": "fail"}]}`,
+		`{"steps": [{"id": "r2", "tool": "fail"}]}`,
+		`{"steps": [{"id": "r3", "tool": "echo", "args": {"text": "never"}}]}`,
+	}}
+	exec := NewExecutor(New(llm, srv), callServer(srv), nil)
+	report, err := exec.Execute(context.Background(), &Plan{Steps: []Step{{ID: "s1", Tool: "fail"}}})
+	if err == nil || !strings.Contains(err.Error(), "step r2 failed after 2 replans") {
+		t.Fatalf("error = %v", err)
+	}
+	if report.Replans != MaxReplans || len(llm.calls) != MaxReplans {
+		t.Fatalf("replans = %d, model calls = %d", report.Replans, len(llm.calls))
+	}
+}
+
+func TestExecutorRejectedStepDoesNotReplan(t *testing.T) {
+	srv := newExecServer(t, nil)
+	llm := &fakeLLM{}
+	call := func(ctx context.Context, s Step, args map[string]any) (mcp.ToolCallResult, error) {
+		if s.ID == "s2" {
+			return mcp.ToolCallResult{}, ErrRejected
+		}
+		return srv.CallTool(ctx, s.Tool, args)
+	}
+	exec := NewExecutor(New(llm, srv), call, nil)
+	report, err := exec.Execute(context.Background(), &Plan{Sequential: true, Steps: []Step{
+		{ID: "s1", Tool: "echo", Args: map[string]any{"text": "x"}},
+		{ID: "s2", Tool: "echo", Args: map[string]any{"text": "y"}},
+		{ID: "s3", Tool: "echo", Args: map[string]any{"text": "z"}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), ErrRejected.Error()) {
+		t.Fatalf("error = %v", err)
+	}
+	if got := statuses(report); got["s1"] != StatusDone || got["s2"] != StatusRejected || got["s3"] != StatusSkipped {
+		t.Fatalf("statuses = %v", got)
+	}
+	if len(llm.calls) != 0 {
+		t.Fatal("rejected step triggered a replan")
+	}
+}
+
+func TestExecutorAbortDrainsRunningSteps(t *testing.T) {
+	slowStarted := make(chan struct{})
+	gate := make(chan struct{})
+	srv := newExecServer(t, map[string]mcp.ToolHandler{
+		"slow": func(context.Context, map[string]any) (mcp.ToolCallResult, error) {
+			close(slowStarted)
+			<-gate
+			return mcp.ToolCallResult{Content: []mcp.ContentPart{{Type: "text", Text: "slow done"}}}, nil
+		},
+	})
+	abort := errors.New("cancelled")
+	call := func(ctx context.Context, s Step, args map[string]any) (mcp.ToolCallResult, error) {
+		if s.ID == "abort" {
+			<-slowStarted
+			return mcp.ToolCallResult{}, abort
+		}
+		return srv.CallTool(ctx, s.Tool, args)
+	}
+	ev := &events{}
+	exec := NewExecutor(New(&fakeLLM{}, srv), call, ev.add)
+	plan := &Plan{Steps: []Step{
+		{ID: "abort", Tool: "echo", Args: map[string]any{"text": "x"}},
+		{ID: "slow", Tool: "slow"},
+		{ID: "next", Tool: "echo", Args: map[string]any{"text": "y"}, DependsOn: []string{"slow"}},
+	}}
+
+	type result struct {
+		report *Report
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		r, err := exec.Execute(context.Background(), plan)
+		done <- result{r, err}
+	}()
+	select {
+	case <-done:
+		t.Fatal("Execute returned before the running step finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(gate)
+	res := <-done
+	if !errors.Is(res.err, abort) {
+		t.Fatalf("error = %v, want %v", res.err, abort)
+	}
+	if got := statuses(res.report); got["slow"] != StatusDone || len(got) != 2 {
+		t.Fatalf("statuses = %v", got)
+	}
+	if n := ev.count(EventStep, StatusRunning); n != 2 {
+		t.Fatalf("%d steps started after the abort, want none", n-2)
+	}
+}
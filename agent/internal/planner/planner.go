@@ -1,5 +1,361 @@
+// Package planner 把用户的目标拆解为多步计划：由模型生成结构化的步骤（调用哪个工具、参数、依赖和预期产出），
+// 按已注册的工具校验后交给 Executor 执行。
 package planner
 
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/obsidian-agent/internal/textutil"
+	"github.com/obsidian-agent/pkg/llm/client"
+	"github.com/obsidian-agent/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	MaxSteps       = 12 // 一份计划最多的步骤数
+	maxPlanRetries = 2  // 计划不合法时把错误反馈给模型重新生成的次数
+)
+
+// Step 是计划中的一步。Tool 为空时是由模型完成的步骤（归纳、撰写等），输出文本供后续步骤引用；
+// Args 中的字符串可以用 {{步骤ID}} 引用所依赖步骤的输出，执行时替换。
+type Step struct {
+	ID        string         `json:"id"`
+	Title     string         `json:"title"`
+	Tool      string         `json:"tool,omitempty"`
+	Args      map[string]any `json:"args,omitempty"`
+	DependsOn []string       `json:"dependsOn,omitempty"`
+	Expected  string         `json:"expected,omitempty"` // 预期产出，用于模型步骤的要求和失败时的重新规划
+}
+
+// HasRefs 判断参数中是否引用了其他步骤的输出，即实际参数要到执行时才能确定
+func (s Step) HasRefs() bool { return len(refs(s.Args)) > 0 }
+
+// Plan 是一份待执行的计划
+type Plan struct {
+	Goal       string `json:"goal"`
+	Steps      []Step `json:"steps"`
+	Sequential bool   `json:"sequential,omitempty"` // 按 Steps 的顺序逐个执行（用户调整过顺序时）
+}
+
+// Step 按 ID 查找步骤
+func (p *Plan) Step(id string) (Step, bool) {
+	for _, s := range p.Steps {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return Step{}, false
+}
+
+// Select 按用户审阅的结果裁剪计划：只保留 ids 中的步骤，并按 ids 的顺序排列。
+// 保留的步骤所依赖的计划内步骤必须一并保留且排在它之前（依赖计划外已完成的步骤不受限制）。
+// 顺序与原计划不同时，新计划按该顺序逐个执行。
+func (p *Plan) Select(ids []string) (*Plan, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("no steps selected")
+	}
+	index := make(map[string]int, len(p.Steps))
+	for i, s := range p.Steps {
+		index[s.ID] = i
+	}
+	pos := make(map[string]int, len(ids))
+	for i, id := range ids {
+		if _, ok := index[id]; !ok {
+			return nil, fmt.Errorf("unknown step %q", id)
+		}
+		if _, dup := pos[id]; dup {
+			return nil, fmt.Errorf("step %s selected twice", id)
+		}
+		pos[id] = i
+	}
+
+	out := &Plan{Goal: p.Goal, Steps: make([]Step, 0, len(ids))}
+	var errs []error
+	for i, id := range ids {
+		s := p.Steps[index[id]]
+		for _, d := range s.DependsOn {
+			if _, inPlan := index[d]; !inPlan {
+				continue
+			}
+			switch j, kept := pos[d]; {
+			case !kept:
+				errs = append(errs, fmt.Errorf("step %s depends on dropped step %s", id, d))
+			case j > i:
+				errs = append(errs, fmt.Errorf("step %s must come after step %s", id, d))
+			}
+		}
+		if i > 0 && index[id] < index[ids[i-1]] {
+			out.Sequential = true
+		}
+		out.Steps = append(out.Steps, s)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// refRe 匹配参数中对其他步骤输出的引用 {{s1}}
+var refRe = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_\-]+)\s*\}\}`)
+
+// Planner 调用模型生成计划并校验
 type Planner struct {
+	llm   client.BaseClient
+	tools *mcp.MCPServer
+	opts  client.ChatOptions
+}
+
+// New 创建 Planner，tools 为计划可以使用的工具注册表
+func New(llm client.BaseClient, tools *mcp.MCPServer) *Planner {
+	return &Planner{
+		llm:   llm,
+		tools: tools,
+		opts:  client.ChatOptions{Temperature: 0.2, MaxTokens: 2000},
+	}
+}
+
+// Plan 为目标生成计划。background 是可选的补充信息（如编辑器中打开的笔记），会附在目标之后。
+// 模型输出不合法时把错误反馈给它重试，仍不合法则返回错误。
+func (p *Planner) Plan(ctx context.Context, goal, background string) (*Plan, error) {
+	user := "目标：" + goal
+	if background != "" {
+		user += "\n\n补充信息：\n" + background
+	}
+	return p.request(ctx, goal, user, nil)
 }
 
+// Replan 在某一步失败后重新规划剩余工作。done 是已完成步骤的结果，新计划可以依赖或引用这些步骤，
+// 但不能重复使用它们的 ID。
+func (p *Planner) Replan(ctx context.Context, prev *Plan, done []StepResult, failed StepResult) (*Plan, error) {
+	var b strings.Builder
+	b.WriteString("目标：" + prev.Goal + "\n\n原计划：\n")
+	raw, _ := json.MarshalIndent(prev.Steps, "", "  ")
+	b.Write(raw)
+	b.WriteString("\n\n已完成的步骤（可以在 dependsOn 中依赖、在参数中用 {{ID}} 引用，不要重复执行）：\n")
+	if len(done) == 0 {
+		b.WriteString("（无）\n")
+	}
+	for _, r := range done {
+		fmt.Fprintf(&b, "- %s：%s\n", r.StepID, textutil.Clip(r.Output, 500))
+	}
+	fmt.Fprintf(&b, "\n失败的步骤：%s（%s）\n错误：%s\n\n", failed.StepID, failed.Tool, failed.Error)
+	b.WriteString("请只为剩余的工作给出新的计划，绕开失败的原因；无法完成时返回空的 steps。")
+
+	doneIDs := make(map[string]bool, len(done))
+	for _, r := range done {
+		doneIDs[r.StepID] = true
+	}
+	return p.request(ctx, prev.Goal, b.String(), doneIDs)
+}
+
+// request 请求模型生成计划并校验，不合法时带上错误重试
+func (p *Planner) request(ctx context.Context, goal, user string, done map[string]bool) (*Plan, error) {
+	msgs := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: p.systemPrompt()},
+		{Role: openai.ChatMessageRoleUser, Content: user},
+	}
+	opts := p.opts
+	var lastErr error
+	for attempt := 0; attempt <= maxPlanRetries; attempt++ {
+		resp, err := p.llm.ChatCompletion(ctx, msgs, &opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 {
+			return nil, errors.New("model returned no choices")
+		}
+		text := resp.Choices[0].Message.Content
+		plan, err := parsePlan(text)
+		if err == nil {
+			plan.Goal = goal
+			err = p.Validate(plan, done)
+			if err == nil {
+				return plan, nil
+			}
+		}
+		lastErr = err
+		msgs = append(msgs,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: text},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "计划不合法：" + err.Error() + "\n请修正后重新输出完整的 JSON。"},
+		)
+	}
+	return nil, fmt.Errorf("invalid plan: %w", lastErr)
+}
+
+// systemPrompt 说明计划格式，并列出可用的工具及其参数 schema
+func (p *Planner) systemPrompt() string {
+	var b strings.Builder
+	b.WriteString(`你负责把用户的目标拆解为可执行的步骤。只输出一个 JSON 对象，不要输出其他内容：
+{"steps": [{"id": "s1", "title": "这一步做什么", "tool": "工具名", "args": {...}, "dependsOn": [], "expected": "预期产出"}]}
+
+规则：
+- id 在计划内唯一，只用字母、数字、-、_；dependsOn 列出必须先完成的步骤，互不依赖的步骤会并行执行。
+- tool 必须是下面列出的工具之一，args 必须符合它的参数 schema。
+- 需要归纳、撰写等不调用工具的步骤，省略 tool 和 args，在 title 和 expected 中写清要求，它的输出是一段文本。
+- args 中的字符串可以用 {{步骤ID}} 引用所依赖步骤的输出（该步骤必须出现在 dependsOn 中）。
+- 步骤尽量少，最多 ` + fmt.Sprint(MaxSteps) + ` 步；修改笔记前先读取它。
+
+可用工具：
+`)
+	if p.tools != nil {
+		for _, def := range p.tools.ListRegisteredTools() {
+			fmt.Fprintf(&b, "- %s：%s\n", def.Name, def.Description)
+			if len(def.InputSchema) > 0 {
+				var compact bytes.Buffer
+				if err := json.Compact(&compact, def.InputSchema); err == nil {
+					fmt.Fprintf(&b, "  参数：%s\n", compact.String())
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// parsePlan 从模型输出中取出 JSON 计划，容忍代码围栏和前后的说明文字
+func parsePlan(text string) (*Plan, error) {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("no JSON object in output")
+	}
+	var plan Plan
+	if err := json.Unmarshal([]byte(text[start:end+1]), &plan); err != nil {
+		return nil, fmt.Errorf("parse plan: %w", err)
+	}
+	return &plan, nil
+}
+
+// Validate 检查计划：步骤 ID 唯一、依赖存在且无环、{{引用}} 只指向依赖的步骤、
+// 工具已注册且参数符合其 schema。done 中的 ID 视为已完成的步骤，可被依赖但不能重复使用。
+func (p *Planner) Validate(plan *Plan, done map[string]bool) error {
+	if len(plan.Steps) > MaxSteps {
+		return fmt.Errorf("plan has %d steps, at most %d allowed", len(plan.Steps), MaxSteps)
+	}
+	var errs []error
+	ids := make(map[string]bool, len(plan.Steps))
+	for i, s := range plan.Steps {
+		switch {
+		case s.ID == "":
+			errs = append(errs, fmt.Errorf("step %d: missing id", i+1))
+		case ids[s.ID] || done[s.ID]:
+			errs = append(errs, fmt.Errorf("step %s: duplicate id", s.ID))
+		}
+		ids[s.ID] = true
+	}
+	for _, s := range plan.Steps {
+		deps := make(map[string]bool, len(s.DependsOn))
+		for _, d := range s.DependsOn {
+			if d == s.ID || !ids[d] && !done[d] {
+				errs = append(errs, fmt.Errorf("step %s: unknown dependency %q", s.ID, d))
+			}
+			deps[d] = true
+		}
+		for _, ref := range refs(s.Args) {
+			if !deps[ref] {
+				errs = append(errs, fmt.Errorf("step %s: references {{%s}} which is not in dependsOn", s.ID, ref))
+			}
+		}
+		switch {
+		case s.Tool == "" && len(s.Args) > 0:
+			errs = append(errs, fmt.Errorf("step %s: args given without a tool", s.ID))
+		case s.Tool == "" && s.Title == "":
+			errs = append(errs, fmt.Errorf("step %s: a step without a tool needs a title", s.ID))
+		case s.Tool != "" && p.tools == nil:
+			errs = append(errs, fmt.Errorf("step %s: no tools are available", s.ID))
+		case s.Tool != "":
+			if err := p.tools.ValidateArguments(s.Tool, s.Args); err != nil {
+				errs = append(errs, fmt.Errorf("step %s: %w", s.ID, err))
+			}
+		}
+	}
+	if len(errs) == 0 {
+		if cycle := findCycle(plan.Steps); cycle != "" {
+			errs = append(errs, fmt.Errorf("dependency cycle through step %s", cycle))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// findCycle 返回依赖环上的某个步骤 ID，无环时返回空串
+func findCycle(steps []Step) string {
+	deps := make(map[string][]string, len(steps))
+	for _, s := range steps {
+		deps[s.ID] = s.DependsOn
+	}
+	const (
+		visiting = 1
+		finished = 2
+	)
+	state := make(map[string]int, len(steps))
+	var visit func(id string) string
+	visit = func(id string) string {
+		switch state[id] {
+		case visiting:
+			return id
+		case finished:
+			return ""
+		}
+		state[id] = visiting
+		for _, d := range deps[id] {
+			if c := visit(d); c != "" {
+				return c
+			}
+		}
+		state[id] = finished
+		return ""
+	}
+	for _, s := range steps {
+		if c := visit(s.ID); c != "" {
+			return c
+		}
+	}
+	return ""
+}
+
+// refs 收集参数（含嵌套的数组和对象）中引用的步骤 ID
+func refs(v any) []string {
+	var out []string
+	switch x := v.(type) {
+	case string:
+		for _, m := range refRe.FindAllStringSubmatch(x, -1) {
+			out = append(out, m[1])
+		}
+	case map[string]any:
+		for _, e := range x {
+			out = append(out, refs(e)...)
+		}
+	case []any:
+		for _, e := range x {
+			out = append(out, refs(e)...)
+		}
+	}
+	return out
+}
+
+// substitute 把参数中的 {{ID}} 替换为对应步骤的输出，返回新的参数
+func substitute(v any, outputs map[string]string) any {
+	switch x := v.(type) {
+	case string:
+		return refRe.ReplaceAllStringFunc(x, func(m string) string {
+			return outputs[refRe.FindStringSubmatch(m)[1]]
+		})
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k, e := range x {
+			out[k] = substitute(e, outputs)
+		}
+		return out
+	case []any:
+		out := make([]any, len(x))
+		for i, e := range x {
+			out[i] = substitute(e, outputs)
+		}
+		return out
+	}
+	return v
+}
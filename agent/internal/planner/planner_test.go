@@ -0,0 +1,247 @@
+package planner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/obsidian-agent/pkg/llm/client"
+	"github.com/obsidian-agent/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+// fakeLLM 按顺序返回预设的回复，并记录收到的消息；执行器会在多个 goroutine 中调用它
+type fakeLLM struct {
+	mu      sync.Mutex
+	replies []string
+	calls   [][]openai.ChatCompletionMessage
+}
+
+func (f *fakeLLM) GetClient() *openai.Client { return nil }
+func (f *fakeLLM) GetModel() string          { return "fake" }
+
+func (f *fakeLLM) BuildMessages(msgs []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	return msgs
+}
+
+func (f *fakeLLM) ChatCompletion(_ context.Context, msgs []openai.ChatCompletionMessage, _ *client.ChatOptions) (openai.ChatCompletionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, msgs)
+	if len(f.replies) == 0 {
+		return openai.ChatCompletionResponse{}, errors.New("no more replies")
+	}
+	text := f.replies[0]
+	f.replies = f.replies[1:]
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: text}}}}, nil
+}
+
+func (f *fakeLLM) StreamChatCompletion(context.Context, []openai.ChatCompletionMessage, *client.ChatOptions, client.StreamHandler) (client.StreamResult, error) {
+	return client.StreamResult{}, errors.New("not implemented")
+}
+
+// newTestServer 注册 read（需要 path 参数）和 note（无参数）两个工具
+func newTestServer(t *testing.T) *mcp.MCPServer {
+	t.Helper()
+	srv := mcp.NewMCPServer()
+	echo := func(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+		raw, _ := json.Marshal(args)
+		return mcp.ToolCallResult{Content: []mcp.ContentPart{{Type: "text", Text: string(raw)}}}, nil
+	}
+	for _, def := range []*mcp.ToolDef{
+		{Name: "read", InputSchema: json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"}},"required":["path"],"additionalProperties":false}`)},
+		{Name: "note"},
+	} {
+		if err := srv.RegisterTool(def, echo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return srv
+}
+
+func TestValidate(t *testing.T) {
+	p := New(&fakeLLM{}, newTestServer(t))
+	tests := []struct {
+		name    string
+		steps   []Step
+		done    map[string]bool
+		wantErr string
+	}{
+		{
+			name: "valid",
+			steps: []Step{
+				{ID: "s1", Tool: "read", Args: map[string]any{"path": "a.md"}},
+				{ID: "s2", Title: "summarize", DependsOn: []string{"s1"}},
+				{ID: "s3", Tool: "read", Args: map[string]any{"path": "{{s2}}"}, DependsOn: []string{"s2", "d1"}},
+			},
+			done: map[string]bool{"d1": true},
+		},
+		{name: "missing id", steps: []Step{{Title: "x"}}, wantErr: "step 1: missing id"},
+		{name: "duplicate id", steps: []Step{{ID: "s1", Title: "x"}, {ID: "s1", Title: "y"}}, wantErr: "step s1: duplicate id"},
+		{name: "reuses done id", steps: []Step{{ID: "d1", Title: "x"}}, done: map[string]bool{"d1": true}, wantErr: "step d1: duplicate id"},
+		{name: "unknown dependency", steps: []Step{{ID: "s1", Title: "x", DependsOn: []string{"s9"}}}, wantErr: `step s1: unknown dependency "s9"`},
+		{name: "self dependency", steps: []Step{{ID: "s1", Title: "x", DependsOn: []string{"s1"}}}, wantErr: `step s1: unknown dependency "s1"`},
+		{
+			name:    "reference outside dependsOn",
+			steps:   []Step{{ID: "s1", Title: "x"}, {ID: "s2", Tool: "read", Args: map[string]any{"path": "{{ s1 }}"}}},
+			wantErr: "step s2: references {{s1}} which is not in dependsOn",
+		},
+		{name: "args without tool", steps: []Step{{ID: "s1", Title: "x", Args: map[string]any{"a": 1}}}, wantErr: "step s1: args given without a tool"},
+		{name: "model step without title", steps: []Step{{ID: "s1"}}, wantErr: "step s1: a step without a tool needs a title"},
+		{name: "unknown tool", steps: []Step{{ID: "s1", Tool: "nope"}}, wantErr: "step s1: unknown tool: nope"},
+		{name: "invalid args", steps: []Step{{ID: "s1", Tool: "read", Args: map[string]any{"file": "a.md"}}}, wantErr: "step s1:"},
+		{
+			name:    "cycle",
+			steps:   []Step{{ID: "s1", Title: "x", DependsOn: []string{"s2"}}, {ID: "s2", Title: "y", DependsOn: []string{"s1"}}},
+			wantErr: "dependency cycle through step s1",
+		},
+		{name: "too many steps", steps: make([]Step, MaxSteps+1), wantErr: "at most 12 allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Validate(&Plan{Steps: tt.steps}, tt.done)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateWithoutTools(t *testing.T) {
+	p := New(&fakeLLM{}, nil)
+	err := p.Validate(&Plan{Steps: []Step{{ID: "s1", Tool: "read"}}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "no tools are available") {
+		t.Fatalf("error = %v", err)
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []Step
+		want  string
+	}{
+		{name: "none", steps: []Step{{ID: "a"}, {ID: "b", DependsOn: []string{"a"}}, {ID: "c", DependsOn: []string{"a", "b"}}}},
+		{name: "diamond", steps: []Step{{ID: "a"}, {ID: "b", DependsOn: []string{"a"}}, {ID: "c", DependsOn: []string{"a"}}, {ID: "d", DependsOn: []string{"b", "c"}}}},
+		{name: "two steps", steps: []Step{{ID: "a", DependsOn: []string{"b"}}, {ID: "b", DependsOn: []string{"a"}}}, want: "a"},
+		{name: "longer", steps: []Step{{ID: "x"}, {ID: "a", DependsOn: []string{"x", "c"}}, {ID: "b", DependsOn: []string{"a"}}, {ID: "c", DependsOn: []string{"b"}}}, want: "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findCycle(tt.steps); got != tt.want {
+				t.Fatalf("findCycle = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefsAndSubstitute(t *testing.T) {
+	args := map[string]any{
+		"path":  "{{s1}}.md",
+		"n":     3,
+		"items": []any{"a {{ s2 }} b", map[string]any{"deep": "{{s1}}{{s3}}"}},
+	}
+	got := refs(args)
+	sort.Strings(got)
+	if want := []string{"s1", "s1", "s2", "s3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("refs = %v, want %v", got, want)
+	}
+
+	out := substitute(args, map[string]string{"s1": "Note", "s2": "X"})
+	want := map[string]any{
+		"path":  "Note.md",
+		"n":     3,
+		"items": []any{"a X b", map[string]any{"deep": "Note"}},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("substitute = %#v, want %#v", out, want)
+	}
+	if args["path"] != "{{s1}}.md" {
+		t.Fatal("substitute modified its input")
+	}
+}
+
+func TestPlanSelect(t *testing.T) {
+	plan := &Plan{Goal: "g", Steps: []Step{
+		{ID: "s1", Title: "a"},
+		{ID: "s2", Title: "b"},
+		{ID: "s3", Title: "c", DependsOn: []string{"s1", "done"}},
+	}}
+	tests := []struct {
+		name           string
+		ids            []string
+		want           []string
+		wantSequential bool
+		wantErr        string
+	}{
+		{name: "all in order", ids: []string{"s1", "s2", "s3"}, want: []string{"s1", "s2", "s3"}},
+		{name: "drop independent step", ids: []string{"s1", "s3"}, want: []string{"s1", "s3"}},
+		{name: "reordered", ids: []string{"s2", "s1", "s3"}, want: []string{"s2", "s1", "s3"}, wantSequential: true},
+		{name: "empty", wantErr: "no steps selected"},
+		{name: "unknown", ids: []string{"s9"}, wantErr: `unknown step "s9"`},
+		{name: "twice", ids: []string{"s1", "s1"}, wantErr: "step s1 selected twice"},
+		{name: "dropped dependency", ids: []string{"s2", "s3"}, wantErr: "step s3 depends on dropped step s1"},
+		{name: "dependency after", ids: []string{"s3", "s1"}, wantErr: "step s3 must come after step s1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := plan.Select(tt.ids)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, s := range got.Steps {
+				ids = append(ids, s.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) || got.Sequential != tt.wantSequential || got.Goal != "g" {
+				t.Fatalf("got steps %v sequential=%v goal=%q", ids, got.Sequential, got.Goal)
+			}
+		})
+	}
+}
+
+func TestPlannerRetriesInvalidPlan(t *testing.T) {
+	llm := &fakeLLM{replies: []string{
+		`{"steps": [{"id": "s1", "tool": "missing"}]}`,
+		"```json\n{\"steps\": [{\"id\": \"s1\", \"tool\": \"read\", \"args\": {\"path\": \"a.md\"}}]}\n```",
+	}}
+	plan, err := New(llm, newTestServer(t)).Plan(context.Background(), "read a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Goal != "read a" || len(plan.Steps) != 1 || plan.Steps[0].Tool != "read" {
+		t.Fatalf("plan = %+v", plan)
+	}
+	if len(llm.calls) != 2 {
+		t.Fatalf("model called %d times, want 2", len(llm.calls))
+	}
+	retry := llm.calls[1]
+	if last := retry[len(retry)-1].Content; !strings.Contains(last, "unknown tool: missing") {
+		t.Fatalf("retry did not include the validation error: %q", last)
+	}
+}
+
+func TestPlannerGivesUpAfterRetries(t *testing.T) {
+	llm := &fakeLLM{replies: []string{"no plan", `{"steps": [}`, `{"steps": [{"title": "x"}]}`}}
+	_, err := New(llm, newTestServer(t)).Plan(context.Background(), "g", "")
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid plan") {
+		t.Fatalf("error = %v", err)
+	}
+	if len(llm.calls) != maxPlanRetries+1 {
+		t.Fatalf("model called %d times, want %d", len(llm.calls), maxPlanRetries+1)
+	}
+}
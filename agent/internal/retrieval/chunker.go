@@ -0,0 +1,234 @@
+package retrieval
+
+import (
+	"strings"
+
+	"github.com/obsidian-agent/internal/vault"
+	"github.com/obsidian-agent/pkg/llm/llmutils"
+)
+
+const (
+	DefaultChunkTokens = 400 // 单个分块的 token 上限
+	minChunkTokens     = 48  // 小于该值的章节会与后续章节合并
+)
+
+// Chunk 是笔记中用于向量检索的一段连续文本
+type Chunk struct {
+	Path      string `json:"path"`
+	Heading   string `json:"heading,omitempty"` // 所在标题路径，如 "计划 > 第一季度"
+	StartLine int    `json:"startLine"`         // 起止行号（含），从 1 开始
+	EndLine   int    `json:"endLine"`
+	Text      string `json:"text"`
+	Tokens    int    `json:"tokens"`
+}
+
+// EmbedText 返回用于计算向量的文本：带上笔记标题和标题路径，让短小的分块也有足够的上下文
+func (c Chunk) EmbedText() string {
+	var b strings.Builder
+	b.WriteString(vault.NoteTitle(c.Path))
+	if c.Heading != "" {
+		b.WriteString(" > ")
+		b.WriteString(c.Heading)
+	}
+	b.WriteString("\n")
+	b.WriteString(c.Text)
+	return b.String()
+}
+
+// Chunker 按标题把笔记切分为不超过 token 上限的分块
+type Chunker struct {
+	MaxTokens int    // 单块 token 上限，默认 DefaultChunkTokens
+	Model     string // 计算 token 所用的模型名，决定分词器
+}
+
+func (c Chunker) count(s string) int {
+	n, _ := llmutils.CountTokens(c.Model, s)
+	return n
+}
+
+func (c Chunker) limit() int {
+	if c.MaxTokens <= 0 {
+		return DefaultChunkTokens
+	}
+	return c.MaxTokens
+}
+
+// section 是切分过程中的一段文本及其位置
+type section struct {
+	heading string
+	lines   []string
+	start   int // 首行行号
+}
+
+func (s section) text() string { return strings.Join(s.lines, "\n") }
+func (s section) end() int     { return s.start + len(s.lines) - 1 }
+
+// Split 切分一篇笔记：先按标题分节（代码块内的 # 不算标题），
+// 过长的章节再按段落、按行依次细分，过短的章节与后续章节合并。frontmatter 不参与切分。
+func (c Chunker) Split(notePath, content string) []Chunk {
+	_, body, bodyLine := vault.SplitFrontmatter(content)
+
+	// 1. 按标题分节
+	var sections []section
+	var stack []string // 各级标题文本，下标为级别-1
+	cur := section{start: bodyLine}
+	inFence := false
+	for i, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if vault.IsFence(line) {
+			inFence = !inFence
+		}
+		if level, text := vault.ParseHeading(line); level > 0 && !inFence {
+			if len(cur.lines) > 0 {
+				sections = append(sections, cur)
+			}
+			if len(stack) >= level {
+				stack = stack[:level-1]
+			}
+			for len(stack) < level-1 {
+				stack = append(stack, "")
+			}
+			stack = append(stack, text)
+			cur = section{heading: joinHeadings(stack), start: bodyLine + i}
+		}
+		cur.lines = append(cur.lines, line)
+	}
+	if len(cur.lines) > 0 {
+		sections = append(sections, cur)
+	}
+
+	// 2. 超长章节细分，过短章节合并
+	var out []Chunk
+	var pending *section
+	for _, s := range sections {
+		if pending != nil {
+			merged := section{heading: pending.heading, start: pending.start, lines: append(append([]string(nil), pending.lines...), s.lines...)}
+			if c.count(merged.text()) <= c.limit() {
+				s = merged
+			} else {
+				out = append(out, c.splitSection(notePath, *pending)...)
+			}
+			pending = nil
+		}
+		if c.count(s.text()) < minChunkTokens {
+			p := s
+			pending = &p
+			continue
+		}
+		out = append(out, c.splitSection(notePath, s)...)
+	}
+	if pending != nil {
+		out = append(out, c.splitSection(notePath, *pending)...)
+	}
+	return out
+}
+
+// splitSection 把一个章节切成不超过上限的分块：优先在空行（段落边界）处断开，段落本身过长时按行断开
+func (c Chunker) splitSection(notePath string, s section) []Chunk {
+	var out []Chunk
+	emit := func(lines []string, start int) {
+		text := strings.TrimSpace(strings.Join(lines, "\n"))
+		if level, _ := vault.ParseHeading(text); text == "" || (level > 0 && !strings.Contains(text, "\n")) {
+			return // 只有标题行的分块没有检索价值，标题已记录在其余分块的 Heading 中
+		}
+		out = append(out, Chunk{
+			Path:      notePath,
+			Heading:   s.heading,
+			StartLine: start,
+			EndLine:   start + len(lines) - 1,
+			Text:      text,
+			Tokens:    c.count(text),
+		})
+	}
+	if c.count(s.text()) <= c.limit() {
+		emit(s.lines, s.start)
+		return out
+	}
+
+	// 按段落分组，每组是一段连续行
+	var paras []section
+	para := section{start: s.start}
+	inFence := false
+	for i, line := range s.lines {
+		if vault.IsFence(line) {
+			inFence = !inFence
+		}
+		para.lines = append(para.lines, line)
+		if strings.TrimSpace(line) == "" && !inFence {
+			paras = append(paras, para)
+			para = section{start: s.start + i + 1}
+		}
+	}
+	if len(para.lines) > 0 {
+		paras = append(paras, para)
+	}
+
+	// 贪心装箱：段落能放下就继续累加，否则先输出当前块
+	var buf []string
+	bufStart := s.start
+	for _, p := range paras {
+		if len(buf) > 0 && c.count(strings.Join(append(append([]string(nil), buf...), p.lines...), "\n")) > c.limit() {
+			emit(buf, bufStart)
+			buf = nil
+		}
+		if len(buf) == 0 {
+			bufStart = p.start
+		}
+		if c.count(p.text()) <= c.limit() {
+			buf = append(buf, p.lines...)
+			continue
+		}
+		// 单个段落超长：按行装箱，单行超长时按字符硬切
+		for i, line := range p.lines {
+			lineNo := p.start + i
+			if len(buf) > 0 && c.count(strings.Join(append(append([]string(nil), buf...), line), "\n")) > c.limit() {
+				emit(buf, bufStart)
+				buf = nil
+			}
+			if len(buf) == 0 {
+				bufStart = lineNo
+			}
+			if c.count(line) <= c.limit() {
+				buf = append(buf, line)
+				continue
+			}
+			for _, piece := range c.hardSplit(line) {
+				emit([]string{piece}, lineNo)
+			}
+		}
+	}
+	if len(buf) > 0 {
+		emit(buf, bufStart)
+	}
+	return out
+}
+
+// hardSplit 把超长的单行按字符切成不超过上限的若干段
+func (c Chunker) hardSplit(line string) []string {
+	var out []string
+	runes := []rune(line)
+	for len(runes) > 0 {
+		// 先按比例估算切点，再逐步回退到上限以内
+		n := len(runes)
+		if t := c.count(string(runes)); t > c.limit() {
+			n = len(runes) * c.limit() / t
+		}
+		for n > 1 && c.count(string(runes[:n])) > c.limit() {
+			n = n * 9 / 10
+		}
+		n = max(n, 1)
+		out = append(out, string(runes[:n]))
+		runes = runes[n:]
+	}
+	return out
+}
+
+func joinHeadings(stack []string) string {
+	parts := make([]string, 0, len(stack))
+	for _, h := range stack {
+		if h != "" {
+			parts = append(parts, h)
+		}
+	}
+	return strings.Join(parts, " > ")
+}
@@ -0,0 +1,122 @@
+package retrieval
+
+import (
+	"strings"
+	"testing"
+)
+
+// testChunker 使用按字符估算 token 的模型，保证结果不依赖 tiktoken 编码能否下载
+func testChunker(max int) Chunker {
+	return Chunker{MaxTokens: max, Model: "deepseek-chat"}
+}
+
+// para 返回约 n 个 token 的一行英文（估算规则下每 3 字节约 1 token）
+func para(word string, n int) string {
+	return strings.TrimSpace(strings.Repeat(word+" ", n*3/(len(word)+1)))
+}
+
+func TestChunkerHeadingPaths(t *testing.T) {
+	content := "---\ntitle: x\n---\n" +
+		"# Plan\n" + para("alpha", 60) + "\n" +
+		"## Q1\n" + para("beta", 60) + "\n" +
+		"### Jan\n" + para("gamma", 60) + "\n" +
+		"## Q2\n" + para("delta", 60) + "\n" +
+		"# Notes\n" + para("eps", 60) + "\n"
+	chunks := testChunker(400).Split("dir/Note.md", content)
+
+	want := []struct {
+		heading    string
+		start, end int
+	}{
+		{"Plan", 4, 5},
+		{"Plan > Q1", 6, 7},
+		{"Plan > Q1 > Jan", 8, 9},
+		{"Plan > Q2", 10, 11},
+		{"Notes", 12, 13},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks: %+v", len(chunks), chunks)
+	}
+	for i, w := range want {
+		c := chunks[i]
+		if c.Heading != w.heading || c.StartLine != w.start || c.EndLine != w.end || c.Path != "dir/Note.md" {
+			t.Errorf("chunk %d = %q lines %d-%d, want %q lines %d-%d", i, c.Heading, c.StartLine, c.EndLine, w.heading, w.start, w.end)
+		}
+	}
+	if got := chunks[1].EmbedText(); !strings.HasPrefix(got, "Note > Plan > Q1\n## Q1\n") {
+		t.Errorf("EmbedText = %q", got[:min(len(got), 40)])
+	}
+}
+
+func TestChunkerSkipsHeadingsInCodeFences(t *testing.T) {
+	content := "# Setup\n" + para("install", 60) + "\n```sh\n# not a heading\necho hi\n```\n" + para("done", 60) + "\n"
+	chunks := testChunker(400).Split("a.md", content)
+	if len(chunks) != 1 || chunks[0].Heading != "Setup" || chunks[0].EndLine != 7 {
+		t.Fatalf("chunks = %+v", chunks)
+	}
+	if !strings.Contains(chunks[0].Text, "# not a heading") {
+		t.Errorf("fenced line missing from chunk text")
+	}
+}
+
+func TestChunkerMergesSmallSections(t *testing.T) {
+	content := "# A\nshort\n# B\ntiny\n# C\n" + para("long", 60) + "\n"
+	chunks := testChunker(400).Split("a.md", content)
+	if len(chunks) != 1 {
+		t.Fatalf("got %d chunks: %+v", len(chunks), chunks)
+	}
+	c := chunks[0]
+	if c.Heading != "A" || c.StartLine != 1 || c.EndLine != 6 {
+		t.Errorf("merged chunk = %q lines %d-%d", c.Heading, c.StartLine, c.EndLine)
+	}
+
+	// 合并后超过上限时，小章节单独成块
+	content = "# A\nshort\n# B\n" + para("long", 60) + "\n"
+	chunks = testChunker(60).Split("a.md", content)
+	if len(chunks) != 2 || chunks[0].Heading != "A" || chunks[1].Heading != "B" {
+		t.Fatalf("chunks = %+v", chunks)
+	}
+}
+
+func TestChunkerSplitsLongSections(t *testing.T) {
+	const limit = 50
+	c := testChunker(limit)
+	content := "# Long\n" + para("one", 30) + "\n\n" + para("two", 30) + "\n\n" +
+		para("three", 30) + "\n" + para("four", 30) + "\n" +
+		strings.Repeat("x", limit*3*5) + "\n"
+	chunks := c.Split("a.md", content)
+	if len(chunks) < 5 {
+		t.Fatalf("got %d chunks: %+v", len(chunks), chunks)
+	}
+	prevEnd := 0
+	for i, ch := range chunks {
+		if ch.Tokens > limit || c.count(ch.Text) > limit {
+			t.Errorf("chunk %d has %d tokens, limit %d", i, ch.Tokens, limit)
+		}
+		if ch.Heading != "Long" || ch.StartLine < prevEnd || ch.EndLine < ch.StartLine {
+			t.Errorf("chunk %d = %q lines %d-%d after line %d", i, ch.Heading, ch.StartLine, ch.EndLine, prevEnd)
+		}
+		prevEnd = ch.EndLine
+	}
+}
+
+func TestHardSplit(t *testing.T) {
+	const limit = 20
+	c := testChunker(limit)
+	for _, line := range []string{
+		strings.Repeat("abcdefghij", 50),
+		strings.Repeat("中文检索", 40),
+		strings.Repeat("mixed 混排 text ", 30),
+		"short",
+	} {
+		pieces := c.hardSplit(line)
+		if strings.Join(pieces, "") != line {
+			t.Fatalf("pieces do not reassemble the line %q", line[:20])
+		}
+		for i, p := range pieces {
+			if n := c.count(p); n > limit || p == "" {
+				t.Errorf("piece %d of %q has %d tokens", i, line[:10], n)
+			}
+		}
+	}
+}
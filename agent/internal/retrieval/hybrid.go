@@ -0,0 +1,144 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/obsidian-agent/internal/indexer"
+	"github.com/obsidian-agent/internal/search"
+)
+
+// rrfK 是倒数排名融合（Reciprocal Rank Fusion）的平滑常数
+const rrfK = 60
+
+// Source 是一段检索到的笔记内容及其出处
+type Source struct {
+	Path      string  `json:"path"`
+	Heading   string  `json:"heading,omitempty"`
+	StartLine int     `json:"startLine"`
+	EndLine   int     `json:"endLine"`
+	Score     float64 `json:"score"`
+	Text      string  `json:"-"` // 片段正文，用于拼进 prompt，不随结果下发
+}
+
+// Retriever 融合关键词检索（BM25）和向量检索的结果，以分块为单位返回
+type Retriever struct {
+	index   *indexer.Index
+	engine  *search.Engine
+	vectors *VectorIndex // 可为 nil，此时只做关键词检索
+	chunker Chunker
+}
+
+// NewRetriever 创建混合检索器；vectors 为 nil 时退化为纯关键词检索
+func NewRetriever(x *indexer.Index, engine *search.Engine, vectors *VectorIndex) *Retriever {
+	r := &Retriever{index: x, engine: engine, vectors: vectors}
+	if vectors != nil {
+		r.chunker = vectors.chunker
+	}
+	return r
+}
+
+// Retrieve 检索与 query 最相关的 limit 个分块。
+// 两路结果各取 2*limit 个候选，按倒数排名融合打分；向量检索失败（如嵌入服务不可用）时只使用关键词结果。
+func (r *Retriever) Retrieve(ctx context.Context, query string, limit int) ([]Source, error) {
+	query = strings.TrimSpace(query)
+	if query == "" || limit <= 0 {
+		return nil, nil
+	}
+	candidates := limit * 2
+
+	type fused struct {
+		chunk Chunk
+		score float64
+	}
+	byKey := make(map[string]*fused)
+	add := func(c Chunk, rank int) {
+		key := fmt.Sprintf("%s:%d", c.Path, c.StartLine)
+		f := byKey[key]
+		if f == nil {
+			f = &fused{chunk: c}
+			byKey[key] = f
+		}
+		f.score += 1 / float64(rrfK+rank+1)
+	}
+
+	// 关键词检索：自然语言问题里的引号不作为短语约束
+	hits, _, err := r.engine.Search(keywordQuery(query), search.Options{Limit: candidates})
+	if err != nil && !errors.Is(err, search.ErrEmptyQuery) {
+		return nil, err
+	}
+	for rank, h := range hits {
+		if c, ok := r.chunkAt(h.Path, h.Line); ok {
+			add(c, rank)
+		}
+	}
+
+	var vecErr error
+	if r.vectors != nil {
+		vhits, err := r.vectors.Search(ctx, query, candidates, nil)
+		vecErr = err
+		for rank, h := range vhits {
+			add(h.Chunk, rank)
+		}
+	}
+	if len(byKey) == 0 && vecErr != nil {
+		return nil, vecErr
+	}
+
+	out := make([]Source, 0, len(byKey))
+	for _, f := range byKey {
+		out = append(out, Source{
+			Path:      f.chunk.Path,
+			Heading:   f.chunk.Heading,
+			StartLine: f.chunk.StartLine,
+			EndLine:   f.chunk.EndLine,
+			Score:     float64(int64(f.score*1e5+0.5)) / 1e5,
+			Text:      f.chunk.Text,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].StartLine < out[j].StartLine
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// chunkAt 返回笔记中包含指定行的分块；优先复用向量索引中已切好的分块
+func (r *Retriever) chunkAt(rel string, line int) (Chunk, bool) {
+	var chunks []Chunk
+	if r.vectors != nil {
+		chunks = r.vectors.Chunks(rel)
+	}
+	if len(chunks) == 0 {
+		content, _, err := r.index.Vault().ReadNote(rel)
+		if err != nil {
+			return Chunk{}, false
+		}
+		chunks = r.chunker.Split(rel, content)
+	}
+	if len(chunks) == 0 {
+		return Chunk{}, false
+	}
+	for _, c := range chunks {
+		if line >= c.StartLine && line <= c.EndLine {
+			return c, true
+		}
+	}
+	return chunks[0], true
+}
+
+// keywordQuery 去掉自然语言问题中的引号，避免被解析为必须连续出现的短语
+func keywordQuery(q string) string {
+	return strings.NewReplacer(`"`, " ", "“", " ", "”", " ").Replace(q)
+}
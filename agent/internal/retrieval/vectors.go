@@ -0,0 +1,450 @@
+package retrieval
+
+import (
+	"container/heap"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/obsidian-agent/internal/indexer"
+	"github.com/obsidian-agent/pkg/llm/embedding"
+)
+
+// vectorsVersion 在持久化格式不兼容地变化时递增
+const vectorsVersion = 1
+
+// embedBatch 是同步时一次交给 Embedder 的分块数，跨笔记凑批以减少请求次数
+const embedBatch = 64
+
+// noteVectors 是一篇笔记的分块及其向量，Hash 与 indexer.Note.Hash 对应
+type noteVectors struct {
+	Hash    string
+	Chunks  []Chunk
+	Vectors [][]float32
+}
+
+// vectorFile 是向量索引的磁盘格式
+type vectorFile struct {
+	Version  int
+	Embedder string
+	Notes    map[string]*noteVectors
+}
+
+// VectorHit 是一条向量检索结果
+type VectorHit struct {
+	Chunk Chunk   `json:"chunk"`
+	Score float64 `json:"score"` // 余弦相似度
+}
+
+// VectorIndex 是本地的向量索引：按笔记保存分块向量，以笔记内容哈希判断是否需要重新计算，
+// 检索时对全部分块做暴力余弦 top-k。
+type VectorIndex struct {
+	embedder embedding.Embedder
+	chunker  Chunker
+
+	mu    sync.RWMutex
+	notes map[string]*noteVectors
+	dirty bool
+}
+
+// NewVectorIndex 创建向量索引
+func NewVectorIndex(e embedding.Embedder, chunker Chunker) *VectorIndex {
+	return &VectorIndex{
+		embedder: e,
+		chunker:  chunker,
+		notes:    make(map[string]*noteVectors),
+	}
+}
+
+// Embedder 返回索引使用的 Embedder
+func (v *VectorIndex) Embedder() embedding.Embedder { return v.embedder }
+
+// Len 返回已索引的笔记数和分块数
+func (v *VectorIndex) Len() (notes, chunks int) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, nv := range v.notes {
+		chunks += len(nv.Chunks)
+	}
+	return len(v.notes), chunks
+}
+
+// Chunks 返回一篇笔记已索引的分块
+func (v *VectorIndex) Chunks(rel string) []Chunk {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	nv, ok := v.notes[rel]
+	if !ok {
+		return nil
+	}
+	return append([]Chunk(nil), nv.Chunks...)
+}
+
+// Save 把索引写入磁盘（先写临时文件再重命名）
+func (v *VectorIndex) Save(file string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".vectors-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = gob.NewEncoder(tmp).Encode(vectorFile{Version: vectorsVersion, Embedder: v.embedder.Name(), Notes: v.notes})
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return err
+	}
+	v.dirty = false
+	return nil
+}
+
+// SaveIfDirty 仅在索引有未保存的变化时写盘
+func (v *VectorIndex) SaveIfDirty(file string) error {
+	v.mu.RLock()
+	dirty := v.dirty
+	v.mu.RUnlock()
+	if !dirty {
+		return nil
+	}
+	return v.Save(file)
+}
+
+// Load 从磁盘恢复索引；文件由其他 Embedder 生成时返回错误，索引保持不变
+func (v *VectorIndex) Load(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var vf vectorFile
+	if err := gob.NewDecoder(f).Decode(&vf); err != nil {
+		return fmt.Errorf("decode vector index: %w", err)
+	}
+	if vf.Version != vectorsVersion {
+		return fmt.Errorf("vector index version %d, want %d", vf.Version, vectorsVersion)
+	}
+	if vf.Embedder != v.embedder.Name() {
+		return fmt.Errorf("vector index built by %s, current embedder is %s", vf.Embedder, v.embedder.Name())
+	}
+	if vf.Notes == nil {
+		vf.Notes = make(map[string]*noteVectors)
+	}
+	v.mu.Lock()
+	v.notes = vf.Notes
+	v.dirty = false
+	v.mu.Unlock()
+	return nil
+}
+
+// SyncStats 汇总一次同步的结果
+type SyncStats struct {
+	Embedded  int `json:"embedded"`  // 重新计算向量的笔记数
+	Chunks    int `json:"chunks"`    // 重新计算的分块数
+	Removed   int `json:"removed"`   // 移除的笔记数
+	Unchanged int `json:"unchanged"` // 哈希未变、沿用已有向量的笔记数
+}
+
+// pendingNote 是等待计算向量的笔记
+type pendingNote struct {
+	path   string
+	hash   string
+	chunks []Chunk
+}
+
+// Sync 让向量索引与笔记索引保持一致：哈希变化的笔记重新切分并计算向量，已删除的笔记被移除
+func (v *VectorIndex) Sync(ctx context.Context, x *indexer.Index) (SyncStats, error) {
+	var stats SyncStats
+	notes := x.Notes()
+	alive := make(map[string]bool, len(notes))
+
+	var batch []pendingNote
+	batchChunks := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := v.embedNotes(ctx, batch); err != nil {
+			return err
+		}
+		stats.Embedded += len(batch)
+		stats.Chunks += batchChunks
+		batch, batchChunks = nil, 0
+		return nil
+	}
+
+	for _, n := range notes {
+		alive[n.Path] = true
+		v.mu.RLock()
+		nv, ok := v.notes[n.Path]
+		v.mu.RUnlock()
+		if ok && nv.Hash == n.Hash {
+			stats.Unchanged++
+			continue
+		}
+		p, err := v.prepare(x, n.Path)
+		if err != nil {
+			continue // 读取失败的笔记留待下次同步
+		}
+		batch = append(batch, p)
+		batchChunks += len(p.chunks)
+		if batchChunks >= embedBatch {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return stats, err
+	}
+
+	v.mu.Lock()
+	for p := range v.notes {
+		if !alive[p] {
+			delete(v.notes, p)
+			stats.Removed++
+			v.dirty = true
+		}
+	}
+	v.mu.Unlock()
+	return stats, nil
+}
+
+// Update 重新计算一篇笔记的向量；内容哈希未变时直接返回，笔记已不在索引中时移除
+func (v *VectorIndex) Update(ctx context.Context, x *indexer.Index, rel string) error {
+	n, ok := x.Note(rel)
+	if !ok {
+		v.Remove(rel)
+		return nil
+	}
+	v.mu.RLock()
+	nv, ok := v.notes[n.Path]
+	v.mu.RUnlock()
+	if ok && nv.Hash == n.Hash {
+		return nil
+	}
+	p, err := v.prepare(x, n.Path)
+	if err != nil {
+		return err
+	}
+	return v.embedNotes(ctx, []pendingNote{p})
+}
+
+// Remove 移除一篇笔记的向量
+func (v *VectorIndex) Remove(rel string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.notes[rel]; ok {
+		delete(v.notes, rel)
+		v.dirty = true
+	}
+}
+
+// Apply 根据索引变化事件增量更新向量
+func (v *VectorIndex) Apply(ctx context.Context, x *indexer.Index, events []indexer.Event) error {
+	var errs []error
+	for _, ev := range events {
+		switch ev.Type {
+		case indexer.EventDeleted:
+			v.Remove(ev.Path)
+		case indexer.EventRenamed:
+			v.rename(ev.OldPath, ev.Path)
+			errs = append(errs, v.Update(ctx, x, ev.Path))
+		default:
+			errs = append(errs, v.Update(ctx, x, ev.Path))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// rename 重命名时内容未变，直接迁移已有向量，避免重新计算
+func (v *VectorIndex) rename(from, to string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	nv, ok := v.notes[from]
+	if !ok {
+		return
+	}
+	delete(v.notes, from)
+	moved := &noteVectors{Hash: nv.Hash, Vectors: nv.Vectors, Chunks: make([]Chunk, len(nv.Chunks))}
+	for i, c := range nv.Chunks {
+		c.Path = to
+		moved.Chunks[i] = c
+	}
+	v.notes[to] = moved
+	v.dirty = true
+}
+
+func (v *VectorIndex) prepare(x *indexer.Index, rel string) (pendingNote, error) {
+	n, ok := x.Note(rel)
+	if !ok {
+		return pendingNote{}, fmt.Errorf("note not indexed: %s", rel)
+	}
+	content, _, err := x.Vault().ReadNote(rel)
+	if err != nil {
+		return pendingNote{}, err
+	}
+	return pendingNote{path: n.Path, hash: n.Hash, chunks: v.chunker.Split(n.Path, content)}, nil
+}
+
+// embedNotes 为一批笔记的全部分块计算向量并写入索引
+func (v *VectorIndex) embedNotes(ctx context.Context, batch []pendingNote) error {
+	var texts []string
+	for _, p := range batch {
+		for _, c := range p.chunks {
+			texts = append(texts, c.EmbedText())
+		}
+	}
+	var vecs [][]float32
+	if len(texts) > 0 {
+		var err error
+		if vecs, err = v.embedder.Embed(ctx, texts); err != nil {
+			return err
+		}
+		if len(vecs) != len(texts) {
+			return fmt.Errorf("embedder returned %d vectors for %d texts", len(vecs), len(texts))
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	i := 0
+	for _, p := range batch {
+		nv := &noteVectors{Hash: p.hash, Chunks: p.chunks, Vectors: make([][]float32, len(p.chunks))}
+		for k := range p.chunks {
+			nv.Vectors[k] = embedding.Normalize(vecs[i])
+			i++
+		}
+		v.notes[p.path] = nv
+	}
+	v.dirty = true
+	return nil
+}
+
+// Search 计算查询文本的向量并返回最相似的 k 个分块；filter 不为 nil 时只考虑其返回 true 的笔记
+func (v *VectorIndex) Search(ctx context.Context, query string, k int, filter func(path string) bool) ([]VectorHit, error) {
+	vecs, err := v.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vecs) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for 1 text", len(vecs))
+	}
+	return v.SearchVector(embedding.Normalize(vecs[0]), k, filter), nil
+}
+
+// SearchVector 用已归一化的查询向量做余弦 top-k
+func (v *VectorIndex) SearchVector(q []float32, k int, filter func(path string) bool) []VectorHit {
+	if k <= 0 {
+		return nil
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	h := &hitHeap{}
+	for p, nv := range v.notes {
+		if filter != nil && !filter(p) {
+			continue
+		}
+		for i, vec := range nv.Vectors {
+			if len(vec) != len(q) {
+				continue
+			}
+			var dot float64
+			for j := range q {
+				dot += float64(q[j]) * float64(vec[j])
+			}
+			if h.Len() < k {
+				heap.Push(h, VectorHit{Chunk: nv.Chunks[i], Score: dot})
+			} else if dot > (*h)[0].Score {
+				(*h)[0] = VectorHit{Chunk: nv.Chunks[i], Score: dot}
+				heap.Fix(h, 0)
+			}
+		}
+	}
+	out := []VectorHit(*h)
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		if out[i].Chunk.Path != out[j].Chunk.Path {
+			return out[i].Chunk.Path < out[j].Chunk.Path
+		}
+		return out[i].Chunk.StartLine < out[j].Chunk.StartLine
+	})
+	return out
+}
+
+// NoteSimilarity 返回笔记 rel 与 others 中每篇笔记的语义相似度：
+// 以各自全部分块向量的均值（归一化后）求余弦。rel 或 others 中尚未计算向量的笔记不出现在结果中。
+func (v *VectorIndex) NoteSimilarity(rel string, others []string) map[string]float64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	out := make(map[string]float64)
+	nv, ok := v.notes[rel]
+	if !ok {
+		return out
+	}
+	base := centroid(nv.Vectors)
+	if base == nil {
+		return out
+	}
+	for _, p := range others {
+		o, ok := v.notes[p]
+		if !ok {
+			continue
+		}
+		c := centroid(o.Vectors)
+		if len(c) != len(base) {
+			continue
+		}
+		var dot float64
+		for j := range base {
+			dot += float64(base[j]) * float64(c[j])
+		}
+		out[p] = dot
+	}
+	return out
+}
+
+// centroid 返回一组向量的归一化均值，维度不一致的向量被忽略
+func centroid(vecs [][]float32) []float32 {
+	if len(vecs) == 0 {
+		return nil
+	}
+	sum := make([]float32, len(vecs[0]))
+	for _, vec := range vecs {
+		if len(vec) != len(sum) {
+			continue
+		}
+		for j, x := range vec {
+			sum[j] += x
+		}
+	}
+	return embedding.Normalize(sum)
+}
+
+// hitHeap 是按得分排序的小顶堆，用于维护 top-k
+type hitHeap []VectorHit
+
+func (h hitHeap) Len() int           { return len(h) }
+func (h hitHeap) Less(i, j int) bool { return h[i].Score < h[j].Score }
+func (h hitHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *hitHeap) Push(x any)        { *h = append(*h, x.(VectorHit)) }
+func (h *hitHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
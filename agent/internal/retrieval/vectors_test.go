@@ -0,0 +1,202 @@
+package retrieval
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/obsidian-agent/internal/indexer"
+	"github.com/obsidian-agent/internal/vault"
+	"github.com/obsidian-agent/pkg/llm/embedding"
+)
+
+// testVault 在临时目录中创建仓库和笔记索引
+func testVault(t *testing.T, notes map[string]string) (string, *indexer.Index) {
+	t.Helper()
+	root := t.TempDir()
+	for rel, content := range notes {
+		writeNote(t, root, rel, content)
+	}
+	v, err := vault.New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := indexer.New(v)
+	if err := x.Build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return root, x
+}
+
+func writeNote(t *testing.T, root, rel, content string) {
+	t.Helper()
+	abs := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(abs, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countingEmbedder 记录计算过向量的文本数
+type countingEmbedder struct {
+	*embedding.HashEmbedder
+	texts int
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.texts += len(texts)
+	return e.HashEmbedder.Embed(ctx, texts)
+}
+
+func TestVectorIndexSyncAndApply(t *testing.T) {
+	ctx := context.Background()
+	root, x := testVault(t, map[string]string{
+		"a.md": "apples and pears",
+		"b.md": "# Cars\nfast red cars",
+	})
+	emb := &countingEmbedder{HashEmbedder: embedding.NewHashEmbedder(64)}
+	v := NewVectorIndex(emb, testChunker(400))
+
+	stats, err := v.Sync(ctx, x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (SyncStats{Embedded: 2, Chunks: 2}) {
+		t.Fatalf("first sync = %+v", stats)
+	}
+	if stats, _ = v.Sync(ctx, x); stats != (SyncStats{Unchanged: 2}) {
+		t.Fatalf("second sync = %+v", stats)
+	}
+
+	// 改写 a.md、删除 b.md 后同步：只重新计算 a.md
+	writeNote(t, root, "a.md", "apples and plums")
+	os.Remove(filepath.Join(root, "b.md"))
+	if _, err := x.Update("a.md"); err != nil {
+		t.Fatal(err)
+	}
+	x.Remove("b.md")
+	emb.texts = 0
+	if stats, _ = v.Sync(ctx, x); stats != (SyncStats{Embedded: 1, Chunks: 1, Removed: 1}) {
+		t.Fatalf("sync after edits = %+v", stats)
+	}
+	if emb.texts != 1 {
+		t.Errorf("embedded %d texts, want 1", emb.texts)
+	}
+
+	// 重命名沿用已有向量，不重新计算
+	if err := os.Rename(filepath.Join(root, "a.md"), filepath.Join(root, "fruit.md")); err != nil {
+		t.Fatal(err)
+	}
+	x.Remove("a.md")
+	if _, err := x.Update("fruit.md"); err != nil {
+		t.Fatal(err)
+	}
+	emb.texts = 0
+	if err := v.Apply(ctx, x, []indexer.Event{{Type: indexer.EventRenamed, Path: "fruit.md", OldPath: "a.md"}}); err != nil {
+		t.Fatal(err)
+	}
+	if emb.texts != 0 {
+		t.Errorf("rename re-embedded %d texts", emb.texts)
+	}
+	if notes, _ := v.Len(); notes != 1 || v.Chunks("a.md") != nil {
+		t.Fatalf("old path still indexed")
+	}
+	if chunks := v.Chunks("fruit.md"); len(chunks) != 1 || chunks[0].Path != "fruit.md" {
+		t.Fatalf("chunks after rename = %+v", chunks)
+	}
+
+	// 新建和删除事件
+	writeNote(t, root, "c.md", "blue boats")
+	if _, err := x.Update("c.md"); err != nil {
+		t.Fatal(err)
+	}
+	err = v.Apply(ctx, x, []indexer.Event{
+		{Type: indexer.EventCreated, Path: "c.md"},
+		{Type: indexer.EventDeleted, Path: "fruit.md"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notes, chunks := v.Len(); notes != 1 || chunks != 1 || v.Chunks("c.md") == nil {
+		t.Fatalf("after apply: %d notes, %d chunks", notes, chunks)
+	}
+}
+
+func TestVectorIndexSaveLoad(t *testing.T) {
+	ctx := context.Background()
+	_, x := testVault(t, map[string]string{
+		"a.md": "apples and pears",
+		"b.md": "fast red cars",
+	})
+	v := NewVectorIndex(embedding.NewHashEmbedder(64), testChunker(400))
+	if _, err := v.Sync(ctx, x); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "vectors", "v.gob")
+	if err := v.Save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewVectorIndex(embedding.NewHashEmbedder(64), testChunker(400))
+	if err := loaded.Load(file); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.notes, v.notes) {
+		t.Fatalf("loaded index differs from saved one")
+	}
+	if stats, _ := loaded.Sync(ctx, x); stats.Embedded != 0 {
+		t.Errorf("sync after load re-embedded %d notes", stats.Embedded)
+	}
+
+	other := NewVectorIndex(embedding.NewHashEmbedder(32), testChunker(400))
+	if err := other.Load(file); err == nil {
+		t.Error("loading a file from another embedder should fail")
+	}
+	if notes, _ := other.Len(); notes != 0 {
+		t.Error("failed load modified the index")
+	}
+}
+
+func TestVectorIndexSearchOrder(t *testing.T) {
+	ctx := context.Background()
+	_, x := testVault(t, map[string]string{
+		"exact.md":   "red apple pie",
+		"partial.md": "red car",
+		"none.md":    "blue ocean waves",
+		"dir/pie.md": "apple pie recipe with red apple",
+	})
+	v := NewVectorIndex(embedding.NewHashEmbedder(256), testChunker(400))
+	if _, err := v.Sync(ctx, x); err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err := v.Search(ctx, "exact red apple pie", 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 3 || hits[0].Chunk.Path != "exact.md" {
+		t.Fatalf("hits = %+v", hits)
+	}
+	for i := 1; i < len(hits); i++ {
+		if hits[i].Score > hits[i-1].Score {
+			t.Errorf("hits not sorted by score: %+v", hits)
+		}
+	}
+
+	hits, _ = v.Search(ctx, "exact red apple pie", 10, func(p string) bool { return p != "exact.md" })
+	if len(hits) != 3 {
+		t.Fatalf("filtered hits = %+v", hits)
+	}
+	for _, h := range hits {
+		if h.Chunk.Path == "exact.md" {
+			t.Errorf("filter ignored: %+v", h)
+		}
+	}
+	if hits, _ := v.Search(ctx, "apple", 0, nil); hits != nil {
+		t.Errorf("k=0 returned %+v", hits)
+	}
+}
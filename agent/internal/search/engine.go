@@ -0,0 +1,329 @@
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/obsidian-agent/internal/indexer"
+	"github.com/obsidian-agent/internal/textutil"
+	"github.com/obsidian-agent/internal/vault"
+)
+
+// BM25 参数
+const (
+	bm25K1     = 1.2
+	bm25B      = 0.75
+	titleBoost = 2.0 // 标题命中的权重倍数
+)
+
+// posting 记录一个词项在一篇笔记中的出现情况
+type posting struct {
+	tf        int   // 正文中的词频
+	positions []int // 正文中的词项位置，用于短语匹配
+	joined    []int // 与前一个词项重叠的位置（同一段 CJK 文本中非首个二元组），用于单字计数
+	titleTF   int   // 标题中的词频
+}
+
+// document 是倒排索引中的一篇笔记
+type document struct {
+	path     string
+	title    string
+	length   int // 正文词项数
+	titleLen int
+	terms    []string // 该笔记出现过的词项，删除时据此清理倒排表
+}
+
+// Engine 是基于 BM25 的嵌入式全文检索引擎，笔记元数据（标签、标题）来自 indexer.Index。
+// 引擎只保存倒排表，不保存正文；摘要在查询时按需从磁盘读取。
+type Engine struct {
+	index *indexer.Index
+
+	mu       sync.RWMutex
+	docs     map[string]*document
+	postings map[string]map[string]*posting // term → path → posting
+	byRune   map[rune]map[string]struct{}   // CJK 字 → 包含它的词项（二元组及单字），用于展开单字查询
+	totalLen int
+	titleLen int
+}
+
+// NewEngine 创建一个检索引擎，调用 Build 后可用
+func NewEngine(x *indexer.Index) *Engine {
+	return &Engine{
+		index:    x,
+		docs:     make(map[string]*document),
+		postings: make(map[string]map[string]*posting),
+		byRune:   make(map[rune]map[string]struct{}),
+	}
+}
+
+// Build 为索引中的全部笔记建立倒排表
+func (e *Engine) Build(ctx context.Context) error {
+	for _, n := range e.index.Notes() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := e.Update(n.Path); err != nil {
+			continue // 单篇笔记读取失败不影响整体
+		}
+	}
+	return nil
+}
+
+// Update 重新读取并索引一篇笔记；笔记不存在时从倒排表中移除
+func (e *Engine) Update(rel string) error {
+	content, info, err := e.index.Vault().ReadNote(rel)
+	if err != nil {
+		e.Remove(rel)
+		return err
+	}
+	e.Put(info.Path, content)
+	return nil
+}
+
+// Put 用给定内容索引一篇笔记，frontmatter 不参与检索
+func (e *Engine) Put(rel, content string) {
+	_, body, _ := vault.SplitFrontmatter(content)
+	title := vault.NoteTitle(rel)
+
+	doc := &document{path: rel, title: title}
+	postings := make(map[string]*posting)
+	prevEnd := 0
+	for _, t := range Tokenize(body) {
+		p := postings[t.Term]
+		if p == nil {
+			p = &posting{}
+			postings[t.Term] = p
+		}
+		p.tf++
+		p.positions = append(p.positions, t.Pos)
+		if t.Start < prevEnd {
+			p.joined = append(p.joined, t.Pos)
+		}
+		prevEnd = t.End
+		doc.length++
+	}
+	for _, term := range Terms(title) {
+		p := postings[term]
+		if p == nil {
+			p = &posting{}
+			postings[term] = p
+		}
+		p.titleTF++
+		doc.titleLen++
+	}
+	doc.terms = make([]string, 0, len(postings))
+	for term := range postings {
+		doc.terms = append(doc.terms, term)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.removeLocked(rel)
+	e.docs[rel] = doc
+	e.totalLen += doc.length
+	e.titleLen += doc.titleLen
+	for term, p := range postings {
+		m := e.postings[term]
+		if m == nil {
+			m = make(map[string]*posting)
+			e.postings[term] = m
+			e.indexRunes(term, true)
+		}
+		m[rel] = p
+	}
+}
+
+// Remove 从倒排表中移除一篇笔记
+func (e *Engine) Remove(rel string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.removeLocked(vault.NotePath(rel))
+}
+
+func (e *Engine) removeLocked(rel string) {
+	doc, ok := e.docs[rel]
+	if !ok {
+		return
+	}
+	for _, term := range doc.terms {
+		if m := e.postings[term]; m != nil {
+			delete(m, rel)
+			if len(m) == 0 {
+				delete(e.postings, term)
+				e.indexRunes(term, false)
+			}
+		}
+	}
+	e.totalLen -= doc.length
+	e.titleLen -= doc.titleLen
+	delete(e.docs, rel)
+}
+
+// indexRunes 在词项首次出现（add）或从倒排表消失时维护 byRune，只处理 CJK 词项
+func (e *Engine) indexRunes(term string, add bool) {
+	for _, r := range term {
+		if !textutil.IsCJK(r) {
+			return
+		}
+		m := e.byRune[r]
+		switch {
+		case add && m == nil:
+			e.byRune[r] = map[string]struct{}{term: {}}
+		case add:
+			m[term] = struct{}{}
+		default:
+			delete(m, term)
+			if len(m) == 0 {
+				delete(e.byRune, r)
+			}
+		}
+	}
+}
+
+// Apply 根据索引变化事件增量更新倒排表，可直接作为 indexer.Watcher 的订阅回调
+func (e *Engine) Apply(events []indexer.Event) {
+	for _, ev := range events {
+		switch ev.Type {
+		case indexer.EventDeleted:
+			e.Remove(ev.Path)
+		case indexer.EventRenamed:
+			e.Remove(ev.OldPath)
+			_ = e.Update(ev.Path)
+		default:
+			_ = e.Update(ev.Path)
+		}
+	}
+}
+
+// Len 返回已索引的笔记数
+func (e *Engine) Len() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.docs)
+}
+
+// idf 使用 BM25 的平滑 IDF，保证结果非负
+func idf(n, df int) float64 {
+	return math.Log(1 + (float64(n)-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+func bm25(tf, docLen int, avgLen float64) float64 {
+	if tf == 0 {
+		return 0
+	}
+	norm := 1 - bm25B
+	if avgLen > 0 {
+		norm += bm25B * float64(docLen) / avgLen
+	}
+	return float64(tf) * (bm25K1 + 1) / (float64(tf) + bm25K1*norm)
+}
+
+// scoreLocked 计算一组查询词的 BM25 得分（正文 + 加权标题）。
+// 单个 CJK 字展开出的多个词项合并为一个词计分（见 charFreq），不会按多个独立词重复加分。
+func (e *Engine) scoreLocked(terms []string, scores map[string]float64) {
+	n := len(e.docs)
+	if n == 0 {
+		return
+	}
+	avgLen := float64(e.totalLen) / float64(n)
+	avgTitle := float64(e.titleLen) / float64(n)
+	for _, term := range terms {
+		tf, titleTF := e.termFreq(term)
+		if len(tf) == 0 {
+			continue
+		}
+		w := idf(n, len(tf))
+		for p, f := range tf {
+			doc := e.docs[p]
+			scores[p] += w * (bm25(f, doc.length, avgLen) + titleBoost*bm25(titleTF[p], doc.titleLen, avgTitle))
+		}
+	}
+}
+
+// termFreq 返回查询词在各笔记正文和标题中的词频；tf 的键即命中的笔记（含只在标题中命中的）
+func (e *Engine) termFreq(term string) (tf, titleTF map[string]int) {
+	if r := []rune(term); len(r) == 1 && textutil.IsCJK(r[0]) {
+		return e.charFreq(r[0])
+	}
+	tf, titleTF = make(map[string]int), make(map[string]int)
+	for p, post := range e.postings[term] {
+		tf[p], titleTF[p] = post.tf, post.titleTF
+	}
+	return tf, titleTF
+}
+
+// charFreq 统计单个 CJK 字的词频。连续 CJK 文本只索引二元组，相邻二元组共享一个字
+// （"中文字" 中的 "文" 同时出现在 "中文" 和 "文字" 里），因此字在二元组首位时，
+// 只有该二元组是一段 CJK 文本的开头才计数，否则已作为前一个二元组的末字计过；标题取各词项中的最大词频。
+func (e *Engine) charFreq(c rune) (tf, titleTF map[string]int) {
+	tf, titleTF = make(map[string]int), make(map[string]int)
+	for term := range e.byRune[c] {
+		r := []rune(term)
+		for p, post := range e.postings[term] {
+			titleTF[p] = max(titleTF[p], post.titleTF)
+			n := 0
+			for _, pos := range post.positions {
+				if len(r) == 1 {
+					n++
+					continue
+				}
+				if r[0] == c && !containsInt(post.joined, pos) {
+					n++
+				}
+				if r[1] == c {
+					n++
+				}
+			}
+			tf[p] += n
+		}
+	}
+	return tf, titleTF
+}
+
+// expandTerm 处理单个 CJK 字：连续的 CJK 文本只索引二元组，查询单字时经 byRune 扩展为包含该字的全部词项，
+// 用于高亮摘要；打分见 charFreq
+func (e *Engine) expandTerm(term string) []string {
+	r := []rune(term)
+	if len(r) != 1 || !textutil.IsCJK(r[0]) {
+		return []string{term}
+	}
+	out := make([]string, 0, len(e.byRune[r[0]]))
+	for t := range e.byRune[r[0]] {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// matchPhrase 判断笔记正文中是否按顺序连续出现 terms
+func (e *Engine) matchPhrase(rel string, terms []string) bool {
+	if len(terms) == 0 {
+		return true
+	}
+	first := e.postings[terms[0]][rel]
+	if first == nil {
+		return false
+	}
+	for _, start := range first.positions {
+		ok := true
+		for k := 1; k < len(terms); k++ {
+			p := e.postings[terms[k]][rel]
+			if p == nil || !containsInt(p.positions, start+k) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// containsInt 在升序切片中二分查找
+func containsInt(s []int, v int) bool {
+	i := sort.SearchInts(s, v)
+	return i < len(s) && s[i] == v
+}
@@ -0,0 +1,67 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCharFreq(t *testing.T) {
+	e := NewEngine(nil)
+	e.Put("a.md", "中文字")
+	e.Put("b.md", "文文文")
+	e.Put("c.md", "文 x 文")
+	e.Put("d.md", "无关")
+	e.Put("e.md", "中文 文化")
+	e.Put("文章.md", "标题命中")
+
+	tf, titleTF := e.charFreq('文')
+	wantTF := map[string]int{"a.md": 1, "b.md": 3, "c.md": 2, "e.md": 2, "文章.md": 0}
+	if !reflect.DeepEqual(tf, wantTF) {
+		t.Errorf("tf = %v, want %v", tf, wantTF)
+	}
+	if titleTF["文章.md"] != 1 || titleTF["a.md"] != 0 {
+		t.Errorf("titleTF = %v", titleTF)
+	}
+}
+
+func TestSingleCJKCharScoresAsOneTerm(t *testing.T) {
+	// 两篇笔记中 "文" 都出现三次：一篇是同一个二元组，一篇分散在三个不同的二元组里，得分应相同
+	e := NewEngine(nil)
+	e.Put("same.md", "文字 文字 文字")
+	e.Put("spread.md", "中文 文化 文学")
+	e.Put("none.md", "其他 内容 无关")
+
+	scores := make(map[string]float64)
+	e.scoreLocked([]string{"文"}, scores)
+	if len(scores) != 2 {
+		t.Fatalf("scores = %v", scores)
+	}
+	if scores["same.md"] != scores["spread.md"] {
+		t.Errorf("same.md = %v, spread.md = %v, want equal", scores["same.md"], scores["spread.md"])
+	}
+}
+
+func TestByRuneFollowsPostings(t *testing.T) {
+	e := NewEngine(nil)
+	e.Put("a.md", "中文 检索")
+	e.Put("b.md", "中文")
+	if got := e.expandTerm("中"); !reflect.DeepEqual(got, []string{"中文"}) {
+		t.Fatalf("expandTerm = %q", got)
+	}
+	if got := e.expandTerm("索"); !reflect.DeepEqual(got, []string{"检索"}) {
+		t.Fatalf("expandTerm = %q", got)
+	}
+
+	e.Put("a.md", "英文")
+	if got := e.expandTerm("索"); len(got) != 0 {
+		t.Errorf("stale expansion after update: %q", got)
+	}
+	e.Remove("b.md")
+	e.Remove("a.md")
+	if len(e.byRune) != 0 {
+		t.Errorf("byRune not cleaned up: %v", e.byRune)
+	}
+	if got := e.expandTerm("go"); !reflect.DeepEqual(got, []string{"go"}) {
+		t.Errorf("non-CJK term expanded: %q", got)
+	}
+}
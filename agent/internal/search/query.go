@@ -0,0 +1,339 @@
+package search
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/obsidian-agent/internal/vault"
+)
+
+const (
+	DefaultLimit      = 20
+	DefaultSnippetLen = 120 // 摘要长度（字符数）
+)
+
+// Query 是解析后的查询
+type Query struct {
+	Terms   []string   // 普通词项，按 BM25 打分，命中任意一个即可
+	Phrases [][]string // "短语"，必须在正文中连续出现
+	Tags    []string   // tag:xxx，必须全部带有（父标签匹配嵌套子标签）
+	Paths   []string   // path:xxx，路径包含该片段（大小写不敏感）
+	Titles  []string   // title:xxx，标题包含该片段（大小写不敏感）
+}
+
+// Empty 判断查询是否没有任何条件
+func (q Query) Empty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0 && len(q.Tags) == 0 && len(q.Paths) == 0 && len(q.Titles) == 0
+}
+
+// ParseQuery 解析查询语法：空白分隔的词，"引号短语"，以及 tag:、path:、title: 字段过滤（值可加引号）
+func ParseQuery(s string) Query {
+	var q Query
+	for _, f := range splitQuery(s) {
+		if !f.quoted {
+			if i := strings.Index(f.text, ":"); i > 0 {
+				field, value := strings.ToLower(f.text[:i]), strings.Trim(f.text[i+1:], `"“”`)
+				if value != "" {
+					switch field {
+					case "tag":
+						q.Tags = append(q.Tags, strings.TrimPrefix(value, "#"))
+						continue
+					case "path":
+						q.Paths = append(q.Paths, strings.ToLower(value))
+						continue
+					case "title":
+						q.Titles = append(q.Titles, strings.ToLower(value))
+						continue
+					}
+				}
+			}
+			q.Terms = append(q.Terms, Terms(f.text)...)
+			continue
+		}
+		if terms := Terms(f.text); len(terms) > 0 {
+			q.Phrases = append(q.Phrases, terms)
+		}
+	}
+	return q
+}
+
+type queryField struct {
+	text   string
+	quoted bool
+}
+
+// splitQuery 按空白切分查询，引号内（含中文引号）的内容作为一个整体；
+// field:"带空格的值" 也视为一个未加引号的字段
+func splitQuery(s string) []queryField {
+	var out []queryField
+	var b strings.Builder
+	inQuote, quotedWhole := false, false
+	flush := func() {
+		if b.Len() > 0 {
+			out = append(out, queryField{text: b.String(), quoted: quotedWhole})
+		}
+		b.Reset()
+		quotedWhole = false
+	}
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '“' || r == '”':
+			if !inQuote && b.Len() == 0 {
+				quotedWhole = true
+			}
+			if !quotedWhole {
+				b.WriteRune('"') // field:"value" 的引号保留给字段解析去除
+			}
+			inQuote = !inQuote
+			if !inQuote && quotedWhole {
+				flush()
+			}
+		case unicode.IsSpace(r) && !inQuote:
+			flush()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+	return out
+}
+
+// Options 控制检索行为
+type Options struct {
+	Limit      int    // 最多返回的结果数，默认 DefaultLimit
+	Folder     string // 只在该目录下检索
+	SnippetLen int    // 摘要长度（字符数），默认 DefaultSnippetLen
+	HighlightPre,
+	HighlightPost string // 高亮标记，默认 Markdown 粗体 **
+}
+
+// Hit 是一条检索结果
+type Hit struct {
+	Path    string  `json:"path"`
+	Title   string  `json:"title"`
+	Score   float64 `json:"score"`
+	Line    int     `json:"line,omitempty"`    // 摘要所在行号，从 1 开始
+	Snippet string  `json:"snippet,omitempty"` // 带高亮标记的摘要
+}
+
+// ErrEmptyQuery 表示查询中没有任何可用条件
+var ErrEmptyQuery = errors.New("empty query")
+
+// Search 执行查询，返回按得分排序的结果和命中总数
+func (e *Engine) Search(query string, opts Options) ([]Hit, int, error) {
+	q := ParseQuery(query)
+	if q.Empty() {
+		return nil, 0, ErrEmptyQuery
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultLimit
+	}
+	if opts.SnippetLen <= 0 {
+		opts.SnippetLen = DefaultSnippetLen
+	}
+	if opts.HighlightPre == "" && opts.HighlightPost == "" {
+		opts.HighlightPre, opts.HighlightPost = "**", "**"
+	}
+	folder := strings.Trim(filepath.ToSlash(strings.TrimSpace(opts.Folder)), "/")
+
+	e.mu.RLock()
+	// 单个 CJK 字在打分时合并其所在的二元组，高亮时展开；短语中的词项同样参与打分
+	scoreTerms := append([]string(nil), q.Terms...)
+	highlight := make(map[string]bool)
+	for _, t := range q.Terms {
+		for _, x := range e.expandTerm(t) {
+			highlight[x] = true
+		}
+	}
+	for _, ph := range q.Phrases {
+		scoreTerms = append(scoreTerms, ph...)
+		for _, t := range ph {
+			highlight[t] = true
+		}
+	}
+
+	scores := make(map[string]float64)
+	if len(scoreTerms) > 0 {
+		e.scoreLocked(scoreTerms, scores)
+		for p := range scores {
+			for _, ph := range q.Phrases {
+				if !e.matchPhrase(p, ph) {
+					delete(scores, p)
+					break
+				}
+			}
+		}
+	} else {
+		// 只有字段过滤：列出全部满足条件的笔记
+		for p := range e.docs {
+			scores[p] = 0
+		}
+	}
+	titles := make(map[string]string, len(scores))
+	for p := range scores {
+		titles[p] = e.docs[p].title
+	}
+	e.mu.RUnlock()
+
+	hits := make([]Hit, 0, len(scores))
+	for p, score := range scores {
+		if folder != "" && !strings.HasPrefix(p, folder+"/") {
+			continue
+		}
+		if !e.matchFilters(p, titles[p], q) {
+			continue
+		}
+		hits = append(hits, Hit{Path: p, Title: titles[p], Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Path < hits[j].Path
+	})
+	total := len(hits)
+	if len(hits) > opts.Limit {
+		hits = hits[:opts.Limit]
+	}
+	for i := range hits {
+		hits[i].Score = roundScore(hits[i].Score)
+		if len(highlight) > 0 {
+			hits[i].Snippet, hits[i].Line = e.snippet(hits[i].Path, highlight, opts)
+		}
+	}
+	return hits, total, nil
+}
+
+func (e *Engine) matchFilters(rel, title string, q Query) bool {
+	if len(q.Tags) > 0 {
+		n, ok := e.index.Note(rel)
+		if !ok {
+			return false
+		}
+		for _, t := range q.Tags {
+			if !n.HasTag(t) {
+				return false
+			}
+		}
+	}
+	lp, lt := strings.ToLower(rel), strings.ToLower(title)
+	for _, p := range q.Paths {
+		if !strings.Contains(lp, p) {
+			return false
+		}
+	}
+	for _, t := range q.Titles {
+		if !strings.Contains(lt, t) {
+			return false
+		}
+	}
+	return true
+}
+
+func roundScore(f float64) float64 {
+	return float64(int64(f*1000+0.5)) / 1000
+}
+
+// snippet 从笔记正文中选出命中词最密集的一段作为摘要，并高亮命中的词
+func (e *Engine) snippet(rel string, terms map[string]bool, opts Options) (string, int) {
+	content, _, err := e.index.Vault().ReadNote(rel)
+	if err != nil {
+		return "", 0
+	}
+	_, body, bodyLine := vault.SplitFrontmatter(content)
+
+	var matched []Token
+	for _, t := range Tokenize(body) {
+		if terms[t.Term] {
+			matched = append(matched, t)
+		}
+	}
+	if len(matched) == 0 {
+		// 只命中标题：取正文开头
+		end := advanceRunes(body, 0, opts.SnippetLen)
+		return oneLine(body[:end]), bodyLine
+	}
+
+	// 滑动窗口：以每个命中词为起点，统计窗口内命中词的数量，取最多的
+	best, bestCount := 0, 0
+	for i, t := range matched {
+		limit := advanceRunes(body, t.Start, opts.SnippetLen)
+		count := 0
+		for k := i; k < len(matched) && matched[k].End <= limit; k++ {
+			count++
+		}
+		if count > bestCount {
+			best, bestCount = i, count
+		}
+	}
+
+	// 窗口起点前留一点上下文
+	start := retreatRunes(body, matched[best].Start, opts.SnippetLen/6)
+	end := advanceRunes(body, start, opts.SnippetLen)
+
+	var b strings.Builder
+	if start > 0 && body[start-1] != '\n' {
+		b.WriteString("…")
+	}
+	cur := start
+	for _, r := range mergeRanges(matched, start, end) {
+		b.WriteString(body[cur:r[0]])
+		b.WriteString(opts.HighlightPre)
+		b.WriteString(body[r[0]:r[1]])
+		b.WriteString(opts.HighlightPost)
+		cur = r[1]
+	}
+	b.WriteString(body[cur:end])
+	if end < len(body) {
+		b.WriteString("…")
+	}
+	line := bodyLine + strings.Count(body[:matched[best].Start], "\n")
+	return oneLine(b.String()), line
+}
+
+// mergeRanges 合并 [start,end) 内命中词的字节区间；CJK 二元组相互重叠，需要合并后再高亮
+func mergeRanges(matched []Token, start, end int) [][2]int {
+	var out [][2]int
+	for _, t := range matched {
+		if t.Start < start || t.End > end {
+			continue
+		}
+		if n := len(out); n > 0 && t.Start <= out[n-1][1] {
+			if t.End > out[n-1][1] {
+				out[n-1][1] = t.End
+			}
+			continue
+		}
+		out = append(out, [2]int{t.Start, t.End})
+	}
+	return out
+}
+
+// advanceRunes 返回从 i 起向后 n 个字符的字节偏移
+func advanceRunes(s string, i, n int) int {
+	for ; n > 0 && i < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return i
+}
+
+// retreatRunes 返回从 i 起向前 n 个字符的字节偏移，不跨越换行
+func retreatRunes(s string, i, n int) int {
+	for ; n > 0 && i > 0; n-- {
+		r, size := utf8.DecodeLastRuneInString(s[:i])
+		if r == '\n' {
+			break
+		}
+		i -= size
+	}
+	return i
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,149 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/obsidian-agent/internal/indexer"
+	"github.com/obsidian-agent/internal/vault"
+)
+
+// newTestEngine 在临时仓库中写入笔记并建立索引和倒排表
+func newTestEngine(t *testing.T, notes map[string]string) *Engine {
+	t.Helper()
+	root := t.TempDir()
+	for rel, content := range notes {
+		abs := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(abs, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	v, err := vault.New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := indexer.New(v)
+	if err := x.Build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(x)
+	if err := e.Build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestSplitQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []queryField
+	}{
+		{query: "  a  b ", want: []queryField{{text: "a"}, {text: "b"}}},
+		{query: `"exact phrase" x`, want: []queryField{{text: "exact phrase", quoted: true}, {text: "x"}}},
+		{query: "“中文 短语”", want: []queryField{{text: "中文 短语", quoted: true}}},
+		{query: `path:"my notes/daily" y`, want: []queryField{{text: `path:"my notes/daily"`}, {text: "y"}}},
+		{query: `"unterminated phrase`, want: []queryField{{text: "unterminated phrase", quoted: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := splitQuery(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Query
+	}{
+		{query: "Running tests", want: Query{Terms: []string{"run", "test"}}},
+		{query: `"Quick Fox" 笔记`, want: Query{Terms: []string{"笔记"}, Phrases: [][]string{{"quick", "fox"}}}},
+		{
+			query: `tag:#project/alpha path:"Work Notes" title:“周报”`,
+			want:  Query{Tags: []string{"project/alpha"}, Paths: []string{"work notes"}, Titles: []string{"周报"}},
+		},
+		{query: "TAG:x", want: Query{Tags: []string{"x"}}},
+		{query: "http://example.com", want: Query{Terms: []string{"http", "exampl", "com"}}},
+		{query: "tag:", want: Query{Terms: []string{"tag"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := ParseQuery(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchPhrase(t *testing.T) {
+	e := newTestEngine(t, map[string]string{
+		"a.md": "the quick brown fox jumps",
+		"b.md": "brown quick fox",
+		"c.md": "全文检索引擎",
+	})
+	tests := []struct {
+		note, phrase string
+		want         bool
+	}{
+		{"a.md", "quick brown", true},
+		{"a.md", "quick fox", false},
+		{"b.md", "quick brown", false},
+		{"b.md", "quick fox", true},
+		{"a.md", "brown quick", false},
+		{"a.md", "quick the brown", true}, // 停用词不占位置
+		{"c.md", "检索引擎", true},
+		{"c.md", "全文引擎", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.note+"/"+tt.phrase, func(t *testing.T) {
+			if got := e.matchPhrase(tt.note, Terms(tt.phrase)); got != tt.want {
+				t.Errorf("matchPhrase(%s, %q) = %v, want %v", tt.note, tt.phrase, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchSnippetHighlight(t *testing.T) {
+	e := newTestEngine(t, map[string]string{
+		"notes/go.md": "---\ntags: [dev]\n---\nIntro line.\nWe are running Go tests daily.\n",
+		"cjk.md":      "这是一个关于全文检索的笔记。",
+		"other.md":    "nothing relevant",
+	})
+	tests := []struct {
+		query, wantPath, wantSnippet string
+		wantLine                     int
+	}{
+		{query: "run test", wantPath: "notes/go.md", wantSnippet: "…e are **running** Go **tests** daily.", wantLine: 5},
+		{query: `"go tests"`, wantPath: "notes/go.md", wantSnippet: "…nning **Go** **tests** daily.", wantLine: 5},
+		{query: "检索", wantPath: "cjk.md", wantSnippet: "…一个关于全文**检索**的笔记。", wantLine: 1},
+		{query: "检", wantPath: "cjk.md", wantSnippet: "…是一个关于全**文检索**的笔记。", wantLine: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			hits, total, err := e.Search(tt.query, Options{SnippetLen: 40})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 1 || hits[0].Path != tt.wantPath {
+				t.Fatalf("hits = %+v", hits)
+			}
+			if hits[0].Snippet != tt.wantSnippet || hits[0].Line != tt.wantLine {
+				t.Errorf("snippet = %q (line %d), want %q (line %d)", hits[0].Snippet, hits[0].Line, tt.wantSnippet, tt.wantLine)
+			}
+		})
+	}
+
+	hits, _, err := e.Search("running", Options{HighlightPre: "<b>", HighlightPost: "</b>"})
+	if err != nil || len(hits) != 1 || !strings.Contains(hits[0].Snippet, "<b>running</b>") {
+		t.Fatalf("custom highlight: %+v, %v", hits, err)
+	}
+}
@@ -0,0 +1,239 @@
+package search
+
+// Stem 是 Porter 词干提取算法的实现（M. F. Porter, 1980），
+// 输入应为小写 ASCII 单词，非 ASCII 或过短的词原样返回。
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	s := &stemmer{b: []byte(word)}
+	s.step1a()
+	s.step1b()
+	s.step1c()
+	s.step2()
+	s.step3()
+	s.step4()
+	s.step5()
+	return string(s.b)
+}
+
+type stemmer struct {
+	b []byte
+	j int // 当前后缀之前的词干末尾下标
+}
+
+// cons 判断 b[i] 是否为辅音
+func (s *stemmer) cons(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !s.cons(i-1)
+	}
+	return true
+}
+
+// m 计算 b[0..j] 中 VC 序列的个数
+func (s *stemmer) m() int {
+	n, i := 0, 0
+	for {
+		if i > s.j {
+			return n
+		}
+		if !s.cons(i) {
+			break
+		}
+		i++
+	}
+	i++
+	for {
+		for {
+			if i > s.j {
+				return n
+			}
+			if s.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+		n++
+		for {
+			if i > s.j {
+				return n
+			}
+			if !s.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+	}
+}
+
+// vowelInStem 判断 b[0..j] 是否含元音
+func (s *stemmer) vowelInStem() bool {
+	for i := 0; i <= s.j; i++ {
+		if !s.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doublec 判断 b[i-1..i] 是否为相同的双辅音
+func (s *stemmer) doublec(i int) bool {
+	return i >= 1 && s.b[i] == s.b[i-1] && s.cons(i)
+}
+
+// cvc 判断 b[i-2..i] 是否为 辅音-元音-辅音，且末尾不是 w/x/y
+func (s *stemmer) cvc(i int) bool {
+	if i < 2 || !s.cons(i) || s.cons(i-1) || !s.cons(i-2) {
+		return false
+	}
+	switch s.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+func (s *stemmer) ends(suffix string) bool {
+	n := len(suffix)
+	if n > len(s.b) || string(s.b[len(s.b)-n:]) != suffix {
+		return false
+	}
+	s.j = len(s.b) - n - 1
+	return true
+}
+
+// setto 把 b[j+1..] 替换为 r
+func (s *stemmer) setto(r string) {
+	s.b = append(s.b[:s.j+1], r...)
+}
+
+func (s *stemmer) r(r string) {
+	if s.m() > 0 {
+		s.setto(r)
+	}
+}
+
+func (s *stemmer) step1a() {
+	switch {
+	case s.ends("sses"):
+		s.b = s.b[:len(s.b)-2]
+	case s.ends("ies"):
+		s.setto("i")
+	case s.ends("ss"):
+	case s.ends("s"):
+		s.b = s.b[:len(s.b)-1]
+	}
+}
+
+func (s *stemmer) step1b() {
+	if s.ends("eed") {
+		if s.m() > 0 {
+			s.b = s.b[:len(s.b)-1]
+		}
+		return
+	}
+	if !(s.ends("ed") || s.ends("ing")) || !s.vowelInStem() {
+		return
+	}
+	s.b = s.b[:s.j+1]
+	switch {
+	case s.ends("at"):
+		s.setto("ate")
+	case s.ends("bl"):
+		s.setto("ble")
+	case s.ends("iz"):
+		s.setto("ize")
+	case s.doublec(len(s.b) - 1):
+		switch s.b[len(s.b)-1] {
+		case 'l', 's', 'z':
+		default:
+			s.b = s.b[:len(s.b)-1]
+		}
+	default:
+		s.j = len(s.b) - 1
+		if s.m() == 1 && s.cvc(len(s.b)-1) {
+			s.b = append(s.b, 'e')
+		}
+	}
+}
+
+func (s *stemmer) step1c() {
+	if s.ends("y") && s.vowelInStem() {
+		s.b[len(s.b)-1] = 'i'
+	}
+}
+
+var step2Rules = []struct{ from, to string }{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"}, {"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"},
+	{"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"},
+	{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"},
+	{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"}, {"logi", "log"},
+}
+
+func (s *stemmer) step2() {
+	for _, rule := range step2Rules {
+		if s.ends(rule.from) {
+			s.r(rule.to)
+			return
+		}
+	}
+}
+
+var step3Rules = []struct{ from, to string }{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+func (s *stemmer) step3() {
+	for _, rule := range step3Rules {
+		if s.ends(rule.from) {
+			s.r(rule.to)
+			return
+		}
+	}
+}
+
+var step4Suffixes = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+	"ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+}
+
+func (s *stemmer) step4() {
+	for _, suf := range step4Suffixes {
+		if !s.ends(suf) {
+			continue
+		}
+		if suf == "ion" && (s.j < 0 || (s.b[s.j] != 's' && s.b[s.j] != 't')) {
+			return
+		}
+		if s.m() > 1 {
+			s.b = s.b[:s.j+1]
+		}
+		return
+	}
+}
+
+func (s *stemmer) step5() {
+	s.j = len(s.b) - 1
+	if s.b[len(s.b)-1] == 'e' {
+		s.j = len(s.b) - 2
+		if m := s.m(); m > 1 || (m == 1 && !s.cvc(len(s.b)-2)) {
+			s.b = s.b[:len(s.b)-1]
+		}
+	}
+	s.j = len(s.b) - 1
+	if s.b[len(s.b)-1] == 'l' && s.doublec(len(s.b)-1) && s.m() > 1 {
+		s.b = s.b[:len(s.b)-1]
+	}
+}
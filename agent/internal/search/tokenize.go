@@ -0,0 +1,93 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/obsidian-agent/internal/textutil"
+)
+
+// Token 是分词结果中的一个词项
+type Token struct {
+	Term  string // 归一化后的词项：英文小写并提取词干，CJK 为相邻两字的二元组
+	Pos   int    // 在词项序列中的位置，用于短语匹配
+	Start int    // 在原文中的字节偏移
+	End   int
+}
+
+// stopWords 是检索时忽略的高频英文虚词
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "this": true, "to": true, "was": true, "with": true,
+}
+
+// Tokenize 对中英文混排文本分词：
+// 英文/数字按单词切分，转小写、去停用词并提取词干；连续的 CJK 字符切成相邻两字的二元组，
+// 单独出现的 CJK 字符保留为一元词项。全角字母数字按半角处理。
+func Tokenize(text string) []Token {
+	var out []Token
+	pos := 0
+	emit := func(term string, start, end int) {
+		out = append(out, Token{Term: term, Pos: pos, Start: start, End: end})
+		pos++
+	}
+
+	i := 0
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		r = textutil.FoldWidth(r)
+		switch {
+		case textutil.IsCJK(r):
+			// 收集一段连续的 CJK 字符
+			type span struct{ start, end int }
+			var runes []span
+			j := i
+			for j < len(text) {
+				r2, sz := utf8.DecodeRuneInString(text[j:])
+				if !textutil.IsCJK(r2) {
+					break
+				}
+				runes = append(runes, span{j, j + sz})
+				j += sz
+			}
+			if len(runes) == 1 {
+				emit(text[i:j], i, j)
+			}
+			for k := 0; k+1 < len(runes); k++ {
+				emit(text[runes[k].start:runes[k+1].end], runes[k].start, runes[k+1].end)
+			}
+			i = j
+		case textutil.IsWordRune(r):
+			var b strings.Builder
+			j := i
+			for j < len(text) {
+				r2, sz := utf8.DecodeRuneInString(text[j:])
+				r2 = textutil.FoldWidth(r2)
+				if !textutil.IsWordRune(r2) {
+					break
+				}
+				b.WriteRune(unicode.ToLower(r2))
+				j += sz
+			}
+			if w := b.String(); !stopWords[w] {
+				emit(Stem(w), i, j)
+			}
+			i = j
+		default:
+			i += size
+		}
+	}
+	return out
+}
+
+// Terms 返回文本分词后的词项序列
+func Terms(text string) []string {
+	toks := Tokenize(text)
+	out := make([]string, len(toks))
+	for i, t := range toks {
+		out[i] = t.Term
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Token
+	}{
+		{
+			name: "english",
+			text: "The Running cats",
+			want: []Token{{Term: "run", Pos: 0, Start: 4, End: 11}, {Term: "cat", Pos: 1, Start: 12, End: 16}},
+		},
+		{
+			name: "cjk bigrams",
+			text: "中文字",
+			want: []Token{{Term: "中文", Pos: 0, Start: 0, End: 6}, {Term: "文字", Pos: 1, Start: 3, End: 9}},
+		},
+		{
+			name: "single cjk char",
+			text: "x 字 y",
+			want: []Token{{Term: "x", Pos: 0, Start: 0, End: 1}, {Term: "字", Pos: 1, Start: 2, End: 5}, {Term: "y", Pos: 2, Start: 6, End: 7}},
+		},
+		{
+			name: "mixed",
+			text: "Go语言v2",
+			want: []Token{{Term: "go", Pos: 0, Start: 0, End: 2}, {Term: "语言", Pos: 1, Start: 2, End: 8}, {Term: "v2", Pos: 2, Start: 8, End: 10}},
+		},
+		{
+			name: "full width",
+			text: "ＡＰＩ１２",
+			want: []Token{{Term: "api12", Pos: 0, Start: 0, End: 15}},
+		},
+		{name: "punctuation only", text: "，。!? -"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "Hello, World!", want: []string{"hello", "world"}},
+		{text: "the and of", want: []string{}},
+		{text: "全文检索 search", want: []string{"全文", "文检", "检索", "search"}},
+		{text: "Ｇｏ 与 Rust", want: []string{"go", "与", "rust"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := Terms(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Terms(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStem(t *testing.T) {
+	tests := map[string]string{
+		"caresses":       "caress",
+		"ponies":         "poni",
+		"cats":           "cat",
+		"feed":           "feed",
+		"agreed":         "agre",
+		"plastered":      "plaster",
+		"motoring":       "motor",
+		"sing":           "sing",
+		"hopping":        "hop",
+		"filing":         "file",
+		"happy":          "happi",
+		"relational":     "relat",
+		"generalization": "gener",
+		"hopeful":        "hope",
+		"adjustable":     "adjust",
+		"controll":       "control",
+		"go":             "go",
+		"v2":             "v2",
+		"naïve":          "naïve",
+	}
+	for word, want := range tests {
+		if got := Stem(word); got != want {
+			t.Errorf("Stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/obsidian-agent/pkg/mcp"
+)
+
+type searchInput struct {
+	Query  string `json:"query"`
+	Folder string `json:"folder"`
+	Limit  int    `json:"limit"`
+}
+
+type searchOutput struct {
+	Hits  []Hit `json:"hits"`
+	Total int   `json:"total"`
+}
+
+const (
+	searchNotesInput = `{
+  "type": "object",
+  "properties": {
+    "query": {"type": "string", "minLength": 1, "description": "关键词（中英文均可），支持 \"短语\" 以及 tag:、path:、title: 过滤，如 tag:project \"release plan\""},
+    "folder": {"type": "string", "description": "只在该目录下检索"},
+    "limit": {"type": "integer", "minimum": 1, "maximum": 100}
+  },
+  "required": ["query"],
+  "additionalProperties": false
+}`
+	searchNotesOutput = `{
+  "type": "object",
+  "properties": {
+    "hits": {"type": "array", "items": {
+      "type": "object",
+      "properties": {"path": {"type": "string"}, "title": {"type": "string"}, "score": {"type": "number"}, "line": {"type": "integer"}, "snippet": {"type": "string"}},
+      "required": ["path", "title", "score"]
+    }},
+    "total": {"type": "integer"}
+  },
+  "required": ["hits", "total"]
+}`
+)
+
+// RegisterTools 注册基于 BM25 排序的 search_notes 工具；
+// 若 vault 已注册了按字面量逐行匹配的同名工具，会被替换。
+func RegisterTools(srv *mcp.MCPServer, e *Engine) error {
+	srv.UnregisterTool("search_notes")
+	openWorld := false
+	return srv.RegisterTool(&mcp.ToolDef{
+		Name:         "search_notes",
+		Title:        "搜索笔记",
+		Description:  "Full-text search over the vault ranked by BM25. Supports mixed Chinese/English keywords, \"quoted phrases\" and tag:, path:, title: filters.",
+		InputSchema:  json.RawMessage(searchNotesInput),
+		OutputSchema: json.RawMessage(searchNotesOutput),
+		Annotations:  &mcp.ToolAnnotations{ReadOnlyHint: true, OpenWorldHint: &openWorld},
+	}, e.searchTool)
+}
+
+func (e *Engine) searchTool(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	var in searchInput
+	if err := json.Unmarshal(raw, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	hits, total, err := e.Search(in.Query, Options{Limit: in.Limit, Folder: in.Folder})
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	if hits == nil {
+		hits = []Hit{}
+	}
+
+	var b strings.Builder
+	for _, h := range hits {
+		fmt.Fprintf(&b, "%s (%.3f)", h.Path, h.Score)
+		if h.Snippet != "" {
+			fmt.Fprintf(&b, "\n  L%d: %s", h.Line, h.Snippet)
+		}
+		b.WriteString("\n")
+	}
+	if total > len(hits) {
+		fmt.Fprintf(&b, "... (%d more)\n", total-len(hits))
+	}
+	if total == 0 {
+		b.WriteString("no matches")
+	}
+	return mcp.ToolCallResult{
+		Content:           []mcp.ContentPart{{Type: "text", Text: strings.TrimRight(b.String(), "\n")}},
+		StructuredContent: searchOutput{Hits: hits, Total: total},
+	}, nil
+}
@@ -0,0 +1,335 @@
+package summarizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/obsidian-agent/internal/retrieval"
+	"github.com/obsidian-agent/pkg/llm/llmutils"
+	"github.com/sashabaranov/go-openai"
+)
+
+// 分层总结的默认参数
+const (
+	DefaultChunkTokens = 1500 // Map 阶段单个分块的 token 上限
+	DefaultGroupTokens = 3000 // Reduce 阶段每次合并的输入 token 上限，也是交给最终总结的上限
+	DefaultWorkers     = 4    // 同时调用模型的数量
+)
+
+// 总结阶段
+const (
+	StageMap    = "map"
+	StageReduce = "reduce"
+)
+
+// Document 是一篇待总结的文本，通常是一篇笔记
+type Document struct {
+	Path    string
+	Content string
+}
+
+// Partial 是分层总结的中间结果：Map 阶段为一个分块的摘要，Reduce 阶段为一组摘要合并后的摘要。
+// 输入足够短时不做 Map，Partial 直接是分块原文（Raw）。
+type Partial struct {
+	Label string `json:"label"` // 来源，如 "Projects/plan.md > 目标"
+	Text  string `json:"text"`
+	Raw   bool   `json:"raw,omitempty"`
+
+	paths  []string // 覆盖的笔记
+	tokens int
+}
+
+// Progress 是分层总结的进度
+type Progress struct {
+	Stage string `json:"stage"`           // map | reduce
+	Level int    `json:"level,omitempty"` // reduce 的层级，从 1 开始
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+	Label string `json:"label,omitempty"` // 刚完成的分块或分组
+}
+
+// MapReduceOptions 控制分层总结
+type MapReduceOptions struct {
+	ChunkTokens int            // Map 阶段单个分块的 token 上限，默认 DefaultChunkTokens
+	GroupTokens int            // Reduce 阶段每次合并的输入 token 上限，默认 DefaultGroupTokens
+	Workers     int            // 同时调用模型的数量，默认 DefaultWorkers
+	Focus       string         // 可选：用户的要求，总结时侧重相关内容
+	OnProgress  func(Progress) // 可选：每完成一个分块或分组调用一次，调用是串行的
+}
+
+func (o MapReduceOptions) withDefaults() MapReduceOptions {
+	if o.ChunkTokens <= 0 {
+		o.ChunkTokens = DefaultChunkTokens
+	}
+	if o.GroupTokens <= 0 {
+		o.GroupTokens = DefaultGroupTokens
+	}
+	if o.Workers <= 0 {
+		o.Workers = DefaultWorkers
+	}
+	if o.OnProgress == nil {
+		o.OnProgress = func(Progress) {}
+	}
+	return o
+}
+
+// Result 是分层总结的结果
+type Result struct {
+	Summary  string    `json:"summary,omitempty"` // 最终摘要；Condense 不生成
+	Partials []Partial `json:"-"`                 // 最终总结之前的中间结果
+	Notes    int       `json:"notes"`
+	Chunks   int       `json:"chunks"`
+	Levels   int       `json:"levels"` // Reduce 的层数（不含最终总结）
+}
+
+// MapReduce 分层总结一组文档：按标题和 token 切块，用有上限的并发逐块总结（Map），
+// 再逐层合并（Reduce），最后生成一份完整的摘要。
+func (s *Summarizer) MapReduce(ctx context.Context, docs []Document, opts MapReduceOptions) (*Result, error) {
+	opts = opts.withDefaults()
+	res, err := s.Condense(ctx, docs, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Partials) == 1 && !res.Partials[0].Raw {
+		res.Summary = res.Partials[0].Text
+		return res, nil
+	}
+	text, err := s.ask(ctx, StageReduce, s.systemPrompt(StageReduce, opts.Focus), FormatPartials(res.Partials))
+	if err != nil {
+		return nil, err
+	}
+	opts.OnProgress(Progress{Stage: StageReduce, Level: res.Levels + 1, Done: 1, Total: 1})
+	res.Summary = text
+	return res, nil
+}
+
+// Condense 执行 MapReduce 中最终总结之前的部分：把文档压缩成总长不超过 GroupTokens 的若干中间结果，
+// 供调用方自行生成最终摘要（例如流式输出给用户）。输入本身不超过 GroupTokens 时直接返回原文分块。
+func (s *Summarizer) Condense(ctx context.Context, docs []Document, opts MapReduceOptions) (*Result, error) {
+	opts = opts.withDefaults()
+	model := s.llmClient.GetModel()
+	chunker := retrieval.Chunker{MaxTokens: opts.ChunkTokens, Model: model}
+
+	res := &Result{}
+	var parts []Partial
+	total := 0
+	for _, d := range docs {
+		chunks := chunker.Split(d.Path, d.Content)
+		if len(chunks) > 0 {
+			res.Notes++
+		}
+		for _, c := range chunks {
+			label := c.Path
+			if c.Heading != "" {
+				label += " > " + c.Heading
+			}
+			parts = append(parts, Partial{Label: label, Text: c.Text, Raw: true, paths: []string{c.Path}, tokens: c.Tokens})
+			total += c.Tokens
+		}
+	}
+	res.Chunks = len(parts)
+	if len(parts) == 0 {
+		return nil, errors.New("nothing to summarize")
+	}
+	if total <= opts.GroupTokens {
+		res.Partials = parts
+		return res, nil
+	}
+
+	// Map：逐块总结
+	system := s.systemPrompt(StageMap, opts.Focus)
+	parts, err := s.each(ctx, parts, opts, Progress{Stage: StageMap}, func(p Partial) (Partial, error) {
+		text, err := s.ask(ctx, StageMap, system, "片段来源："+p.Label+"\n\n"+p.Text)
+		if err != nil {
+			return Partial{}, fmt.Errorf("summarize %s: %w", p.Label, err)
+		}
+		return s.partial(p.Label, text, p.paths), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Reduce：按 GroupTokens 分组合并，直到总长不超过 GroupTokens 或只剩一段
+	system = s.systemPrompt(StageReduce, opts.Focus)
+	for len(parts) > 1 && tokensOf(parts) > opts.GroupTokens {
+		res.Levels++
+		groups := group(parts, opts.GroupTokens)
+		merged := make([]Partial, len(groups))
+		for i, g := range groups {
+			merged[i] = Partial{Label: groupLabel(g), Text: FormatPartials(g), paths: pathsOf(g)}
+		}
+		parts, err = s.each(ctx, merged, opts, Progress{Stage: StageReduce, Level: res.Levels}, func(p Partial) (Partial, error) {
+			text, err := s.ask(ctx, StageReduce, system, p.Text)
+			if err != nil {
+				return Partial{}, fmt.Errorf("merge summaries of %s: %w", p.Label, err)
+			}
+			return s.partial(p.Label, text, p.paths), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	res.Partials = parts
+	return res, nil
+}
+
+// each 用最多 opts.Workers 个 goroutine 对 parts 逐个执行 fn，结果保持原顺序；
+// 任一调用出错时取消其余调用并返回第一个错误
+func (s *Summarizer) each(ctx context.Context, parts []Partial, opts MapReduceOptions, progress Progress, fn func(Partial) (Partial, error)) ([]Partial, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	out := make([]Partial, len(parts))
+	sem := make(chan struct{}, opts.Workers)
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		first error
+	)
+	progress.Total = len(parts)
+	for i := range parts {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			p, err := fn(parts[i])
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if first == nil {
+					first = err
+					cancel()
+				}
+				return
+			}
+			out[i] = p
+			if first == nil {
+				progress.Done++
+				progress.Label = p.Label
+				opts.OnProgress(progress)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if first != nil {
+		return nil, first
+	}
+	return out, ctx.Err()
+}
+
+// ask 调用模型完成总结的一步：场景的 prompt 附在内容之后
+func (s *Summarizer) ask(ctx context.Context, scene, system, content string) (string, error) {
+	prompt, opts := s.GetScene(scene)
+	msgs := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: system},
+		{Role: openai.ChatMessageRoleUser, Content: content + "\n\n" + prompt},
+	}
+	resp, err := s.llmClient.ChatCompletion(ctx, msgs, opts)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("model returned no choices")
+	}
+	text := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if text == "" {
+		return "", errors.New("model returned an empty summary")
+	}
+	return text, nil
+}
+
+// systemPrompt 说明当前所处的阶段，有用户要求时一并给出
+func (s *Summarizer) systemPrompt(stage, focus string) string {
+	var b strings.Builder
+	if stage == StageMap {
+		b.WriteString("你在分段总结较长的笔记，每次只看到其中一个片段。")
+	} else {
+		b.WriteString("你在合并同一批笔记的分段摘要，输入中每段以【来源】开头。")
+	}
+	if focus = strings.TrimSpace(focus); focus != "" {
+		b.WriteString("\n用户的要求：" + focus + "\n总结时侧重与此相关的内容。")
+	}
+	return b.String()
+}
+
+func (s *Summarizer) partial(label, text string, paths []string) Partial {
+	n, _ := llmutils.CountTokens(s.llmClient.GetModel(), text)
+	return Partial{Label: label, Text: text, paths: paths, tokens: n}
+}
+
+// FormatPartials 把中间结果拼成一段文本，每段以【来源】开头
+func FormatPartials(parts []Partial) string {
+	var b strings.Builder
+	for i, p := range parts {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString("【" + p.Label + "】\n" + p.Text)
+	}
+	return b.String()
+}
+
+// group 把相邻的中间结果按 token 上限分组；每组至少两段，保证每一层都在缩小
+func group(parts []Partial, limit int) [][]Partial {
+	var groups [][]Partial
+	var cur []Partial
+	size := 0
+	for _, p := range parts {
+		if len(cur) >= 2 && size+p.tokens > limit {
+			groups = append(groups, cur)
+			cur, size = nil, 0
+		}
+		cur = append(cur, p)
+		size += p.tokens
+	}
+	if len(cur) == 1 && len(groups) > 0 {
+		// 最后剩下的一段并入前一组，避免原样进入下一层
+		groups[len(groups)-1] = append(groups[len(groups)-1], cur[0])
+	} else if len(cur) > 0 {
+		groups = append(groups, cur)
+	}
+	return groups
+}
+
+// groupLabel 为一组中间结果生成来源标签：同一篇笔记时用笔记路径，否则列出第一篇和篇数
+func groupLabel(parts []Partial) string {
+	paths := pathsOf(parts)
+	if len(paths) == 1 {
+		return paths[0]
+	}
+	return fmt.Sprintf("%s 等 %d 篇笔记", paths[0], len(paths))
+}
+
+// pathsOf 按出现顺序收集一组中间结果覆盖的笔记
+func pathsOf(parts []Partial) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, p := range parts {
+		for _, path := range p.paths {
+			if !seen[path] {
+				seen[path] = true
+				out = append(out, path)
+			}
+		}
+	}
+	return out
+}
+
+func tokensOf(parts []Partial) int {
+	n := 0
+	for _, p := range parts {
+		n += p.tokens
+	}
+	return n
+}
@@ -2,6 +2,8 @@ package summarizer
 
 import (
 	"context"
+	"errors"
+	"strings"
 
 	"github.com/obsidian-agent/pkg/llm/client"
 	"github.com/sashabaranov/go-openai"
@@ -25,6 +27,20 @@ func NewSummarizer(llmClient client.BaseClient) *Summarizer {
 		MaxTokens: 1024,
 	}
 	summarizer.SetDefaultScene(defaultPrompt, defaultOptions)
+
+	// summary 场景用于压缩对话历史，摘要会代替原文作为后续对话的上下文
+	summaryPrompt := `请把以上对话（含开头已有的摘要）压缩成一段新的摘要，供后续对话参考。
+保留：用户的目标和偏好、已经确定的事实和结论、提到的笔记路径、尚未完成的事项；省略寒暄和重复内容。
+直接输出摘要正文，不要添加标题或说明。`
+	summarizer.SetScene("summary", summaryPrompt, &client.ChatOptions{Temperature: 0.3, MaxTokens: 800})
+
+	// map、reduce 场景用于长笔记和文件夹的分层总结（见 MapReduce）
+	mapPrompt := `请总结以上片段的要点：保留关键的事实、数字、结论、待办和提到的笔记链接；只依据片段内容，不要补充。
+用简洁的要点列表输出，不要添加标题或说明。`
+	reducePrompt := `请把以上各段内容合并成一份完整的摘要：先用一两句话概括主旨，再按主题分点列出要点；
+去掉重复，保留关键的事实、结论和待办；不要补充原文没有的内容，不要输出【来源】标记。`
+	summarizer.SetScene("map", mapPrompt, &client.ChatOptions{Temperature: 0.2, MaxTokens: 600})
+	summarizer.SetScene("reduce", reducePrompt, &client.ChatOptions{Temperature: 0.3, MaxTokens: 1200})
 	return summarizer
 }
 
@@ -63,6 +79,18 @@ func (s *Summarizer) Summary(ctx context.Context,messages []openai.ChatCompletio
 	return  s.llmClient.ChatCompletion(ctx,messages,opts)
 }
 
+// SummaryText 与 Summary 相同，只返回摘要文本，可用作 llmutils.SummarizeFunc
+func (s *Summarizer) SummaryText(ctx context.Context, messages []openai.ChatCompletionMessage) (string, error) {
+	resp, err := s.Summary(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("model returned no choices")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
 // Judge 负责根据用户的提问/对话进行判断
 func (s *Summarizer) Judge(ctx context.Context,messages []openai.ChatCompletionMessage) (openai.ChatCompletionResponse, error) {
 	prompt, opts := s.GetScene("judge")
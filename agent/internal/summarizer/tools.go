@@ -0,0 +1,204 @@
+package summarizer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/obsidian-agent/internal/vault"
+	"github.com/obsidian-agent/pkg/mcp"
+)
+
+// MaxNotes 是一次最多总结的笔记数
+const MaxNotes = 50
+
+// maxSourceLinks 是写入摘要笔记时列出的来源链接上限
+const maxSourceLinks = 20
+
+// Collect 读取要总结的笔记：target 是笔记时返回该笔记，是文件夹时返回其中（含子目录）的全部笔记，
+// 按路径排序。空笔记会被跳过，超过 MaxNotes 篇时返回错误。
+func Collect(v *vault.Vault, target string) ([]Document, error) {
+	target = strings.Trim(strings.TrimSpace(target), "/")
+	if target != "" && v.Exists(target) {
+		content, info, err := v.ReadNote(target)
+		if err != nil {
+			return nil, err
+		}
+		return []Document{{Path: info.Path, Content: content}}, nil
+	}
+
+	abs, err := v.Resolve(target)
+	if err != nil {
+		return nil, err
+	}
+	if st, err := os.Stat(abs); err != nil || !st.IsDir() {
+		return nil, fmt.Errorf("note or folder not found: %s", target)
+	}
+	notes, err := v.ListNotes(target, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(notes) > MaxNotes {
+		return nil, fmt.Errorf("folder %s has %d notes, at most %d can be summarized at once", target, len(notes), MaxNotes)
+	}
+	var docs []Document
+	for _, n := range notes {
+		content, _, err := v.ReadNote(n.Path)
+		if err != nil {
+			continue // 遍历之后被删除或无法读取的笔记直接跳过
+		}
+		if strings.TrimSpace(content) != "" {
+			docs = append(docs, Document{Path: n.Path, Content: content})
+		}
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no notes to summarize in %s", target)
+	}
+	return docs, nil
+}
+
+// SaveSummary 把摘要写入一篇新笔记，末尾列出来源笔记的链接；笔记已存在时返回错误。
+// 写入经由 Vault.Commit，ctx 携带工具调用信息时会记入编辑日志，可以撤销。
+func SaveSummary(ctx context.Context, v *vault.Vault, output string, docs []Document, summary string) (vault.PatchResult, error) {
+	if err := vault.CheckNoteTarget(output); err != nil {
+		return vault.PatchResult{}, err
+	}
+	output = vault.NotePath(output)
+	if output == "" {
+		return vault.PatchResult{}, errors.New("output path must not be empty")
+	}
+	if _, _, err := v.ReadNote(output); err == nil {
+		return vault.PatchResult{}, fmt.Errorf("note already exists: %s", output)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return vault.PatchResult{}, err
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(summary))
+	b.WriteString("\n\n---\n来源：")
+	for i, d := range docs {
+		if i == maxSourceLinks {
+			fmt.Fprintf(&b, " 等 %d 篇", len(docs))
+			break
+		}
+		if i > 0 {
+			b.WriteString("、")
+		}
+		b.WriteString("[[" + strings.TrimSuffix(d.Path, path.Ext(d.Path)) + "]]")
+	}
+	b.WriteString("\n")
+	return v.Commit(ctx, output, "", false, b.String())
+}
+
+type summarizeInput struct {
+	Path   string `json:"path"`
+	Focus  string `json:"focus"`
+	Output string `json:"output"`
+}
+
+// summarizeOutput 是 summarize_notes 的结构化结果
+type summarizeOutput struct {
+	Path    string             `json:"path"`
+	Summary string             `json:"summary"`
+	Notes   int                `json:"notes"`
+	Chunks  int                `json:"chunks"`
+	Levels  int                `json:"levels"`
+	Output  *vault.PatchResult `json:"output,omitempty"`
+}
+
+const (
+	summarizeNotesInput = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string", "description": "要总结的笔记或文件夹（含子目录），相对仓库根目录；空串表示整个仓库"},
+    "focus": {"type": "string", "description": "可选：总结的侧重点"},
+    "output": {"type": "string", "minLength": 1, "description": "可选：把摘要写入这篇新笔记，笔记已存在时失败"}
+  },
+  "required": ["path"],
+  "additionalProperties": false
+}`
+	summarizeNotesOutput = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string"},
+    "summary": {"type": "string"},
+    "notes": {"type": "integer"},
+    "chunks": {"type": "integer"},
+    "levels": {"type": "integer"},
+    "output": {"type": "object"}
+  },
+  "required": ["path", "summary", "notes", "chunks", "levels"]
+}`
+)
+
+// RegisterTools 注册 summarize_notes 工具：分层总结一篇长笔记或一个文件夹，
+// 给出 output 时把结果写入新笔记，此时需要用户确认。
+func RegisterTools(srv *mcp.MCPServer, s *Summarizer, v *vault.Vault) error {
+	openWorld := false
+	return srv.RegisterTool(&mcp.ToolDef{
+		Name:  "summarize_notes",
+		Title: "总结笔记",
+		Description: "Summarize a long note or every note in a folder. The text is split by headings, chunks are summarized in parallel and then merged, " +
+			"so input of any length works. Optionally writes the summary into a new note.",
+		InputSchema:  json.RawMessage(summarizeNotesInput),
+		OutputSchema: json.RawMessage(summarizeNotesOutput),
+		Annotations:  &mcp.ToolAnnotations{DestructiveHint: boolPtr(false), OpenWorldHint: &openWorld},
+	}, func(ctx context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+		return s.summarizeTool(ctx, v, args)
+	}, mcp.WithConfirmation(func(args map[string]any) string {
+		if out, _ := args["output"].(string); out != "" {
+			return fmt.Sprintf("把总结写入新笔记 %s", vault.NotePath(out))
+		}
+		return "" // 不写入时只读，无需确认
+	}))
+}
+
+func (s *Summarizer) summarizeTool(ctx context.Context, v *vault.Vault, args map[string]any) (mcp.ToolCallResult, error) {
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	var in summarizeInput
+	if err := json.Unmarshal(raw, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	if in.Output != "" {
+		// 先检查，避免总结完才发现无法写入
+		if err := vault.CheckNoteTarget(in.Output); err != nil {
+			return mcp.ToolCallResult{}, err
+		}
+		if v.Exists(in.Output) {
+			return mcp.ToolCallResult{}, fmt.Errorf("note already exists: %s", vault.NotePath(in.Output))
+		}
+	}
+	docs, err := Collect(v, in.Path)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	res, err := s.MapReduce(ctx, docs, MapReduceOptions{Focus: in.Focus})
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+
+	out := summarizeOutput{Path: in.Path, Summary: res.Summary, Notes: res.Notes, Chunks: res.Chunks, Levels: res.Levels}
+	text := res.Summary
+	if in.Output != "" {
+		pr, err := SaveSummary(ctx, v, in.Output, docs, res.Summary)
+		if err != nil {
+			return mcp.ToolCallResult{}, err
+		}
+		out.Output = &pr
+		text += "\n\n(written to " + pr.Path + ")"
+	}
+	return mcp.ToolCallResult{
+		Content:           []mcp.ContentPart{{Type: "text", Text: text}},
+		StructuredContent: out,
+	}, nil
+}
+
+func boolPtr(b bool) *bool { return &b }
@@ -0,0 +1,36 @@
+// Package textutil 提供中英文混排文本共用的字符判断和截断，检索分词和链接建议使用同一套规则。
+package textutil
+
+import "unicode"
+
+// IsCJK 判断字符是否属于中日韩文字：这类文字之间没有词边界，检索时按二元组切分
+func IsCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// IsWordRune 判断字符是否属于英文单词（字母、数字或下划线，不含 CJK），全角字符按半角判断
+func IsWordRune(r rune) bool {
+	r = FoldWidth(r)
+	return (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') && !IsCJK(r)
+}
+
+// FoldWidth 把全角 ASCII 字符转换为对应的半角字符，全角空格转为半角空格
+func FoldWidth(r rune) rune {
+	if r >= 0xFF01 && r <= 0xFF5E {
+		return r - 0xFEE0
+	}
+	if r == 0x3000 {
+		return ' '
+	}
+	return r
+}
+
+// Clip 把过长的文本截断到 n 个字符并加上省略号
+func Clip(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
@@ -0,0 +1,45 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SplitFrontmatter 拆分笔记开头的 YAML frontmatter（以 --- 包围），
+// 返回 frontmatter 原文（不含分隔线）、正文以及正文起始行号（从 1 开始）。
+// 没有 frontmatter 时 raw 为空、body 为全文。
+func SplitFrontmatter(content string) (raw, body string, bodyLine int) {
+	text := strings.TrimPrefix(content, "\ufeff")
+	if !strings.HasPrefix(text, "---\n") && !strings.HasPrefix(text, "---\r\n") {
+		return "", content, 1
+	}
+	lines := strings.SplitAfter(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		l := strings.TrimRight(lines[i], "\r\n")
+		if l == "---" || l == "..." {
+			raw = strings.Join(lines[1:i], "")
+			body = strings.Join(lines[i+1:], "")
+			return raw, body, i + 2
+		}
+	}
+	// 未闭合的 --- 不视为 frontmatter
+	return "", content, 1
+}
+
+// ParseFrontmatter 解析笔记的 frontmatter 为键值对，没有 frontmatter 时返回空 map
+func ParseFrontmatter(content string) (map[string]any, error) {
+	raw, _, _ := SplitFrontmatter(content)
+	fm := map[string]any{}
+	if strings.TrimSpace(raw) == "" {
+		return fm, nil
+	}
+	if err := yaml.Unmarshal([]byte(raw), &fm); err != nil {
+		return nil, fmt.Errorf("parse frontmatter: %w", err)
+	}
+	if fm == nil {
+		fm = map[string]any{}
+	}
+	return fm, nil
+}
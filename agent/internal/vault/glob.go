@@ -0,0 +1,41 @@
+package vault
+
+import (
+	"regexp"
+	"strings"
+)
+
+// globRegexp 将 glob 转换为正则：* 匹配单层路径内的任意字符，** 跨越多层目录，? 匹配单个字符。
+// 不含 / 的模式只匹配文件名，例如 "*.md" 可以匹配任意目录下的笔记。
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	glob = strings.TrimPrefix(glob, "/")
+	var b strings.Builder
+	if !strings.Contains(glob, "/") {
+		b.WriteString("^(?:.*/)?")
+	} else {
+		b.WriteString("^")
+	}
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?") // **/ 匹配零或多层目录
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,292 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/obsidian-agent/internal/edit"
+)
+
+// maxSeen 是为三方合并保留的笔记版本数
+const maxSeen = 64
+
+// Patch 是对一篇笔记的一组编辑，BaseHash/BaseModified 描述生成编辑时看到的版本
+type Patch struct {
+	Path         string
+	BaseHash     string    // 生成编辑时笔记内容的 sha256，为空时取 Ops 中的 BaseHash
+	BaseModified time.Time // 可选：生成编辑时的修改时间，没有哈希时用它判断笔记是否变化
+	Base         string    // 可选：生成编辑时的全文，缺省时从 Remember 记录的版本中查找
+	Ops          []edit.Op
+	Merge        bool // 锚点无法重新定位时是否尝试三方合并；false 时直接拒绝
+}
+
+// PatchResult 描述一次写入
+type PatchResult struct {
+	Path       string `json:"path"`
+	Created    bool   `json:"created,omitempty"`
+	Deleted    bool   `json:"deleted,omitempty"`
+	BeforeHash string `json:"beforeHash,omitempty"` // 写入前的内容哈希，笔记原本不存在时为空
+	AfterHash  string `json:"afterHash,omitempty"`  // 删除时为空
+	Size       int    `json:"size"`
+	Relocated  bool   `json:"relocated,omitempty"` // 笔记已变化，编辑按锚点重新定位后应用
+	Merged     bool   `json:"merged,omitempty"`    // 笔记已变化，编辑经三方合并后应用
+	Backup     bool   `json:"backup,omitempty"`    // 写入前的版本已备份，可用 Backup(BeforeHash) 取回
+	Diff       string `json:"diff,omitempty"`      // 统一 diff，超过 maxDiffBytes 时截断
+}
+
+// maxDiffBytes 是 PatchResult 中 diff 的上限：diff 会进入工具结果、编辑日志和前端消息，大笔记整篇改写时截断
+const maxDiffBytes = 64 << 10
+
+// ConflictError 表示笔记在生成编辑之后被修改过，且编辑无法安全地应用
+type ConflictError struct {
+	Path      string
+	Reason    string
+	Conflicts []edit.Conflict
+}
+
+func (e *ConflictError) Error() string {
+	if len(e.Conflicts) > 0 {
+		return fmt.Sprintf("%s changed since it was read: %d conflicting region(s), first at line %d", e.Path, len(e.Conflicts), e.Conflicts[0].Line)
+	}
+	return fmt.Sprintf("%s changed since it was read: %s", e.Path, e.Reason)
+}
+
+func (e *ConflictError) Unwrap() error { return edit.ErrConflict }
+
+// CommitHook 在笔记被改动后调用，ctx 为发起写入的调用方上下文
+type CommitHook func(ctx context.Context, res PatchResult)
+
+// SetBackupDir 设置备份目录：此后每次写入前，旧版本按内容哈希保存在该目录下
+func (v *Vault) SetBackupDir(dir string) { v.backupDir = dir }
+
+// SetCommitHook 设置写入后的回调，用于记录编辑历史等
+func (v *Vault) SetCommitHook(h CommitHook) { v.commitHook = h }
+
+// Remember 记录一份交给模型的笔记内容，之后针对该版本的编辑在冲突时可以做三方合并
+func (v *Vault) Remember(content string) string {
+	h := edit.Hash(content)
+	v.seenMu.Lock()
+	defer v.seenMu.Unlock()
+	if _, ok := v.seen[h]; ok {
+		return h
+	}
+	v.seen[h] = content
+	v.seenAt = append(v.seenAt, h)
+	if len(v.seenAt) > maxSeen {
+		delete(v.seen, v.seenAt[0])
+		v.seenAt = v.seenAt[1:]
+	}
+	return h
+}
+
+func (v *Vault) recall(hash string) (string, bool) {
+	v.seenMu.Lock()
+	defer v.seenMu.Unlock()
+	s, ok := v.seen[hash]
+	return s, ok
+}
+
+// Backup 读取按哈希备份的旧版本
+func (v *Vault) Backup(hash string) (string, error) {
+	if v.backupDir == "" {
+		return "", errors.New("backups are not enabled")
+	}
+	if len(hash) != 64 || strings.Trim(hash, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid backup hash %q", hash)
+	}
+	data, err := os.ReadFile(filepath.Join(v.backupDir, hash[:2], hash+NoteExt))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ApplyPatch 把编辑应用到笔记：笔记未变化时按原位置应用；已变化时先按锚点重新定位，
+// 定位失败且允许合并时以生成编辑时的版本为祖先做三方合并，仍有冲突则返回 ConflictError。
+// 写入前备份旧版本，写入通过临时文件加重命名完成。
+func (v *Vault) ApplyPatch(ctx context.Context, p Patch) (PatchResult, error) {
+	path := NotePath(p.Path)
+	baseHash := p.BaseHash
+	if baseHash == "" && len(p.Ops) > 0 {
+		baseHash = p.Ops[0].BaseHash
+	}
+
+	v.writeMu.Lock()
+	defer v.writeMu.Unlock()
+
+	cur, info, err := v.ReadNote(path)
+	if err != nil {
+		return PatchResult{}, err
+	}
+	curHash := edit.Hash(cur)
+	changed := (baseHash != "" && baseHash != curHash) ||
+		(baseHash == "" && !p.BaseModified.IsZero() && !info.Modified.Equal(p.BaseModified))
+
+	var relocated, merged bool
+	updated := ""
+	if !changed {
+		updated, err = edit.Apply(cur, p.Ops)
+		if err != nil && !errors.Is(err, edit.ErrConflict) {
+			return PatchResult{}, err
+		}
+		// 内容未变但锚点对不上，说明编辑本身的位置有误，也走重新定位
+		changed = err != nil
+	}
+	if changed {
+		updated, err = relocateAll(cur, p.Ops)
+		relocated = err == nil
+		if err != nil {
+			if !p.Merge {
+				return PatchResult{}, &ConflictError{Path: path, Reason: err.Error()}
+			}
+			base := p.Base
+			if base == "" {
+				base, _ = v.recall(baseHash)
+			}
+			if base == "" || (baseHash != "" && edit.Hash(base) != baseHash) {
+				return PatchResult{}, &ConflictError{Path: path, Reason: err.Error() + "; the original version is unknown, cannot merge"}
+			}
+			ours, err := edit.Apply(base, p.Ops)
+			if err != nil {
+				return PatchResult{}, &ConflictError{Path: path, Reason: err.Error()}
+			}
+			result, conflicts := edit.Merge3(base, ours, cur)
+			if len(conflicts) > 0 {
+				return PatchResult{}, &ConflictError{Path: path, Conflicts: conflicts}
+			}
+			updated, merged = result, true
+		}
+	}
+
+	res, err := v.commit(ctx, path, cur, true, updated)
+	if err != nil {
+		return PatchResult{}, err
+	}
+	res.Relocated, res.Merged = relocated, merged
+	return res, nil
+}
+
+// relocateAll 在 content 中重新定位所有编辑并应用
+func relocateAll(content string, ops []edit.Op) (string, error) {
+	moved := make([]edit.Op, len(ops))
+	for i, op := range ops {
+		r, err := edit.Relocate(content, op)
+		if err != nil {
+			return "", err
+		}
+		moved[i] = r
+	}
+	return edit.Apply(content, moved)
+}
+
+// Commit 把笔记从 before 改写为 after：before 必须与磁盘上的当前内容一致，
+// existed 为 false 表示笔记原本不存在，此时 rel 必须是笔记（见 CheckNoteTarget）。写入前备份旧版本。
+func (v *Vault) Commit(ctx context.Context, rel, before string, existed bool, after string) (PatchResult, error) {
+	if !existed {
+		if err := CheckNoteTarget(rel); err != nil {
+			return PatchResult{}, err
+		}
+	}
+	v.writeMu.Lock()
+	defer v.writeMu.Unlock()
+	return v.commit(ctx, NotePath(rel), before, existed, after)
+}
+
+func (v *Vault) commit(ctx context.Context, path, before string, existed bool, after string) (PatchResult, error) {
+	// 读取与写入之间用户可能又保存了一次，写入前再核对一遍
+	cur, _, err := v.ReadNote(path)
+	switch {
+	case err == nil && !existed:
+		return PatchResult{}, &ConflictError{Path: path, Reason: "note was created concurrently"}
+	case err == nil && cur != before:
+		return PatchResult{}, &ConflictError{Path: path, Reason: "note was modified while the edit was being applied"}
+	case err != nil && (existed || !errors.Is(err, fs.ErrNotExist)):
+		return PatchResult{}, err
+	}
+
+	res := PatchResult{Path: path, Created: !existed, AfterHash: edit.Hash(after), Size: len(after)}
+	if existed {
+		res.BeforeHash = edit.Hash(before)
+	}
+	res.Diff = edit.TruncateDiff(edit.UnifiedDiff(path, before, after), maxDiffBytes)
+	if existed && before == after {
+		return res, nil
+	}
+	if existed && v.backupDir != "" {
+		if err := v.saveBackup(res.BeforeHash, before); err != nil {
+			return PatchResult{}, fmt.Errorf("backup %s: %w", path, err)
+		}
+		res.Backup = true
+	}
+	if err := v.WriteNote(path, after); err != nil {
+		return PatchResult{}, err
+	}
+	if v.commitHook != nil {
+		v.commitHook(ctx, res)
+	}
+	return res, nil
+}
+
+// DeleteNote 删除笔记，before 必须与磁盘上的当前内容一致；删除前备份
+func (v *Vault) DeleteNote(ctx context.Context, rel, before string) (PatchResult, error) {
+	path := NotePath(rel)
+	v.writeMu.Lock()
+	defer v.writeMu.Unlock()
+
+	cur, _, err := v.ReadNote(path)
+	if err != nil {
+		return PatchResult{}, err
+	}
+	if cur != before {
+		return PatchResult{}, &ConflictError{Path: path, Reason: "note was modified before it could be deleted"}
+	}
+	res := PatchResult{Path: path, Deleted: true, BeforeHash: edit.Hash(cur), Diff: edit.TruncateDiff(edit.UnifiedDiff(path, cur, ""), maxDiffBytes)}
+	if v.backupDir != "" {
+		if err := v.saveBackup(res.BeforeHash, cur); err != nil {
+			return PatchResult{}, fmt.Errorf("backup %s: %w", path, err)
+		}
+		res.Backup = true
+	}
+	abs, err := v.Resolve(path)
+	if err != nil {
+		return PatchResult{}, err
+	}
+	if err := os.Remove(abs); err != nil {
+		return PatchResult{}, err
+	}
+	if v.commitHook != nil {
+		v.commitHook(ctx, res)
+	}
+	return res, nil
+}
+
+// saveBackup 按内容哈希保存旧版本，相同内容只存一份
+func (v *Vault) saveBackup(hash, content string) error {
+	dir := filepath.Join(v.backupDir, hash[:2])
+	file := filepath.Join(dir, hash+NoteExt)
+	if _, err := os.Stat(file); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".backup-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
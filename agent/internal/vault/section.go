@@ -0,0 +1,140 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseHeading 返回 ATX 标题的级别和文本，不是标题时 level 为 0
+func ParseHeading(line string) (level int, text string) {
+	s := strings.TrimRight(line, "\r")
+	for level < len(s) && level < 7 && s[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 {
+		return 0, ""
+	}
+	if level < len(s) && s[level] != ' ' && s[level] != '\t' {
+		return 0, ""
+	}
+	text = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(s[level:]), "#"))
+	return level, text
+}
+
+// IsFence 判断是否为代码块围栏行，代码块内的 # 不算标题
+func IsFence(line string) bool {
+	s := strings.TrimSpace(line)
+	return strings.HasPrefix(s, "```") || strings.HasPrefix(s, "~~~")
+}
+
+// ReplaceSection 用 content 替换指定标题下的内容（直到下一个同级或更高级标题为止），
+// 标题行本身保留。heading 可以带 # 前缀以限定级别，匹配时忽略大小写与首尾空白。
+func ReplaceSection(note, heading, content string) (string, error) {
+	wantLevel, wantText := ParseHeading(strings.TrimSpace(heading))
+	if wantLevel == 0 {
+		wantText = strings.TrimSpace(heading)
+	}
+	if wantText == "" {
+		return "", fmt.Errorf("heading is empty")
+	}
+
+	lines := strings.SplitAfter(note, "\n")
+	start, level := -1, 0
+	inFence := false
+	for i, l := range lines {
+		if IsFence(l) {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		lv, text := ParseHeading(l)
+		if lv == 0 {
+			continue
+		}
+		if start < 0 {
+			if strings.EqualFold(text, wantText) && (wantLevel == 0 || lv == wantLevel) {
+				start, level = i, lv
+			}
+			continue
+		}
+		if lv <= level {
+			return joinSection(lines[:start+1], content, lines[i:]), nil
+		}
+	}
+	if start < 0 {
+		return "", fmt.Errorf("heading not found: %s", heading)
+	}
+	return joinSection(lines[:start+1], content, nil), nil
+}
+
+func joinSection(head []string, content string, tail []string) string {
+	var b strings.Builder
+	for _, l := range head {
+		b.WriteString(l)
+	}
+	if !strings.HasSuffix(b.String(), "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString(content)
+	if len(tail) > 0 {
+		if !strings.HasSuffix(content, "\n") {
+			b.WriteString("\n")
+		}
+		// 保持标题前的空行，便于阅读
+		if !strings.HasSuffix(content, "\n\n") {
+			b.WriteString("\n")
+		}
+		for _, l := range tail {
+			b.WriteString(l)
+		}
+	} else if content != "" && !strings.HasSuffix(content, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Section 是笔记中以标题划分的一段，行号从 0 开始，End 不包含
+type Section struct {
+	Heading string // 标题链，如 "项目 > 进度"；位于首个标题之前时为空
+	Level   int    // 所在标题的级别，首个标题之前为 0
+	Start   int    // 标题行（或笔记首行）
+	End     int    // 下一个标题行，没有时为总行数
+}
+
+// SectionAt 返回第 line 行所在的最小一段：从它之前最近的标题到下一个任意级别的标题。
+// 代码块内的 # 不视为标题；line 越界时按首行/末行处理。
+func SectionAt(content string, line int) Section {
+	lines := strings.Split(content, "\n")
+	line = max(0, min(line, len(lines)-1))
+
+	var chain []string
+	var levels []int
+	sec := Section{End: len(lines)}
+	inFence := false
+	for i, l := range lines {
+		if IsFence(l) {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		lv, text := ParseHeading(l)
+		if lv == 0 {
+			continue
+		}
+		if i > line {
+			sec.End = i
+			break
+		}
+		for len(levels) > 0 && levels[len(levels)-1] >= lv {
+			chain, levels = chain[:len(chain)-1], levels[:len(levels)-1]
+		}
+		chain, levels = append(chain, text), append(levels, lv)
+		sec.Start, sec.Level = i, lv
+	}
+	sec.Heading = strings.Join(chain, " > ")
+	return sec
+}
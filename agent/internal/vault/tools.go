@@ -0,0 +1,667 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/obsidian-agent/internal/edit"
+	"github.com/obsidian-agent/pkg/mcp"
+)
+
+const (
+	defaultListLimit   = 200
+	defaultSearchLimit = 50
+	maxSearchLineLen   = 300
+)
+
+// ---- 入参 ----
+
+type pathInput struct {
+	Path string `json:"path"`
+}
+
+type listInput struct {
+	Folder string `json:"folder"`
+	Glob   string `json:"glob"`
+	Limit  int    `json:"limit"`
+}
+
+type searchInput struct {
+	Query         string `json:"query"`
+	Folder        string `json:"folder"`
+	Limit         int    `json:"limit"`
+	CaseSensitive bool   `json:"caseSensitive"`
+}
+
+type createInput struct {
+	Path      string `json:"path"`
+	Content   string `json:"content"`
+	Overwrite bool   `json:"overwrite"`
+	BaseHash  string `json:"baseHash"`
+}
+
+type appendInput struct {
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	BaseHash string `json:"baseHash"`
+}
+
+type replaceSectionInput struct {
+	Path     string `json:"path"`
+	Heading  string `json:"heading"`
+	Content  string `json:"content"`
+	BaseHash string `json:"baseHash"`
+}
+
+type applyEditsInput struct {
+	Path     string    `json:"path"`
+	BaseHash string    `json:"baseHash"`
+	Ops      []edit.Op `json:"ops"`
+	Merge    *bool     `json:"merge"`
+}
+
+// ---- 结构化返回 ----
+
+type readOutput struct {
+	NoteInfo
+	Hash    string `json:"hash"`
+	Content string `json:"content"`
+}
+
+type listOutput struct {
+	Notes     []NoteInfo `json:"notes"`
+	Total     int        `json:"total"`
+	Truncated bool       `json:"truncated"`
+}
+
+// SearchMatch 是全文搜索命中的一行
+type SearchMatch struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+type searchOutput struct {
+	Matches   []SearchMatch `json:"matches"`
+	Truncated bool          `json:"truncated"`
+}
+
+type frontmatterOutput struct {
+	Path        string         `json:"path"`
+	Frontmatter map[string]any `json:"frontmatter"`
+}
+
+// ---- schema ----
+
+const noteInfoSchema = `{"type":"object","properties":{"path":{"type":"string"},"size":{"type":"integer"},"modified":{"type":"string"}},"required":["path"]}`
+
+var (
+	readNoteInput = `{
+  "type": "object",
+  "properties": {"path": {"type": "string", "minLength": 1, "description": "笔记相对仓库根目录的路径，可省略 .md"}},
+  "required": ["path"],
+  "additionalProperties": false
+}`
+	readNoteOutput = `{
+  "type": "object",
+  "properties": {"path": {"type": "string"}, "size": {"type": "integer"}, "modified": {"type": "string"}, "hash": {"type": "string"}, "content": {"type": "string"}},
+  "required": ["path", "hash", "content"]
+}`
+	listNotesInput = `{
+  "type": "object",
+  "properties": {
+    "folder": {"type": "string", "description": "只列出该目录下的笔记，默认整个仓库"},
+    "glob": {"type": "string", "description": "按路径过滤，支持 * ? 和 **，如 \"Projects/**/*.md\""},
+    "limit": {"type": "integer", "minimum": 1, "maximum": 2000}
+  },
+  "additionalProperties": false
+}`
+	listNotesOutput = `{
+  "type": "object",
+  "properties": {"notes": {"type": "array", "items": ` + noteInfoSchema + `}, "total": {"type": "integer"}, "truncated": {"type": "boolean"}},
+  "required": ["notes", "total"]
+}`
+	searchNotesInput = `{
+  "type": "object",
+  "properties": {
+    "query": {"type": "string", "minLength": 1},
+    "folder": {"type": "string"},
+    "limit": {"type": "integer", "minimum": 1, "maximum": 500},
+    "caseSensitive": {"type": "boolean"}
+  },
+  "required": ["query"],
+  "additionalProperties": false
+}`
+	searchNotesOutput = `{
+  "type": "object",
+  "properties": {
+    "matches": {"type": "array", "items": {"type": "object", "properties": {"path": {"type": "string"}, "line": {"type": "integer"}, "text": {"type": "string"}}, "required": ["path", "line", "text"]}},
+    "truncated": {"type": "boolean"}
+  },
+  "required": ["matches"]
+}`
+	createNoteInput = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string", "minLength": 1},
+    "content": {"type": "string"},
+    "overwrite": {"type": "boolean", "description": "笔记已存在时是否覆盖，默认 false"},
+    "baseHash": ` + baseHashSchema + `
+  },
+  "required": ["path", "content"],
+  "additionalProperties": false
+}`
+	appendToNoteInput = `{
+  "type": "object",
+  "properties": {"path": {"type": "string", "minLength": 1}, "content": {"type": "string", "minLength": 1}, "baseHash": ` + baseHashSchema + `},
+  "required": ["path", "content"],
+  "additionalProperties": false
+}`
+	replaceSectionInputSchema = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string", "minLength": 1},
+    "heading": {"type": "string", "minLength": 1, "description": "标题文本，可带 # 前缀以限定级别，如 \"## 待办\""},
+    "content": {"type": "string", "description": "替换该标题下的正文（不含标题行）"},
+    "baseHash": ` + baseHashSchema + `
+  },
+  "required": ["path", "heading", "content"],
+  "additionalProperties": false
+}`
+	applyEditsInputSchema = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string", "minLength": 1},
+    "baseHash": ` + baseHashSchema + `,
+    "ops": {
+      "type": "array", "minItems": 1,
+      "items": {
+        "type": "object",
+        "properties": {
+          "kind": {"enum": ["insert", "replace"]},
+          "from": ` + posSchema + `,
+          "to": ` + posSchema + `,
+          "original": {"type": "string", "description": "replace 时被替换的原文，必须与笔记中的内容完全一致"},
+          "before": {"type": "string", "description": "from 之前的一小段原文，用于笔记变化后重新定位"},
+          "after": {"type": "string", "description": "to 之后的一小段原文"},
+          "text": {"type": "string"}
+        },
+        "required": ["kind", "from", "text"]
+      }
+    },
+    "merge": {"type": "boolean", "description": "笔记已变化且无法按原文重新定位时是否尝试三方合并，默认 true"}
+  },
+  "required": ["path", "ops"],
+  "additionalProperties": false
+}`
+	baseHashSchema    = `{"type": "string", "description": "read_note 返回的 hash，用于检测笔记在此之后是否被修改"}`
+	posSchema         = `{"type": "object", "properties": {"line": {"type": "integer", "minimum": 0}, "ch": {"type": "integer", "minimum": 0}}, "required": ["line", "ch"]}`
+	writeOutputSchema = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string"}, "created": {"type": "boolean"}, "size": {"type": "integer"},
+    "beforeHash": {"type": "string"}, "afterHash": {"type": "string"},
+    "relocated": {"type": "boolean"}, "merged": {"type": "boolean"}, "backup": {"type": "boolean"}, "diff": {"type": "string"}
+  },
+  "required": ["path", "size"]
+}`
+	getFrontmatterOutput = `{
+  "type": "object",
+  "properties": {"path": {"type": "string"}, "frontmatter": {"type": "object"}},
+  "required": ["path", "frontmatter"]
+}`
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+// RegisterTools 把仓库的内置笔记工具注册到 MCPServer；会修改笔记的工具需要用户确认
+func RegisterTools(srv *mcp.MCPServer, v *Vault) error {
+	readOnly := &mcp.ToolAnnotations{ReadOnlyHint: true, OpenWorldHint: boolPtr(false)}
+	tools := []struct {
+		def     *mcp.ToolDef
+		handler mcp.ToolHandler
+		opts    []mcp.ToolOption
+	}{
+		{
+			def: &mcp.ToolDef{
+				Name: "read_note", Title: "读取笔记",
+				Description:  "Read the full Markdown content of a note in the vault.",
+				InputSchema:  json.RawMessage(readNoteInput),
+				OutputSchema: json.RawMessage(readNoteOutput),
+				Annotations:  readOnly,
+			},
+			handler: v.readNoteTool,
+		},
+		{
+			def: &mcp.ToolDef{
+				Name: "list_notes", Title: "列出笔记",
+				Description:  "List notes in the vault, optionally restricted to a folder or filtered by a glob pattern.",
+				InputSchema:  json.RawMessage(listNotesInput),
+				OutputSchema: json.RawMessage(listNotesOutput),
+				Annotations:  readOnly,
+			},
+			handler: v.listNotesTool,
+		},
+		{
+			def: &mcp.ToolDef{
+				Name: "search_notes", Title: "搜索笔记",
+				Description:  "Search note contents for a literal string and return matching lines.",
+				InputSchema:  json.RawMessage(searchNotesInput),
+				OutputSchema: json.RawMessage(searchNotesOutput),
+				Annotations:  readOnly,
+			},
+			handler: v.searchNotesTool,
+		},
+		{
+			def: &mcp.ToolDef{
+				Name: "get_frontmatter", Title: "读取 frontmatter",
+				Description:  "Return the parsed YAML frontmatter of a note.",
+				InputSchema:  json.RawMessage(readNoteInput),
+				OutputSchema: json.RawMessage(getFrontmatterOutput),
+				Annotations:  readOnly,
+			},
+			handler: v.getFrontmatterTool,
+		},
+		{
+			def: &mcp.ToolDef{
+				Name: "create_note", Title: "创建笔记",
+				Description: "Create a new note. Fails if the note exists unless overwrite is true. " +
+					"When overwriting, pass the hash from read_note as baseHash so concurrent changes are merged instead of lost.",
+				InputSchema:  json.RawMessage(createNoteInput),
+				OutputSchema: json.RawMessage(writeOutputSchema),
+				Annotations:  &mcp.ToolAnnotations{DestructiveHint: boolPtr(false), OpenWorldHint: boolPtr(false)},
+			},
+			handler: v.createNoteTool,
+			opts: []mcp.ToolOption{mcp.WithConfirmation(func(args map[string]any) string {
+				if b, _ := args["overwrite"].(bool); b {
+					return fmt.Sprintf("创建笔记 %s（若已存在将被覆盖）", argPath(args))
+				}
+				return fmt.Sprintf("创建笔记 %s", argPath(args))
+			})},
+		},
+		{
+			def: &mcp.ToolDef{
+				Name: "append_to_note", Title: "追加到笔记",
+				Description:  "Append Markdown content to the end of an existing note. Pass the hash from read_note as baseHash to merge with concurrent changes.",
+				InputSchema:  json.RawMessage(appendToNoteInput),
+				OutputSchema: json.RawMessage(writeOutputSchema),
+				Annotations:  &mcp.ToolAnnotations{DestructiveHint: boolPtr(false), OpenWorldHint: boolPtr(false)},
+			},
+			handler: v.appendToNoteTool,
+			opts: []mcp.ToolOption{mcp.WithConfirmation(func(args map[string]any) string {
+				return fmt.Sprintf("在笔记 %s 末尾追加内容", argPath(args))
+			})},
+		},
+		{
+			def: &mcp.ToolDef{
+				Name: "replace_section", Title: "替换章节",
+				Description: "Replace the body under a heading (up to the next heading of the same or higher level). " +
+					"Pass the hash from read_note as baseHash to merge with concurrent changes.",
+				InputSchema:  json.RawMessage(replaceSectionInputSchema),
+				OutputSchema: json.RawMessage(writeOutputSchema),
+				Annotations:  &mcp.ToolAnnotations{DestructiveHint: boolPtr(true), OpenWorldHint: boolPtr(false)},
+			},
+			handler: v.replaceSectionTool,
+			opts: []mcp.ToolOption{mcp.WithConfirmation(func(args map[string]any) string {
+				heading, _ := args["heading"].(string)
+				return fmt.Sprintf("替换笔记 %s 中「%s」下的内容", argPath(args), heading)
+			})},
+		},
+		{
+			def: &mcp.ToolDef{
+				Name: "apply_edits", Title: "编辑笔记",
+				Description: "Apply precise insert/replace edits to a note. Positions are 0-based line/ch. " +
+					"Pass the hash from read_note as baseHash; if the note changed since, edits are relocated by their original text or merged, and refused on conflict.",
+				InputSchema:  json.RawMessage(applyEditsInputSchema),
+				OutputSchema: json.RawMessage(writeOutputSchema),
+				Annotations:  &mcp.ToolAnnotations{DestructiveHint: boolPtr(true), OpenWorldHint: boolPtr(false)},
+			},
+			handler: v.applyEditsTool,
+			opts: []mcp.ToolOption{mcp.WithConfirmation(func(args map[string]any) string {
+				ops, _ := args["ops"].([]any)
+				return fmt.Sprintf("编辑笔记 %s（%d 处修改）", argPath(args), len(ops))
+			})},
+		},
+	}
+	for _, t := range tools {
+		if err := srv.RegisterTool(t.def, t.handler, t.opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func argPath(args map[string]any) string {
+	p, _ := args["path"].(string)
+	return NotePath(p)
+}
+
+// decodeArgs 把已通过 schema 校验的 arguments 解码到具体的入参结构体
+func decodeArgs(args map[string]any, out any) error {
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func textResult(text string, structured any) mcp.ToolCallResult {
+	return mcp.ToolCallResult{
+		Content:           []mcp.ContentPart{{Type: "text", Text: text}},
+		StructuredContent: structured,
+	}
+}
+
+func (v *Vault) readNoteTool(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	var in pathInput
+	if err := decodeArgs(args, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	content, info, err := v.ReadNote(in.Path)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	// 记下模型看到的版本，之后基于它的编辑在冲突时可以三方合并
+	hash := v.Remember(content)
+	return textResult(content, readOutput{NoteInfo: info, Hash: hash, Content: content}), nil
+}
+
+func (v *Vault) listNotesTool(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	var in listInput
+	if err := decodeArgs(args, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	if in.Limit <= 0 {
+		in.Limit = defaultListLimit
+	}
+	notes, err := v.ListNotes(in.Folder, in.Glob)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	out := listOutput{Notes: notes, Total: len(notes)}
+	if len(notes) > in.Limit {
+		out.Notes, out.Truncated = notes[:in.Limit], true
+	}
+	if out.Notes == nil {
+		out.Notes = []NoteInfo{}
+	}
+
+	var b strings.Builder
+	for _, n := range out.Notes {
+		b.WriteString(n.Path)
+		b.WriteString("\n")
+	}
+	if out.Truncated {
+		fmt.Fprintf(&b, "... (%d more)\n", out.Total-len(out.Notes))
+	}
+	if out.Total == 0 {
+		b.WriteString("no notes found")
+	}
+	return textResult(strings.TrimRight(b.String(), "\n"), out), nil
+}
+
+// SearchText 在笔记中逐行查找字面量，返回命中行；limit 用尽时 truncated 为 true
+func (v *Vault) SearchText(query, folder string, caseSensitive bool, limit int) ([]SearchMatch, bool, error) {
+	needle := query
+	if !caseSensitive {
+		needle = strings.ToLower(query)
+	}
+	var matches []SearchMatch
+	errLimit := errors.New("limit reached")
+	err := v.WalkNotes(folder, func(info NoteInfo) error {
+		content, _, err := v.ReadNote(info.Path)
+		if err != nil {
+			return nil
+		}
+		for i, line := range strings.Split(content, "\n") {
+			hay := line
+			if !caseSensitive {
+				hay = strings.ToLower(line)
+			}
+			if !strings.Contains(hay, needle) {
+				continue
+			}
+			if len(matches) == limit {
+				return errLimit
+			}
+			matches = append(matches, SearchMatch{Path: info.Path, Line: i + 1, Text: clipLine(strings.TrimSpace(line))})
+		}
+		return nil
+	})
+	if errors.Is(err, errLimit) {
+		return matches, true, nil
+	}
+	return matches, false, err
+}
+
+func clipLine(s string) string {
+	if len(s) <= maxSearchLineLen {
+		return s
+	}
+	r := []rune(s)
+	if len(r) <= maxSearchLineLen {
+		return s
+	}
+	return string(r[:maxSearchLineLen]) + "…"
+}
+
+func (v *Vault) searchNotesTool(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	var in searchInput
+	if err := decodeArgs(args, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	if in.Limit <= 0 {
+		in.Limit = defaultSearchLimit
+	}
+	matches, truncated, err := v.SearchText(in.Query, in.Folder, in.CaseSensitive, in.Limit)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	if matches == nil {
+		matches = []SearchMatch{}
+	}
+
+	var b strings.Builder
+	for _, m := range matches {
+		fmt.Fprintf(&b, "%s:%d: %s\n", m.Path, m.Line, m.Text)
+	}
+	if truncated {
+		b.WriteString("... (more matches omitted)\n")
+	}
+	if len(matches) == 0 {
+		b.WriteString("no matches")
+	}
+	return textResult(strings.TrimRight(b.String(), "\n"), searchOutput{Matches: matches, Truncated: truncated}), nil
+}
+
+func (v *Vault) getFrontmatterTool(_ context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	var in pathInput
+	if err := decodeArgs(args, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	content, info, err := v.ReadNote(in.Path)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	fm, err := ParseFrontmatter(content)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	raw, err := json.Marshal(fm)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	return textResult(string(raw), frontmatterOutput{Path: info.Path, Frontmatter: fm}), nil
+}
+
+func (v *Vault) createNoteTool(ctx context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	var in createInput
+	if err := decodeArgs(args, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	path := NotePath(in.Path)
+	before, _, err := v.ReadNote(path)
+	existed := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return mcp.ToolCallResult{}, err
+	}
+	if existed && !in.Overwrite {
+		return mcp.ToolCallResult{}, fmt.Errorf("note already exists: %s", path)
+	}
+	if existed && in.BaseHash != "" {
+		// 覆盖读取过的笔记：按读取时的版本整体改写，期间的修改经三方合并保留
+		res, err := v.rewrite(ctx, path, in.BaseHash, func(string) (string, error) { return in.Content, nil })
+		if err != nil {
+			return mcp.ToolCallResult{}, err
+		}
+		return textResult(withMergeNote("overwrote "+res.Path, res), res), nil
+	}
+	if !existed {
+		if in.BaseHash != "" {
+			return mcp.ToolCallResult{}, &ConflictError{Path: path, Reason: "note was deleted"}
+		}
+		if err := CheckNoteTarget(in.Path); err != nil {
+			return mcp.ToolCallResult{}, err
+		}
+	}
+	res, err := v.Commit(ctx, path, before, existed, in.Content)
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	return textResult("created "+path, res), nil
+}
+
+// maxRewriteAttempts 是改写笔记时因用户同时保存而重试的次数
+const maxRewriteAttempts = 3
+
+// rewrite 读取笔记、用 fn 计算新内容后写回。
+// 给出 baseHash 时 fn 作用于该版本，笔记此后的变化经 ApplyPatch 重新定位或三方合并，冲突时拒绝；
+// 否则作用于当前内容，写入前笔记又被修改时重新读取并计算
+func (v *Vault) rewrite(ctx context.Context, rel, baseHash string, fn func(content string) (string, error)) (PatchResult, error) {
+	if baseHash != "" {
+		return v.rewriteFrom(ctx, rel, baseHash, fn)
+	}
+	for attempt := 1; ; attempt++ {
+		content, info, err := v.ReadNote(rel)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return PatchResult{}, fmt.Errorf("note not found: %s", NotePath(rel))
+			}
+			return PatchResult{}, err
+		}
+		updated, err := fn(content)
+		if err != nil {
+			return PatchResult{}, err
+		}
+		res, err := v.Commit(ctx, info.Path, content, true, updated)
+		var conflict *ConflictError
+		if errors.As(err, &conflict) && attempt < maxRewriteAttempts {
+			continue
+		}
+		return res, err
+	}
+}
+
+// rewriteFrom 用 fn 改写 baseHash 对应的版本，并把改写收窄为一个编辑交给 ApplyPatch
+func (v *Vault) rewriteFrom(ctx context.Context, rel, baseHash string, fn func(content string) (string, error)) (PatchResult, error) {
+	content, info, err := v.ReadNote(rel)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return PatchResult{}, fmt.Errorf("note not found: %s", NotePath(rel))
+		}
+		return PatchResult{}, err
+	}
+	base := content
+	if edit.Hash(content) != baseHash {
+		var ok bool
+		if base, ok = v.recall(baseHash); !ok {
+			return PatchResult{}, &ConflictError{Path: info.Path, Reason: "the original version is unknown, cannot merge"}
+		}
+	}
+	updated, err := fn(base)
+	if err != nil {
+		return PatchResult{}, err
+	}
+	op, ok := edit.Between(info.Path, base, updated)
+	if !ok {
+		// 相对读取时的版本没有改动，不覆盖期间的修改
+		return v.Commit(ctx, info.Path, content, true, content)
+	}
+	return v.ApplyPatch(ctx, Patch{Path: info.Path, BaseHash: baseHash, Base: base, Ops: []edit.Op{op}, Merge: true})
+}
+
+// withMergeNote 在工具结果文本后注明编辑是否经过重新定位或合并
+func withMergeNote(text string, res PatchResult) string {
+	switch {
+	case res.Merged:
+		return text + " (merged with concurrent changes)"
+	case res.Relocated:
+		return text + " (relocated after concurrent changes)"
+	}
+	return text
+}
+
+func (v *Vault) appendToNoteTool(ctx context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	var in appendInput
+	if err := decodeArgs(args, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	res, err := v.rewrite(ctx, in.Path, in.BaseHash, func(content string) (string, error) {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		content += in.Content
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		return content, nil
+	})
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	return textResult(withMergeNote("appended to "+res.Path, res), res), nil
+}
+
+func (v *Vault) replaceSectionTool(ctx context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	var in replaceSectionInput
+	if err := decodeArgs(args, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	res, err := v.rewrite(ctx, in.Path, in.BaseHash, func(content string) (string, error) {
+		return ReplaceSection(content, in.Heading, in.Content)
+	})
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	return textResult(withMergeNote("replaced section "+in.Heading+" in "+res.Path, res), res), nil
+}
+
+func (v *Vault) applyEditsTool(ctx context.Context, args map[string]any) (mcp.ToolCallResult, error) {
+	var in applyEditsInput
+	if err := decodeArgs(args, &in); err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	path := NotePath(in.Path)
+	for i := range in.Ops {
+		in.Ops[i].Path = path
+		if in.Ops[i].ID == "" {
+			in.Ops[i].ID = fmt.Sprint(i + 1)
+		}
+		if in.Ops[i].Kind == edit.KindInsert {
+			in.Ops[i].To = in.Ops[i].From
+		}
+	}
+	res, err := v.ApplyPatch(ctx, Patch{Path: path, BaseHash: in.BaseHash, Ops: in.Ops, Merge: in.Merge == nil || *in.Merge})
+	if err != nil {
+		return mcp.ToolCallResult{}, err
+	}
+	text := withMergeNote("edited "+res.Path, res)
+	if res.Diff != "" {
+		text += "\n" + res.Diff
+	}
+	return textResult(text, res), nil
+}
@@ -0,0 +1,294 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NoteExt 是 Obsidian 笔记的扩展名
+const NoteExt = ".md"
+
+var (
+	// ErrOutsideVault 表示路径试图逃出仓库根目录
+	ErrOutsideVault = errors.New("path escapes the vault root")
+	// ErrHiddenPath 表示路径位于 .obsidian/ 等隐藏目录中
+	ErrHiddenPath = errors.New("hidden paths such as .obsidian/ are not accessible")
+	// ErrNotNote 表示写入目标带有 .md 以外的文件扩展名
+	ErrNotNote = errors.New("only Markdown notes can be written")
+)
+
+// fileExtRe 匹配像文件扩展名的后缀（.sh、.json、.mp3），不匹配 "2024.01.05"、"v1.2 release" 中的点
+var fileExtRe = regexp.MustCompile(`^\.[A-Za-z][A-Za-z0-9]{0,7}$`)
+
+// Vault 表示一个 Obsidian 仓库，所有读写都被限制在根目录之内。
+// 对外的路径一律是相对仓库根目录、以 / 分隔的形式，例如 "Projects/plan.md"。
+type Vault struct {
+	root string
+
+	writeMu    sync.Mutex // 串行化经由 ApplyPatch/Commit 的写入
+	backupDir  string     // 写入前的版本备份到这里，为空时不备份
+	commitHook CommitHook // 每次经由 ApplyPatch/Commit/DeleteNote 改动笔记后调用
+
+	seenMu sync.Mutex
+	seen   map[string]string // 最近交给模型的笔记内容，按哈希索引，用于三方合并
+	seenAt []string          // seen 的插入顺序，超出 maxSeen 时淘汰最旧的
+}
+
+// New 打开一个仓库根目录
+func New(root string) (*Vault, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("open vault: %w", err)
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return nil, fmt.Errorf("open vault: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("open vault: %s is not a directory", root)
+	}
+	return &Vault{root: real, seen: make(map[string]string)}, nil
+}
+
+// Root 返回仓库根目录的绝对路径
+func (v *Vault) Root() string { return v.root }
+
+// NotePath 规范化笔记路径：统一为 / 分隔，扩展名不是 .md（不区分大小写）时补上 .md，
+// 因此 "Meeting 2024.01.05" 这类文件名中带点的笔记同样解析为 .md 文件
+func NotePath(rel string) string {
+	rel = strings.TrimSpace(filepath.ToSlash(rel))
+	rel = strings.TrimPrefix(rel, "/")
+	if rel != "" && !strings.EqualFold(path.Ext(rel), NoteExt) {
+		rel += NoteExt
+	}
+	return rel
+}
+
+// NoteTitle 返回笔记的标题，即去掉目录和 .md 扩展名的文件名
+func NoteTitle(rel string) string {
+	base := rel
+	if i := strings.LastIndex(base, "/"); i >= 0 {
+		base = base[i+1:]
+	}
+	return strings.TrimSuffix(base, NoteExt)
+}
+
+// CheckNoteTarget 检查新建笔记的目标路径：带有 .md 以外的文件扩展名（如 foo.sh、x.json）时返回 ErrNotNote，
+// 而不是悄悄写成 foo.sh.md。文件名本身以这类后缀结尾的笔记需要显式写出 .md。
+func CheckNoteTarget(rel string) error {
+	ext := path.Ext(strings.TrimSpace(filepath.ToSlash(rel)))
+	if !strings.EqualFold(ext, NoteExt) && fileExtRe.MatchString(ext) {
+		return fmt.Errorf("%w: %s", ErrNotNote, rel)
+	}
+	return nil
+}
+
+// Resolve 把仓库内的相对路径转换成绝对路径，并做沙箱检查：
+// 不允许绝对路径、.. 逃逸、隐藏目录（.obsidian/ 等），以及指向仓库外的符号链接。
+func (v *Vault) Resolve(rel string) (string, error) {
+	rel = strings.TrimSpace(filepath.FromSlash(rel))
+	if rel == "" || rel == "." {
+		return v.root, nil
+	}
+	if filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" {
+		return "", fmt.Errorf("%w: %s", ErrOutsideVault, rel)
+	}
+	clean := filepath.Clean(rel)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideVault, rel)
+	}
+	for _, seg := range strings.Split(clean, string(filepath.Separator)) {
+		if isHidden(seg) {
+			return "", fmt.Errorf("%w: %s", ErrHiddenPath, rel)
+		}
+	}
+
+	abs := filepath.Join(v.root, clean)
+	real, err := evalExisting(abs)
+	if err != nil {
+		return "", err
+	}
+	if !within(v.root, real) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideVault, rel)
+	}
+	return abs, nil
+}
+
+// Rel 把仓库内的绝对路径转换回 / 分隔的相对路径
+func (v *Vault) Rel(abs string) string {
+	rel, err := filepath.Rel(v.root, abs)
+	if err != nil {
+		return filepath.ToSlash(abs)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// isHidden 判断路径片段是否为隐藏文件/目录（.obsidian、.trash、.git 等）
+func isHidden(seg string) bool {
+	return strings.HasPrefix(seg, ".") && seg != "." && seg != ".."
+}
+
+// evalExisting 解析路径中已存在部分的符号链接，不存在的部分原样拼接
+func evalExisting(p string) (string, error) {
+	rest := ""
+	cur := p
+	for {
+		real, err := filepath.EvalSymlinks(cur)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			return p, nil
+		}
+		rest = filepath.Join(filepath.Base(cur), rest)
+		cur = parent
+	}
+}
+
+func within(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// NoteInfo 是笔记的基本信息
+type NoteInfo struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// ReadNote 读取笔记内容
+func (v *Vault) ReadNote(rel string) (string, NoteInfo, error) {
+	rel = NotePath(rel)
+	abs, err := v.Resolve(rel)
+	if err != nil {
+		return "", NoteInfo{}, err
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return "", NoteInfo{}, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", NoteInfo{}, err
+	}
+	return string(data), NoteInfo{Path: rel, Size: info.Size(), Modified: info.ModTime()}, nil
+}
+
+// Exists 判断笔记是否存在
+func (v *Vault) Exists(rel string) bool {
+	abs, err := v.Resolve(NotePath(rel))
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(abs)
+	return err == nil && !info.IsDir()
+}
+
+// WriteNote 写入笔记：先写临时文件再重命名，避免 Obsidian 读到写了一半的内容；
+// 必要时自动创建父目录。已有笔记保留原来的权限，新笔记为 0644；
+// 笔记是符号链接时写入链接指向的文件，而不是用普通文件替换掉链接。
+func (v *Vault) WriteNote(rel, content string) error {
+	abs, err := v.Resolve(NotePath(rel))
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(abs); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+		// Resolve 已确认链接目标位于仓库内
+		if abs, err = filepath.EvalSymlinks(abs); err != nil {
+			return err
+		}
+	}
+	mode := fs.FileMode(0o644)
+	if fi, err := os.Stat(abs); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(abs), ".agent-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), abs)
+}
+
+// WalkNotes 遍历仓库（或其中一个子目录）下的全部笔记，跳过隐藏目录
+func (v *Vault) WalkNotes(folder string, fn func(info NoteInfo) error) error {
+	start, err := v.Resolve(folder)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == start {
+				return err
+			}
+			return nil // 单个文件读取失败不影响整体遍历
+		}
+		if p != start && isHidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(p), NoteExt) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		return fn(NoteInfo{Path: v.Rel(p), Size: info.Size(), Modified: info.ModTime()})
+	})
+}
+
+// ListNotes 列出笔记，可按子目录和 glob（支持 **）过滤，结果按路径排序
+func (v *Vault) ListNotes(folder, glob string) ([]NoteInfo, error) {
+	var match func(string) bool
+	if glob != "" {
+		re, err := globRegexp(glob)
+		if err != nil {
+			return nil, err
+		}
+		match = re.MatchString
+	}
+	var out []NoteInfo
+	err := v.WalkNotes(folder, func(info NoteInfo) error {
+		if match == nil || match(info.Path) {
+			out = append(out, info)
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out, err
+}
@@ -9,6 +9,9 @@ import (
 type BaseClient interface {
 	GetClient() *openai.Client
 
+	// GetModel 返回当前使用的模型名称
+	GetModel() string
+
 	// ChatCompletion 基于用户输入和上下文生成回复
 	ChatCompletion(
 		ctx context.Context,
@@ -32,6 +35,9 @@ type ChatOptions struct {
 	Temperature float32
 	MaxTokens   int
 	Stop        []string
+
+	Tools      []openai.Tool // 可供模型调用的工具，可由 ToolsFromMCP 转换得到
+	ToolChoice any           // "auto" | "none" | openai.ToolChoice；为空时由服务端决定
 }
 
 // StreamResult 用于保存流式结果，避免丢失元数据
@@ -41,6 +47,7 @@ type StreamResult struct {
     FinishReason      openai.FinishReason           // 结束原因（stop/length/...）
     SystemFingerprint string                        // 模型快照指纹，便于复现
     Usage             *openai.Usage                 // Token 使用情况（输入/输出/总数等）
+    ToolCalls         []openai.ToolCall             // 模型请求的工具调用（已按分片拼接完整）
     RawChoices        []openai.ChatCompletionStreamChoice // 原始返回的分片，便于调试
     Headers           map[string]string             // 可选：HTTP 响应头
 }
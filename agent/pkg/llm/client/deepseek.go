@@ -3,13 +3,15 @@ package client
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 
+	"github.com/obsidian-agent/pkg/llm/models"
 	openai "github.com/sashabaranov/go-openai"
 )
 
 const (
-	DEFAULT_MODEL              = "deepseek-chat"
+	DEFAULT_BASE_URL           = "https://api.deepseek.com/v1"
 	DEFAULT_HISTORY_SIZE_LIMIT = 100_000 // 先当“字符预算”用；后续可换 token 计数
 )
 
@@ -21,37 +23,82 @@ type DeepSeekClient struct {
 	systemPrompt string
 }
 
+// NewDeepSeekClient 使用模型注册表中的默认模型创建客户端
 func NewDeepSeekClient(apiKey string) *DeepSeekClient {
+	model := models.Default()
 	cfg := openai.DefaultConfig(apiKey)
-	cfg.BaseURL = "https://api.deepseek.com/v1"
+	cfg.BaseURL = DEFAULT_BASE_URL
+	if model.BaseURL != "" {
+		cfg.BaseURL = model.BaseURL
+	}
 
 	return &DeepSeekClient{
 		Client:           openai.NewClientWithConfig(cfg),
-		Model:            DEFAULT_MODEL,
+		Model:            model.Name,
 		HistorySizeLimit: DEFAULT_HISTORY_SIZE_LIMIT,
 	}
 }
 
 func (d *DeepSeekClient) GetClient() *openai.Client { return d.Client }
+func (d *DeepSeekClient) GetModel() string          { return d.Model }
+
+// SetModel 切换模型，模型必须已在注册表中登记
+func (d *DeepSeekClient) SetModel(name string) error {
+	if _, ok := models.Lookup(name); !ok {
+		return fmt.Errorf("unknown model: %s", name)
+	}
+	d.Model = name
+	return nil
+}
+
+// maxTokens 将调用方请求的输出上限限制在模型允许的范围内
+func (d *DeepSeekClient) maxTokens(opts *ChatOptions) int {
+	limit := models.Get(d.Model).MaxOutputTokens
+	if opts.MaxTokens <= 0 || opts.MaxTokens > limit {
+		return limit
+	}
+	return opts.MaxTokens
+}
 
 func (d *DeepSeekClient) SetSystemPrompt(p string) { d.systemPrompt = p }
 func (d *DeepSeekClient) GetSystemPrompt() string  { return d.systemPrompt }
 
-// BuildMessages 将系统 prompt 组装到用户的上下文尾部
+// BuildMessages 将服务端系统 prompt 与用户上下文合并：
+// 服务端 system prompt 置于最前，上下文里的 system 消息依次合并进同一条首部 system 消息，
+// 其余 user/assistant 消息保持原有顺序。
 func (d *DeepSeekClient) BuildMessages(llmContext []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
-	var msgs []openai.ChatCompletionMessage
+	var systems []string
+	if p := strings.TrimSpace(d.systemPrompt); p != "" {
+		systems = append(systems, p)
+	}
 
-	if len(llmContext) > 0 {
-		msgs = append(msgs, llmContext...)
+	rest := make([]openai.ChatCompletionMessage, 0, len(llmContext))
+	for _, m := range llmContext {
+		if m.Role == openai.ChatMessageRoleSystem {
+			if c := strings.TrimSpace(m.Content); c != "" {
+				systems = append(systems, c)
+			}
+			continue
+		}
+		rest = append(rest, m)
 	}
 
-	if strings.TrimSpace(d.systemPrompt) != "" {
+	msgs := make([]openai.ChatCompletionMessage, 0, len(rest)+1)
+	if len(systems) > 0 {
 		msgs = append(msgs, openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleSystem,
-			Content: d.systemPrompt,
+			Content: strings.Join(systems, "\n\n"),
 		})
 	}
-	return msgs
+	return append(msgs, rest...)
+}
+
+// tools 返回本次请求可携带的工具定义；模型不支持工具调用时不下发
+func (d *DeepSeekClient) tools(opts *ChatOptions) []openai.Tool {
+	if len(opts.Tools) == 0 || !models.Get(d.Model).Capabilities.Tools {
+		return nil
+	}
+	return opts.Tools
 }
 
 // ---- 非流式 ----
@@ -60,13 +107,20 @@ func (d *DeepSeekClient) ChatCompletion(
 		messages []openai.ChatCompletionMessage,
 		opts *ChatOptions,
 ) (response openai.ChatCompletionResponse, err error){
+	if opts == nil {
+		opts = &ChatOptions{Temperature: 0.3, MaxTokens: 512}
+	}
 	// 组装请求
 	req := openai.ChatCompletionRequest{
 		Model:       d.Model,
 		Messages:    messages,
 		Temperature: opts.Temperature,
-		MaxTokens:   opts.MaxTokens,
+		MaxTokens:   d.maxTokens(opts),
 		Stop:        opts.Stop,
+		Tools:       d.tools(opts),
+	}
+	if len(req.Tools) > 0 {
+		req.ToolChoice = opts.ToolChoice
 	}
 	return d.Client.CreateChatCompletion(ctx, req)
 }
@@ -86,19 +140,28 @@ func (d *DeepSeekClient) StreamChatCompletion(
     if opts == nil {
         opts = &ChatOptions{Temperature: 0.3, MaxTokens: 512}
     }
+    // 模型不支持流式时退化为一次性返回
+    if !models.Get(d.Model).Capabilities.Streaming {
+        return d.completeAsStream(ctx, messages, opts, onDelta)
+    }
 
     // 构造请求，开启流式模式
     req := openai.ChatCompletionRequest{
         Model:       d.Model,
         Messages:    messages,
         Temperature: opts.Temperature,
-        MaxTokens:   opts.MaxTokens,
+        MaxTokens:   d.maxTokens(opts),
         Stop:        opts.Stop,
+        Tools:       d.tools(opts),
         Stream:      true,
         // 关键：请求服务端在最后一个 chunk 中包含 usage
         StreamOptions: &openai.StreamOptions{IncludeUsage: true},
     }
 
+    if len(req.Tools) > 0 {
+        req.ToolChoice = opts.ToolChoice
+    }
+
     stream, err := d.Client.CreateChatCompletionStream(ctx, req)
     if err != nil {
         return out, err
@@ -106,18 +169,19 @@ func (d *DeepSeekClient) StreamChatCompletion(
     defer stream.Close()
 
     var b strings.Builder
+    calls := &toolCallAccumulator{}
 
     for {
         // 每次接收一个流式分片
         resp, recvErr := stream.Recv()
         if recvErr != nil {
-            // EOF 或上下文取消：返回已收集的内容
-            if b.Len() > 0 && (errors.Is(recvErr, context.Canceled) || strings.Contains(recvErr.Error(), "EOF")) {
-                out.Text = b.String()
+            out.Text = b.String()
+            out.ToolCalls = calls.ToolCalls()
+            // EOF 或上下文取消：返回已收集的内容（文本或工具调用）
+            if (b.Len() > 0 || len(out.ToolCalls) > 0) && (errors.Is(recvErr, context.Canceled) || strings.Contains(recvErr.Error(), "EOF")) {
                 return out, nil
             }
             // 其他错误：也返回已收集的内容并报错
-            out.Text = b.String()
             return out, recvErr
         }
 
@@ -145,6 +209,10 @@ func (d *DeepSeekClient) StreamChatCompletion(
                     }
                 }
             }
+            // 工具调用以分片形式到达，按 index 拼接
+            for _, tc := range ch.Delta.ToolCalls {
+                calls.Add(tc)
+            }
             // finish_reason 通常只在最后一个分片里出现
             if ch.FinishReason != "" {
                 out.FinishReason = ch.FinishReason
@@ -155,3 +223,32 @@ func (d *DeepSeekClient) StreamChatCompletion(
         out.RawChoices = resp.Choices
     }
 }
+
+
+// completeAsStream 用非流式接口模拟流式调用：整段文本作为一次增量交给 onDelta
+func (d *DeepSeekClient) completeAsStream(
+	ctx context.Context,
+	messages []openai.ChatCompletionMessage,
+	opts *ChatOptions,
+	onDelta StreamHandler,
+) (StreamResult, error) {
+	var out StreamResult
+	resp, err := d.ChatCompletion(ctx, messages, opts)
+	if err != nil {
+		return out, err
+	}
+	out.Model = resp.Model
+	out.SystemFingerprint = resp.SystemFingerprint
+	out.Usage = &resp.Usage
+	if len(resp.Choices) > 0 {
+		out.Text = resp.Choices[0].Message.Content
+		out.ToolCalls = resp.Choices[0].Message.ToolCalls
+		out.FinishReason = resp.Choices[0].FinishReason
+	}
+	if onDelta != nil && out.Text != "" {
+		if err := onDelta(out.Text); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
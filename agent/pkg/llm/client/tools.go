@@ -0,0 +1,85 @@
+package client
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/obsidian-agent/pkg/mcp"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// emptyObjectSchema 用于没有声明入参的工具，function calling 要求 parameters 为 object
+var emptyObjectSchema = json.RawMessage(`{"type":"object","properties":{}}`)
+
+// ToolsFromMCP 将 MCP 工具说明书转换为 OpenAI function calling 的工具定义
+func ToolsFromMCP(defs []*mcp.ToolDef) []openai.Tool {
+	tools := make([]openai.Tool, 0, len(defs))
+	for _, def := range defs {
+		if def == nil {
+			continue
+		}
+		params := def.InputSchema
+		if len(params) == 0 {
+			params = emptyObjectSchema
+		}
+		desc := def.Description
+		if desc == "" {
+			desc = def.Title
+		}
+		tools = append(tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        def.Name,
+				Description: desc,
+				Parameters:  params,
+			},
+		})
+	}
+	// 保证顺序稳定，便于复现和命中服务端缓存
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Function.Name < tools[j].Function.Name })
+	return tools
+}
+
+// toolCallAccumulator 按 index 拼接流式返回的工具调用分片：
+// 首个分片带 id/name，后续分片只追加 arguments。
+type toolCallAccumulator struct {
+	calls []openai.ToolCall
+}
+
+func (a *toolCallAccumulator) Add(delta openai.ToolCall) {
+	idx := len(a.calls)
+	if delta.Index != nil {
+		idx = *delta.Index
+	} else if delta.ID == "" && idx > 0 {
+		idx-- // 没有 index 也没有 id：视为上一个调用的续片
+	}
+	for len(a.calls) <= idx {
+		a.calls = append(a.calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+	}
+
+	call := &a.calls[idx]
+	if delta.ID != "" {
+		call.ID = delta.ID
+	}
+	if delta.Type != "" {
+		call.Type = delta.Type
+	}
+	if delta.Function.Name != "" && call.Function.Name == "" {
+		call.Function.Name = delta.Function.Name
+	}
+	call.Function.Arguments += delta.Function.Arguments
+}
+
+// ToolCalls 返回拼接完成的工具调用，丢弃没有函数名的残缺项
+func (a *toolCallAccumulator) ToolCalls() []openai.ToolCall {
+	out := make([]openai.ToolCall, 0, len(a.calls))
+	for _, c := range a.calls {
+		if c.Function.Name != "" {
+			out = append(out, c)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// Embedder 把文本转换为向量，实现需保证同一输入得到相同维度的向量
+type Embedder interface {
+	// Embed 批量计算向量，返回值与 texts 一一对应
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Dimensions 返回向量维度；维度在首次调用前未知时返回 0
+	Dimensions() int
+	// Name 标识模型，向量索引据此判断已有向量是否仍然可用
+	Name() string
+}
+
+// 支持的 provider
+const (
+	ProviderOpenAI = "openai" // OpenAI 兼容的 /embeddings 接口
+	ProviderHash   = "hash"   // 本地特征哈希，无需网络，适合离线和测试
+)
+
+// Config 描述嵌入模型的配置
+type Config struct {
+	Provider   string `json:"provider"`             // openai | hash，默认 hash
+	Model      string `json:"model,omitempty"`      // 例如 text-embedding-3-small
+	BaseURL    string `json:"base_url,omitempty"`   // OpenAI 兼容服务地址
+	APIKey     string `json:"api_key,omitempty"`    // 为空时由调用方传入默认 key
+	Dimensions int    `json:"dimensions,omitempty"` // 向量维度，hash 默认 DefaultHashDimensions
+	BatchSize  int    `json:"batch_size,omitempty"` // 每次请求的文本条数
+}
+
+// New 根据配置创建 Embedder；fallbackKey 在配置未指定 api_key 时使用
+func New(cfg Config, fallbackKey string) (Embedder, error) {
+	switch cfg.Provider {
+	case "", ProviderHash:
+		return NewHashEmbedder(cfg.Dimensions), nil
+	case ProviderOpenAI:
+		if cfg.APIKey == "" {
+			cfg.APIKey = fallbackKey
+		}
+		return NewOpenAIEmbedder(cfg)
+	default:
+		return nil, fmt.Errorf("unknown embedding provider: %s", cfg.Provider)
+	}
+}
+
+// Normalize 把向量缩放为单位长度，零向量原样返回
+func Normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	inv := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= inv
+	}
+	return v
+}
+
+// Cosine 计算两个向量的余弦相似度，维度不同时返回 0
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
@@ -0,0 +1,94 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// DefaultHashDimensions 是 HashEmbedder 的默认维度
+const DefaultHashDimensions = 256
+
+// HashEmbedder 用特征哈希（hashing trick）把词项映射到固定维度的向量。
+// 结果是确定性的，不依赖网络，只能反映词面重合度，适合离线环境和测试。
+type HashEmbedder struct {
+	dims int
+}
+
+// NewHashEmbedder 创建 HashEmbedder，dims <= 0 时使用默认维度
+func NewHashEmbedder(dims int) *HashEmbedder {
+	if dims <= 0 {
+		dims = DefaultHashDimensions
+	}
+	return &HashEmbedder{dims: dims}
+}
+
+func (e *HashEmbedder) Name() string    { return fmt.Sprintf("hash-%d", e.dims) }
+func (e *HashEmbedder) Dimensions() int { return e.dims }
+
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		out[i] = e.embed(t)
+	}
+	return out, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float32 {
+	v := make([]float32, e.dims)
+	for _, term := range hashTerms(text) {
+		h := fnv.New64a()
+		h.Write([]byte(term))
+		sum := h.Sum64()
+		// 用哈希的最高位决定符号，降低碰撞带来的偏差
+		sign := float32(1)
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		v[sum%uint64(e.dims)] += sign
+	}
+	return Normalize(v)
+}
+
+// hashTerms 切分词项：英文/数字按单词小写，CJK 按相邻两字的二元组
+func hashTerms(text string) []string {
+	var out []string
+	var word strings.Builder
+	var cjk []rune
+	flushWord := func() {
+		if word.Len() > 0 {
+			out = append(out, word.String())
+			word.Reset()
+		}
+	}
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			out = append(out, string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			out = append(out, string(cjk[i:i+2]))
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word.WriteRune(unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return out
+}
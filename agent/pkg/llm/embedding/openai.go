@@ -0,0 +1,100 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	DefaultOpenAIModel = string(openai.SmallEmbedding3)
+	defaultBatchSize   = 64
+)
+
+// OpenAIEmbedder 调用 OpenAI 兼容的 /embeddings 接口
+type OpenAIEmbedder struct {
+	client    *openai.Client
+	model     string
+	dims      int
+	batchSize int
+
+	mu       sync.Mutex
+	seenDims int // 服务端实际返回的维度
+}
+
+// NewOpenAIEmbedder 创建 OpenAI 兼容的 Embedder
+func NewOpenAIEmbedder(cfg Config) (*OpenAIEmbedder, error) {
+	if cfg.APIKey == "" {
+		return nil, errors.New("embedding api key is empty")
+	}
+	oc := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		oc.BaseURL = cfg.BaseURL
+	}
+	model := cfg.Model
+	if model == "" {
+		model = DefaultOpenAIModel
+	}
+	batch := cfg.BatchSize
+	if batch <= 0 {
+		batch = defaultBatchSize
+	}
+	return &OpenAIEmbedder{
+		client:    openai.NewClientWithConfig(oc),
+		model:     model,
+		dims:      cfg.Dimensions,
+		batchSize: batch,
+	}, nil
+}
+
+func (e *OpenAIEmbedder) Name() string {
+	if e.dims > 0 {
+		return fmt.Sprintf("openai:%s-%d", e.model, e.dims)
+	}
+	return "openai:" + e.model
+}
+
+func (e *OpenAIEmbedder) Dimensions() int {
+	if e.dims > 0 {
+		return e.dims
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.seenDims
+}
+
+// Embed 按 batchSize 分批请求，返回的向量已归一化
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += e.batchSize {
+		end := min(start+e.batchSize, len(texts))
+		resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+			Input:      texts[start:end],
+			Model:      openai.EmbeddingModel(e.model),
+			Dimensions: e.dims,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create embeddings: %w", err)
+		}
+		if len(resp.Data) != end-start {
+			return nil, fmt.Errorf("create embeddings: got %d vectors for %d inputs", len(resp.Data), end-start)
+		}
+		batch := make([][]float32, end-start)
+		for _, d := range resp.Data {
+			if d.Index < 0 || d.Index >= len(batch) {
+				return nil, fmt.Errorf("create embeddings: index %d out of range", d.Index)
+			}
+			batch[d.Index] = Normalize(d.Embedding)
+		}
+		out = append(out, batch...)
+	}
+	if len(out) > 0 {
+		e.mu.Lock()
+		e.seenDims = len(out[0])
+		e.mu.Unlock()
+	}
+	return out, nil
+}
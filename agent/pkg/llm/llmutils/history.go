@@ -1,2 +1,341 @@
 package llmutils
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 会话记忆的默认参数
+const (
+	DefaultHistoryMaxTokens = 3000 // 原样保留的消息超过该 token 数时折叠较早的轮次
+	DefaultHistoryKeepTurns = 2    // 折叠时至少原样保留的最近轮数
+
+	DefaultHistoryIdleTTL     = 30 * time.Minute // 会话闲置超过该时长后从内存中移出
+	DefaultHistoryMaxSessions = 256              // 内存中最多保留的会话数，超出时移出最久未用的
+)
+
+// SummaryHead 是把滚动摘要交给模型时使用的前缀
+const SummaryHead = "此前对话的摘要："
+
+// ErrInvalidSessionID 表示会话 ID 为空或含有不允许的字符
+var ErrInvalidSessionID = errors.New("invalid session id")
+
+// sessionIDRe 限制会话 ID 的字符，会话 ID 直接用作文件名
+var sessionIDRe = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,128}$`)
+
+// SummarizeFunc 把一组消息压缩成摘要文本；msgs 的开头可能是携带旧摘要的消息
+type SummarizeFunc func(ctx context.Context, msgs []openai.ChatCompletionMessage) (string, error)
+
+// HistoryState 是一段会话需要持久化的全部记忆
+type HistoryState struct {
+	Summary  string                         `json:"summary,omitempty"` // 较早轮次的滚动摘要
+	Messages []openai.ChatCompletionMessage `json:"messages"`          // 原样保留的最近消息
+	Folded   int                            `json:"folded,omitempty"`  // 已折叠进摘要的消息数
+	Updated  time.Time                      `json:"updated"`
+}
+
+// HistoryStore 持久化会话记忆
+type HistoryStore interface {
+	// Load 读取会话记忆，不存在时返回 nil, nil
+	Load(id string) (*HistoryState, error)
+	Save(id string, st *HistoryState) error
+}
+
+// HistoryOptions 控制折叠时机
+type HistoryOptions struct {
+	MaxTokens int // 原样保留的消息超过该 token 数时折叠，<=0 时使用 DefaultHistoryMaxTokens
+	KeepTurns int // 折叠时至少原样保留的最近轮数，<=0 时使用 DefaultHistoryKeepTurns
+
+	// 内存中的会话按闲置时长和数量淘汰，之后再访问时从 store 重新加载；store 为 nil 时淘汰即丢弃
+	IdleTTL     time.Duration // <=0 时使用 DefaultHistoryIdleTTL
+	MaxSessions int           // <=0 时使用 DefaultHistoryMaxSessions
+}
+
+// Histories 按会话 ID 管理会话记忆，同一会话在进程内只有一个 History
+type Histories struct {
+	model     string
+	store     HistoryStore
+	summarize SummarizeFunc
+	opts      HistoryOptions
+
+	mu       sync.Mutex
+	sessions map[string]*History
+}
+
+// NewHistories 创建会话记忆管理器；model 用于统计 token，store 为 nil 时只保存在内存中
+func NewHistories(model string, store HistoryStore, summarize SummarizeFunc, opts HistoryOptions) *Histories {
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = DefaultHistoryMaxTokens
+	}
+	if opts.KeepTurns <= 0 {
+		opts.KeepTurns = DefaultHistoryKeepTurns
+	}
+	if opts.IdleTTL <= 0 {
+		opts.IdleTTL = DefaultHistoryIdleTTL
+	}
+	if opts.MaxSessions <= 0 {
+		opts.MaxSessions = DefaultHistoryMaxSessions
+	}
+	return &Histories{
+		model:     model,
+		store:     store,
+		summarize: summarize,
+		opts:      opts,
+		sessions:  make(map[string]*History),
+	}
+}
+
+// Get 返回会话记忆，首次访问（或被淘汰后再次访问）时从 store 加载
+func (hs *Histories) Get(id string) (*History, error) {
+	if !sessionIDRe.MatchString(id) {
+		return nil, ErrInvalidSessionID
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	now := time.Now()
+	if h, ok := hs.sessions[id]; ok {
+		h.lastUsed = now
+		return h, nil
+	}
+	hs.evictLocked(now)
+	h := &History{id: id, owner: hs, lastUsed: now}
+	if hs.store != nil {
+		st, err := hs.store.Load(id)
+		if err != nil {
+			return nil, fmt.Errorf("load session %s: %w", id, err)
+		}
+		if st != nil {
+			h.state = *st
+		}
+	}
+	hs.sessions[id] = h
+	return h, nil
+}
+
+// evictLocked 移出闲置超过 IdleTTL 的会话，数量仍达到 MaxSessions 时再移出最久未用的，为新会话留出位置。
+// 正在折叠的会话不移出，避免同一会话在内存中出现两份
+func (hs *Histories) evictLocked(now time.Time) {
+	var oldest *History
+	for id, h := range hs.sessions {
+		if h.isCompacting() {
+			continue
+		}
+		if now.Sub(h.lastUsed) > hs.opts.IdleTTL {
+			delete(hs.sessions, id)
+			continue
+		}
+		if oldest == nil || h.lastUsed.Before(oldest.lastUsed) {
+			oldest = h
+		}
+	}
+	if len(hs.sessions) >= hs.opts.MaxSessions && oldest != nil {
+		delete(hs.sessions, oldest.id)
+	}
+}
+
+// History 是一段会话的记忆：最近的轮次原样保留，超过 token 阈值后较早的轮次连同旧摘要
+// 一起折叠成新的滚动摘要。
+type History struct {
+	id    string
+	owner *Histories
+
+	lastUsed time.Time // 最近一次 Get 的时间，由 owner.mu 保护
+
+	mu         sync.Mutex
+	state      HistoryState
+	compacting bool
+}
+
+// ID 返回会话 ID
+func (h *History) ID() string { return h.id }
+
+func (h *History) isCompacting() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.compacting
+}
+
+// Summary 返回当前的滚动摘要
+func (h *History) Summary() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.state.Summary
+}
+
+// Messages 返回原样保留的最近消息（副本）
+func (h *History) Messages() []openai.ChatCompletionMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]openai.ChatCompletionMessage(nil), h.state.Messages...)
+}
+
+// State 返回会话记忆的快照
+func (h *History) State() HistoryState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st := h.state
+	st.Messages = append([]openai.ChatCompletionMessage(nil), h.state.Messages...)
+	return st
+}
+
+// Append 追加消息（通常是一轮 user + assistant）并持久化
+func (h *History) Append(msgs ...openai.ChatCompletionMessage) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state.Messages = append(h.state.Messages, msgs...)
+	h.state.Updated = time.Now()
+	return h.saveLocked()
+}
+
+// Compact 在原样保留的消息超过阈值时，把较早的轮次折叠进滚动摘要并持久化，返回是否发生了折叠。
+// 至少保留最近 KeepTurns 轮，保留部分总是从 user 消息开始；调用模型期间不持有锁，
+// 其间追加的消息不受影响，同一会话同时只会有一次折叠。
+func (h *History) Compact(ctx context.Context) (bool, error) {
+	hs := h.owner
+	if hs.summarize == nil {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	if h.compacting {
+		h.mu.Unlock()
+		return false, nil
+	}
+	split, err := h.splitLocked()
+	if err != nil || split == 0 {
+		h.mu.Unlock()
+		return false, err
+	}
+	folded := append([]openai.ChatCompletionMessage(nil), h.state.Messages[:split]...)
+	summary := h.state.Summary
+	h.compacting = true
+	h.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		h.compacting = false
+		h.mu.Unlock()
+	}()
+
+	input := folded
+	if summary != "" {
+		input = append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: SummaryHead + "\n" + summary}}, folded...)
+	}
+	next, err := hs.summarize(ctx, input)
+	if err != nil {
+		return false, fmt.Errorf("summarize session %s: %w", h.id, err)
+	}
+	if next == "" {
+		return false, errors.New("summarize returned an empty summary")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state.Summary = next
+	h.state.Messages = append([]openai.ChatCompletionMessage(nil), h.state.Messages[split:]...)
+	h.state.Folded += split
+	h.state.Updated = time.Now()
+	return true, h.saveLocked()
+}
+
+// splitLocked 计算折叠的分界：返回需要折叠的消息数，未超过阈值或保留部分中没有 user 消息时返回 0。
+// 从最新的消息往前保留，直到超出阈值的一半（但至少 KeepTurns 轮），分界落在 user 消息上。
+func (h *History) splitLocked() (int, error) {
+	hs := h.owner
+	msgs := h.state.Messages
+	total, err := CountMessagesTokens(hs.model, msgs)
+	if err != nil || total <= hs.opts.MaxTokens {
+		return 0, err
+	}
+
+	// 保留部分必须从 user 消息开始；一条 user 消息都放不下时不折叠，而不是把全部消息折叠掉
+	keep, turns, split := 0, 0, 0
+	for i := len(msgs) - 1; i >= 0; i-- {
+		n, err := CountMessageTokens(hs.model, msgs[i])
+		if err != nil {
+			return 0, err
+		}
+		if keep+n > hs.opts.MaxTokens/2 && turns >= hs.opts.KeepTurns {
+			break
+		}
+		keep += n
+		if msgs[i].Role == openai.ChatMessageRoleUser {
+			turns++
+			split = i
+		}
+	}
+	return split, nil
+}
+
+func (h *History) saveLocked() error {
+	if h.owner.store == nil {
+		return nil
+	}
+	return h.owner.store.Save(h.id, &h.state)
+}
+
+// FileHistoryStore 把每个会话的记忆保存为 dir 下的一个 JSON 文件
+type FileHistoryStore struct {
+	dir string
+}
+
+// NewFileHistoryStore 创建基于目录的会话存储，目录不存在时自动创建
+func NewFileHistoryStore(dir string) (*FileHistoryStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileHistoryStore{dir: dir}, nil
+}
+
+func (s *FileHistoryStore) path(id string) (string, error) {
+	if !sessionIDRe.MatchString(id) {
+		return "", ErrInvalidSessionID
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// Load 读取会话记忆，文件不存在时返回 nil, nil
+func (s *FileHistoryStore) Load(id string) (*HistoryState, error) {
+	file, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st HistoryState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", file, err)
+	}
+	return &st, nil
+}
+
+// Save 先写临时文件再改名，避免中途失败留下不完整的文件
+func (s *FileHistoryStore) Save(id string, st *HistoryState) error {
+	file, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -4,23 +4,61 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"sync"
+	"unicode"
 	"unicode/utf8"
 
+	"github.com/obsidian-agent/pkg/llm/models"
 	openai "github.com/sashabaranov/go-openai"
 	tiktoken "github.com/pkoukk/tiktoken-go"
 )
 
 // CountTokens 用于统计单个字符串在指定模型/分词器下的 token 数量。
+// 分词器由模型注册表决定；分词器不可用（如离线时无法加载编码文件）则回退到近似估算。
 func CountTokens(model, s string) (int, error) {
-	enc, err := tiktoken.EncodingForModel(model)
+	enc := encodingFor(model)
+	if enc == nil {
+		return estimateTokens(s), nil
+	}
+	return len(enc.Encode(s, nil, nil)), nil
+}
+
+// IsEstimate 报告该模型的 token 数是否为近似估算：注册表声明为 approx，或编码不可用
+func IsEstimate(model string) bool { return encodingFor(model) == nil }
+
+// encodings 缓存已加载的编码（包括加载失败的 nil 结果），避免离线时每次都重试下载
+var encodings sync.Map // tokenizer name -> *tiktoken.Tiktoken
+
+// encodingFor 根据模型注册表中的 tokenizer 获取 tiktoken 编码，
+// 注册表声明为 approx 或编码加载失败时返回 nil。
+func encodingFor(model string) *tiktoken.Tiktoken {
+	name := models.Get(model).Tokenizer
+	if name == models.ApproxTokenizer {
+		return nil
+	}
+	if v, ok := encodings.Load(name); ok {
+		return v.(*tiktoken.Tiktoken)
+	}
+	enc, err := tiktoken.GetEncoding(name)
 	if err != nil {
-		// 回退到一个广泛使用的基础编码
-		enc, err = tiktoken.GetEncoding("cl100k_base")
-		if err != nil {
-			return 0, err
+		enc = nil
+	}
+	encodings.Store(name, enc)
+	return enc
+}
+
+// estimateTokens 粗略估算 token 数：CJK 字符按 1 个 token 计，其余按每 3 字节 1 个 token 计。
+// 两者都略高于 DeepSeek 官方给出的换算（中文约 0.6、英文约 0.3 token/字符），宁可多算也不超窗口。
+func estimateTokens(s string) int {
+	cjk, other := 0, 0
+	for _, r := range s {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+			continue
 		}
+		other += utf8.RuneLen(r)
 	}
-	return len(enc.Encode(s, nil, nil)), nil
+	return cjk + (other+2)/3
 }
 
 // CountMessageTokens 用于估算单条聊天消息的 token 数量。
@@ -32,6 +70,14 @@ func CountMessageTokens(model string, msg openai.ChatCompletionMessage) (int, er
 	if err != nil {
 		return 0, err
 	}
+	// 工具调用的函数名和参数同样占用上下文
+	for _, tc := range msg.ToolCalls {
+		m, err := CountTokens(model, tc.Function.Name+tc.Function.Arguments)
+		if err != nil {
+			return 0, err
+		}
+		n += m + roleOverhead
+	}
 	return n + roleOverhead, nil
 }
 
@@ -86,6 +132,7 @@ func ClipMessagesToTokenLimit(
 	selected := make([]openai.ChatCompletionMessage, 0, len(rest)+1)
 
 	total := 0
+	head := 0 // 前插位置：有 system 时为 1，保证 system 始终位于索引 0
 	if system != nil {
 		n, err := CountMessageTokens(model, *system)
 		if err != nil {
@@ -100,6 +147,7 @@ func ClipMessagesToTokenLimit(
 		}
 		total += n
 		selected = append(selected, *system)
+		head = 1
 	}
 
 	// 从末尾累加
@@ -111,8 +159,8 @@ func ClipMessagesToTokenLimit(
 		if total+n <= budget {
 			// 前插以保持后续时间顺序
 			selected = append(selected, openai.ChatCompletionMessage{}) // 插入占位
-			copy(selected[2:], selected[1:])                           // 右移；如有 system 保持在索引 0
-			selected[1] = rest[i]
+			copy(selected[head+1:], selected[head:])                   // 右移；如有 system 保持在索引 0
+			selected[head] = rest[i]
 			total += n
 			continue
 		}
@@ -126,8 +174,8 @@ func ClipMessagesToTokenLimit(
 					msg.Content = truncContent
 					// 插入截断后的消息
 					selected = append(selected, openai.ChatCompletionMessage{})
-					copy(selected[2:], selected[1:])
-					selected[1] = msg
+					copy(selected[head+1:], selected[head:])
+					selected[head] = msg
 					total = budget // 已用满预算
 				}
 			}
@@ -140,16 +188,39 @@ func ClipMessagesToTokenLimit(
 	return selected, nil
 }
 
+// FitTokens 返回 s 在 maxTokens 以内的最长前缀（按字符截断），以及是否发生了截断
+func FitTokens(model, s string, maxTokens int) (string, bool, error) {
+	n, err := CountTokens(model, s)
+	if err != nil || n <= maxTokens {
+		return s, false, err
+	}
+	if maxTokens <= 0 {
+		return "", true, nil
+	}
+	runes := []rune(s)
+	lo, hi := 0, len(runes) // runes[:lo] 放得下，runes[:hi] 放不下
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		n, err := CountTokens(model, string(runes[:mid]))
+		if err != nil {
+			return "", true, err
+		}
+		if n <= maxTokens {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return string(runes[:lo]), true, nil
+}
+
 // truncateByTokens 用于将字符串 s 截断到最多 maxTokens 个 token（近似），
 // 如果无法快速获得精确边界，则回退到按字符截断。
 func truncateByTokens(model, s string, maxTokens int) string {
 	if maxTokens <= 0 || len(s) == 0 {
 		return ""
 	}
-	enc, err := tiktoken.EncodingForModel(model)
-	if err != nil {
-		enc, _ = tiktoken.GetEncoding("cl100k_base")
-	}
+	enc := encodingFor(model)
 	if enc == nil {
 		// 回退：粗略按字符截断（非精确 token）
 		return roughCutRunes(s, maxTokens*3/2)
@@ -0,0 +1,65 @@
+package models
+
+// builtinModels 是内置的模型描述，可被配置文件中的同名模型覆盖。
+// 价格参考官方定价（缓存未命中），仅用于粗略统计费用。
+// DeepSeek 使用自有分词器，没有对应的 tiktoken 编码，token 数按 ApproxTokenizer 估算。
+var builtinModels = []Model{
+	{
+		Name:            "deepseek-chat",
+		Provider:        "deepseek",
+		BaseURL:         "https://api.deepseek.com/v1",
+		ContextWindow:   64_000,
+		MaxOutputTokens: 8192,
+		Tokenizer:       ApproxTokenizer,
+		InputPrice:      0.27,
+		OutputPrice:     1.10,
+		Capabilities:    Capabilities{Streaming: true, Tools: true, JSONMode: true},
+	},
+	{
+		Name:            "deepseek-reasoner",
+		Provider:        "deepseek",
+		BaseURL:         "https://api.deepseek.com/v1",
+		ContextWindow:   64_000,
+		MaxOutputTokens: 8192,
+		Tokenizer:       ApproxTokenizer,
+		InputPrice:      0.55,
+		OutputPrice:     2.19,
+		Capabilities:    Capabilities{Streaming: true, Reasoning: true},
+	},
+}
+
+var defaultRegistry = newBuiltinRegistry()
+
+func newBuiltinRegistry() *Registry {
+	r := NewRegistry()
+	for _, m := range builtinModels {
+		_ = r.Register(m)
+	}
+	return r
+}
+
+// DefaultRegistry 返回进程级的全局模型注册表
+func DefaultRegistry() *Registry { return defaultRegistry }
+
+// Load 将配置中的模型注册到全局注册表（同名覆盖内置描述），
+// defaultModel 非空时同时设置默认模型。
+func Load(models []Model, defaultModel string) error {
+	for _, m := range models {
+		if err := defaultRegistry.Register(m); err != nil {
+			return err
+		}
+	}
+	if defaultModel != "" {
+		return defaultRegistry.SetDefault(defaultModel)
+	}
+	return nil
+}
+
+// Lookup 在全局注册表中查找模型
+func Lookup(name string) (Model, bool) { return defaultRegistry.Lookup(name) }
+
+// Get 返回全局注册表中的模型描述，未注册时返回保守默认值
+func Get(name string) Model { return defaultRegistry.Get(name) }
+
+// Default 返回全局默认模型
+func Default() Model { return defaultRegistry.Default() }
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	// DefaultContextWindow 是未注册模型的保守上下文窗口大小
+	DefaultContextWindow = 32_000
+	// DefaultMaxOutputTokens 是未注册模型的保守最大输出 token 数
+	DefaultMaxOutputTokens = 4096
+	// DefaultTokenizer 是未声明分词器时使用的 tiktoken 编码
+	DefaultTokenizer = "cl100k_base"
+	// ApproxTokenizer 表示没有可用的精确分词器，按字符数近似估算
+	ApproxTokenizer = "approx"
+)
+
+// Capabilities 描述模型支持的能力
+type Capabilities struct {
+	Streaming bool `json:"streaming"` // 是否支持流式输出
+	Tools     bool `json:"tools"`     // 是否支持 function/tool calling
+	JSONMode  bool `json:"json_mode"` // 是否支持 response_format=json_object
+	Reasoning bool `json:"reasoning"` // 是否为推理模型（输出思维链）
+}
+
+// Model 描述一个模型的元数据：所属 provider、上下文窗口、分词器、价格与能力
+type Model struct {
+	Name            string       `json:"name"`
+	Provider        string       `json:"provider"`
+	BaseURL         string       `json:"base_url,omitempty"`
+	ContextWindow   int          `json:"context_window"`
+	MaxOutputTokens int          `json:"max_output_tokens"`
+	Tokenizer       string       `json:"tokenizer,omitempty"`
+	InputPrice      float64      `json:"input_price"`  // 每百万输入 token 的价格（USD）
+	OutputPrice     float64      `json:"output_price"` // 每百万输出 token 的价格（USD）
+	Capabilities    Capabilities `json:"capabilities"`
+}
+
+// Cost 根据 token 用量估算一次调用的费用（USD）
+func (m Model) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*m.InputPrice + float64(completionTokens)*m.OutputPrice) / 1_000_000
+}
+
+// Registry 维护模型名到元数据的映射，并记录默认模型
+type Registry struct {
+	mu           sync.RWMutex
+	models       map[string]Model
+	defaultModel string
+}
+
+// NewRegistry 创建一个空的模型注册表
+func NewRegistry() *Registry {
+	return &Registry{models: make(map[string]Model)}
+}
+
+// Register 注册或覆盖一个模型；第一个注册的模型会成为默认模型
+func (r *Registry) Register(m Model) error {
+	if m.Name == "" {
+		return errors.New("model name must not be empty")
+	}
+	if m.ContextWindow <= 0 {
+		return fmt.Errorf("model %q: context_window must be positive", m.Name)
+	}
+	if m.MaxOutputTokens <= 0 || m.MaxOutputTokens > m.ContextWindow {
+		m.MaxOutputTokens = min(DefaultMaxOutputTokens, m.ContextWindow/2)
+	}
+	if m.Tokenizer == "" {
+		m.Tokenizer = DefaultTokenizer
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.models[m.Name] = m
+	if r.defaultModel == "" {
+		r.defaultModel = m.Name
+	}
+	return nil
+}
+
+// Lookup 查找已注册的模型
+func (r *Registry) Lookup(name string) (Model, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.models[name]
+	return m, ok
+}
+
+// Get 返回模型元数据；未注册的模型返回一份保守的默认描述，保证调用方总能拿到可用的数值
+func (r *Registry) Get(name string) Model {
+	if m, ok := r.Lookup(name); ok {
+		return m
+	}
+	return Model{
+		Name:            name,
+		Provider:        "unknown",
+		ContextWindow:   DefaultContextWindow,
+		MaxOutputTokens: DefaultMaxOutputTokens,
+		Tokenizer:       DefaultTokenizer,
+		Capabilities:    Capabilities{Streaming: true},
+	}
+}
+
+// SetDefault 设置默认模型，模型必须已注册
+func (r *Registry) SetDefault(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.models[name]; !ok {
+		return fmt.Errorf("unknown model: %s", name)
+	}
+	r.defaultModel = name
+	return nil
+}
+
+// Default 返回默认模型
+func (r *Registry) Default() Model {
+	r.mu.RLock()
+	name := r.defaultModel
+	r.mu.RUnlock()
+	return r.Get(name)
+}
+
+// List 按名称排序返回全部已注册模型
+func (r *Registry) List() []Model {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Model, 0, len(r.models))
+	for _, m := range r.models {
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 )
 
@@ -13,6 +14,28 @@ type Logger struct {
 	logger *log.Logger
 }
 
+// consoleWriter 是所有 Logger 共享的控制台输出，默认写 stdout
+type consoleWriter struct {
+	mu sync.RWMutex
+	w  io.Writer
+}
+
+func (c *consoleWriter) Write(p []byte) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.w.Write(p)
+}
+
+var console = &consoleWriter{w: os.Stdout}
+
+// SetConsole 切换所有 Logger 的控制台输出（包括已创建的）。
+// 以 stdio 方式提供 MCP 服务时 stdout 专用于协议数据，需要切到 stderr。
+func SetConsole(w io.Writer) {
+	console.mu.Lock()
+	defer console.mu.Unlock()
+	console.w = w
+}
+
 // New creates a logger writing to both file and stdout
 func New(logFile string) (*Logger, error) {
 	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -20,8 +43,8 @@ func New(logFile string) (*Logger, error) {
 		return nil, err
 	}
 
-	// MultiWriter -> file + stdout
-	writer := io.MultiWriter(file, os.Stdout)
+	// MultiWriter -> file + console（默认 stdout）
+	writer := io.MultiWriter(file, console)
 
 	return &Logger{
 		logger: log.New(writer, "", 0), // no default prefix
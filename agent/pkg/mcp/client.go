@@ -0,0 +1,244 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// ErrClientClosed 表示连接已断开（例如外部服务进程退出）
+var ErrClientClosed = errors.New("mcp client closed")
+
+// NotificationHandler 处理服务端推送的通知
+type NotificationHandler func(method string, params json.RawMessage)
+
+// Client 是一个 MCP 客户端：在一对读写流上以换行分隔的 JSON-RPC 2.0 与服务端通信。
+type Client struct {
+	w       io.WriteCloser
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	nextID   int64
+	pending  map[string]chan RPCMessage
+	onNotify NotificationHandler
+	closeErr error
+
+	done   chan struct{}
+	server InitializeResult
+}
+
+// NewClient 在 r/w 上创建客户端并开始读取消息；w 关闭即表示断开连接
+func NewClient(r io.Reader, w io.WriteCloser) *Client {
+	c := &Client{
+		w:       w,
+		pending: make(map[string]chan RPCMessage),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(r)
+	return c
+}
+
+// OnNotification 设置通知回调，回调在读循环中执行，不应阻塞
+func (c *Client) OnNotification(h NotificationHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onNotify = h
+}
+
+// Done 在连接断开后关闭
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+// Err 返回连接断开的原因，连接仍可用时返回 nil
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeErr
+}
+
+// Close 关闭写端，服务端读到 EOF 后应自行退出
+func (c *Client) Close() error {
+	return c.w.Close()
+}
+
+// ServerInfo 返回握手时服务端上报的信息
+func (c *Client) ServerInfo() InitializeResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.server
+}
+
+// Initialize 完成 MCP 握手：发送 initialize，再发送 notifications/initialized
+func (c *Client) Initialize(ctx context.Context, info Implementation) (InitializeResult, error) {
+	var res InitializeResult
+	err := c.call(ctx, MethodInitialize, InitializeParams{
+		ProtocolVersion: LatestProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      info,
+	}, &res)
+	if err != nil {
+		return res, err
+	}
+	c.mu.Lock()
+	c.server = res
+	c.mu.Unlock()
+	return res, c.notify(NotifyInitialized, nil)
+}
+
+// Ping 检查服务端是否存活
+func (c *Client) Ping(ctx context.Context) error {
+	return c.call(ctx, MethodPing, nil, nil)
+}
+
+// ListTools 拉取服务端的全部工具（自动处理分页）
+func (c *Client) ListTools(ctx context.Context) ([]*ToolDef, error) {
+	var tools []*ToolDef
+	cursor := ""
+	for {
+		var params any
+		if cursor != "" {
+			params = map[string]string{"cursor": cursor}
+		}
+		var page ListToolsResult
+		if err := c.call(ctx, MethodToolsList, params, &page); err != nil {
+			return nil, err
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool 调用服务端的工具；业务错误体现在 IsError 中，协议错误以 error 返回
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (ToolCallResult, error) {
+	var res ToolCallResult
+	err := c.call(ctx, MethodToolsCall, ToolCallRequest{Name: name, Arguments: args}, &res)
+	return res, err
+}
+
+// call 发送请求并等待响应；ctx 取消时按 MCP 约定补发 notifications/cancelled
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	c.mu.Lock()
+	if c.closeErr != nil {
+		err := c.closeErr
+		c.mu.Unlock()
+		return err
+	}
+	c.nextID++
+	id := json.RawMessage(strconv.FormatInt(c.nextID, 10))
+	ch := make(chan RPCMessage, 1)
+	c.pending[string(id)] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, string(id))
+		c.mu.Unlock()
+	}()
+
+	msg, err := newRequest(id, method, params)
+	if err != nil {
+		return err
+	}
+	if err := c.write(msg); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("decode %s result: %w", method, err)
+		}
+		return nil
+	case <-c.done:
+		return c.Err()
+	case <-ctx.Done():
+		_ = c.notify(NotifyCancelled, CancelledParams{RequestID: json.Number(id), Reason: ctx.Err().Error()})
+		return ctx.Err()
+	}
+}
+
+func (c *Client) notify(method string, params any) error {
+	msg, err := newRequest(nil, method, params)
+	if err != nil {
+		return err
+	}
+	return c.write(msg)
+}
+
+func (c *Client) write(msg RPCMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.w.Write(append(data, '\n'))
+	return err
+}
+
+// readLoop 持续读取服务端消息：响应交给等待者，通知交给回调，服务端发起的 ping 直接应答
+func (c *Client) readLoop(r io.Reader) {
+	br := bufio.NewReader(r)
+	var readErr error
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			c.dispatch(line)
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+
+	c.mu.Lock()
+	if errors.Is(readErr, io.EOF) {
+		c.closeErr = ErrClientClosed
+	} else {
+		c.closeErr = fmt.Errorf("%w: %v", ErrClientClosed, readErr)
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
+
+func (c *Client) dispatch(line []byte) {
+	var msg RPCMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return // 非协议输出（例如服务端误打到 stdout 的日志），忽略
+	}
+	switch {
+	case msg.IsResponse():
+		c.mu.Lock()
+		ch, ok := c.pending[idKey(msg.ID)]
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	case msg.IsNotification():
+		c.mu.Lock()
+		h := c.onNotify
+		c.mu.Unlock()
+		if h != nil {
+			h(msg.Method, msg.Params)
+		}
+	case msg.IsRequest():
+		if msg.Method == MethodPing {
+			_ = c.write(newResult(msg.ID, struct{}{}))
+			return
+		}
+		_ = c.write(newError(msg.ID, CodeMethodNotFound, "method not found: "+msg.Method))
+	}
+}
@@ -3,11 +3,9 @@ package mcp
 import (
 	"context"
 	"encoding/json"
-	"sync"
+	"strings"
 
-    // 可选：使用 JSON Schema 校验库（需要时再取消注释其中一个）
-	// "github.com/santhosh-tekuri/jsonschema/v5"
-	// "github.com/xeipuuv/gojsonschema"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 )
 
 // ---- 对外的工具“说明书”定义 ----
@@ -15,11 +13,21 @@ import (
 // ToolDef 表示一个工具的元数据和入/出参的 JSON-Schema（原始 JSON 文本）。
 // 注意：这里不用承载任何“可执行”内容，仅用于对外暴露（如 tools/list）或持久化。
 type ToolDef struct {
-	Name         string          `json:"name"`
-	Title        string          `json:"title,omitempty"`
-	Description  string          `json:"description,omitempty"`
-	InputSchema  json.RawMessage `json:"inputSchema"`
-	OutputSchema json.RawMessage `json:"outputSchema,omitempty"`
+	Name         string           `json:"name"`
+	Title        string           `json:"title,omitempty"`
+	Description  string           `json:"description,omitempty"`
+	InputSchema  json.RawMessage  `json:"inputSchema"`
+	OutputSchema json.RawMessage  `json:"outputSchema,omitempty"`
+	Annotations  *ToolAnnotations `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations 是 MCP 规范中对工具行为的提示（仅供参考，不作安全保证）
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    bool   `json:"readOnlyHint,omitempty"`    // 不修改环境
+	DestructiveHint *bool  `json:"destructiveHint,omitempty"` // 可能做出破坏性修改（默认 true）
+	IdempotentHint  bool   `json:"idempotentHint,omitempty"`  // 相同参数重复调用无额外影响
+	OpenWorldHint   *bool  `json:"openWorldHint,omitempty"`   // 会与外部世界交互（默认 true）
 }
 
 // ToolCallRequest 表示一次工具调用的请求体（由客户端发起）。
@@ -45,6 +53,31 @@ type ToolCallResult struct {
 	ErrorMessage      string        `json:"errorMessage,omitempty"`
 }
 
+// Text 将调用结果整理成一段文本，便于回填给大模型：
+// 优先使用 text 内容，没有时退化为结构化结果的 JSON；业务错误会带上 error 前缀。
+func (r ToolCallResult) Text() string {
+	var b strings.Builder
+	if r.IsError {
+		b.WriteString("error: ")
+		b.WriteString(r.ErrorMessage)
+	}
+	for _, p := range r.Content {
+		if p.Type != "text" || p.Text == "" || (r.IsError && p.Text == r.ErrorMessage) {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(p.Text)
+	}
+	if b.Len() == 0 && r.StructuredContent != nil {
+		if raw, err := json.Marshal(r.StructuredContent); err == nil {
+			b.Write(raw)
+		}
+	}
+	return b.String()
+}
+
 // ---- 可执行工具的绑定 ----
 
 // ToolHandler 是与某个 ToolDef 绑定的可执行函数。
@@ -53,17 +86,33 @@ type ToolCallResult struct {
 // 若要返回协议级错误（如方法不存在），请在更上层（RPC 层）处理。
 type ToolHandler func(ctx context.Context, args map[string]any) (ToolCallResult, error)
 
-// toolEntry 代表一个已注册的工具，包含：说明书、可执行函数、（可选）编译后的 schema。
+// ConfirmDescriber 根据调用参数生成一段给用户看的待执行操作描述
+type ConfirmDescriber func(args map[string]any) string
+
+// ToolOption 是注册工具时的可选配置
+type ToolOption func(te *toolEntry)
+
+// WithConfirmation 声明该工具需要用户确认后才能执行；
+// describe 用于生成确认提示，为 nil 时使用工具标题和参数拼出默认描述；
+// describe 返回空串表示本次调用无需确认（例如只有带输出路径时才会写入的工具）。
+func WithConfirmation(describe ConfirmDescriber) ToolOption {
+	return func(te *toolEntry) {
+		te.requireConfirm = true
+		te.describe = describe
+	}
+}
+
+// toolEntry 代表一个已注册的工具，包含：说明书、可执行函数、编译后的 schema。
 // 把编译后的 schema 放在这里有三点好处：性能（编译一次复用）、并发安全、避免对外暴露内部实现。
 type toolEntry struct {
 	def     *ToolDef
 	handler ToolHandler
 
-	// ---- 可选：编译后的 JSON-Schema（取消注释并引入库即可）----
-	// inSchema  *jsonschema.Schema
-	// outSchema *jsonschema.Schema
+	// 需要用户确认后才能执行（例如会修改笔记的工具）
+	requireConfirm bool
+	describe       ConfirmDescriber
 
-	// 懒编译控制（只在第一次需要时编译，避免注册时阻塞）
-	compileOnce sync.Once
-	compileErr  error
+	// 注册时编译好的 JSON-Schema，未声明对应 schema 时为 nil
+	inSchema  *jsonschema.Schema
+	outSchema *jsonschema.Schema
 }
@@ -0,0 +1,366 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/obsidian-agent/pkg/logger"
+)
+
+// NamespaceSeparator 分隔外部服务前缀与原始工具名，例如 git__status。
+// 使用下划线是为了满足大模型 function name 只允许 [a-zA-Z0-9_-] 的限制。
+const NamespaceSeparator = "__"
+
+const (
+	externalInitTimeout = 10 * time.Second
+	minRestartBackoff   = time.Second
+	maxRestartBackoff   = 30 * time.Second
+	stableRunDuration   = time.Minute // 进程稳定运行超过该时长后，重启退避重新计时
+)
+
+// ExternalServerConfig 描述一个以子进程方式启动的外部 MCP 服务
+type ExternalServerConfig struct {
+	Name    string            `json:"name"`    // 服务名，同时作为工具名前缀
+	Command string            `json:"command"` // 可执行文件
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"` // 追加到当前进程环境变量之上
+	Dir     string            `json:"dir"`
+	// 默认除声明了 readOnlyHint 的工具外，调用前都需要用户确认；
+	// SkipConfirm 为 true 表示信任该服务，其全部工具无需确认即可执行
+	SkipConfirm bool `json:"skip_confirm"`
+}
+
+// ExternalServer 负责拉起外部 MCP 服务子进程、完成握手、
+// 把其工具以 "<name>__<tool>" 导入本地 MCPServer 并代理调用，进程崩溃后自动重启。
+type ExternalServer struct {
+	cfg   ExternalServerConfig
+	local *MCPServer
+	log   *logger.Logger
+
+	minBackoff time.Duration
+
+	mu       sync.RWMutex
+	client   *Client
+	imported map[string]string // 已导入本地注册表的工具（带前缀）→ 远端说明书的序列化结果，用于判断定义是否变化
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewExternalServer 创建外部服务的管理器，调用 Start 后才会拉起进程
+func NewExternalServer(cfg ExternalServerConfig, local *MCPServer) *ExternalServer {
+	return &ExternalServer{
+		cfg:        cfg,
+		local:      local,
+		minBackoff: minRestartBackoff,
+		imported:   make(map[string]string),
+	}
+}
+
+// SetLogger 设置日志输出，不设置时不打印日志
+func (e *ExternalServer) SetLogger(l *logger.Logger) { e.log = l }
+
+// Name 返回服务名
+func (e *ExternalServer) Name() string { return e.cfg.Name }
+
+// Start 拉起进程并导入工具；首次启动失败直接返回错误，之后的崩溃由后台协程负责重启。
+// ctx 控制外部服务的整个生命周期，取消后进程会被停止（与调用 Close 等价，但不注销工具）。
+func (e *ExternalServer) Start(ctx context.Context) error {
+	if e.cfg.Name == "" || e.cfg.Command == "" {
+		return errors.New("external mcp server requires name and command")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c, cmd, err := e.launch(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	e.setClient(c)
+	if err := e.syncTools(ctx); err != nil {
+		e.logf("WARN", "sync tools from %s: %v", e.cfg.Name, err)
+	}
+
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	go e.supervise(ctx, c, cmd)
+	return nil
+}
+
+// Close 停止进程并注销已导入的工具
+func (e *ExternalServer) Close() {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	<-e.done
+
+	e.mu.Lock()
+	names := make([]string, 0, len(e.imported))
+	for name := range e.imported {
+		names = append(names, name)
+	}
+	e.imported = make(map[string]string)
+	e.mu.Unlock()
+	for _, name := range names {
+		e.local.UnregisterTool(name)
+	}
+}
+
+// launch 启动子进程并完成 MCP 握手
+func (e *ExternalServer) launch(ctx context.Context) (*Client, *exec.Cmd, error) {
+	cmd := exec.Command(e.cfg.Command, e.cfg.Args...)
+	cmd.Dir = e.cfg.Dir
+	cmd.Env = os.Environ()
+	for k, v := range e.cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("start %s: %w", e.cfg.Name, err)
+	}
+	go e.drainStderr(stderr)
+
+	c := NewClient(stdout, stdin)
+	c.OnNotification(func(method string, _ json.RawMessage) {
+		if method == NotifyToolsListChanged {
+			go func() {
+				if err := e.syncTools(ctx); err != nil {
+					e.logf("WARN", "resync tools from %s: %v", e.cfg.Name, err)
+				}
+			}()
+		}
+	})
+
+	initCtx, cancel := context.WithTimeout(ctx, externalInitTimeout)
+	defer cancel()
+	if _, err := c.Initialize(initCtx, Implementation{Name: "obsidian-agent", Version: "dev"}); err != nil {
+		_ = c.Close()
+		_ = cmd.Process.Kill()
+		<-c.Done()
+		_ = cmd.Wait()
+		return nil, nil, fmt.Errorf("initialize %s: %w", e.cfg.Name, err)
+	}
+	e.logf("INFO", "external mcp server %s started (pid %d)", e.cfg.Name, cmd.Process.Pid)
+	return c, cmd, nil
+}
+
+// supervise 等待进程退出，非主动停止时按指数退避重启并重新同步工具
+func (e *ExternalServer) supervise(ctx context.Context, c *Client, cmd *exec.Cmd) {
+	defer close(e.done)
+	backoff := e.minBackoff
+	for {
+		started := time.Now()
+		select {
+		case <-c.Done():
+		case <-ctx.Done():
+			_ = c.Close()
+			stopProcess(cmd, c)
+			return
+		}
+		err := cmd.Wait()
+		e.setClient(nil)
+		if ctx.Err() != nil {
+			return
+		}
+		e.logf("WARN", "external mcp server %s exited: %v", e.cfg.Name, err)
+		if time.Since(started) > stableRunDuration {
+			backoff = e.minBackoff
+		}
+
+		// 重启，失败则继续退避重试
+		for {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff = min(backoff*2, maxRestartBackoff)
+
+			nc, ncmd, err := e.launch(ctx)
+			if err != nil {
+				e.logf("ERROR", "restart %s: %v", e.cfg.Name, err)
+				continue
+			}
+			c, cmd = nc, ncmd
+			e.setClient(c)
+			if err := e.syncTools(ctx); err != nil {
+				e.logf("WARN", "sync tools from %s: %v", e.cfg.Name, err)
+			}
+			break
+		}
+	}
+}
+
+// stopProcess 关闭 stdin 后给进程一点时间自行退出，超时则强制结束
+func stopProcess(cmd *exec.Cmd, c *Client) {
+	select {
+	case <-c.Done():
+	case <-time.After(2 * time.Second):
+		_ = cmd.Process.Kill()
+		<-c.Done()
+	}
+	_ = cmd.Wait()
+}
+
+func (e *ExternalServer) setClient(c *Client) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.client = c
+}
+
+func (e *ExternalServer) currentClient() *Client {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.client
+}
+
+// syncTools 拉取外部工具列表，与已导入的工具做差量同步
+func (e *ExternalServer) syncTools(ctx context.Context) error {
+	c := e.currentClient()
+	if c == nil {
+		return ErrClientClosed
+	}
+	listCtx, cancel := context.WithTimeout(ctx, externalInitTimeout)
+	defer cancel()
+	remote, err := c.ListTools(listCtx)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	var (
+		add, replace []*toolEntry
+		remove       []string
+	)
+	seen := make(map[string]bool, len(remote))
+	for _, def := range remote {
+		if def == nil || def.Name == "" {
+			continue
+		}
+		name := e.cfg.Name + NamespaceSeparator + def.Name
+		seen[name] = true
+		raw, err := json.Marshal(def)
+		if err != nil {
+			e.logf("WARN", "import tool %s: %v", name, err)
+			continue
+		}
+		if prev, ok := e.imported[name]; ok && prev == string(raw) {
+			continue
+		}
+		// 新增或定义有变化的工具原地替换，避免并发调用看到 "unknown tool"
+		te, err := newToolEntry(e.localDef(name, def), e.proxy(def.Name), e.toolOptions(def)...)
+		if err != nil {
+			e.logf("WARN", "import tool %s: %v", name, err)
+			if _, ok := e.imported[name]; ok {
+				remove = append(remove, name)
+				delete(e.imported, name)
+			}
+			continue
+		}
+		if _, ok := e.imported[name]; ok {
+			replace = append(replace, te)
+		} else {
+			add = append(add, te)
+		}
+		e.imported[name] = string(raw)
+	}
+	for name := range e.imported {
+		if !seen[name] {
+			remove = append(remove, name)
+			delete(e.imported, name)
+		}
+	}
+	for _, name := range e.local.replaceTools(add, replace, remove) {
+		e.logf("WARN", "import tool %s: tool already registered", name)
+		delete(e.imported, name)
+	}
+	e.mu.Unlock()
+
+	if len(add) > 0 || len(replace) > 0 || len(remove) > 0 {
+		e.local.notifyToolsChanged()
+	}
+	return nil
+}
+
+// localDef 生成导入到本地注册表的工具说明书（带命名空间前缀）
+func (e *ExternalServer) localDef(name string, def *ToolDef) *ToolDef {
+	cp := *def
+	cp.Name = name
+	if cp.Description != "" {
+		cp.Description = fmt.Sprintf("[%s] %s", e.cfg.Name, cp.Description)
+	}
+	return &cp
+}
+
+func (e *ExternalServer) toolOptions(def *ToolDef) []ToolOption {
+	if e.cfg.SkipConfirm || (def.Annotations != nil && def.Annotations.ReadOnlyHint) {
+		return nil
+	}
+	return []ToolOption{WithConfirmation(nil)}
+}
+
+// proxy 返回把本地调用转发给外部服务的 handler
+func (e *ExternalServer) proxy(remoteName string) ToolHandler {
+	return func(ctx context.Context, args map[string]any) (ToolCallResult, error) {
+		c := e.currentClient()
+		if c == nil {
+			return ToolCallResult{}, fmt.Errorf("external mcp server %s is restarting", e.cfg.Name)
+		}
+		res, err := c.CallTool(ctx, remoteName, args)
+		if err != nil {
+			return ToolCallResult{}, err
+		}
+		if res.IsError {
+			if res.ErrorMessage == "" {
+				// 标准 MCP 服务只在 content 中描述错误
+				plain := res
+				plain.IsError = false
+				res.ErrorMessage = plain.Text()
+			}
+			return res, errors.New(res.ErrorMessage)
+		}
+		return res, nil
+	}
+}
+
+func (e *ExternalServer) drainStderr(r io.Reader) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		e.logf("DEBUG", "[%s] %s", e.cfg.Name, sc.Text())
+	}
+}
+
+func (e *ExternalServer) logf(level, format string, args ...any) {
+	if e.log == nil {
+		return
+	}
+	switch level {
+	case "ERROR":
+		e.log.Error(format, args...)
+	case "WARN":
+		e.log.Warn(format, args...)
+	case "DEBUG":
+		e.log.Debug(format, args...)
+	default:
+		e.log.Info(format, args...)
+	}
+}
@@ -0,0 +1,172 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeServerEnv 置为 1 时，测试二进制本身作为一个极简的外部 MCP 服务运行
+const fakeServerEnv = "MCP_FAKE_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeServerEnv) == "1" {
+		runFakeServer()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runFakeServer 提供 echo（回显）和 crash（直接退出进程）两个工具
+func runFakeServer() {
+	s := NewMCPServer()
+	_ = s.RegisterTool(&ToolDef{
+		Name:        "echo",
+		Description: "echo text back",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"text":{"type":"string"}},"required":["text"]}`),
+		Annotations: &ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, args map[string]any) (ToolCallResult, error) {
+		return ToolCallResult{Content: []ContentPart{{Type: "text", Text: args["text"].(string)}}}, nil
+	})
+	_ = s.RegisterTool(&ToolDef{Name: "crash"}, func(ctx context.Context, args map[string]any) (ToolCallResult, error) {
+		os.Exit(3)
+		return ToolCallResult{}, nil
+	})
+	_ = s.RegisterTool(&ToolDef{Name: "fail"}, func(ctx context.Context, args map[string]any) (ToolCallResult, error) {
+		return ToolCallResult{}, errors.New("boom")
+	})
+	_ = s.ServeStdio(context.Background(), os.Stdin, os.Stdout)
+}
+
+func startFakeServer(t *testing.T, skipConfirm bool) (*MCPServer, *ExternalServer) {
+	t.Helper()
+	local := NewMCPServer()
+	ext := NewExternalServer(ExternalServerConfig{
+		Name:        "fake",
+		Command:     os.Args[0],
+		Env:         map[string]string{fakeServerEnv: "1"},
+		SkipConfirm: skipConfirm,
+	}, local)
+	ext.minBackoff = 10 * time.Millisecond
+	if err := ext.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(ext.Close)
+	return local, ext
+}
+
+func TestExternalServerImportsTools(t *testing.T) {
+	local, _ := startFakeServer(t, false)
+
+	var names []string
+	for _, def := range local.ListRegisteredTools() {
+		names = append(names, def.Name)
+	}
+	want := []string{"fake__crash", "fake__echo", "fake__fail"}
+	if len(names) != len(want) {
+		t.Fatalf("tools = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("tools = %v, want %v", names, want)
+		}
+	}
+
+	if _, need := local.NeedsConfirmation("fake__echo", nil); need {
+		t.Error("read-only tool should not require confirmation")
+	}
+	if _, need := local.NeedsConfirmation("fake__fail", nil); !need {
+		t.Error("tool without readOnlyHint should require confirmation")
+	}
+}
+
+func TestExternalServerSkipConfirm(t *testing.T) {
+	local, _ := startFakeServer(t, true)
+	if _, need := local.NeedsConfirmation("fake__fail", nil); need {
+		t.Error("skip_confirm should disable confirmation for every tool")
+	}
+}
+
+func TestExternalServerProxiesCalls(t *testing.T) {
+	local, _ := startFakeServer(t, true)
+	ctx := context.Background()
+
+	res, err := local.CallTool(ctx, "fake__echo", map[string]any{"text": "hi"})
+	if err != nil || res.IsError || res.Text() != "hi" {
+		t.Fatalf("echo = %+v, %v", res, err)
+	}
+
+	// 入参在本地按导入的 schema 校验，不会转发给外部服务
+	res, err = local.CallTool(ctx, "fake__echo", map[string]any{})
+	if err != nil || !res.IsError {
+		t.Fatalf("expected local validation error, got %+v, %v", res, err)
+	}
+
+	res, err = local.CallTool(ctx, "fake__fail", nil)
+	if err != nil || !res.IsError || res.ErrorMessage != "boom" {
+		t.Fatalf("fail = %+v, %v", res, err)
+	}
+}
+
+func TestExternalServerRestartsAfterCrash(t *testing.T) {
+	local, _ := startFakeServer(t, true)
+	ctx := context.Background()
+
+	res, err := local.CallTool(ctx, "fake__crash", nil)
+	if err != nil || !res.IsError {
+		t.Fatalf("crash call should surface as tool error, got %+v, %v", res, err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		res, err = local.CallTool(ctx, "fake__echo", map[string]any{"text": "back"})
+		if err == nil && !res.IsError && res.Text() == "back" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not come back: %+v, %v", res, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestExternalServerResyncNotifiesOnce(t *testing.T) {
+	local, ext := startFakeServer(t, true)
+	sess, out := testSession(t, local)
+	initSession(t, sess, out)
+	ctx := context.Background()
+
+	// 定义未变化时不替换工具，也不通知
+	if err := ext.syncTools(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-out:
+		t.Fatalf("unexpected notification after an unchanged sync: %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 多个工具同时变化时只发一次 list_changed
+	ext.mu.Lock()
+	for name := range ext.imported {
+		ext.imported[name] = "stale"
+	}
+	ext.mu.Unlock()
+	if err := ext.syncTools(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if msg := recv(t, out); msg.Method != NotifyToolsListChanged {
+		t.Fatalf("got %+v, want %s", msg, NotifyToolsListChanged)
+	}
+	select {
+	case msg := <-out:
+		t.Fatalf("unexpected second notification: %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if n := len(local.ListRegisteredTools()); n != 3 {
+		t.Fatalf("got %d tools after resync, want 3", n)
+	}
+}
@@ -0,0 +1,79 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JSONRPCVersion 是 JSON-RPC 协议版本号
+const JSONRPCVersion = "2.0"
+
+// JSON-RPC 2.0 标准错误码
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// RPCMessage 是 JSON-RPC 2.0 的线上消息，请求、通知和响应共用同一结构：
+// - 请求：Method + ID；
+// - 通知：Method，无 ID；
+// - 响应：ID + Result 或 Error。
+type RPCMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// IsRequest 判断是否为需要响应的请求
+func (m *RPCMessage) IsRequest() bool { return m.Method != "" && len(m.ID) > 0 }
+
+// IsNotification 判断是否为通知（不需要响应）
+func (m *RPCMessage) IsNotification() bool { return m.Method != "" && len(m.ID) == 0 }
+
+// IsResponse 判断是否为响应
+func (m *RPCMessage) IsResponse() bool { return m.Method == "" && len(m.ID) > 0 }
+
+// RPCError 是 JSON-RPC 的协议级错误
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string { return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message) }
+
+// newRequest 构造一个请求或通知（id 为 nil 时为通知）
+func newRequest(id json.RawMessage, method string, params any) (RPCMessage, error) {
+	msg := RPCMessage{JSONRPC: JSONRPCVersion, ID: id, Method: method}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return msg, fmt.Errorf("marshal params: %w", err)
+		}
+		msg.Params = raw
+	}
+	return msg, nil
+}
+
+// newResult 构造一个成功响应
+func newResult(id json.RawMessage, result any) RPCMessage {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return newError(id, CodeInternalError, "marshal result: "+err.Error())
+	}
+	return RPCMessage{JSONRPC: JSONRPCVersion, ID: id, Result: raw}
+}
+
+// newError 构造一个错误响应；无法确定请求 ID 时按规范使用 null
+func newError(id json.RawMessage, code int, message string) RPCMessage {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return RPCMessage{JSONRPC: JSONRPCVersion, ID: id, Error: &RPCError{Code: code, Message: message}}
+}
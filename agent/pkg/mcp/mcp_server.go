@@ -2,48 +2,162 @@ package mcp
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
-
-	// 可选：使用 JSON Schema 校验库（需要时再取消注释其中一个）
-	// "github.com/santhosh-tekuri/jsonschema/v5"
-	// "github.com/xeipuuv/gojsonschema"
 )
 
 // MCPServer 维护一个工具注册表，对外提供“列出工具/调用工具”的能力。
+// 进程内可直接调用 Go 方法，也可以通过 Session 以 JSON-RPC 2.0（stdio / WebSocket）对外提供 MCP 服务。
 type MCPServer struct {
 	mu    sync.RWMutex
 	tools map[string]*toolEntry
+
+	info         Implementation
+	instructions string
+	sessions     map[*Session]struct{}
 }
 
 // NewMCPServer 创建一个空的工具注册表。
 func NewMCPServer() *MCPServer {
-	return &MCPServer{tools: make(map[string]*toolEntry)}
+	return &MCPServer{
+		tools:    make(map[string]*toolEntry),
+		info:     Implementation{Name: "obsidian-agent", Version: "dev"},
+		sessions: make(map[*Session]struct{}),
+	}
 }
 
-// RegisterTool 注册一个工具（说明书 + 执行函数）。
-// 你可以选择：
-//   1) 立即编译 schema（把编译逻辑放在这里）；
-//   2) 懒编译（首次调用再编译，下方 CallTool 中会触发 compileSchemasOnce）。
-func (s *MCPServer) RegisterTool(def *ToolDef, handler ToolHandler) error {
-	if def == nil || handler == nil {
-		return errors.New("tool definition and handler must not be nil")
+// SetServerInfo 设置 initialize 时返回给客户端的实现信息和使用说明
+func (s *MCPServer) SetServerInfo(info Implementation, instructions string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.info = info
+	s.instructions = instructions
+}
+
+func (s *MCPServer) serverInfo() (Implementation, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.info, s.instructions
+}
+
+// notifyToolsChanged 通知所有已完成握手的会话：工具列表发生了变化
+func (s *MCPServer) notifyToolsChanged() {
+	s.mu.RLock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for ss := range s.sessions {
+		sessions = append(sessions, ss)
 	}
-	if def.Name == "" {
-		return errors.New("tool name must not be empty")
+	s.mu.RUnlock()
+
+	for _, ss := range sessions {
+		ss.mu.Lock()
+		ready := ss.initialized
+		ss.mu.Unlock()
+		if ready {
+			_ = ss.Notify(NotifyToolsListChanged, nil)
+		}
+	}
+}
+
+// RegisterTool 注册一个工具（说明书 + 执行函数）。
+// 入/出参 schema 在注册时立即编译，schema 非法或引用了外部资源时直接返回错误。
+func (s *MCPServer) RegisterTool(def *ToolDef, handler ToolHandler, opts ...ToolOption) error {
+	te, err := newToolEntry(def, handler, opts...)
+	if err != nil {
+		return err
 	}
 
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	if _, exists := s.tools[def.Name]; exists {
+		s.mu.Unlock()
 		return fmt.Errorf("tool %q already registered", def.Name)
 	}
-	s.tools[def.Name] = &toolEntry{
+	s.tools[def.Name] = te
+	s.mu.Unlock()
+
+	s.notifyToolsChanged()
+	return nil
+}
+
+// newToolEntry 应用选项并编译入/出参 schema
+func newToolEntry(def *ToolDef, handler ToolHandler, opts ...ToolOption) (*toolEntry, error) {
+	if def == nil || handler == nil {
+		return nil, errors.New("tool definition and handler must not be nil")
+	}
+	if def.Name == "" {
+		return nil, errors.New("tool name must not be empty")
+	}
+
+	te := &toolEntry{
 		def:     def,
 		handler: handler,
 	}
-	return nil
+	for _, opt := range opts {
+		opt(te)
+	}
+	if err := te.compileSchemas(); err != nil {
+		return nil, fmt.Errorf("tool %q: %w", def.Name, err)
+	}
+	return te, nil
+}
+
+// replaceTools 在一次加锁内新增 add、原地替换 replace 中的工具并注销 remove 中的工具，返回因重名未能新增的工具名。
+// 调用方在批量变更完成后自行调用 notifyToolsChanged，替换期间并发调用不会看到工具缺失
+func (s *MCPServer) replaceTools(add, replace []*toolEntry, remove []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var dup []string
+	for _, te := range add {
+		if _, exists := s.tools[te.def.Name]; exists {
+			dup = append(dup, te.def.Name)
+			continue
+		}
+		s.tools[te.def.Name] = te
+	}
+	for _, te := range replace {
+		s.tools[te.def.Name] = te
+	}
+	for _, name := range remove {
+		delete(s.tools, name)
+	}
+	return dup
+}
+
+// UnregisterTool 注销一个工具，返回该工具此前是否存在
+func (s *MCPServer) UnregisterTool(name string) bool {
+	s.mu.Lock()
+	_, ok := s.tools[name]
+	delete(s.tools, name)
+	s.mu.Unlock()
+	if ok {
+		s.notifyToolsChanged()
+	}
+	return ok
+}
+
+// NeedsConfirmation 判断调用该工具前是否需要用户确认；需要时同时返回待执行操作的描述
+func (s *MCPServer) NeedsConfirmation(name string, args map[string]any) (string, bool) {
+	s.mu.RLock()
+	te, ok := s.tools[name]
+	s.mu.RUnlock()
+	if !ok || !te.requireConfirm {
+		return "", false
+	}
+	if te.describe != nil {
+		if description := te.describe(args); description != "" {
+			return description, true
+		}
+		return "", false
+	}
+	title := te.def.Title
+	if title == "" {
+		title = te.def.Name
+	}
+	raw, _ := json.Marshal(args)
+	return fmt.Sprintf("%s %s", title, raw), true
 }
 
 // ListRegisteredTools 返回对外的工具说明书列表（用于 tools/list），不暴露内部 handler/编译器等实现细节。
@@ -54,9 +168,24 @@ func (s *MCPServer) ListRegisteredTools() []*ToolDef {
 	for _, te := range s.tools {
 		out = append(out, te.def)
 	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
 	return out
 }
 
+// ValidateArguments 只校验参数而不执行工具，用于提前检查（如多步计划中的工具调用）；工具不存在时同样返回错误
+func (s *MCPServer) ValidateArguments(name string, args map[string]any) error {
+	s.mu.RLock()
+	te, ok := s.tools[name]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown tool: %s", name)
+	}
+	if args == nil {
+		args = map[string]any{}
+	}
+	return te.validateInput(args)
+}
+
 // CallTool 根据名称执行工具：可选参数校验 → 执行 → 可选返回校验。
 // - 若工具不存在：返回协议级错误（error）；
 // - 若业务执行失败：以 IsError=true 的成功响应返回（JSON-RPC 200）。
@@ -68,83 +197,48 @@ func (s *MCPServer) CallTool(ctx context.Context, name string, args map[string]a
 		return ToolCallResult{}, fmt.Errorf("unknown tool: %s", name)
 	}
 
-	// 懒编译 schema（需要时再编译；如果你选择“注册时编译”，可删除这段）
-	if err := te.compileSchemasOnce(); err != nil {
-		// 编译失败属于服务端配置问题，建议作为协议级错误抛出
-		return ToolCallResult{}, fmt.Errorf("schema compile failed: %w", err)
+	// 入参校验失败作为业务错误返回，以便模型收到按路径列出的错误信息后自我修正
+	if args == nil {
+		args = map[string]any{}
+	}
+	if err := te.validateInput(args); err != nil {
+		return errorResult("input validation failed: " + err.Error()), nil
 	}
-
-	// ---- 可选：对入参进行 JSON-Schema 校验 ----
-	/*
-		if te.inSchema != nil {
-			raw, _ := json.Marshal(args)
-			if err := te.inSchema.Validate(bytes.NewReader(raw)); err != nil {
-				// 入参校验失败：通常作为“业务错误”返回，以便客户端收到 200 + isError=true + 文本提示
-				return ToolCallResult{IsError: true, ErrorMessage: "input validation failed: " + err.Error()}, nil
-			}
-		}
-	*/
 
 	// 执行工具逻辑
 	res, err := te.handler(ctx, args)
 	if err != nil {
-		// 业务错误：按 MCP 惯例，以成功响应 + isError=true 形式返回
+		// 业务错误：按 MCP 惯例，以成功响应 + isError=true 形式返回；content 为空时补上错误文本
+		content := res.Content
+		if len(content) == 0 {
+			content = []ContentPart{{Type: "text", Text: err.Error()}}
+		}
 		return ToolCallResult{
 			IsError:          true,
 			ErrorMessage:     err.Error(),
-			Content:          res.Content,
+			Content:          content,
 			StructuredContent: res.StructuredContent,
 		}, nil
 	}
 
-	// ---- 可选：对结构化返回进行 JSON-Schema 校验 ----
-	/*
-		if te.outSchema != nil && res.StructuredContent != nil {
-			raw, _ := json.Marshal(res.StructuredContent)
-			if err := te.outSchema.Validate(bytes.NewReader(raw)); err != nil {
-				return ToolCallResult{IsError: true, ErrorMessage: "output validation failed: " + err.Error()}, nil
-			}
+	// 结构化返回与 outputSchema 不符属于工具实现问题，同样以业务错误返回
+	if te.outSchema != nil && res.StructuredContent != nil {
+		if err := validateValue(te.outSchema, res.StructuredContent); err != nil {
+			return errorResult("output validation failed: " + err.Error()), nil
 		}
-	*/
+	}
 
+	if res.Content == nil {
+		res.Content = []ContentPart{}
+	}
 	return res, nil
 }
 
-// compileSchemasOnce 在需要时编译一次 schema，并缓存结果。
-// 若你不需要 schema 校验，可直接让该函数空实现（返回 nil）。
-func (te *toolEntry) compileSchemasOnce() error {
-	te.compileOnce.Do(func() {
-		// 在这里执行一次性编译，并把结果放到 te.inSchema / te.outSchema。
-		// 例如使用 santhosh-tekuri/jsonschema：
-		/*
-			compiler := jsonschema.NewCompiler()
-			if len(te.def.InputSchema) > 0 {
-				if err := compiler.AddResource("input.json", bytes.NewReader(te.def.InputSchema)); err != nil {
-					te.compileErr = fmt.Errorf("add input schema: %w", err)
-					return
-				}
-			}
-			inSch, err := compiler.Compile("input.json")
-			if err != nil {
-				te.compileErr = fmt.Errorf("compile input schema: %w", err)
-				return
-			}
-			te.inSchema = inSch
-
-			if len(te.def.OutputSchema) > 0 {
-				if err := compiler.AddResource("output.json", bytes.NewReader(te.def.OutputSchema)); err != nil {
-					te.compileErr = fmt.Errorf("add output schema: %w", err)
-					return
-				}
-				outSch, err := compiler.Compile("output.json")
-				if err != nil {
-					te.compileErr = fmt.Errorf("compile output schema: %w", err)
-					return
-				}
-				te.outSchema = outSch
-			}
-		*/
-		// 如果你当前不想做校验，这里什么都不做即可（te.compileErr 默认为 nil）
-	})
-	return te.compileErr
-}
\ No newline at end of file
+// errorResult 构造一个业务错误结果，错误信息同时放进 content 以满足“content 必须存在”的约定
+func errorResult(msg string) ToolCallResult {
+	return ToolCallResult{
+		Content:      []ContentPart{{Type: "text", Text: msg}},
+		IsError:      true,
+		ErrorMessage: msg,
+	}
+}
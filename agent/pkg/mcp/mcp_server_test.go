@@ -0,0 +1,249 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const noteInputSchema = `{
+	"type": "object",
+	"properties": {
+		"path":  {"type": "string", "minLength": 1},
+		"limit": {"type": "integer", "minimum": 1},
+		"tags":  {"type": "array", "items": {"$ref": "#/$defs/tag"}}
+	},
+	"required": ["path"],
+	"additionalProperties": false,
+	"$defs": {"tag": {"type": "string", "pattern": "^[^#\\s]+$"}}
+}`
+
+const noteOutputSchema = `{
+	"type": "object",
+	"properties": {"count": {"type": "integer"}},
+	"required": ["count"]
+}`
+
+func TestRegisterToolCompilesSchemas(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		output  string
+		wantErr string
+	}{
+		{name: "no schema"},
+		{name: "valid schemas", input: noteInputSchema, output: noteOutputSchema},
+		{name: "malformed json", input: `{"type":`, wantErr: "compile input schema"},
+		{name: "invalid keyword value", input: `{"type": 42}`, wantErr: "compile input schema"},
+		{name: "remote ref is rejected", input: `{"$ref": "https://example.com/schema.json"}`, wantErr: "remote $ref is not allowed"},
+		{name: "invalid output schema", input: noteInputSchema, output: `{"required": "count"}`, wantErr: "compile output schema"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := &ToolDef{Name: "t", InputSchema: raw(tt.input), OutputSchema: raw(tt.output)}
+			err := NewMCPServer().RegisterTool(def, nopHandler(nil))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCallToolValidatesInput(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      map[string]any
+		wantError bool
+		wantMsg   []string
+	}{
+		{name: "valid", args: map[string]any{"path": "a.md", "limit": 3, "tags": []any{"go"}}},
+		{name: "missing required", args: map[string]any{"limit": 3}, wantError: true, wantMsg: []string{"/: missing properties: 'path'"}},
+		{name: "nil args", args: nil, wantError: true, wantMsg: []string{"missing properties: 'path'"}},
+		{name: "wrong type", args: map[string]any{"path": "a.md", "limit": "3"}, wantError: true, wantMsg: []string{"/limit: expected integer, but got string"}},
+		{name: "below minimum", args: map[string]any{"path": "a.md", "limit": 0}, wantError: true, wantMsg: []string{"/limit:"}},
+		{name: "nested ref", args: map[string]any{"path": "a.md", "tags": []any{"ok", "#bad"}}, wantError: true, wantMsg: []string{"/tags/1:"}},
+		{name: "unknown property", args: map[string]any{"path": "a.md", "extra": true}, wantError: true, wantMsg: []string{"additionalProperties 'extra' not allowed"}},
+		{name: "several errors", args: map[string]any{"path": "", "limit": 1.5}, wantError: true, wantMsg: []string{"/limit:", "/path:"}},
+	}
+
+	s := NewMCPServer()
+	called := 0
+	handler := func(ctx context.Context, args map[string]any) (ToolCallResult, error) {
+		called++
+		return ToolCallResult{Content: []ContentPart{{Type: "text", Text: "ok"}}}, nil
+	}
+	if err := s.RegisterTool(&ToolDef{Name: "read_note", InputSchema: raw(noteInputSchema)}, handler); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := called
+			res, err := s.CallTool(context.Background(), "read_note", tt.args)
+			if err != nil {
+				t.Fatalf("unexpected protocol error: %v", err)
+			}
+			if res.IsError != tt.wantError {
+				t.Fatalf("IsError = %v, want %v (%s)", res.IsError, tt.wantError, res.ErrorMessage)
+			}
+			if ran := called > before; ran == tt.wantError {
+				t.Fatalf("handler ran = %v, want %v", ran, !tt.wantError)
+			}
+			for _, m := range tt.wantMsg {
+				if !strings.Contains(res.ErrorMessage, m) {
+					t.Errorf("ErrorMessage = %q, want containing %q", res.ErrorMessage, m)
+				}
+			}
+			if tt.wantError && len(res.Content) == 0 {
+				t.Errorf("error result must carry content")
+			}
+		})
+	}
+}
+
+func TestCallToolValidatesOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    any
+		wantError bool
+	}{
+		{name: "matching struct", output: struct {
+			Count int `json:"count"`
+		}{Count: 2}},
+		{name: "matching map", output: map[string]any{"count": 2}},
+		{name: "no structured content", output: nil},
+		{name: "missing field", output: map[string]any{"total": 2}, wantError: true},
+		{name: "wrong type", output: map[string]any{"count": "2"}, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMCPServer()
+			def := &ToolDef{Name: "count", OutputSchema: raw(noteOutputSchema)}
+			if err := s.RegisterTool(def, nopHandler(tt.output)); err != nil {
+				t.Fatal(err)
+			}
+			res, err := s.CallTool(context.Background(), "count", map[string]any{})
+			if err != nil {
+				t.Fatalf("unexpected protocol error: %v", err)
+			}
+			if res.IsError != tt.wantError {
+				t.Fatalf("IsError = %v, want %v (%s)", res.IsError, tt.wantError, res.ErrorMessage)
+			}
+			if tt.wantError && !strings.HasPrefix(res.ErrorMessage, "output validation failed: ") {
+				t.Errorf("ErrorMessage = %q", res.ErrorMessage)
+			}
+		})
+	}
+}
+
+func TestValidateArguments(t *testing.T) {
+	s := NewMCPServer()
+	called := false
+	handler := func(ctx context.Context, args map[string]any) (ToolCallResult, error) {
+		called = true
+		return ToolCallResult{}, nil
+	}
+	if err := s.RegisterTool(&ToolDef{Name: "read_note", InputSchema: raw(noteInputSchema)}, handler); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterTool(&ToolDef{Name: "free"}, handler); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tool    string
+		args    map[string]any
+		wantErr string
+	}{
+		{name: "valid", tool: "read_note", args: map[string]any{"path": "a.md"}},
+		{name: "invalid", tool: "read_note", args: map[string]any{"limit": 0}, wantErr: "missing properties: 'path'"},
+		{name: "nil args", tool: "read_note", wantErr: "missing properties: 'path'"},
+		{name: "no schema", tool: "free", args: map[string]any{"anything": 1}},
+		{name: "unknown tool", tool: "missing", wantErr: "unknown tool: missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.ValidateArguments(tt.tool, tt.args)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+	if called {
+		t.Fatal("ValidateArguments must not run the handler")
+	}
+}
+
+func TestNeedsConfirmation(t *testing.T) {
+	s := NewMCPServer()
+	describe := func(args map[string]any) string {
+		if out, _ := args["output"].(string); out != "" {
+			return "write " + out
+		}
+		return ""
+	}
+	if err := s.RegisterTool(&ToolDef{Name: "summarize"}, nopHandler(nil), WithConfirmation(describe)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterTool(&ToolDef{Name: "delete", Title: "Delete"}, nopHandler(nil), WithConfirmation(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterTool(&ToolDef{Name: "read"}, nopHandler(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		tool     string
+		args     map[string]any
+		wantNeed bool
+		wantDesc string
+	}{
+		{name: "describer asks", tool: "summarize", args: map[string]any{"output": "a.md"}, wantNeed: true, wantDesc: "write a.md"},
+		{name: "describer declines", tool: "summarize", args: map[string]any{}},
+		{name: "default description", tool: "delete", args: map[string]any{"path": "a.md"}, wantNeed: true, wantDesc: `Delete {"path":"a.md"}`},
+		{name: "no confirmation", tool: "read"},
+		{name: "unknown tool", tool: "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc, need := s.NeedsConfirmation(tt.tool, tt.args)
+			if need != tt.wantNeed || desc != tt.wantDesc {
+				t.Fatalf("NeedsConfirmation = (%q, %v), want (%q, %v)", desc, need, tt.wantDesc, tt.wantNeed)
+			}
+		})
+	}
+}
+
+func TestCallToolUnknownTool(t *testing.T) {
+	if _, err := NewMCPServer().CallTool(context.Background(), "missing", nil); err == nil {
+		t.Fatal("expected protocol error for unknown tool")
+	}
+}
+
+func raw(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
+
+func nopHandler(structured any) ToolHandler {
+	return func(ctx context.Context, args map[string]any) (ToolCallResult, error) {
+		return ToolCallResult{Content: []ContentPart{{Type: "text", Text: "ok"}}, StructuredContent: structured}, nil
+	}
+}
@@ -0,0 +1,71 @@
+package mcp
+
+// MCP 协议版本：LatestProtocolVersion 为服务端首选版本，
+// supportedProtocolVersions 中的版本在握手时会原样回传给客户端。
+const LatestProtocolVersion = "2025-06-18"
+
+var supportedProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// MCP 方法名
+const (
+	MethodInitialize       = "initialize"
+	MethodPing             = "ping"
+	MethodToolsList        = "tools/list"
+	MethodToolsCall        = "tools/call"
+	NotifyInitialized      = "notifications/initialized"
+	NotifyCancelled        = "notifications/cancelled"
+	NotifyToolsListChanged = "notifications/tools/list_changed"
+)
+
+// Implementation 描述一端的实现名称和版本
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// InitializeParams 是 initialize 请求的参数
+type InitializeParams struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	Capabilities    map[string]any `json:"capabilities"`
+	ClientInfo      Implementation `json:"clientInfo"`
+}
+
+// ToolsCapability 声明工具相关能力
+type ToolsCapability struct {
+	ListChanged bool `json:"listChanged"`
+}
+
+// ServerCapabilities 是服务端在握手时声明的能力
+type ServerCapabilities struct {
+	Tools *ToolsCapability `json:"tools,omitempty"`
+}
+
+// InitializeResult 是 initialize 请求的返回
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      Implementation     `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
+}
+
+// ListToolsResult 是 tools/list 的返回
+type ListToolsResult struct {
+	Tools      []*ToolDef `json:"tools"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// CancelledParams 是 notifications/cancelled 的参数
+type CancelledParams struct {
+	RequestID any    `json:"requestId"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// negotiateVersion 客户端请求的版本受支持时原样返回，否则返回服务端首选版本
+func negotiateVersion(requested string) string {
+	for _, v := range supportedProtocolVersions {
+		if v == requested {
+			return v
+		}
+	}
+	return LatestProtocolVersion
+}
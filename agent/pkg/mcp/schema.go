@@ -0,0 +1,109 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// errRemoteRef 表示 schema 引用了外部资源；工具 schema 必须自包含，不允许联网拉取 $ref
+var errRemoteRef = errors.New("remote $ref is not allowed, tool schemas must be self-contained")
+
+// compileSchema 编译一份工具 schema；未声明 $schema 时按 draft 2020-12 处理。
+// 所有外部 $ref 都会被拒绝，保证注册时不会发生网络访问。
+func compileSchema(url string, raw json.RawMessage) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.LoadURL = func(s string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("%w: %s", errRemoteRef, s)
+	}
+	if err := compiler.AddResource(url, bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	return compiler.Compile(url)
+}
+
+// compileSchemas 在注册时编译工具的入参/出参 schema，并缓存到 toolEntry 中
+func (te *toolEntry) compileSchemas() error {
+	base := "mem://tools/" + te.def.Name
+	if len(te.def.InputSchema) > 0 {
+		sch, err := compileSchema(base+"/input.json", te.def.InputSchema)
+		if err != nil {
+			return fmt.Errorf("compile input schema: %w", err)
+		}
+		te.inSchema = sch
+	}
+	if len(te.def.OutputSchema) > 0 {
+		sch, err := compileSchema(base+"/output.json", te.def.OutputSchema)
+		if err != nil {
+			return fmt.Errorf("compile output schema: %w", err)
+		}
+		te.outSchema = sch
+	}
+	return nil
+}
+
+// validateInput 按入参 schema 校验参数，未声明 schema 时不做限制
+func (te *toolEntry) validateInput(args map[string]any) error {
+	if te.inSchema == nil {
+		return nil
+	}
+	return validateValue(te.inSchema, args)
+}
+
+// validateValue 用 schema 校验任意 Go 值：先经过一次 JSON 往返，
+// 保证结构体、整数等类型与 schema 看到的 JSON 数据一致。
+func validateValue(sch *jsonschema.Schema, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal value: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("decode value: %w", err)
+	}
+	if err := sch.Validate(doc); err != nil {
+		var ve *jsonschema.ValidationError
+		if errors.As(err, &ve) {
+			return errors.New(formatValidationError(ve))
+		}
+		return err
+	}
+	return nil
+}
+
+// formatValidationError 将校验错误展开为按路径排列的可读信息，
+// 例如 "/limit: expected integer, but got string"，便于模型据此修正参数。
+func formatValidationError(ve *jsonschema.ValidationError) string {
+	seen := make(map[string]bool)
+	var lines []string
+	var walk func(e *jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			loc := e.InstanceLocation
+			if loc == "" {
+				loc = "/"
+			}
+			line := loc + ": " + e.Message
+			if !seen[line] {
+				seen[line] = true
+				lines = append(lines, line)
+			}
+			return
+		}
+		for _, c := range e.Causes {
+			walk(c)
+		}
+	}
+	walk(ve)
+	sort.Strings(lines)
+	return strings.Join(lines, "; ")
+}
@@ -0,0 +1,274 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// ConfirmFunc 征求用户对一次工具调用的同意，desc 为工具给出的确认说明
+type ConfirmFunc func(ctx context.Context, name, desc string) (bool, error)
+
+// SessionOption 是创建会话时的可选配置
+type SessionOption func(ss *Session)
+
+// WithConfirm 让会话在执行需要确认的工具（见 WithConfirmation）前调用 confirm 征求同意；
+// confirm 为 nil 表示这条连接无法征求确认，这类调用一律拒绝。
+// 未设置时会话不做确认，由 MCP 客户端自行负责（如 stdio 模式下拉起本服务的编辑器）。
+func WithConfirm(confirm ConfirmFunc) SessionOption {
+	return func(ss *Session) {
+		ss.gated = true
+		ss.confirm = confirm
+	}
+}
+
+// Session 是一条 MCP 连接（stdio 或 WebSocket）上的协议会话：
+// 解析 JSON-RPC 消息、分发到 MCPServer，并通过 send 写回响应和通知。
+type Session struct {
+	server *MCPServer
+
+	writeMu sync.Mutex
+	send    func(data []byte) error
+
+	gated   bool // 是否对需要确认的工具做确认
+	confirm ConfirmFunc
+
+	mu          sync.Mutex
+	initialized bool
+	client      Implementation
+	inflight    map[string]context.CancelFunc // 请求 ID -> 取消函数，用于 notifications/cancelled
+	wg          sync.WaitGroup
+}
+
+// NewSession 创建一个协议会话；send 负责把一条完整的 JSON-RPC 消息写到连接上
+func (s *MCPServer) NewSession(send func(data []byte) error, opts ...SessionOption) *Session {
+	ss := &Session{server: s, send: send, inflight: make(map[string]context.CancelFunc)}
+	for _, opt := range opts {
+		opt(ss)
+	}
+	s.mu.Lock()
+	s.sessions[ss] = struct{}{}
+	s.mu.Unlock()
+	return ss
+}
+
+// Close 结束会话：取消仍在执行的工具调用并等待其退出
+func (ss *Session) Close() {
+	ss.server.mu.Lock()
+	delete(ss.server.sessions, ss)
+	ss.server.mu.Unlock()
+
+	ss.mu.Lock()
+	for _, cancel := range ss.inflight {
+		cancel()
+	}
+	ss.mu.Unlock()
+	ss.wg.Wait()
+}
+
+// ClientInfo 返回客户端在 initialize 时上报的实现信息
+func (ss *Session) ClientInfo() Implementation {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.client
+}
+
+// Notify 向客户端发送一条通知
+func (ss *Session) Notify(method string, params any) error {
+	msg, err := newRequest(nil, method, params)
+	if err != nil {
+		return err
+	}
+	return ss.write(msg)
+}
+
+func (ss *Session) write(msg RPCMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	ss.writeMu.Lock()
+	defer ss.writeMu.Unlock()
+	return ss.send(data)
+}
+
+// HandleMessage 处理一条来自客户端的 JSON-RPC 消息。
+// tools/call 在独立 goroutine 中执行，其余请求同步处理。
+func (ss *Session) HandleMessage(ctx context.Context, data []byte) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return
+	}
+	if data[0] == '[' {
+		_ = ss.write(newError(nil, CodeInvalidRequest, "batch requests are not supported"))
+		return
+	}
+
+	var msg RPCMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		_ = ss.write(newError(nil, CodeParseError, "parse error: "+err.Error()))
+		return
+	}
+	if msg.JSONRPC != JSONRPCVersion {
+		if len(msg.ID) > 0 {
+			_ = ss.write(newError(msg.ID, CodeInvalidRequest, `jsonrpc must be "2.0"`))
+		}
+		return
+	}
+
+	switch {
+	case msg.IsRequest():
+		ss.handleRequest(ctx, msg)
+	case msg.IsNotification():
+		ss.handleNotification(msg)
+	default:
+		// 服务端不会主动发起请求，收到的响应直接忽略
+	}
+}
+
+func (ss *Session) handleRequest(ctx context.Context, msg RPCMessage) {
+	switch msg.Method {
+	case MethodInitialize:
+		_ = ss.write(ss.initialize(msg))
+	case MethodPing:
+		_ = ss.write(newResult(msg.ID, struct{}{}))
+	case MethodToolsList:
+		_ = ss.write(newResult(msg.ID, ListToolsResult{Tools: listableTools(ss.server.ListRegisteredTools())}))
+	case MethodToolsCall:
+		ss.startToolCall(ctx, msg)
+	default:
+		_ = ss.write(newError(msg.ID, CodeMethodNotFound, "method not found: "+msg.Method))
+	}
+}
+
+func (ss *Session) handleNotification(msg RPCMessage) {
+	switch msg.Method {
+	case NotifyInitialized:
+		ss.mu.Lock()
+		ss.initialized = true
+		ss.mu.Unlock()
+	case NotifyCancelled:
+		var p CancelledParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return
+		}
+		raw, err := json.Marshal(p.RequestID)
+		if err != nil {
+			return
+		}
+		ss.mu.Lock()
+		if cancel, ok := ss.inflight[idKey(raw)]; ok {
+			cancel()
+		}
+		ss.mu.Unlock()
+	}
+}
+
+func (ss *Session) initialize(msg RPCMessage) RPCMessage {
+	var p InitializeParams
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return newError(msg.ID, CodeInvalidParams, "invalid initialize params: "+err.Error())
+		}
+	}
+	ss.mu.Lock()
+	ss.client = p.ClientInfo
+	ss.mu.Unlock()
+
+	info, instructions := ss.server.serverInfo()
+	return newResult(msg.ID, InitializeResult{
+		ProtocolVersion: negotiateVersion(p.ProtocolVersion),
+		Capabilities:    ServerCapabilities{Tools: &ToolsCapability{ListChanged: true}},
+		ServerInfo:      info,
+		Instructions:    instructions,
+	})
+}
+
+// startToolCall 异步执行 tools/call；请求被 notifications/cancelled 取消后按规范不再响应。
+// 客户端完成初始化（发出 notifications/initialized）之前的调用直接拒绝。
+func (ss *Session) startToolCall(ctx context.Context, msg RPCMessage) {
+	ss.mu.Lock()
+	initialized := ss.initialized
+	ss.mu.Unlock()
+	if !initialized {
+		_ = ss.write(newError(msg.ID, CodeInvalidRequest, "session is not initialized"))
+		return
+	}
+
+	var p ToolCallRequest
+	if err := json.Unmarshal(msg.Params, &p); err != nil || p.Name == "" {
+		_ = ss.write(newError(msg.ID, CodeInvalidParams, "tools/call requires a tool name"))
+		return
+	}
+
+	key := idKey(msg.ID)
+	callCtx, cancel := context.WithCancel(ctx)
+	ss.mu.Lock()
+	ss.inflight[key] = cancel
+	ss.mu.Unlock()
+
+	ss.wg.Add(1)
+	go func() {
+		defer ss.wg.Done()
+		defer func() {
+			ss.mu.Lock()
+			delete(ss.inflight, key)
+			ss.mu.Unlock()
+			cancel()
+		}()
+
+		res, err := ss.callTool(callCtx, p)
+		if callCtx.Err() != nil {
+			return
+		}
+		if err != nil {
+			_ = ss.write(newError(msg.ID, CodeInvalidParams, err.Error()))
+			return
+		}
+		_ = ss.write(newResult(msg.ID, res))
+	}()
+}
+
+// callTool 执行一次工具调用；会话启用了确认时，需要确认的工具先征求同意，未获同意以业务错误返回
+func (ss *Session) callTool(ctx context.Context, p ToolCallRequest) (ToolCallResult, error) {
+	if ss.gated {
+		if desc, ok := ss.server.NeedsConfirmation(p.Name, p.Arguments); ok {
+			if ss.confirm == nil {
+				return errorResult(fmt.Sprintf("tool %s needs user confirmation (%s), which this connection cannot provide", p.Name, desc)), nil
+			}
+			approved, err := ss.confirm(ctx, p.Name, desc)
+			if err != nil {
+				return errorResult("confirmation failed: " + err.Error()), nil
+			}
+			if !approved {
+				return errorResult("the user rejected the call to " + p.Name), nil
+			}
+		}
+	}
+	return ss.server.CallTool(ctx, p.Name, p.Arguments)
+}
+
+// listableTools 为没有声明入参的工具补上空 object schema，MCP 要求 inputSchema 必须存在
+func listableTools(defs []*ToolDef) []*ToolDef {
+	out := make([]*ToolDef, 0, len(defs))
+	for _, d := range defs {
+		if len(d.InputSchema) == 0 {
+			cp := *d
+			cp.InputSchema = json.RawMessage(`{"type":"object","properties":{}}`)
+			d = &cp
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// idKey 将请求 ID 规范化为 map key（去掉多余空白，使 1 与 "1" 可区分）
+func idKey(id json.RawMessage) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, id); err != nil {
+		return string(id)
+	}
+	return b.String()
+}
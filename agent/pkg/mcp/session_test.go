@@ -0,0 +1,122 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSession 创建一个会话，写出的消息经由返回的 channel 读取
+func testSession(t *testing.T, s *MCPServer, opts ...SessionOption) (*Session, <-chan RPCMessage) {
+	t.Helper()
+	out := make(chan RPCMessage, 8)
+	sess := s.NewSession(func(data []byte) error {
+		var msg RPCMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Errorf("session wrote invalid JSON: %v", err)
+		}
+		out <- msg
+		return nil
+	}, opts...)
+	t.Cleanup(sess.Close)
+	return sess, out
+}
+
+func initSession(t *testing.T, sess *Session, out <-chan RPCMessage) {
+	t.Helper()
+	sess.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`))
+	recv(t, out)
+	sess.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+}
+
+func recv(t *testing.T, out <-chan RPCMessage) RPCMessage {
+	t.Helper()
+	select {
+	case msg := <-out:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a response")
+		return RPCMessage{}
+	}
+}
+
+func callResult(t *testing.T, msg RPCMessage) ToolCallResult {
+	t.Helper()
+	if msg.Error != nil {
+		t.Fatalf("unexpected error: %+v", msg.Error)
+	}
+	var res ToolCallResult
+	if err := json.Unmarshal(msg.Result, &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestSessionRejectsToolCallBeforeInitialized(t *testing.T) {
+	s := NewMCPServer()
+	if err := s.RegisterTool(&ToolDef{Name: "read"}, nopHandler(nil)); err != nil {
+		t.Fatal(err)
+	}
+	sess, out := testSession(t, s)
+
+	sess.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read"}}`))
+	if msg := recv(t, out); msg.Error == nil || msg.Error.Code != CodeInvalidRequest {
+		t.Fatalf("expected invalid request before initialize, got %+v", msg)
+	}
+
+	initSession(t, sess, out)
+	sess.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"read"}}`))
+	if res := callResult(t, recv(t, out)); res.IsError {
+		t.Fatalf("call after initialize failed: %+v", res)
+	}
+}
+
+func TestSessionConfirmation(t *testing.T) {
+	newServer := func(called *bool) *MCPServer {
+		s := NewMCPServer()
+		handler := func(ctx context.Context, args map[string]any) (ToolCallResult, error) {
+			*called = true
+			return ToolCallResult{Content: []ContentPart{{Type: "text", Text: "ok"}}}, nil
+		}
+		if err := s.RegisterTool(&ToolDef{Name: "write"}, handler, WithConfirmation(func(map[string]any) string { return "write a.md" })); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name       string
+		opts       []SessionOption
+		wantCalled bool
+		wantErr    string
+	}{
+		{name: "no gate", wantCalled: true},
+		{name: "cannot confirm", opts: []SessionOption{WithConfirm(nil)}, wantErr: "needs user confirmation"},
+		{name: "approved", opts: []SessionOption{WithConfirm(func(ctx context.Context, name, desc string) (bool, error) {
+			return name == "write" && desc == "write a.md", nil
+		})}, wantCalled: true},
+		{name: "rejected", opts: []SessionOption{WithConfirm(func(ctx context.Context, name, desc string) (bool, error) {
+			return false, nil
+		})}, wantErr: "rejected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			sess, out := testSession(t, newServer(&called), tt.opts...)
+			initSession(t, sess, out)
+			sess.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"write"}}`))
+			res := callResult(t, recv(t, out))
+			if called != tt.wantCalled {
+				t.Fatalf("handler called = %v, want %v", called, tt.wantCalled)
+			}
+			if tt.wantErr == "" && res.IsError {
+				t.Fatalf("unexpected error result: %s", res.ErrorMessage)
+			}
+			if tt.wantErr != "" && (!res.IsError || !strings.Contains(res.ErrorMessage, tt.wantErr)) {
+				t.Fatalf("error = %q, want it to contain %q", res.ErrorMessage, tt.wantErr)
+			}
+		})
+	}
+}
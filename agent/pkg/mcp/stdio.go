@@ -0,0 +1,37 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+)
+
+// ServeStdio 在 in/out 上以换行分隔的 JSON-RPC 消息提供 MCP 服务（MCP stdio 传输），
+// 直到输入结束或 ctx 被取消。注意：out 上不能再写入任何日志等非协议内容。
+func (s *MCPServer) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	sess := s.NewSession(func(data []byte) error {
+		_, err := out.Write(append(data, '\n'))
+		return err
+	})
+	defer sess.Close()
+
+	r := bufio.NewReader(in)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			sess.HandleMessage(ctx, line)
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// 输入结束：等已开始的工具调用写完响应再退出
+				sess.wg.Wait()
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+
+	"github.com/obsidian-agent/pkg/llm/embedding"
+	"github.com/obsidian-agent/pkg/llm/models"
+	"github.com/obsidian-agent/pkg/mcp"
 )
 
 const (
@@ -12,12 +16,29 @@ const (
 	// DefaultApikey is the default API key for the agent.
 	DefaultApikey = "sk-1234567890abcdef1234567890abcdef"
 	DefaultLocalServerAddr = "127.0.0.1:8787"
+	// DefaultDataDir 存放索引快照等持久化数据
+	DefaultDataDir = "/Users/jianghaojun/Projects/obsidian-agent/agent/data"
 )
 
 type Config struct {
 	LogDir string `json:"log_dir"`
 	Apikey string `json:"apikey"`
 	ServerAddr string `json:"server_addr"`
+
+	AuthToken      string   `json:"auth_token"`      // /mcp 连接须以 ?token= 携带的密钥，为空时启动时生成并写入 data_dir/mcp_token
+	AllowedOrigins []string `json:"allowed_origins"` // 除同源页面外允许连接的浏览器来源，如 app://obsidian.md
+
+	Model  string         `json:"model"`  // 默认使用的模型名，需在模型注册表中存在
+	Models []models.Model `json:"models"` // 额外注册或覆盖内置描述的模型
+
+	MCPServers []mcp.ExternalServerConfig `json:"mcp_servers"` // 以子进程方式接入的外部 MCP 服务
+
+	VaultRoot string `json:"vault_root"` // Obsidian 仓库根目录，为空时不注册内置笔记工具
+	DataDir   string `json:"data_dir"`   // 索引快照等数据的存放目录
+
+	Embedding embedding.Config `json:"embedding"` // 向量检索使用的嵌入模型，默认本地哈希
+
+	SessionMaxTokens int `json:"session_max_tokens"` // 会话记忆原样保留的 token 上限，超过后较早的轮次折叠为摘要；0 使用默认值
 }
 
 var currentConfig *Config
@@ -33,6 +54,7 @@ func LoadDefaultConfig(){
 		LogDir: DefaultLogDir,
 		Apikey: DefaultApikey,
 		ServerAddr: DefaultLocalServerAddr,
+		DataDir: DefaultDataDir,
 	}
 }
 
@@ -64,6 +86,9 @@ func LoadConfig(filePath string) error {
 	if config.ServerAddr == "" {
 		config.ServerAddr = DefaultLocalServerAddr
 	}
+	if config.DataDir == "" {
+		config.DataDir = DefaultDataDir
+	}
 	currentConfig = &config
 	return nil
 }
\ No newline at end of file